@@ -1,17 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/gethomeport/homeport/internal/forward"
 )
 
 var apiURL = "http://localhost:8080/api"
@@ -39,6 +49,19 @@ func main() {
 	shareCmd.Flags().Bool("public", false, "Make port publicly accessible")
 	shareCmd.Flags().Bool("password", false, "Require password for access")
 	shareCmd.Flags().StringP("pass", "p", "", "Password (prompts if not provided)")
+	shareCmd.Flags().StringSlice("email", nil, "Require a magic link sent to one of these addresses or domains")
+	shareCmd.Flags().String("expires", "", "Stop sharing after a duration (1h, 24h, 7d, 30d)")
+	shareCmd.Flags().String("from", "", "Start sharing at this time (RFC 3339, e.g. 2024-05-01T09:00:00+02:00)")
+	shareCmd.Flags().String("until", "", "Stop sharing at this time (RFC 3339)")
+	shareCmd.Flags().String("days", "", "Only share on these days, e.g. mon-fri or sat,sun")
+	shareCmd.Flags().String("hours", "", "Only share during this daily window, e.g. 09:00-18:00")
+	shareCmd.Flags().String("tz", "", "Timezone for --days/--hours (default UTC), e.g. Europe/Berlin")
+	shareCmd.Flags().Int("rate", 0, "Max requests per second per visitor IP (0 = unlimited)")
+	shareCmd.Flags().String("quota", "", "Pause the share after this much transfer, e.g. 500MB or 2GB")
+	shareCmd.Flags().StringSlice("allow", nil, "Only allow these IPs/CIDRs (e.g. 203.0.113.0/24)")
+	shareCmd.Flags().StringSlice("deny", nil, "Block these IPs/CIDRs")
+	shareCmd.Flags().Bool("banner", false, "Show visitors a preview banner with repo, branch and expiry")
+	shareCmd.Flags().Bool("feedback", false, "Add a \"leave feedback\" box to the preview banner (implies --banner)")
 
 	// unshare command
 	unshareCmd := &cobra.Command{
@@ -48,6 +71,39 @@ func main() {
 		Run:   runUnshare,
 	}
 
+	// protocol command
+	protocolCmd := &cobra.Command{
+		Use:   "protocol <port> <auto|http|h2c|grpc>",
+		Short: "Set how the proxy talks to a port",
+		Long: `Ports are probed for HTTP/1.1, h2c (HTTP/2 without TLS) and gRPC when
+they start listening. Override the result if detection gets it wrong, or
+set "auto" to go back to the detected protocol.`,
+		Args: cobra.ExactArgs(2),
+		Run:  runProtocol,
+	}
+
+	// label command
+	labelCmd := &cobra.Command{
+		Use:   "label <port> [name]",
+		Short: "Name a port (omit the name to clear it)",
+		Args:  cobra.RangeArgs(1, 2),
+		Run:   runLabel,
+	}
+
+	// pin/unpin commands
+	pinCmd := &cobra.Command{
+		Use:   "pin <port>",
+		Short: "Keep a port and its share settings listed while it's offline",
+		Args:  cobra.ExactArgs(1),
+		Run:   runPin,
+	}
+	unpinCmd := &cobra.Command{
+		Use:   "unpin <port>",
+		Short: "Let an offline port drop out of the list again",
+		Args:  cobra.ExactArgs(1),
+		Run:   runPin,
+	}
+
 	// url command
 	urlCmd := &cobra.Command{
 		Use:   "url <port>",
@@ -121,9 +177,176 @@ func main() {
 		Run:   runTerminal,
 	}
 
+	// history command
+	historyCmd := &cobra.Command{
+		Use:   "history [search]",
+		Short: "Search commands run in terminals",
+		Long: `List commands run in homeport terminals, newest first, with their exit
+code, duration and directory. Commands are recorded by bash and zsh shell
+integration.
+
+  homeport history migrate --since 7d   # that migration from last week
+  homeport history --repo my-app --failed
+  homeport history show 42              # output and a link to run it again`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  runHistory,
+	}
+	historyCmd.Flags().String("repo", "", "Only commands run in this repository")
+	historyCmd.Flags().Bool("failed", false, "Only commands that exited with an error")
+	historyCmd.Flags().String("since", "", "How far back to look, e.g. 24h or 7d")
+	historyCmd.Flags().IntP("lines", "n", 20, "Number of commands to show")
+	historyCmd.AddCommand(&cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a command's output and a link to run it again",
+		Args:  cobra.ExactArgs(1),
+		Run:   runHistoryShow,
+	})
+
+	// feedback command
+	feedbackCmd := &cobra.Command{
+		Use:   "feedback <port>",
+		Short: "List feedback visitors left through the preview banner",
+		Args:  cobra.ExactArgs(1),
+		Run:   runFeedback,
+	}
+	feedbackCmd.Flags().Bool("all", false, "Include resolved feedback")
+
+	feedbackResolveCmd := &cobra.Command{
+		Use:   "resolve <id>...",
+		Short: "Mark feedback as resolved",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   runFeedbackResolve,
+	}
+	feedbackResolveCmd.Flags().Bool("reopen", false, "Reopen instead of resolving")
+
+	feedbackExportCmd := &cobra.Command{
+		Use:   "export <port>",
+		Short: "Print open feedback as markdown, or file it as a GitHub issue",
+		Args:  cobra.ExactArgs(1),
+		Run:   runFeedbackExport,
+	}
+	feedbackExportCmd.Flags().Bool("issue", false, "Create a GitHub issue on the port's repo")
+	feedbackExportCmd.Flags().String("title", "", "Issue title (with --issue)")
+	feedbackExportCmd.Flags().Bool("resolve", false, "Mark the exported feedback resolved (with --issue)")
+	feedbackCmd.AddCommand(feedbackResolveCmd, feedbackExportCmd)
+
+	// mock command
+	mockCmd := &cobra.Command{
+		Use:   "mock <port> <file>",
+		Short: "Serve a mock API on a port from a YAML/JSON routes file",
+		Args:  cobra.ExactArgs(2),
+		Run:   runMock,
+	}
+	mockCmd.AddCommand(
+		&cobra.Command{
+			Use:   "stop <port>",
+			Short: "Stop a mock server",
+			Args:  cobra.ExactArgs(1),
+			Run:   runMockStop,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List running mock servers",
+			Args:  cobra.NoArgs,
+			Run:   runMockList,
+		},
+	)
+
+	// serve command
+	serveCmd := &cobra.Command{
+		Use:   "serve <repo> <dir>",
+		Short: "Serve a repo directory (e.g. dist) on a shareable port",
+		Args:  cobra.ExactArgs(2),
+		Run:   runServe,
+	}
+	serveCmd.Flags().Int("port", 0, "Port to serve on (default: a free port in the range)")
+	serveCmd.Flags().Bool("spa", false, "Serve index.html for unknown paths (single-page apps)")
+	serveCmd.Flags().Bool("no-listing", false, "Don't list directories without an index.html")
+	serveCmd.AddCommand(
+		&cobra.Command{
+			Use:   "stop <port>",
+			Short: "Stop serving a directory",
+			Args:  cobra.ExactArgs(1),
+			Run:   runServeStop,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List served directories",
+			Args:  cobra.NoArgs,
+			Run:   runServeList,
+		},
+	)
+
+	// forward command
+	forwardCmd := &cobra.Command{
+		Use:   "forward [local:]<port>",
+		Short: "Forward a TCP or UDP port from the server to this machine",
+		Long: `Open a local listener and tunnel it to a port on the homeport server over
+an authenticated WebSocket, for services that don't speak HTTP (Postgres,
+Redis, ...). Run it on your laptop:
+
+  homeport forward 5432 --server https://dev.example.com
+  homeport forward 15432:5432         # listen on 15432 locally
+  homeport forward 5353 --udp
+
+The password is read from HOMEPORT_PASSWORD or prompted for. Behind
+Cloudflare Access, set CF_ACCESS_CLIENT_ID and CF_ACCESS_CLIENT_SECRET
+to a service token.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runForward,
+	}
+	forwardCmd.Flags().String("server", os.Getenv("HOMEPORT_SERVER"), "Homeport URL (default: local daemon, or $HOMEPORT_SERVER)")
+	forwardCmd.Flags().Bool("udp", false, "Forward UDP instead of TCP")
+
+	// exec and jobs commands
+	execCmd := &cobra.Command{
+		Use:   "exec <repo> -- <command>...",
+		Short: "Run a command in a repository on the server and stream its output",
+		Long: `Run a command with sh in a repository on the homeport server, streaming
+its stdout and stderr here as it runs. homeport exits with the command's
+exit code, and Ctrl+C cancels it on the server.
+
+  homeport exec my-app -- npm test
+  homeport exec --server https://dev.example.com my-app -- go test ./...
+  homeport exec my-app 'npm run build && npm run lint'
+  homeport exec my-app -d -- npm run e2e   # print the job ID and return
+
+The server needs remote_exec: true in homeport.yaml. Logging in works as
+for homeport forward.`,
+		Args: cobra.MinimumNArgs(2),
+		Run:  runExec,
+	}
+	execCmd.Flags().String("server", os.Getenv("HOMEPORT_SERVER"), "Homeport URL (default: local daemon, or $HOMEPORT_SERVER)")
+	execCmd.Flags().BoolP("detach", "d", false, "Print the job ID instead of waiting for the command")
+
+	jobsCmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "List commands run with homeport exec",
+		Args:  cobra.NoArgs,
+		Run:   runJobs,
+	}
+	jobsCmd.PersistentFlags().String("server", os.Getenv("HOMEPORT_SERVER"), "Homeport URL (default: local daemon, or $HOMEPORT_SERVER)")
+	jobsCmd.Flags().String("repo", "", "Only jobs run in this repository")
+	jobsCmd.Flags().IntP("lines", "n", 20, "Number of jobs to show")
+	jobsCmd.AddCommand(
+		&cobra.Command{
+			Use:   "attach <id>",
+			Short: "Stream a job's output from the start until it finishes",
+			Args:  cobra.ExactArgs(1),
+			Run:   runJobsAttach,
+		},
+		&cobra.Command{
+			Use:   "cancel <id>",
+			Short: "Stop a running job",
+			Args:  cobra.ExactArgs(1),
+			Run:   runJobsCancel,
+		},
+	)
+
 	rootCmd.AddCommand(
-		listCmd, shareCmd, unshareCmd, urlCmd, statusCmd, reposCmd,
-		cloneCmd, startCmd, stopCmd, logsCmd, openCmd, terminalCmd,
+		listCmd, shareCmd, unshareCmd, protocolCmd, labelCmd, pinCmd, unpinCmd, urlCmd, statusCmd, reposCmd,
+		cloneCmd, startCmd, stopCmd, logsCmd, openCmd, terminalCmd, historyCmd,
+		feedbackCmd, mockCmd, serveCmd, forwardCmd, execCmd, jobsCmd,
 	)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -138,6 +361,19 @@ type Port struct {
 	PID         int    `json:"pid"`
 	ProcessName string `json:"process_name"`
 	ShareMode   string `json:"share_mode"`
+	QuotaBytes  int64  `json:"quota_bytes"`
+	UsageBytes  int64  `json:"usage_bytes"`
+
+	Protocol         string   `json:"protocol"`
+	ProtocolOverride string   `json:"protocol_override"`
+	Title            string   `json:"title"`
+	Framework        string   `json:"framework"`
+	BindAddresses    []string `json:"bind_addresses"`
+	Exposed          bool     `json:"exposed"`
+	Container        string   `json:"container"`
+	Label            string   `json:"label"`
+	Pinned           bool     `json:"pinned"`
+	Offline          bool     `json:"offline"`
 }
 
 type Status struct {
@@ -185,15 +421,70 @@ func runList(cmd *cobra.Command, args []string) {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "PORT\tPROCESS\tREPO\tSHARE MODE")
+	fmt.Fprintln(w, "PORT\tPROCESS\tREPO\tPROTO\tAPP\tSHARE MODE\tUSAGE")
 	for _, p := range ports {
 		repo := p.RepoName
 		if repo == "" {
 			repo = "-"
 		}
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", p.Port, p.ProcessName, repo, p.ShareMode)
+		usage := formatSize(p.UsageBytes)
+		if p.QuotaBytes > 0 {
+			usage += " / " + formatSize(p.QuotaBytes)
+		}
+		proto := p.Protocol
+		if p.ProtocolOverride != "" {
+			proto = p.ProtocolOverride + "*"
+		}
+		if proto == "" {
+			proto = "-"
+		}
+		process := p.ProcessName
+		if p.Container != "" {
+			process = "docker:" + p.Container
+		}
+		if p.Offline {
+			process = "(offline)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", p.Port, process, repo, proto, appName(p), p.ShareMode, usage)
 	}
 	w.Flush()
+
+	// Ports bound beyond loopback can be reached without going through homeport
+	var exposed []string
+	for _, p := range ports {
+		if p.Exposed {
+			exposed = append(exposed, fmt.Sprintf("%d (%s)", p.Port, strings.Join(p.BindAddresses, ", ")))
+		}
+	}
+	if len(exposed) > 0 {
+		fmt.Printf("\nWarning: these ports listen beyond loopback and can be reached without homeport auth if the firewall allows it: %s\n", strings.Join(exposed, "; "))
+		fmt.Println("Bind the dev server to 127.0.0.1 (e.g. --host 127.0.0.1) to keep it behind homeport.")
+	}
+}
+
+// appName describes what a port serves: its label, or the page title and
+// framework
+func appName(p Port) string {
+	pin := ""
+	if p.Pinned {
+		pin = " [pinned]"
+	}
+	if p.Label != "" {
+		return p.Label + pin
+	}
+	title := p.Title
+	if len([]rune(title)) > 40 {
+		title = string([]rune(title)[:39]) + "…"
+	}
+	switch {
+	case title != "" && p.Framework != "":
+		return title + " (" + p.Framework + ")" + pin
+	case title != "":
+		return title + pin
+	case p.Framework != "":
+		return p.Framework + pin
+	}
+	return "-" + pin
 }
 
 func runShare(cmd *cobra.Command, args []string) {
@@ -202,9 +493,12 @@ func runShare(cmd *cobra.Command, args []string) {
 	isPublic, _ := cmd.Flags().GetBool("public")
 	isPassword, _ := cmd.Flags().GetBool("password")
 	password, _ := cmd.Flags().GetString("pass")
+	emails, _ := cmd.Flags().GetStringSlice("email")
 
 	mode := "private"
-	if isPublic {
+	if len(emails) > 0 {
+		mode = "email"
+	} else if isPublic {
 		mode = "public"
 	} else if isPassword {
 		mode = "password"
@@ -214,13 +508,68 @@ func runShare(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	body := fmt.Sprintf(`{"mode":"%s"`, mode)
+	shareReq := map[string]interface{}{"mode": mode}
 	if mode == "password" {
-		body += fmt.Sprintf(`,"password":"%s"`, password)
+		shareReq["password"] = password
+	}
+	if mode == "email" {
+		shareReq["email_allowlist"] = emails
+	}
+	if cmd.Flags().Changed("allow") {
+		allow, _ := cmd.Flags().GetStringSlice("allow")
+		shareReq["ip_allow"] = allow
+	}
+	if cmd.Flags().Changed("deny") {
+		deny, _ := cmd.Flags().GetStringSlice("deny")
+		shareReq["ip_deny"] = deny
+	}
+	if cmd.Flags().Changed("rate") {
+		rate, _ := cmd.Flags().GetInt("rate")
+		shareReq["rate_limit_rps"] = rate
+	}
+	if cmd.Flags().Changed("quota") {
+		quotaStr, _ := cmd.Flags().GetString("quota")
+		quota, err := parseSize(quotaStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		shareReq["quota_bytes"] = quota
+	}
+	if cmd.Flags().Changed("banner") {
+		banner, _ := cmd.Flags().GetBool("banner")
+		shareReq["banner"] = banner
+	}
+	if cmd.Flags().Changed("feedback") {
+		feedback, _ := cmd.Flags().GetBool("feedback")
+		shareReq["feedback"] = feedback
+		if feedback {
+			shareReq["banner"] = true
+		}
+	}
+	if expires, _ := cmd.Flags().GetString("expires"); expires != "" {
+		shareReq["expires_in"] = expires
+	}
+	if from, _ := cmd.Flags().GetString("from"); from != "" {
+		shareReq["starts_at"] = from
+	}
+	if until, _ := cmd.Flags().GetString("until"); until != "" {
+		shareReq["ends_at"] = until
+	}
+	days, _ := cmd.Flags().GetString("days")
+	hours, _ := cmd.Flags().GetString("hours")
+	tz, _ := cmd.Flags().GetString("tz")
+	if days != "" || hours != "" {
+		schedule, err := buildSchedule(days, hours, tz)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		shareReq["schedule"] = schedule
 	}
-	body += "}"
+	body, _ := json.Marshal(shareReq)
 
-	req, _ := http.NewRequest("POST", apiURL+"/share/"+port, strings.NewReader(body))
+	req, _ := http.NewRequest("POST", apiURL+"/share/"+port, bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := http.DefaultClient.Do(req)
@@ -236,10 +585,14 @@ func runShare(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	var result map[string]string
+	var result map[string]interface{}
 	json.NewDecoder(resp.Body).Decode(&result)
-	fmt.Printf("Port %s shared as %s\n", port, mode)
-	fmt.Printf("URL: %s\n", result["url"])
+	if result["status"] == "scheduled" {
+		fmt.Printf("Port %s scheduled to share as %s (currently %s)\n", port, mode, map[bool]string{true: "open", false: "closed"}[result["active"] == true])
+	} else {
+		fmt.Printf("Port %s shared as %s\n", port, mode)
+	}
+	fmt.Printf("URL: %v\n", result["url"])
 }
 
 func runUnshare(cmd *cobra.Command, args []string) {
@@ -262,6 +615,76 @@ func runUnshare(cmd *cobra.Command, args []string) {
 	fmt.Printf("Port %s unshared (now private)\n", port)
 }
 
+// updatePort sends a PATCH with the given fields
+func updatePort(port string, fields map[string]interface{}) {
+	body, _ := json.Marshal(fields)
+	req, _ := http.NewRequest("PATCH", apiURL+"/ports/"+port, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", body)
+		os.Exit(1)
+	}
+}
+
+func runLabel(cmd *cobra.Command, args []string) {
+	port, label := args[0], ""
+	if len(args) > 1 {
+		label = args[1]
+	}
+	updatePort(port, map[string]interface{}{"label": label})
+
+	if label == "" {
+		fmt.Printf("Cleared the label of port %s\n", port)
+	} else {
+		fmt.Printf("Port %s is now labelled %q\n", port, label)
+	}
+}
+
+func runPin(cmd *cobra.Command, args []string) {
+	port, pinned := args[0], cmd.Name() == "pin"
+	updatePort(port, map[string]interface{}{"pinned": pinned})
+
+	if pinned {
+		fmt.Printf("Port %s pinned: it stays listed, with its share settings, while offline\n", port)
+	} else {
+		fmt.Printf("Port %s unpinned\n", port)
+	}
+}
+
+func runProtocol(cmd *cobra.Command, args []string) {
+	port, protocol := args[0], args[1]
+
+	body, _ := json.Marshal(map[string]string{"protocol": protocol})
+	req, _ := http.NewRequest("PUT", apiURL+"/ports/"+port+"/protocol", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", body)
+		os.Exit(1)
+	}
+
+	if protocol == "auto" {
+		fmt.Printf("Port %s now uses the detected protocol\n", port)
+	} else {
+		fmt.Printf("Port %s is proxied as %s\n", port, protocol)
+	}
+}
+
 func runURL(cmd *cobra.Command, args []string) {
 	port := args[0]
 
@@ -545,45 +968,948 @@ func runTerminal(cmd *cobra.Command, args []string) {
 	fmt.Println(url)
 }
 
-// findRepo finds a repo by name or ID
-func findRepo(nameOrID string) *Repo {
-	resp, err := http.Get(apiURL + "/repos")
+type TerminalCommand struct {
+	ID        int64     `json:"id"`
+	RepoID    string    `json:"repo_id"`
+	Command   string    `json:"command"`
+	Cwd       string    `json:"cwd"`
+	ExitCode  *int      `json:"exit_code"`
+	StartedAt time.Time `json:"started_at"`
+	Duration  float64   `json:"duration"`
+	Output    string    `json:"output"`
+	RerunURL  string    `json:"rerun_url"`
+}
+
+func runHistory(cmd *cobra.Command, args []string) {
+	query := url.Values{}
+	if len(args) == 1 {
+		query.Set("q", args[0])
+	}
+	if name, _ := cmd.Flags().GetString("repo"); name != "" {
+		repo := findRepo(name)
+		if repo == nil {
+			fmt.Fprintf(os.Stderr, "Error: repository '%s' not found\n", name)
+			os.Exit(1)
+		}
+		query.Set("repo", repo.ID)
+	}
+	if failed, _ := cmd.Flags().GetBool("failed"); failed {
+		query.Set("failed", "true")
+	}
+	if since, _ := cmd.Flags().GetString("since"); since != "" {
+		query.Set("range", since)
+	}
+	lines, _ := cmd.Flags().GetInt("lines")
+	query.Set("limit", strconv.Itoa(lines))
+
+	resp, err := http.Get(apiURL + "/terminal/history?" + query.Encode())
 	if err != nil {
-		return nil
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 	defer resp.Body.Close()
 
-	var repos []Repo
-	if err := json.NewDecoder(resp.Body).Decode(&repos); err != nil {
-		return nil
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", body)
+		os.Exit(1)
 	}
 
-	// Try exact match on ID first
-	for _, r := range repos {
-		if r.ID == nameOrID {
-			return &r
+	var commands []TerminalCommand
+	if err := json.NewDecoder(resp.Body).Decode(&commands); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(commands) == 0 {
+		fmt.Println("No commands found")
+		return
+	}
+
+	// Oldest first, so the newest ends up next to the prompt
+	for i := len(commands) - 1; i >= 0; i-- {
+		c := commands[i]
+		fmt.Printf("#%d  %s  %s  %s  %s\n", c.ID, c.StartedAt.Local().Format("2006-01-02 15:04"),
+			exitStatus(c.ExitCode), formatSeconds(c.Duration), c.Cwd)
+		for _, line := range strings.Split(c.Command, "\n") {
+			fmt.Printf("    %s\n", line)
 		}
 	}
+}
 
-	// Try exact match on name
-	for _, r := range repos {
-		if r.Name == nameOrID {
-			return &r
+func runHistoryShow(cmd *cobra.Command, args []string) {
+	resp, err := http.Get(apiURL + "/terminal/history/" + url.PathEscape(args[0]))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", body)
+		os.Exit(1)
+	}
+
+	var c TerminalCommand
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Command:   %s\n", c.Command)
+	fmt.Printf("Directory: %s\n", c.Cwd)
+	fmt.Printf("Started:   %s\n", c.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("Took:      %s\n", formatSeconds(c.Duration))
+	fmt.Printf("Status:    %s\n", exitStatus(c.ExitCode))
+	if c.Output != "" {
+		fmt.Printf("\n%s\n", c.Output)
+	}
+	fmt.Printf("\nRun again: %s\n", c.RerunURL)
+}
+
+// exitStatus describes a command's exit code, which may be unknown
+func exitStatus(code *int) string {
+	switch {
+	case code == nil:
+		return "exit ?"
+	case *code == 0:
+		return "ok"
+	}
+	return fmt.Sprintf("exit %d", *code)
+}
+
+// formatSeconds renders a duration in seconds like "850ms" or "2m5s"
+func formatSeconds(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	if d < time.Millisecond {
+		return "<1ms"
+	}
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+type Feedback struct {
+	ID         int64      `json:"id"`
+	Page       string     `json:"page"`
+	Viewport   string     `json:"viewport"`
+	Name       string     `json:"name"`
+	Identity   string     `json:"identity"`
+	IP         string     `json:"ip"`
+	Message    string     `json:"message"`
+	Screenshot string     `json:"screenshot"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+}
+
+func runFeedback(cmd *cobra.Command, args []string) {
+	port := args[0]
+	status := "open"
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		status = ""
+	}
+
+	resp, err := http.Get(apiURL + "/ports/" + port + "/feedback?status=" + status)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", body)
+		os.Exit(1)
+	}
+
+	var entries []Feedback
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No feedback")
+		return
+	}
+
+	for _, f := range entries {
+		from := f.Identity
+		if from == "" {
+			from = f.Name
+		}
+		if from == "" {
+			from = f.IP
 		}
+		state := ""
+		if f.ResolvedAt != nil {
+			state = " [resolved]"
+		}
+		fmt.Printf("#%d  %s  %s  %s%s\n", f.ID, f.CreatedAt.Local().Format("2006-01-02 15:04"), from, f.Page, state)
+		if f.Screenshot != "" {
+			fmt.Printf("    screenshot: %s/feedback/%d/screenshot\n", apiURL, f.ID)
+		}
+		for _, line := range strings.Split(f.Message, "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+		fmt.Println()
 	}
+}
 
-	// Try case-insensitive match on name
-	for _, r := range repos {
-		if strings.EqualFold(r.Name, nameOrID) {
-			return &r
+func runFeedbackResolve(cmd *cobra.Command, args []string) {
+	reopen, _ := cmd.Flags().GetBool("reopen")
+	body, _ := json.Marshal(map[string]bool{"resolved": !reopen})
+
+	for _, id := range args {
+		req, _ := http.NewRequest("PATCH", apiURL+"/feedback/"+id, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", respBody)
+			os.Exit(1)
+		}
+		if reopen {
+			fmt.Printf("Reopened feedback #%s\n", id)
+		} else {
+			fmt.Printf("Resolved feedback #%s\n", id)
 		}
 	}
+}
 
-	return nil
+func runFeedbackExport(cmd *cobra.Command, args []string) {
+	port := args[0]
+
+	if issue, _ := cmd.Flags().GetBool("issue"); !issue {
+		resp, err := http.Get(apiURL + "/ports/" + port + "/feedback/export")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", body)
+			os.Exit(1)
+		}
+		os.Stdout.Write(body)
+		return
+	}
+
+	title, _ := cmd.Flags().GetString("title")
+	resolve, _ := cmd.Flags().GetBool("resolve")
+	body, _ := json.Marshal(map[string]interface{}{"title": title, "resolve": resolve})
+
+	req, _ := http.NewRequest("POST", apiURL+"/ports/"+port+"/feedback/issue", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", respBody)
+		os.Exit(1)
+	}
+
+	var result struct {
+		URL   string `json:"url"`
+		Count int    `json:"count"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	fmt.Printf("Created issue with %d feedback entries: %s\n", result.Count, result.URL)
 }
 
-// Unused but keeping for reference
-func parseInt(s string) int {
-	n, _ := strconv.Atoi(s)
-	return n
+type Mock struct {
+	Port     int       `json:"port"`
+	File     string    `json:"file"`
+	Routes   int       `json:"routes"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Error    string    `json:"error"`
+}
+
+func runMock(cmd *cobra.Command, args []string) {
+	port, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid port %q\n", args[0])
+		os.Exit(1)
+	}
+	// The server watches the file for changes, so send its path rather than its contents
+	file, err := filepath.Abs(args[1])
+	if err == nil {
+		_, err = os.Stat(file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"port": port, "file": file})
+	resp, err := http.Post(apiURL+"/mocks", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", respBody)
+		os.Exit(1)
+	}
+
+	var m Mock
+	json.NewDecoder(resp.Body).Decode(&m)
+	fmt.Printf("Mock serving %s on port %d (%d routes)\n", m.File, m.Port, m.Routes)
+	fmt.Println("Edits to the file are picked up automatically")
+}
+
+func runMockStop(cmd *cobra.Command, args []string) {
+	req, _ := http.NewRequest("DELETE", apiURL+"/mocks/"+args[0], nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", body)
+		os.Exit(1)
+	}
+	fmt.Printf("Stopped mock on port %s\n", args[0])
+}
+
+func runMockList(cmd *cobra.Command, args []string) {
+	resp, err := http.Get(apiURL + "/mocks")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	var mocks []Mock
+	if err := json.NewDecoder(resp.Body).Decode(&mocks); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(mocks) == 0 {
+		fmt.Println("No mocks running")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PORT\tROUTES\tFILE\tSTATUS")
+	for _, m := range mocks {
+		status := "ok"
+		if m.Error != "" {
+			status = "reload failed: " + m.Error
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", m.Port, m.Routes, m.File, status)
+	}
+	w.Flush()
+}
+
+type StaticServer struct {
+	Port    int    `json:"port"`
+	RepoID  string `json:"repo_id"`
+	Root    string `json:"root"`
+	SPA     bool   `json:"spa"`
+	Listing bool   `json:"listing"`
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	repo := findRepo(args[0])
+	if repo == nil {
+		fmt.Fprintf(os.Stderr, "Error: repository '%s' not found\n", args[0])
+		fmt.Fprintf(os.Stderr, "Run 'homeport repos' to see available repositories\n")
+		os.Exit(1)
+	}
+
+	port, _ := cmd.Flags().GetInt("port")
+	spa, _ := cmd.Flags().GetBool("spa")
+	noListing, _ := cmd.Flags().GetBool("no-listing")
+	body, _ := json.Marshal(map[string]interface{}{
+		"repo_id": repo.ID,
+		"dir":     args[1],
+		"port":    port,
+		"spa":     spa,
+		"listing": !noListing,
+	})
+
+	resp, err := http.Post(apiURL+"/static", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", errResp["error"])
+		os.Exit(1)
+	}
+
+	var ss StaticServer
+	json.NewDecoder(resp.Body).Decode(&ss)
+	fmt.Printf("Serving %s on port %d\n", ss.Root, ss.Port)
+	fmt.Printf("Share it with: homeport share %d --public\n", ss.Port)
+}
+
+func runServeStop(cmd *cobra.Command, args []string) {
+	req, _ := http.NewRequest("DELETE", apiURL+"/static/"+args[0], nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp map[string]string
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", errResp["error"])
+		os.Exit(1)
+	}
+	fmt.Printf("Stopped serving port %s\n", args[0])
+}
+
+func runServeList(cmd *cobra.Command, args []string) {
+	resp, err := http.Get(apiURL + "/static")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	var servers []StaticServer
+	if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(servers) == 0 {
+		fmt.Println("No directories being served")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PORT\tDIRECTORY\tOPTIONS")
+	for _, ss := range servers {
+		var opts []string
+		if ss.SPA {
+			opts = append(opts, "spa")
+		}
+		if ss.Listing {
+			opts = append(opts, "listing")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", ss.Port, ss.Root, strings.Join(opts, ","))
+	}
+	w.Flush()
+}
+
+func runForward(cmd *cobra.Command, args []string) {
+	localPort, remotePort := args[0], args[0]
+	if i := strings.Index(args[0], ":"); i != -1 {
+		localPort, remotePort = args[0][:i], args[0][i+1:]
+	}
+	for _, p := range []string{localPort, remotePort} {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			fmt.Fprintf(os.Stderr, "Error: invalid port %q\n", p)
+			os.Exit(1)
+		}
+	}
+
+	server, header := connect(cmd)
+
+	proto := "tcp"
+	if udp, _ := cmd.Flags().GetBool("udp"); udp {
+		proto = "udp"
+	}
+	wsURL := server + "/api/forward/" + remotePort + "?proto=" + proto
+	wsURL = "ws" + strings.TrimPrefix(wsURL, "http")
+	dialer := &forward.Dialer{URL: wsURL, Header: header}
+
+	// Fail early if the remote port is closed or access is denied
+	ws, err := dialer.Dial()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	ws.Close()
+
+	addr := "127.0.0.1:" + localPort
+	fmt.Printf("Forwarding %s/%s → %s port %s (Ctrl+C to stop)\n", proto, addr, server, remotePort)
+	if proto == "udp" {
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		err = forward.ServeUDP(pc, dialer)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = forward.ServeTCP(ln, dialer)
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(1)
+}
+
+// Job is a command run with homeport exec
+type Job struct {
+	ID         string     `json:"id"`
+	RepoID     string     `json:"repo_id"`
+	Command    string     `json:"command"`
+	Status     string     `json:"status"`
+	ExitCode   *int       `json:"exit_code"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Duration   float64    `json:"duration"`
+}
+
+func runExec(cmd *cobra.Command, args []string) {
+	server, header := connect(cmd)
+	repo := findServerRepo(server, header, args[0])
+	if repo == nil {
+		fmt.Fprintf(os.Stderr, "Error: repository '%s' not found\n", args[0])
+		os.Exit(1)
+	}
+
+	// A single argument is a shell command line, like with ssh
+	command := args[1]
+	if len(args) > 2 {
+		command = shellJoin(args[1:])
+	}
+	body, _ := json.Marshal(map[string]string{"repo": repo.ID, "command": command})
+	req, _ := http.NewRequest("POST", server+"/api/jobs", bytes.NewReader(body))
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", apiError(resp))
+		os.Exit(1)
+	}
+	var job Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if detach, _ := cmd.Flags().GetBool("detach"); detach {
+		fmt.Println(job.ID)
+		return
+	}
+	os.Exit(attachJob(server, header, job.ID))
+}
+
+func runJobs(cmd *cobra.Command, args []string) {
+	server, header := connect(cmd)
+	query := url.Values{}
+	if name, _ := cmd.Flags().GetString("repo"); name != "" {
+		repo := findServerRepo(server, header, name)
+		if repo == nil {
+			fmt.Fprintf(os.Stderr, "Error: repository '%s' not found\n", name)
+			os.Exit(1)
+		}
+		query.Set("repo", repo.ID)
+	}
+	lines, _ := cmd.Flags().GetInt("lines")
+	query.Set("limit", strconv.Itoa(lines))
+
+	req, _ := http.NewRequest("GET", server+"/api/jobs?"+query.Encode(), nil)
+	req.Header = header.Clone()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", apiError(resp))
+		os.Exit(1)
+	}
+	var jobs []Job
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(jobs) == 0 {
+		fmt.Println("No jobs")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tTOOK\tSTATUS\tCOMMAND")
+	for _, j := range jobs {
+		status := j.Status
+		if j.Status == "failed" && j.ExitCode != nil {
+			status = exitStatus(j.ExitCode)
+		}
+		command := strings.ReplaceAll(j.Command, "\n", " ")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", j.ID, j.StartedAt.Local().Format("2006-01-02 15:04"),
+			formatSeconds(j.Duration), status, command)
+	}
+	w.Flush()
+}
+
+func runJobsAttach(cmd *cobra.Command, args []string) {
+	server, header := connect(cmd)
+	os.Exit(attachJob(server, header, args[0]))
+}
+
+func runJobsCancel(cmd *cobra.Command, args []string) {
+	server, header := connect(cmd)
+	if err := cancelJob(server, header, args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Canceled job", args[0])
+}
+
+// attachJob streams a job's output to stdout and stderr and returns the
+// exit code to leave with. The first Ctrl+C cancels the job, the second
+// stops waiting for it.
+func attachJob(server string, header http.Header, id string) int {
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		fmt.Fprintln(os.Stderr, "\nCanceling job (Ctrl+C again to stop waiting)...")
+		if err := cancelJob(server, header, id); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		<-interrupts
+		fmt.Fprintf(os.Stderr, "Job %s may still be running\n", id)
+		os.Exit(130)
+	}()
+
+	req, _ := http.NewRequest("GET", server+"/api/jobs/"+url.PathEscape(id)+"/stream", nil)
+	req.Header = header.Clone()
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", apiError(resp))
+		return 1
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event != "":
+			switch event {
+			case "stdout", "stderr":
+				var text string
+				json.Unmarshal([]byte(data), &text)
+				if event == "stdout" {
+					os.Stdout.WriteString(text)
+				} else {
+					os.Stderr.WriteString(text)
+				}
+			case "exit":
+				var job Job
+				json.Unmarshal([]byte(data), &job)
+				switch {
+				case job.ExitCode != nil:
+					return *job.ExitCode
+				case job.Status == "succeeded":
+					return 0
+				}
+				fmt.Fprintf(os.Stderr, "Job %s\n", job.Status)
+				return 1
+			}
+			event, data = "", ""
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Error: lost the connection; job %s may still be running (homeport jobs attach %s)\n", id, id)
+	return 1
+}
+
+func cancelJob(server string, header http.Header, id string) error {
+	req, _ := http.NewRequest("DELETE", server+"/api/jobs/"+url.PathEscape(id), nil)
+	req.Header = header.Clone()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.New(apiError(resp))
+	}
+	return nil
+}
+
+// apiError returns the error message of a failed API response
+func apiError(resp *http.Response) string {
+	body, _ := io.ReadAll(resp.Body)
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		return e.Error
+	}
+	if len(body) == 0 {
+		return resp.Status
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// shellJoin joins arguments into a sh command line, quoting those that
+// need it
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// connect returns the server named by the --server flag, or the local
+// daemon, and the headers that get past Cloudflare Access and its login
+func connect(cmd *cobra.Command) (string, http.Header) {
+	server, _ := cmd.Flags().GetString("server")
+	if server == "" {
+		server = strings.TrimSuffix(apiURL, "/api")
+	}
+	server = strings.TrimSuffix(server, "/")
+
+	header := http.Header{}
+	if id, secret := os.Getenv("CF_ACCESS_CLIENT_ID"), os.Getenv("CF_ACCESS_CLIENT_SECRET"); id != "" && secret != "" {
+		header.Set("CF-Access-Client-Id", id)
+		header.Set("CF-Access-Client-Secret", secret)
+	}
+	if err := login(server, header); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return server, header
+}
+
+// login adds a session cookie to header if the server requires a password
+func login(server string, header http.Header) error {
+	req, _ := http.NewRequest("GET", server+"/api/status", nil)
+	req.Header = header.Clone()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil
+	}
+
+	password := os.Getenv("HOMEPORT_PASSWORD")
+	if password == "" {
+		fmt.Print("Homeport password: ")
+		fmt.Scanln(&password)
+	}
+
+	form := url.Values{"password": {password}}
+	req, _ = http.NewRequest("POST", server+"/login", strings.NewReader(form.Encode()))
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	for _, c := range resp.Cookies() {
+		if c.Name == "homeport_session" && c.Value != "" {
+			header.Set("Cookie", c.Name+"="+c.Value)
+			return nil
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("too many failed logins, try again later")
+	}
+	return fmt.Errorf("login failed: invalid password")
+}
+
+// findRepo finds a repo by name or ID
+func findRepo(nameOrID string) *Repo {
+	return findServerRepo(strings.TrimSuffix(apiURL, "/api"), nil, nameOrID)
+}
+
+// findServerRepo finds a repo by name or ID on a homeport server
+func findServerRepo(server string, header http.Header, nameOrID string) *Repo {
+	req, _ := http.NewRequest("GET", server+"/api/repos", nil)
+	if header != nil {
+		req.Header = header.Clone()
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var repos []Repo
+	if err := json.NewDecoder(resp.Body).Decode(&repos); err != nil {
+		return nil
+	}
+
+	// Try exact match on ID first
+	for _, r := range repos {
+		if r.ID == nameOrID {
+			return &r
+		}
+	}
+
+	// Try exact match on name
+	for _, r := range repos {
+		if r.Name == nameOrID {
+			return &r
+		}
+	}
+
+	// Try case-insensitive match on name
+	for _, r := range repos {
+		if strings.EqualFold(r.Name, nameOrID) {
+			return &r
+		}
+	}
+
+	return nil
+}
+
+// Unused but keeping for reference
+func parseInt(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// parseSize parses sizes like "500MB", "2GB" or a plain byte count
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		mult   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return int64(n * float64(u.mult)), nil
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n, nil
+}
+
+// formatSize renders a byte count like "1.5 GB"
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// buildSchedule turns --days/--hours/--tz into a share schedule request
+func buildSchedule(days, hours, tz string) (map[string]interface{}, error) {
+	schedule := map[string]interface{}{"start": "00:00", "end": "00:00", "timezone": tz}
+
+	if hours != "" {
+		parts := strings.SplitN(hours, "-", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid --hours %q (use HH:MM-HH:MM)", hours)
+		}
+		schedule["start"], schedule["end"] = parts[0], parts[1]
+	}
+
+	if days != "" {
+		order := []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+		index := func(day string) int {
+			for i, d := range order {
+				if d == day {
+					return i
+				}
+			}
+			return -1
+		}
+
+		var list []string
+		for _, part := range strings.Split(strings.ToLower(days), ",") {
+			bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+			from := index(bounds[0])
+			to := from
+			if len(bounds) == 2 {
+				to = index(bounds[1])
+			}
+			if from < 0 || to < 0 {
+				return nil, fmt.Errorf("invalid --days %q (use e.g. mon-fri or sat,sun)", days)
+			}
+			// Ranges may wrap around the week, e.g. fri-mon
+			for i := from; ; i = (i + 1) % 7 {
+				list = append(list, order[i])
+				if i == to {
+					break
+				}
+			}
+		}
+		schedule["days"] = list
+	}
+
+	return schedule, nil
 }
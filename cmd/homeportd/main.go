@@ -11,12 +11,16 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/gethomeport/homeport/internal/api"
 	"github.com/gethomeport/homeport/internal/config"
+	"github.com/gethomeport/homeport/internal/scanner"
 	"github.com/gethomeport/homeport/internal/store"
+	"github.com/gethomeport/homeport/internal/terminal"
 )
 
 func main() {
@@ -29,6 +33,15 @@ func main() {
 		case "generate-password":
 			generatePassword()
 			return
+		case "scan-bench":
+			scanBench(os.Args[2:])
+			return
+		case terminal.HolderCommand:
+			if err := terminal.RunHolder(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		}
 	}
 
@@ -68,6 +81,7 @@ func main() {
 	}
 	cfg.PasswordHash = os.Getenv("HOMEPORT_PASSWORD_HASH")
 	cfg.CookieSecret = os.Getenv("HOMEPORT_COOKIE_SECRET")
+	cfg.Mail.Password = os.Getenv("HOMEPORT_SMTP_PASSWORD")
 
 	// Ensure directories exist
 	if err := cfg.EnsureDirs(); err != nil {
@@ -156,3 +170,32 @@ func generatePassword() {
 	fmt.Println(password)
 	fmt.Println(string(hash))
 }
+
+// scanBench compares the port scanning backends available on this machine.
+// The scanner benchmarks (go test -bench) cover the same backends; this runs
+// them from the installed binary with its privileges, where there is no Go
+// toolchain, and adds the CPU time each scan costs.
+func scanBench(args []string) {
+	fs := flag.NewFlagSet("scan-bench", flag.ExitOnError)
+	rounds := fs.Int("n", 50, "Scans per backend")
+	minPort := fs.Int("min", 1, "Lowest port to scan")
+	maxPort := fs.Int("max", 65535, "Highest port to scan")
+	fs.Parse(args)
+
+	if *rounds < 1 {
+		fmt.Fprintln(os.Stderr, "-n must be at least 1")
+		os.Exit(1)
+	}
+
+	s := scanner.New(*minPort, *maxPort, "")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BACKEND\tPORTS\tWALL/SCAN\tCPU/SCAN\tMETHOD")
+	for _, r := range s.Bench(*rounds) {
+		if r.Err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t%s (error: %v)\n", r.Backend, r.Description, r.Err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%s\n", r.Backend, r.Ports, r.Wall.Round(time.Microsecond), r.CPU.Round(time.Microsecond), r.Description)
+	}
+	w.Flush()
+}
@@ -5,6 +5,8 @@ go 1.22
 require (
 	github.com/go-chi/chi/v5 v5.0.12
 	golang.org/x/crypto v0.21.0
+	golang.org/x/net v0.23.0
+	golang.org/x/text v0.14.0
 	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.29.5
 )
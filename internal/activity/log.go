@@ -9,7 +9,7 @@ import (
 type Entry struct {
 	ID        int64     `json:"id"`
 	Timestamp time.Time `json:"timestamp"`
-	Type      string    `json:"type"`      // "clone", "delete", "share", "unshare", "commit", "push", "pull", "start", "stop"
+	Type      string    `json:"type"`      // "clone", "delete", "share", "unshare", "commit", "push", "pull", "start", "stop", "wake", "sleep", "throttle", "pause", "schedule", "feedback", "mock", "serve"
 	RepoID    string    `json:"repo_id,omitempty"`
 	RepoName  string    `json:"repo_name,omitempty"`
 	Port      int       `json:"port,omitempty"`
@@ -115,3 +115,55 @@ func LogStart(repoID, repoName string) {
 func LogStop(repoID, repoName string) {
 	Global().Add("stop", repoID, repoName, 0, "Stopped dev server", "")
 }
+
+func LogWake(repoID, repoName string, port int) {
+	Global().Add("wake", repoID, repoName, port, "Woke dev server on request", "")
+}
+
+func LogSleep(repoID, repoName string, idle time.Duration) {
+	Global().Add("sleep", repoID, repoName, 0, "Stopped idle dev server", "idle for "+idle.Round(time.Minute).String())
+}
+
+func LogRateLimited(port int, ip string) {
+	Global().Add("throttle", "", "", port, "Rate limited visitor", ip)
+}
+
+func LogSharePaused(port int, reason string) {
+	Global().Add("pause", "", "", port, "Paused share", reason)
+}
+
+func LogShareExpired(port int) {
+	Global().Add("unshare", "", "", port, "Share expired", "")
+}
+
+func LogFeedback(port int, from string) {
+	Global().Add("feedback", "", "", port, "New feedback", from)
+}
+
+func LogScheduleChange(port int, from, to string) {
+	Global().Add("schedule", "", "", port, "Scheduled share change", from+" → "+to)
+}
+
+func LogMockStart(port int, file string) {
+	Global().Add("mock", "", "", port, "Started mock server", file)
+}
+
+func LogMockStop(port int) {
+	Global().Add("mock", "", "", port, "Stopped mock server", "")
+}
+
+func LogServeStart(repoID, repoName string, port int, root string) {
+	Global().Add("serve", repoID, repoName, port, "Started serving directory", root)
+}
+
+func LogServeStop(port int) {
+	Global().Add("serve", "", "", port, "Stopped serving directory", "")
+}
+
+func LogTerminalShare(repoID, mode string) {
+	Global().Add("share", repoID, "", 0, "Shared terminal", mode)
+}
+
+func LogTerminalJoin(repoID, name, mode string) {
+	Global().Add("share", repoID, "", 0, "Guest joined terminal", name+" ("+mode+")")
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+const (
+	// retentionInterval is how often old access logs are rolled up
+	retentionInterval = time.Hour
+	// analyticsTop limits the top paths, referrers, etc. in analytics responses
+	analyticsTop = 10
+	// maxAnalyticsRange bounds the range query parameter
+	maxAnalyticsRange = 366 * 24 * time.Hour
+)
+
+// retentionLoop periodically rolls access logs past the retention period into daily totals
+func (s *Server) retentionLoop() {
+	if s.cfg.AccessLogRetentionDays <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		s.rollupAccessLogs()
+		select {
+		case <-ticker.C:
+		case <-s.stopScan:
+			return
+		}
+	}
+}
+
+func (s *Server) rollupAccessLogs() {
+	n, err := s.store.RollupAccessLogs(s.retentionCutoff())
+	if err != nil {
+		log.Printf("Failed to roll up access logs: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Rolled up %d access log entries into daily totals", n)
+	}
+}
+
+// retentionCutoff is the start of the oldest day that still has raw access logs
+func (s *Server) retentionCutoff() time.Time {
+	return time.Now().UTC().AddDate(0, 0, -s.cfg.AccessLogRetentionDays).Truncate(24 * time.Hour)
+}
+
+func (s *Server) handlePortAnalytics(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "Invalid port")
+		return
+	}
+
+	rangeStr := r.URL.Query().Get("range")
+	if rangeStr == "" {
+		rangeStr = "7d"
+	}
+	span, err := parseRange(rangeStr)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	since := time.Now().Add(-span)
+	hourly := span <= 48*time.Hour
+	if !hourly {
+		since = since.UTC().Truncate(24 * time.Hour)
+	}
+	shareID := r.URL.Query().Get("share")
+
+	stats, err := s.store.AccessAnalytics(port, since, shareID, hourly, analyticsTop)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	stats.UserAgents = userAgentFamilies(stats.UserAgents)
+
+	granularity := "day"
+	if hourly {
+		granularity = "hour"
+	}
+
+	resp := map[string]interface{}{
+		"port":        port,
+		"range":       rangeStr,
+		"from":        since.UTC(),
+		"granularity": granularity,
+		"share_id":    shareID,
+		"stats":       stats,
+	}
+	if s.cfg.AccessLogRetentionDays > 0 {
+		// Breakdowns and visitor counts only cover raw logs after this point
+		resp["detailed_since"] = s.retentionCutoff()
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// parseRange parses an analytics range like "24h" or "7d"
+func parseRange(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid range %q (use e.g. 24h or 7d)", s)
+	if len(s) < 2 {
+		return 0, invalid
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return 0, invalid
+	}
+
+	var d time.Duration
+	switch s[len(s)-1] {
+	case 'h':
+		d = time.Duration(n) * time.Hour
+	case 'd':
+		d = time.Duration(n) * 24 * time.Hour
+	default:
+		return 0, invalid
+	}
+	if d > maxAnalyticsRange {
+		return 0, fmt.Errorf("range %q is too long (max 366d)", s)
+	}
+	return d, nil
+}
+
+// userAgentFamilies groups raw user agent counts into browser families
+func userAgentFamilies(agents []store.CountItem) []store.CountItem {
+	counts := map[string]int64{}
+	for _, a := range agents {
+		counts[uaFamily(a.Value)] += a.Count
+	}
+
+	families := make([]store.CountItem, 0, len(counts))
+	for family, count := range counts {
+		families = append(families, store.CountItem{Value: family, Count: count})
+	}
+	sort.Slice(families, func(i, j int) bool {
+		if families[i].Count != families[j].Count {
+			return families[i].Count > families[j].Count
+		}
+		return families[i].Value < families[j].Value
+	})
+	return families
+}
+
+// uaFamily maps a user agent string to a coarse family. Order matters:
+// Edge and Chrome both claim to be Safari, and Edge claims to be Chrome.
+func uaFamily(ua string) string {
+	lower := strings.ToLower(ua)
+	switch {
+	case lower == "":
+		return "Unknown"
+	case strings.Contains(lower, "bot"), strings.Contains(lower, "crawl"), strings.Contains(lower, "spider"),
+		strings.Contains(lower, "slurp"), strings.Contains(lower, "preview"):
+		return "Bot"
+	case strings.HasPrefix(lower, "curl/"), strings.HasPrefix(lower, "wget/"), strings.HasPrefix(lower, "go-http-client"),
+		strings.HasPrefix(lower, "python-"), strings.HasPrefix(lower, "httpie/"), strings.HasPrefix(lower, "node-fetch"):
+		return "CLI"
+	case strings.Contains(lower, "edg/"), strings.Contains(lower, "edge/"):
+		return "Edge"
+	case strings.Contains(lower, "opr/"), strings.Contains(lower, "opera"):
+		return "Opera"
+	case strings.Contains(lower, "firefox/"), strings.Contains(lower, "fxios/"):
+		return "Firefox"
+	case strings.Contains(lower, "chrome/"), strings.Contains(lower, "crios/"), strings.Contains(lower, "chromium/"):
+		return "Chrome"
+	case strings.Contains(lower, "safari/"):
+		return "Safari"
+	default:
+		return "Other"
+	}
+}
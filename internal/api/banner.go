@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/gethomeport/homeport/internal/share"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+// visitor is what portAuthMiddleware learned about a granted request
+type visitor struct {
+	port     *store.Port
+	identity string // verified email for email-gated shares
+	owner    bool
+}
+
+const visitorContextKey contextKey = "visitor"
+
+func withVisitor(ctx context.Context, v *visitor) context.Context {
+	return context.WithValue(ctx, visitorContextKey, v)
+}
+
+func visitorFromContext(ctx context.Context) *visitor {
+	v, _ := ctx.Value(visitorContextKey).(*visitor)
+	return v
+}
+
+// bannerFor returns the proxy's HTML injection hook for a request, or nil if
+// the visitor shouldn't see the preview banner. The owner never sees it.
+func (s *Server) bannerFor(r *http.Request) func() string {
+	v := visitorFromContext(r.Context())
+	if v == nil || v.owner || !v.port.Banner || v.port.ShareMode == "private" {
+		return nil
+	}
+	portInfo := v.port
+
+	return func() string {
+		info := share.BannerInfo{
+			Port:      portInfo.Port,
+			RepoName:  portInfo.RepoName,
+			ExpiresAt: portInfo.ExpiresAt,
+			Feedback:  portInfo.BannerFeedback,
+		}
+		if repo := s.repoForPort(portInfo.Port); repo != nil {
+			info.RepoName = repo.Name
+			info.Branch = currentBranch(repo.Path)
+		}
+		return share.BannerHTML(info)
+	}
+}
+
+// currentBranch returns the checked-out branch of a repo ("" if unknown)
+func currentBranch(repoPath string) string {
+	out, err := exec.Command("git", "-C", repoPath, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	branch := strings.TrimSpace(string(out))
+	if branch == "HEAD" {
+		return "" // detached
+	}
+	return branch
+}
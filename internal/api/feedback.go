@@ -0,0 +1,475 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/activity"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+const (
+	maxFeedbackLength = 2000
+	maxFeedbackName   = 100
+	maxScreenshotSize = 5 << 20
+	// feedbackRate is how many feedback messages per second a visitor may send (burst of twice that)
+	feedbackRate = 1
+)
+
+// screenshotTypes maps accepted screenshot content types to file extensions
+var screenshotTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+var viewportPattern = regexp.MustCompile(`^\d{1,5}x\d{1,5}$`)
+
+// feedbackDir is where feedback screenshots are stored
+func (s *Server) feedbackDir() string {
+	return filepath.Join(s.cfg.DataDir, "feedback")
+}
+
+// handlePortFeedback stores feedback sent from the preview banner, as JSON
+// or as multipart/form-data with an optional "screenshot" image.
+// It runs behind portAuthMiddleware, so only visitors who can see the share may post.
+func (s *Server) handlePortFeedback(w http.ResponseWriter, r *http.Request) {
+	v := visitorFromContext(r.Context())
+	if v == nil || !v.port.BannerFeedback {
+		errorResponse(w, http.StatusNotFound, "feedback is not enabled for this port")
+		return
+	}
+	port := v.port.Port
+	clientIP := s.clientIP(r)
+
+	if ok, _ := s.feedbackLimiter.Allow(port, clientIP, feedbackRate); !ok {
+		errorResponse(w, http.StatusTooManyRequests, "too many messages")
+		return
+	}
+
+	var req struct {
+		Message  string `json:"message"`
+		Name     string `json:"name"`
+		Page     string `json:"page"`
+		Viewport string `json:"viewport"`
+	}
+	var screenshot []byte
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxScreenshotSize+64<<10)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid form or screenshot too large")
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		req.Message = r.FormValue("message")
+		req.Name = r.FormValue("name")
+		req.Page = r.FormValue("page")
+		req.Viewport = r.FormValue("viewport")
+
+		if file, _, err := r.FormFile("screenshot"); err == nil {
+			screenshot, err = io.ReadAll(io.LimitReader(file, maxScreenshotSize+1))
+			file.Close()
+			if err != nil || len(screenshot) > maxScreenshotSize {
+				errorResponse(w, http.StatusBadRequest, "screenshot is too large (max 5 MB)")
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	req.Message = strings.TrimSpace(req.Message)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Message == "" {
+		errorResponse(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	if len(req.Message) > maxFeedbackLength || len(req.Name) > maxFeedbackName || len(req.Page) > 1000 {
+		errorResponse(w, http.StatusBadRequest, "message is too long")
+		return
+	}
+	if !viewportPattern.MatchString(req.Viewport) {
+		req.Viewport = ""
+	}
+
+	// The banner sends the browser path; store it relative to the dev server
+	page := strings.TrimPrefix(req.Page, "/"+strconv.Itoa(port))
+	if page == "" || page[0] != '/' {
+		page = "/" + page
+	}
+
+	fb := &store.Feedback{
+		Port:      port,
+		ShareID:   v.port.ShareID,
+		RepoID:    v.port.RepoID,
+		Page:      page,
+		Viewport:  req.Viewport,
+		Name:      req.Name,
+		Message:   req.Message,
+		Identity:  v.identity,
+		IP:        clientIP,
+		UserAgent: r.UserAgent(),
+	}
+
+	if len(screenshot) > 0 {
+		name, err := s.saveScreenshot(screenshot)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		fb.Screenshot = name
+	}
+
+	if err := s.store.AddFeedback(fb); err != nil {
+		s.removeScreenshot(fb.Screenshot)
+		errorResponse(w, http.StatusInternalServerError, "failed to save feedback")
+		return
+	}
+	pruned, err := s.store.PruneFeedback(port)
+	if err != nil {
+		log.Printf("Failed to prune feedback for port %d: %v", port, err)
+	}
+	for _, name := range pruned {
+		s.removeScreenshot(name)
+	}
+
+	from := req.Name
+	if v.identity != "" {
+		from = v.identity
+	}
+	activity.LogFeedback(port, from)
+
+	jsonResponse(w, http.StatusCreated, map[string]interface{}{"status": "ok", "id": fb.ID})
+}
+
+// saveScreenshot validates an uploaded image and writes it to the feedback
+// directory under a random name, returning the file name
+func (s *Server) saveScreenshot(data []byte) (string, error) {
+	ext, ok := screenshotTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", fmt.Errorf("screenshot must be a PNG, JPEG, WebP or GIF image")
+	}
+	if err := os.MkdirAll(s.feedbackDir(), 0700); err != nil {
+		return "", err
+	}
+	name := generateID() + generateID() + ext
+	if err := os.WriteFile(filepath.Join(s.feedbackDir(), name), data, 0600); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (s *Server) removeScreenshot(name string) {
+	if name == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(s.feedbackDir(), filepath.Base(name))); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove screenshot %s: %v", name, err)
+	}
+}
+
+// handleListFeedback returns feedback left for a port, newest first.
+// ?status=open or ?status=resolved filters the list.
+func (s *Server) handleListFeedback(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "Invalid port")
+		return
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	entries, err := s.store.ListFeedback(port, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []store.Feedback{}
+	}
+	jsonResponse(w, http.StatusOK, entries)
+}
+
+// handleUpdateFeedback resolves or reopens a feedback entry
+func (s *Server) handleUpdateFeedback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid feedback id")
+		return
+	}
+
+	var req struct {
+		Resolved *bool `json:"resolved"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Resolved == nil {
+		errorResponse(w, http.StatusBadRequest, "resolved is required")
+		return
+	}
+
+	if _, err := s.store.GetFeedback(id); err != nil {
+		errorResponse(w, http.StatusNotFound, "feedback not found")
+		return
+	}
+	if err := s.store.SetFeedbackResolved(*req.Resolved, id); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fb, err := s.store.GetFeedback(id)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, fb)
+}
+
+func (s *Server) handleDeleteFeedback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid feedback id")
+		return
+	}
+
+	fb, err := s.store.GetFeedback(id)
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "feedback not found")
+		return
+	}
+	if err := s.store.DeleteFeedback(id); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.removeScreenshot(fb.Screenshot)
+
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleFeedbackScreenshot serves the screenshot attached to a feedback entry
+func (s *Server) handleFeedbackScreenshot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid feedback id", http.StatusBadRequest)
+		return
+	}
+
+	fb, err := s.store.GetFeedback(id)
+	if err != nil || fb.Screenshot == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	http.ServeFile(w, r, filepath.Join(s.feedbackDir(), filepath.Base(fb.Screenshot)))
+}
+
+// handleExportFeedback renders a port's feedback as markdown (open entries by default)
+func (s *Server) handleExportFeedback(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "Invalid port")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	} else if status == "all" {
+		status = ""
+	}
+
+	entries, err := s.store.ListFeedback(port, status, maxFeedbackExport)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Write([]byte(s.feedbackMarkdown(port, entries)))
+}
+
+// handleFeedbackIssue files a port's open feedback (or the given entries) as
+// a GitHub issue on the repo serving the port
+func (s *Server) handleFeedbackIssue(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "Invalid port")
+		return
+	}
+
+	var req struct {
+		Title   string  `json:"title"`
+		IDs     []int64 `json:"ids"`     // defaults to all open feedback
+		Resolve bool    `json:"resolve"` // mark the exported entries resolved
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	repo := s.repoForPort(port)
+	if repo == nil {
+		errorResponse(w, http.StatusBadRequest, "port is not served by a known repo")
+		return
+	}
+	if !s.github.IsAuthenticated() {
+		errorResponse(w, http.StatusBadRequest, "GitHub CLI is not authenticated")
+		return
+	}
+
+	var entries []store.Feedback
+	if len(req.IDs) > 0 {
+		for _, id := range req.IDs {
+			fb, err := s.store.GetFeedback(id)
+			if err != nil || fb.Port != port {
+				errorResponse(w, http.StatusNotFound, fmt.Sprintf("feedback %d not found for port %d", id, port))
+				return
+			}
+			entries = append(entries, *fb)
+		}
+	} else {
+		entries, err = s.store.ListFeedback(port, "open", maxFeedbackExport)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if len(entries) == 0 {
+		errorResponse(w, http.StatusBadRequest, "no feedback to export")
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = fmt.Sprintf("Preview feedback for %s (%d %s)", repo.Name, len(entries), plural(len(entries), "comment", "comments"))
+	}
+
+	url, err := s.github.CreateIssue(repo.Path, title, s.feedbackMarkdown(port, entries))
+	if err != nil {
+		errorResponse(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if req.Resolve {
+		ids := make([]int64, len(entries))
+		for i, fb := range entries {
+			ids[i] = fb.ID
+		}
+		if err := s.store.SetFeedbackResolved(true, ids...); err != nil {
+			log.Printf("Failed to resolve exported feedback: %v", err)
+		}
+	}
+
+	jsonResponse(w, http.StatusCreated, map[string]interface{}{"url": url, "count": len(entries)})
+}
+
+// maxFeedbackExport bounds how many entries go into one export or issue
+const maxFeedbackExport = 200
+
+// feedbackMarkdown formats feedback entries, oldest first, for a GitHub issue
+func (s *Server) feedbackMarkdown(port int, entries []store.Feedback) string {
+	var b strings.Builder
+
+	source := fmt.Sprintf("port %d", port)
+	if repo := s.repoForPort(port); repo != nil {
+		source = fmt.Sprintf("**%s** (port %d", repo.Name, port)
+		if branch := currentBranch(repo.Path); branch != "" {
+			source += ", branch `" + branch + "`"
+		}
+		source += ")"
+	}
+	fmt.Fprintf(&b, "Feedback left by visitors of the shared preview of %s.\n", source)
+
+	if len(entries) == 0 {
+		b.WriteString("\n_No feedback._\n")
+		return b.String()
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		fb := entries[i]
+		// Visitors wrote the message and name, so they are escaped to keep
+		// them from adding links, images or mentions to the issue
+		fmt.Fprintf(&b, "\n### %s\n\n", escapeMarkdown(feedbackTitle(fb.Message)))
+		for _, line := range strings.Split(fb.Message, "\n") {
+			b.WriteString("> " + escapeMarkdown(line) + "\n")
+		}
+		b.WriteString("\n")
+
+		from := fb.Identity
+		if from == "" {
+			from = fb.Name
+		}
+		if from == "" {
+			from = "anonymous"
+		}
+		fmt.Fprintf(&b, "- **From:** %s\n", escapeMarkdown(from))
+		fmt.Fprintf(&b, "- **Page:** `%s`\n", strings.NewReplacer("`", "", "\r", "", "\n", "").Replace(fb.Page))
+		if fb.Viewport != "" {
+			fmt.Fprintf(&b, "- **Viewport:** %s\n", escapeMarkdown(fb.Viewport))
+		}
+		if fb.UserAgent != "" {
+			fmt.Fprintf(&b, "- **Browser:** %s\n", uaFamily(fb.UserAgent))
+		}
+		fmt.Fprintf(&b, "- **Date:** %s\n", fb.CreatedAt.UTC().Format("2006-01-02 15:04 UTC"))
+		if fb.Screenshot != "" {
+			fmt.Fprintf(&b, "- **Screenshot:** [view in Homeport](%s/api/feedback/%d/screenshot)\n", s.cfg.ExternalURL, fb.ID)
+		}
+		if fb.ResolvedAt != nil {
+			b.WriteString("- **Status:** resolved\n")
+		}
+	}
+	return b.String()
+}
+
+// feedbackTitle shortens a message to its first line for use as a heading
+func feedbackTitle(message string) string {
+	title := strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+	if len([]rune(title)) > 80 {
+		title = string([]rune(title)[:77]) + "..."
+	}
+	return title
+}
+
+// escapeMarkdown makes text render as written: markdown punctuation is
+// backslash-escaped and a word joiner after @ keeps GitHub from treating
+// it as a mention
+func escapeMarkdown(text string) string {
+	var b strings.Builder
+	for _, c := range strings.TrimRight(text, "\r") {
+		switch {
+		case c == '@':
+			b.WriteString("@\u2060")
+		case strings.ContainsRune("\\`*_{}[]()<>#+-.!|~&:", c):
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
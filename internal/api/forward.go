@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+
+	"github.com/gethomeport/homeport/internal/forward"
+)
+
+// forwardUpgrader only accepts tunnels from non-browser clients or pages on
+// homeport itself, so a logged-in browser can't be used to reach local services
+var forwardUpgrader = websocket.Upgrader{
+	ReadBufferSize:  32 << 10,
+	WriteBufferSize: 32 << 10,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	},
+}
+
+// handleForward tunnels a raw TCP connection to localhost:{port} over a
+// WebSocket, or UDP datagrams with ?proto=udp. It sits behind the same
+// login as private ports and, unless forward_any_port is set, only reaches
+// ports in the port range.
+func (s *Server) handleForward(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil || port < 1 || port > 65535 {
+		errorResponse(w, http.StatusBadRequest, "invalid port")
+		return
+	}
+	if !s.cfg.ForwardAnyPort && (port < s.cfg.PortRangeMin || port > s.cfg.PortRangeMax) {
+		errorResponse(w, http.StatusForbidden, "port must be between "+strconv.Itoa(s.cfg.PortRangeMin)+" and "+strconv.Itoa(s.cfg.PortRangeMax))
+		return
+	}
+	proto := r.URL.Query().Get("proto")
+	if proto == "" {
+		proto = "tcp"
+	}
+	if proto != "tcp" && proto != "udp" {
+		errorResponse(w, http.StatusBadRequest, "proto must be 'tcp' or 'udp'")
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		errorResponse(w, http.StatusBadRequest, "expected a WebSocket upgrade")
+		return
+	}
+
+	// Dial before upgrading so a closed port is reported as an HTTP error
+	// Dial the address the port is bound to, as the proxy does. A UDP dial
+	// can't fall back between families, so an unknown port gets IPv4.
+	host := "localhost"
+	if proto == "udp" {
+		host = "127.0.0.1"
+	}
+	if p, err := s.store.GetPort(port); err == nil {
+		host = p.DialHost()
+	}
+	conn, err := net.DialTimeout(proto, net.JoinHostPort(host, strconv.Itoa(port)), 5*time.Second)
+	if err != nil {
+		errorResponse(w, http.StatusBadGateway, fmt.Sprintf("nothing is listening on %s port %d", proto, port))
+		return
+	}
+
+	ws, err := forwardUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	clientIP := s.clientIP(r)
+	log.Printf("Forward %s/%d opened from %s", proto, port, clientIP)
+	if proto == "tcp" {
+		err = forward.Stream(ws, conn)
+	} else {
+		err = forward.Packets(ws, conn)
+	}
+	if err != nil {
+		log.Printf("Forward %s/%d from %s closed: %v", proto, port, clientIP, err)
+	}
+}
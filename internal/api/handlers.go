@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -18,6 +19,7 @@ import (
 	"github.com/gethomeport/homeport/internal/auth"
 	"github.com/gethomeport/homeport/internal/process"
 	"github.com/gethomeport/homeport/internal/repo"
+	"github.com/gethomeport/homeport/internal/share"
 	"github.com/gethomeport/homeport/internal/stats"
 	"github.com/gethomeport/homeport/internal/store"
 	"github.com/gethomeport/homeport/internal/version"
@@ -64,7 +66,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check rate limiting
-	clientIP := auth.GetClientIP(r)
+	clientIP := s.clientIP(r)
 	if s.auth.IsRateLimited(clientIP) {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusTooManyRequests)
@@ -199,6 +201,10 @@ func (s *Server) handleListPorts(w http.ResponseWriter, r *http.Request) {
 		if p.Port == 8080 || p.Port == 8443 {
 			continue // Skip system ports
 		}
+		// Include traffic that hasn't been flushed to the database yet
+		pending := s.usage.Pending(p.Port)
+		p.UsageRequests += pending.Requests
+		p.UsageBytes += pending.Bytes
 		ports = append(ports, p)
 	}
 
@@ -209,6 +215,54 @@ func (s *Server) handleListPorts(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, ports)
 }
 
+// handleUpdatePort names or pins a port. Fields left out are unchanged.
+func (s *Server) handleUpdatePort(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid port")
+		return
+	}
+
+	var req struct {
+		Label  *string `json:"label"`
+		Pinned *bool   `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if _, err := s.store.GetPort(port); err != nil {
+		errorResponse(w, http.StatusNotFound, "port not found")
+		return
+	}
+
+	if req.Label != nil {
+		label := strings.TrimSpace(*req.Label)
+		if len([]rune(label)) > 64 {
+			errorResponse(w, http.StatusBadRequest, "label must be at most 64 characters")
+			return
+		}
+		if err := s.store.SetPortLabel(port, label); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if req.Pinned != nil {
+		if err := s.store.SetPortPinned(port, *req.Pinned); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	p, err := s.store.GetPort(port)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to load port")
+		return
+	}
+	jsonResponse(w, http.StatusOK, p)
+}
+
 // Access log endpoints
 
 func (s *Server) handleAccessLogs(w http.ResponseWriter, r *http.Request) {
@@ -469,15 +523,30 @@ func (s *Server) handleUpdateRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Fields are optional so clients can update one setting without clobbering the others
 	var req struct {
-		StartCommand string `json:"start_command"`
+		StartCommand  *string `json:"start_command"`
+		WakeOnRequest *bool   `json:"wake_on_request"`
+		IdleTimeout   *int    `json:"idle_timeout_minutes"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		errorResponse(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	repo.StartCommand = req.StartCommand
+	if req.StartCommand != nil {
+		repo.StartCommand = *req.StartCommand
+	}
+	if req.WakeOnRequest != nil {
+		repo.WakeOnRequest = *req.WakeOnRequest
+	}
+	if req.IdleTimeout != nil {
+		if *req.IdleTimeout < 0 {
+			errorResponse(w, http.StatusBadRequest, "idle_timeout_minutes must not be negative")
+			return
+		}
+		repo.IdleTimeout = *req.IdleTimeout
+	}
 	repo.UpdatedAt = time.Now()
 
 	if err := s.store.UpdateRepo(repo); err != nil {
@@ -549,9 +618,24 @@ func (s *Server) handleGitHubSearch(w http.ResponseWriter, r *http.Request) {
 // Share endpoints
 
 type ShareRequest struct {
-	Mode      string `json:"mode"`       // "private", "password", "public"
-	Password  string `json:"password"`   // required if mode is "password"
-	ExpiresIn string `json:"expires_in"` // optional: "1h", "24h", "7d", "30d", or empty for never
+	Mode     string `json:"mode"`     // "private", "password", "email", "public"
+	Password string `json:"password"` // required if mode is "password"
+	// required if mode is "email": addresses ("alice@example.com") or domains ("example.com")
+	EmailAllowlist []string `json:"email_allowlist"`
+	ExpiresIn      string   `json:"expires_in"` // optional: "1h", "24h", "7d", "30d", or empty for never
+	// optional IP/CIDR lists; omit to keep the current rules, send [] to clear them
+	IPAllow []string `json:"ip_allow"`
+	IPDeny  []string `json:"ip_deny"`
+	// optional timing: share opens at starts_at (RFC 3339) and/or only during a weekly window
+	StartsAt string               `json:"starts_at"`
+	EndsAt   string               `json:"ends_at"` // absolute alternative to expires_in
+	Schedule *store.ShareSchedule `json:"schedule"`
+	// optional visitor limits; omit to keep the current ones, 0 = unlimited
+	RateLimit  *int   `json:"rate_limit_rps"` // requests per second per client IP
+	QuotaBytes *int64 `json:"quota_bytes"`    // total transfer before the share is paused
+	// optional preview banner for visitors; omit to keep the current setting
+	Banner   *bool `json:"banner"`
+	Feedback *bool `json:"feedback"` // "leave feedback" box in the banner
 }
 
 func (s *Server) handleSharePort(w http.ResponseWriter, r *http.Request) {
@@ -572,8 +656,52 @@ func (s *Server) handleSharePort(w http.ResponseWriter, r *http.Request) {
 		req.Mode = "private"
 	}
 
-	if req.Mode != "private" && req.Mode != "password" && req.Mode != "public" {
-		errorResponse(w, http.StatusBadRequest, "mode must be 'private', 'password', or 'public'")
+	if req.Mode != "private" && req.Mode != "password" && req.Mode != "email" && req.Mode != "public" {
+		errorResponse(w, http.StatusBadRequest, "mode must be 'private', 'password', 'email', or 'public'")
+		return
+	}
+
+	if req.Mode == "email" {
+		if len(req.EmailAllowlist) == 0 {
+			errorResponse(w, http.StatusBadRequest, "email_allowlist is required for email mode")
+			return
+		}
+		if err := share.ValidateEmailAllowlist(req.EmailAllowlist); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.IPAllow != nil || req.IPDeny != nil {
+		if _, err := share.ParseIPRules(req.IPAllow, req.IPDeny); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var startsAt *time.Time
+	if req.StartsAt != "" {
+		t, err := time.Parse(time.RFC3339, req.StartsAt)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid starts_at: use RFC 3339, e.g. 2024-05-01T09:00:00+02:00")
+			return
+		}
+		startsAt = &t
+	}
+	if req.Schedule != nil {
+		if err := share.ValidateSchedule(req.Schedule); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	scheduled := startsAt != nil || req.Schedule != nil
+	if scheduled && req.Mode == "private" {
+		errorResponse(w, http.StatusBadRequest, "starts_at and schedule need a mode other than 'private'")
+		return
+	}
+
+	if (req.RateLimit != nil && *req.RateLimit < 0) || (req.QuotaBytes != nil && *req.QuotaBytes < 0) {
+		errorResponse(w, http.StatusBadRequest, "rate_limit_rps and quota_bytes must not be negative")
 		return
 	}
 
@@ -594,30 +722,112 @@ func (s *Server) handleSharePort(w http.ResponseWriter, r *http.Request) {
 	// Parse expiration
 	var expiresAt *time.Time
 	if req.ExpiresIn != "" {
-		var duration time.Duration
-		switch req.ExpiresIn {
-		case "1h":
-			duration = time.Hour
-		case "24h":
-			duration = 24 * time.Hour
-		case "7d":
-			duration = 7 * 24 * time.Hour
-		case "30d":
-			duration = 30 * 24 * time.Hour
-		default:
-			// Try parsing as a Go duration
-			d, err := time.ParseDuration(req.ExpiresIn)
-			if err != nil {
-				errorResponse(w, http.StatusBadRequest, "invalid expires_in: use '1h', '24h', '7d', '30d', or a valid Go duration")
-				return
-			}
-			duration = d
+		duration, err := parseExpiresIn(req.ExpiresIn)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
 		}
 		t := time.Now().Add(duration)
 		expiresAt = &t
 	}
+	if req.EndsAt != "" {
+		t, err := time.Parse(time.RFC3339, req.EndsAt)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid ends_at: use RFC 3339, e.g. 2024-05-31T18:00:00+02:00")
+			return
+		}
+		expiresAt = &t
+	}
+	if expiresAt != nil && startsAt != nil && !expiresAt.After(*startsAt) {
+		errorResponse(w, http.StatusBadRequest, "the share must end after it starts")
+		return
+	}
 
-	if err := s.store.UpdatePortShare(port, req.Mode, passwordHash, expiresAt); err != nil {
+	// A scheduled share stays private until its window opens
+	scheduledMode := ""
+	currentMode := req.Mode
+	if scheduled {
+		scheduledMode = req.Mode
+		probe := &store.Port{StartsAt: startsAt, Schedule: req.Schedule, ScheduledMode: scheduledMode}
+		if !share.ShareOpen(probe, time.Now()) {
+			currentMode = "private"
+		}
+	}
+
+	if err := s.store.UpdatePortShare(port, currentMode, passwordHash, expiresAt); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.store.UpdatePortSchedule(port, scheduledMode, startsAt, req.Schedule); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.triggerReschedule()
+
+	if req.Mode == "email" {
+		if err := s.store.UpdatePortEmailAllowlist(port, req.EmailAllowlist); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	portInfo, err := s.store.GetPort(port)
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "port not found")
+		return
+	}
+
+	if req.IPAllow != nil || req.IPDeny != nil {
+		allow, deny := portInfo.IPAllow, portInfo.IPDeny
+		if req.IPAllow != nil {
+			allow = req.IPAllow
+		}
+		if req.IPDeny != nil {
+			deny = req.IPDeny
+		}
+		if err := s.store.UpdatePortIPRules(port, allow, deny); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if req.RateLimit != nil || req.QuotaBytes != nil {
+		rateLimit, quota := portInfo.RateLimit, portInfo.QuotaBytes
+		if req.RateLimit != nil {
+			rateLimit = *req.RateLimit
+		}
+		if req.QuotaBytes != nil {
+			quota = *req.QuotaBytes
+		}
+		if err := s.store.UpdatePortLimits(port, rateLimit, quota); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if req.Banner != nil || req.Feedback != nil {
+		banner, feedback := portInfo.Banner, portInfo.BannerFeedback
+		if req.Banner != nil {
+			banner = *req.Banner
+		}
+		if req.Feedback != nil {
+			feedback = *req.Feedback
+		}
+		if err := s.store.UpdatePortBanner(port, banner, feedback); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Each share starts with fresh usage counters (this also un-pauses an over-quota share)
+	if err := s.resetShareUsage(port); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// A new share ID lets analytics tell this share link apart from earlier ones
+	shareID := generateID()
+	if err := s.store.SetPortShareID(port, shareID); err != nil {
 		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -628,17 +838,42 @@ func (s *Server) handleSharePort(w http.ResponseWriter, r *http.Request) {
 	url := s.cfg.ExternalURL + "/" + portStr
 
 	resp := map[string]interface{}{
-		"status": "shared",
-		"mode":   req.Mode,
-		"url":    url,
+		"status":   "shared",
+		"mode":     req.Mode,
+		"url":      url,
+		"share_id": shareID,
 	}
 	if expiresAt != nil {
 		resp["expires_at"] = expiresAt.Format(time.RFC3339)
 	}
+	if scheduled {
+		resp["status"] = "scheduled"
+		resp["active"] = currentMode == req.Mode
+	}
 
 	jsonResponse(w, http.StatusOK, resp)
 }
 
+// parseExpiresIn parses the expires_in of a share: "1h", "24h", "7d",
+// "30d" or a Go duration
+func parseExpiresIn(value string) (time.Duration, error) {
+	switch value {
+	case "1h":
+		return time.Hour, nil
+	case "24h":
+		return 24 * time.Hour, nil
+	case "7d":
+		return 7 * 24 * time.Hour, nil
+	case "30d":
+		return 30 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, errors.New("invalid expires_in: use '1h', '24h', '7d', '30d', or a valid Go duration")
+	}
+	return d, nil
+}
+
 func (s *Server) handleUnsharePort(w http.ResponseWriter, r *http.Request) {
 	portStr := chi.URLParam(r, "port")
 	port, err := strconv.Atoi(portStr)
@@ -648,10 +883,11 @@ func (s *Server) handleUnsharePort(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Reset to private (default)
-	if err := s.store.UpdatePortShare(port, "private", "", nil); err != nil {
+	if err := s.expireShare(port); err != nil {
 		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	s.triggerReschedule()
 
 	activity.LogUnshare(port)
 	jsonResponse(w, http.StatusOK, map[string]string{"status": "unshared"})
@@ -1129,4 +1365,3 @@ func (s *Server) handleGitPush(w http.ResponseWriter, r *http.Request) {
 		"message": "Pushed successfully",
 	})
 }
-
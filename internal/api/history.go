@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+const (
+	// defaultHistoryLimit and maxHistoryLimit bound the limit query parameter
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// commandInfo is a command from the history as listed by the API, with the
+// command line that runs it again from the same directory
+type commandInfo struct {
+	store.TerminalCommand
+	Rerun    string `json:"rerun"`
+	RerunURL string `json:"rerun_url"` // opens a new terminal running Rerun
+}
+
+func (s *Server) commandInfo(c store.TerminalCommand) commandInfo {
+	rerun := c.Command
+	if c.Cwd != "" {
+		rerun = "cd " + shellQuote(c.Cwd) + " && " + c.Command
+	}
+	return commandInfo{
+		TerminalCommand: c,
+		Rerun:           rerun,
+		RerunURL:        s.cfg.ExternalURL + "/terminal/" + url.PathEscape(c.RepoID) + "?cmd=" + url.QueryEscape(rerun),
+	}
+}
+
+// shellQuote quotes a string for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// handleCommandHistory searches the commands run in terminals: repo limits
+// it to one repo, q matches part of the command line, failed=true keeps
+// commands that exited non-zero and range (24h, 7d) how far back to look
+func (s *Server) handleCommandHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := store.CommandQuery{
+		RepoID: query.Get("repo"),
+		Text:   query.Get("q"),
+		Failed: query.Get("failed") == "true",
+		Limit:  defaultHistoryLimit,
+	}
+	if v := query.Get("range"); v != "" {
+		span, err := parseRange(v)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		q.Since = time.Now().Add(-span)
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			errorResponse(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxHistoryLimit))
+			return
+		}
+		q.Limit = limit
+	}
+
+	commands, err := s.store.ListTerminalCommands(q)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := []commandInfo{}
+	for _, c := range commands {
+		result = append(result, s.commandInfo(c))
+	}
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// handleGetCommand returns a single command from the history
+func (s *Server) handleGetCommand(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid command id")
+		return
+	}
+	c, err := s.store.GetTerminalCommand(id)
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "command not found")
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.commandInfo(*c))
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/jobs"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+const (
+	// defaultJobsLimit and maxJobsLimit bound the limit query parameter
+	defaultJobsLimit = 20
+	maxJobsLimit     = 500
+)
+
+// jobInfo is a job as returned by the API. The duration of a running job is
+// as of now.
+type jobInfo struct {
+	store.ExecJob
+	Duration float64 `json:"duration"` // Seconds
+}
+
+func newJobInfo(job store.ExecJob) jobInfo {
+	end := time.Now()
+	if job.FinishedAt != nil {
+		end = *job.FinishedAt
+	}
+	return jobInfo{ExecJob: job, Duration: end.Sub(job.StartedAt).Seconds()}
+}
+
+// handleListJobs lists jobs, newest first; repo limits it to one repo
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	limit := defaultJobsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxJobsLimit {
+			errorResponse(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxJobsLimit))
+			return
+		}
+		limit = n
+	}
+
+	list, err := s.jobs.List(r.URL.Query().Get("repo"), limit)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := []jobInfo{}
+	for _, job := range list {
+		result = append(result, newJobInfo(job))
+	}
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// handleStartJob runs a command in a repo with sh. Output is read from the
+// job's stream.
+func (s *Server) handleStartJob(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.RemoteExec {
+		errorResponse(w, http.StatusForbidden, "remote exec is disabled; set remote_exec: true in homeport.yaml to allow it")
+		return
+	}
+
+	var req struct {
+		Repo    string `json:"repo"`
+		Command string `json:"command"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		errorResponse(w, http.StatusBadRequest, "command is required")
+		return
+	}
+	repoData, err := s.store.GetRepo(req.Repo)
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "repo not found")
+		return
+	}
+
+	job, err := s.jobs.Start(repoData.ID, repoData.Path, req.Command)
+	if errors.Is(err, jobs.ErrTooMany) {
+		errorResponse(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusCreated, newJobInfo(*job))
+}
+
+// handleGetJob returns a single job
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, newJobInfo(*job))
+}
+
+// handleCancelJob stops a running job. The job's stream ends once it has
+// exited.
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	err := s.jobs.Cancel(chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		errorResponse(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrFinished):
+		errorResponse(w, http.StatusConflict, err.Error())
+	case err != nil:
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleJobStream streams a job's output from the start as server-sent
+// events: "stdout" and "stderr" events carry a JSON string, and a final
+// "exit" event carries the finished job.
+func (s *Server) handleJobStream(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.jobs.Get(id); err != nil {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Tell nginx-style proxies not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	job, err := s.jobs.Follow(r.Context(), id, func(c jobs.Chunk) error {
+		var err error
+		if c.Stream == "" {
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+		} else {
+			data, _ := json.Marshal(c.Data)
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", c.Stream, data)
+		}
+		flush()
+		return err
+	})
+	if err != nil {
+		return
+	}
+	data, _ := json.Marshal(newJobInfo(*job))
+	fmt.Fprintf(w, "event: exit\ndata: %s\n\n", data)
+	flush()
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gethomeport/homeport/internal/activity"
+	"github.com/gethomeport/homeport/internal/ratelimit"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+// throttleLogInterval limits how often rate limiting is written to the activity log
+const throttleLogInterval = time.Minute
+
+// checkShareLimits enforces a share's rate limit and transfer quota for a
+// visitor request. It writes the error response and returns false if the
+// request must not be served.
+func (s *Server) checkShareLimits(w http.ResponseWriter, portInfo *store.Port, clientIP string) bool {
+	port := portInfo.Port
+
+	if s.quotaExhausted(portInfo) {
+		s.pauseShare(portInfo, portInfo.UsageBytes+s.usage.Pending(port).Bytes)
+		http.Error(w, "This share has used its transfer quota", http.StatusTooManyRequests)
+		return false
+	}
+
+	if ok, wait := s.limiter.Allow(port, clientIP, portInfo.RateLimit); !ok {
+		if time.Since(s.throttled.LastSeen(port)) > throttleLogInterval {
+			s.throttled.Touch(port)
+			activity.LogRateLimited(port, clientIP)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
+
+// quotaExhausted reports whether a share has used up its transfer quota,
+// counting usage not yet written to the store
+func (s *Server) quotaExhausted(portInfo *store.Port) bool {
+	return portInfo.QuotaBytes > 0 && portInfo.UsageBytes+s.usage.Pending(portInfo.Port).Bytes >= portInfo.QuotaBytes
+}
+
+// pauseShare makes a share private once it has used up its quota, keeping
+// its password, expiry and other settings. Sharing it again resets the usage
+// counters.
+func (s *Server) pauseShare(portInfo *store.Port, used int64) {
+	if err := s.store.SetPortShareMode(portInfo.Port, "private"); err != nil {
+		log.Printf("Failed to pause share on port %d: %v", portInfo.Port, err)
+		return
+	}
+	log.Printf("Paused share on port %d: %s of %s quota used", portInfo.Port, formatBytes(used), formatBytes(portInfo.QuotaBytes))
+	activity.LogSharePaused(portInfo.Port, fmt.Sprintf("%s transfer quota used", formatBytes(portInfo.QuotaBytes)))
+}
+
+// serveCounted serves a request, measuring the response. Visitor traffic
+// is added to the share's usage; the owner's own requests are not.
+func (s *Server) serveCounted(w http.ResponseWriter, r *http.Request, port int, next http.Handler, visitor bool) *ratelimit.CountingWriter {
+	cw := &ratelimit.CountingWriter{ResponseWriter: w}
+	next.ServeHTTP(cw, r)
+	if visitor {
+		s.usage.Add(port, cw.Bytes)
+	}
+	return cw
+}
+
+// flushUsage writes in-memory usage counters to the store
+func (s *Server) flushUsage() {
+	for port, c := range s.usage.Flush() {
+		if err := s.store.AddPortUsage(port, c.Requests, c.Bytes); err != nil {
+			log.Printf("Failed to save usage for port %d: %v", port, err)
+		}
+	}
+}
+
+// resetShareUsage clears a port's counters and rate limit state (a new share starts fresh)
+func (s *Server) resetShareUsage(port int) error {
+	s.usage.Discard(port)
+	s.limiter.Reset(port)
+	return s.store.ResetPortUsage(port)
+}
+
+// formatBytes renders a byte count like "1.5 GB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
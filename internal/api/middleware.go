@@ -1,6 +1,8 @@
 package api
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -32,92 +34,179 @@ func (s *Server) portAuthMiddleware(next http.Handler) http.Handler {
 		// Get port info
 		portInfo, err := s.store.GetPort(port)
 		if err != nil {
-			http.Error(w, "Port not found - is a dev server running?", http.StatusNotFound)
+			portInfo = nil
+		}
+		// Only wake a sleeping dev server for requests allowed to reach it
+		if (portInfo == nil || portInfo.Offline) && s.portAccessible(r, portInfo) && s.wakePort(r.Context(), port) {
+			// Dev server was asleep - it's up now, so look the port up again
+			portInfo, err = s.store.GetPort(port)
+		}
+		if err != nil {
+			s.servePortOffline(w, r, port, http.StatusNotFound, "Port not found - is a dev server running?")
 			return
 		}
 
 		// Check if share has expired (treat as private if expired)
 		if portInfo.ExpiresAt != nil && time.Now().After(*portInfo.ExpiresAt) {
-			// Share expired - reset to private
-			_ = s.store.UpdatePortShare(port, "private", "", nil)
+			// Share expired - reset to private (the scheduler normally does this on time)
+			_ = s.expireShare(port)
 			portInfo.ShareMode = "private"
 		}
 
-		clientIP := getClientIP(r)
+		clientIP := s.clientIP(r)
 		userAgent := r.UserAgent()
+		isOwner := s.isOwner(r)
+
+		if !s.ipAllowed(r, portInfo, clientIP) {
+			http.Error(w, "Access from your network is not allowed", http.StatusForbidden)
+			return
+		}
+
+		// Rate limits and quotas protect shares from visitors, not the owner
+		if !isOwner && portInfo.ShareMode != "private" && !s.checkShareLimits(w, portInfo, clientIP) {
+			return
+		}
+
+		// grant serves the request and logs it, counting visitor traffic
+		grant := func(authenticated bool, identity string) {
+			r := r.WithContext(withVisitor(r.Context(), &visitor{port: portInfo, identity: identity, owner: isOwner}))
+			cw := s.serveCounted(w, r, port, next, !isOwner)
+			s.store.LogAccess(&store.AccessLog{
+				Port:          port,
+				IP:            clientIP,
+				UserAgent:     userAgent,
+				Authenticated: authenticated,
+				Identity:      identity,
+				Path:          portRelativePath(r, port),
+				Status:        cw.Status,
+				Referrer:      stripQuery(r.Referer()),
+				Bytes:         cw.Bytes,
+				ShareMode:     portInfo.ShareMode,
+				ShareID:       portInfo.ShareID,
+			})
+		}
 
 		// Check sharing mode
 		switch portInfo.ShareMode {
 		case "public":
 			// No auth required - log access and continue
-			s.store.LogAccess(port, clientIP, userAgent, false)
-			next.ServeHTTP(w, r)
-
-		case "private":
-			// Check for valid homeport session cookie (same as main app auth)
-			cookie, err := r.Cookie(auth.SessionCookieName)
-			if err == nil && s.auth.ValidateSession(cookie.Value) {
-				s.store.LogAccess(port, clientIP, userAgent, true)
-				next.ServeHTTP(w, r)
-				return
-			}
-			// Not authenticated - redirect to login
-			http.Redirect(w, r, "/login?next="+r.URL.Path, http.StatusFound)
+			grant(false, "")
 
 		case "password":
 			// If user has valid Homeport session, grant access automatically (admin bypass)
-			sessionCookie, err := r.Cookie(auth.SessionCookieName)
-			if err == nil && s.auth.ValidateSession(sessionCookie.Value) {
-				s.store.LogAccess(port, clientIP, userAgent, true)
-				next.ServeHTTP(w, r)
+			// Otherwise check for valid port-specific auth cookie (for external users with password)
+			if isOwner || share.ValidateAuthCookie(r, port) {
+				grant(true, "")
 				return
 			}
 
-			// Check for valid port-specific auth cookie (for external users with password)
-			if share.ValidateAuthCookie(r, port) {
-				s.store.LogAccess(port, clientIP, userAgent, true)
-				next.ServeHTTP(w, r)
+			// Not authenticated - show password form or handle form submission
+			s.handlePasswordAuth(w, r, port, portInfo)
+
+		case "email":
+			// Admin bypass, same as password mode
+			if isOwner {
+				grant(true, "")
 				return
 			}
 
-			// Not authenticated - show password form or handle form submission
-			s.handlePasswordAuth(w, r, port, portInfo)
+			// Verified visitor - re-check the allowlist so removed addresses lose access
+			if email, ok := share.ValidateIdentityCookie(r, port); ok && share.EmailAllowed(email, portInfo.EmailAllowlist) {
+				grant(true, email)
+				return
+			}
+
+			// Not authenticated - show email form, send a link or redeem one
+			s.handleEmailAuth(w, r, port, portInfo)
 
 		default:
-			// Unknown mode, treat as private and check session
-			cookie, err := r.Cookie(auth.SessionCookieName)
-			if err == nil && s.auth.ValidateSession(cookie.Value) {
-				s.store.LogAccess(port, clientIP, userAgent, true)
-				next.ServeHTTP(w, r)
+			// "private" (or an unknown mode): only the signed-in owner gets through
+			if isOwner {
+				grant(true, "")
 				return
 			}
+			// Not authenticated - redirect to login
 			http.Redirect(w, r, "/login?next="+r.URL.Path, http.StatusFound)
 		}
 	})
 }
 
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For first (for proxied requests)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		return strings.TrimSpace(parts[0])
+// portAccessible reports whether a request may reach a port, without
+// prompting for anything: the signed-in owner always can, visitors need an
+// open share, an allowed network and the share's password or email sign-in.
+// A port that isn't tracked (nil portInfo) is only for the owner.
+func (s *Server) portAccessible(r *http.Request, portInfo *store.Port) bool {
+	if s.isOwner(r) {
+		return true
+	}
+	if portInfo == nil || !s.ipAllowed(r, portInfo, s.clientIP(r)) {
+		return false
+	}
+	if portInfo.ExpiresAt != nil && time.Now().After(*portInfo.ExpiresAt) {
+		return false
+	}
+	switch portInfo.ShareMode {
+	case "public":
+		return true
+	case "password":
+		return share.ValidateAuthCookie(r, portInfo.Port)
+	case "email":
+		email, ok := share.ValidateIdentityCookie(r, portInfo.Port)
+		return ok && share.EmailAllowed(email, portInfo.EmailAllowlist)
+	}
+	return false
+}
+
+// portRelativePath returns the request path without the /{port} prefix
+func portRelativePath(r *http.Request, port int) string {
+	path := strings.TrimPrefix(r.URL.Path, "/"+strconv.Itoa(port))
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// stripQuery drops the query string and fragment from a URL, which may carry tokens
+func stripQuery(rawURL string) string {
+	if i := strings.IndexAny(rawURL, "?#"); i != -1 {
+		return rawURL[:i]
+	}
+	return rawURL
+}
+
+// isOwner returns true if the request carries a valid Homeport session cookie
+func (s *Server) isOwner(r *http.Request) bool {
+	cookie, err := r.Cookie(auth.SessionCookieName)
+	return err == nil && s.auth.ValidateSession(cookie.Value)
+}
+
+// clientIP returns the request's client IP, trusting forwarding headers
+// only from configured proxies
+func (s *Server) clientIP(r *http.Request) string {
+	return s.ipResolver.ClientIP(r)
+}
+
+// ipAllowed checks the port's IP allow/deny rules. The signed-in owner
+// bypasses them so they can't lock themselves out of their own share.
+func (s *Server) ipAllowed(r *http.Request, portInfo *store.Port, clientIP string) bool {
+	if len(portInfo.IPAllow) == 0 && len(portInfo.IPDeny) == 0 {
+		return true
 	}
-	// Check CF-Connecting-IP (Cloudflare)
-	if cfIP := r.Header.Get("CF-Connecting-IP"); cfIP != "" {
-		return cfIP
+	if s.isOwner(r) {
+		return true
 	}
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+	rules, err := share.ParseIPRules(portInfo.IPAllow, portInfo.IPDeny)
+	if err != nil {
+		// Fail closed - rules are validated on save, so this means a bad DB row
+		log.Printf("Invalid IP rules for port %d: %v", portInfo.Port, err)
+		return false
 	}
-	return ip
+	return rules.Allows(clientIP)
 }
 
 // handlePasswordAuth shows the password form or validates the submitted password
 func (s *Server) handlePasswordAuth(w http.ResponseWriter, r *http.Request, port int, portInfo *store.Port) {
-	clientIP := getClientIP(r)
+	clientIP := s.clientIP(r)
 
 	// Check rate limiting
 	if share.CheckRateLimit(clientIP) {
@@ -163,3 +252,78 @@ func (s *Server) handlePasswordAuth(w http.ResponseWriter, r *http.Request, port
 	w.WriteHeader(http.StatusUnauthorized)
 	w.Write([]byte(share.PasswordFormHTML(port, "")))
 }
+
+// handleEmailAuth shows the email form, sends magic links and redeems them
+func (s *Server) handleEmailAuth(w http.ResponseWriter, r *http.Request, port int, portInfo *store.Port) {
+	base := "/" + strconv.Itoa(port)
+
+	// Redeem a link from the email
+	if r.Method == "GET" && r.URL.Path == base+"/_auth/verify" {
+		email, ok := share.ConsumeMagicLink(r.URL.Query().Get("token"), port)
+		if !ok || !share.EmailAllowed(email, portInfo.EmailAllowlist) {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(share.EmailFormHTML(port, "This login link is invalid or has expired. Request a new one.", "")))
+			return
+		}
+
+		share.SetIdentityCookie(w, r, port, email, 24*time.Hour)
+		http.Redirect(w, r, base+"/", http.StatusSeeOther)
+		return
+	}
+
+	// Request a link
+	if r.Method == "POST" && r.URL.Path == base+"/_auth" {
+		clientIP := s.clientIP(r)
+
+		// Every request counts against the limit so the form can't be used to spam inboxes
+		if share.CheckRateLimit(clientIP) {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(share.EmailFormHTML(port, "Too many attempts. Please try again later.", "")))
+			return
+		}
+		share.RecordFailedAttempt(clientIP)
+
+		email, err := share.NormalizeEmail(r.FormValue("email"))
+		if err != nil {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(share.EmailFormHTML(port, "Enter a valid email address", "")))
+			return
+		}
+
+		if share.EmailAllowed(email, portInfo.EmailAllowlist) {
+			if err := s.sendMagicLink(port, email); err != nil {
+				log.Printf("Failed to send login link for port %d to %s: %v", port, email, err)
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(share.EmailFormHTML(port, "Couldn't send the login link. Please try again later.", "")))
+				return
+			}
+		}
+
+		// Same response either way so the allowlist can't be probed
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(share.EmailFormHTML(port, "", "If "+email+" has access, a login link is on its way. It expires in 15 minutes.")))
+		return
+	}
+
+	// Show email form
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(share.EmailFormHTML(port, "", "")))
+}
+
+// sendMagicLink emails a one-time login link for the port
+func (s *Server) sendMagicLink(port int, email string) error {
+	token, err := share.CreateMagicLink(port, email)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/%d/_auth/verify?token=%s", strings.TrimSuffix(s.cfg.ExternalURL, "/"), port, token)
+	subject := fmt.Sprintf("Your login link for port %d", port)
+	body := fmt.Sprintf("Use this link to sign in to the preview on port %d:\n\n%s\n\nThe link works once and expires in 15 minutes. If you didn't ask for it, you can ignore this email.\n", port, link)
+	return s.mailer.Send(email, subject, body)
+}
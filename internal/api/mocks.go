@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/activity"
+	"github.com/gethomeport/homeport/internal/mock"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+// mockProcessName is shown as the process of ports served by a mock
+const mockProcessName = "homeport-mock"
+
+// MockRequest starts a mock server, either from a file on the server or
+// from an inline spec (a JSON object, or YAML/JSON text)
+type MockRequest struct {
+	Port int             `json:"port"`
+	File string          `json:"file,omitempty"`
+	Spec json.RawMessage `json:"spec,omitempty"`
+}
+
+// mocksDir is where inline mock specs are written
+func (s *Server) mocksDir() string {
+	return filepath.Join(s.cfg.DataDir, "mocks")
+}
+
+// restoreMocks restarts the mocks that were running when homeport stopped
+func (s *Server) restoreMocks() {
+	mocks, err := s.store.ListMocks()
+	if err != nil {
+		log.Printf("Warning: failed to list mocks: %v", err)
+		return
+	}
+	for _, m := range mocks {
+		if _, err := s.mocks.Start(m.Port, m.File); err != nil {
+			log.Printf("Warning: failed to restore mock on port %d: %v", m.Port, err)
+		}
+	}
+}
+
+// handleListMocks returns the running mocks
+func (s *Server) handleListMocks(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, s.mocks.List())
+}
+
+// handleStartMock starts a mock server on a port in the configured range
+func (s *Server) handleStartMock(w http.ResponseWriter, r *http.Request) {
+	var req MockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Port < s.cfg.PortRangeMin || req.Port > s.cfg.PortRangeMax {
+		errorResponse(w, http.StatusBadRequest, "port must be between "+strconv.Itoa(s.cfg.PortRangeMin)+" and "+strconv.Itoa(s.cfg.PortRangeMax))
+		return
+	}
+	if (req.File == "") == (len(req.Spec) == 0) {
+		errorResponse(w, http.StatusBadRequest, "either file or spec is required")
+		return
+	}
+	if s.mocks.Get(req.Port) != nil {
+		errorResponse(w, http.StatusConflict, "a mock is already running on port "+strconv.Itoa(req.Port))
+		return
+	}
+
+	file := req.File
+	if file != "" {
+		if !filepath.IsAbs(file) {
+			errorResponse(w, http.StatusBadRequest, "file must be an absolute path")
+			return
+		}
+		if _, err := mock.LoadFile(file); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		data := []byte(req.Spec)
+		var text string
+		if json.Unmarshal(req.Spec, &text) == nil {
+			data = []byte(text)
+		}
+		if _, err := mock.Parse(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := os.MkdirAll(s.mocksDir(), 0755); err != nil {
+			errorResponse(w, http.StatusInternalServerError, "failed to save mock")
+			return
+		}
+		file = filepath.Join(s.mocksDir(), strconv.Itoa(req.Port)+".yaml")
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			errorResponse(w, http.StatusInternalServerError, "failed to save mock")
+			return
+		}
+	}
+
+	srv, err := s.mocks.Start(req.Port, file)
+	if err != nil {
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err := s.store.SaveMock(&store.Mock{Port: req.Port, File: file}); err != nil {
+		log.Printf("Warning: failed to save mock on port %d: %v", req.Port, err)
+	}
+	activity.LogMockStart(req.Port, file)
+
+	// Show the port right away instead of waiting for the next scan
+	go s.doScan()
+
+	jsonResponse(w, http.StatusCreated, srv.Info())
+}
+
+// handleStopMock stops the mock on a port
+func (s *Server) handleStopMock(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid port")
+		return
+	}
+
+	srv := s.mocks.Get(port)
+	if srv == nil {
+		errorResponse(w, http.StatusNotFound, "no mock running on port "+strconv.Itoa(port))
+		return
+	}
+	if err := s.mocks.Stop(port); err != nil {
+		log.Printf("Mock on port %d: %v", port, err)
+	}
+	if err := s.store.DeleteMock(port); err != nil {
+		log.Printf("Warning: failed to delete mock on port %d: %v", port, err)
+	}
+	// Inline specs belong to homeport; files the user pointed at are left alone
+	if filepath.Dir(srv.File) == s.mocksDir() {
+		if err := os.Remove(srv.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: failed to remove %s: %v", srv.File, err)
+		}
+	}
+	activity.LogMockStop(port)
+
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "stopped"})
+}
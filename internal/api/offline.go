@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/activity"
+	"github.com/gethomeport/homeport/internal/auth"
+	"github.com/gethomeport/homeport/internal/share"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+// portWaitTimeout is how long a single long-poll waits for a port to come up.
+// Kept below the 30s request timeout middleware.
+const portWaitTimeout = 20 * time.Second
+
+// hasValidSession returns true if the request carries a valid Homeport login
+func (s *Server) hasValidSession(r *http.Request) bool {
+	if !s.auth.IsConfigured() {
+		return true
+	}
+	cookie, err := r.Cookie(auth.SessionCookieName)
+	return err == nil && s.auth.ValidateSession(cookie.Value)
+}
+
+// repoForPort finds the repo that serves (or last served) a port
+func (s *Server) repoForPort(port int) *store.Repo {
+	repoID := ""
+	if portInfo, err := s.store.GetPort(port); err == nil {
+		repoID = portInfo.RepoID
+	}
+	if repoID == "" {
+		repoID, _ = s.store.GetLastRepoForPort(port)
+	}
+	if repoID == "" {
+		return nil
+	}
+	repo, err := s.store.GetRepo(repoID)
+	if err != nil {
+		return nil
+	}
+	return repo
+}
+
+// servePortOffline renders the "server starting" interstitial for browser
+// navigations, and falls back to a plain error for assets and API calls
+func (s *Server) servePortOffline(w http.ResponseWriter, r *http.Request, port int, status int, message string) {
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, message, status)
+		return
+	}
+
+	// Visitors only learn the port number, not which repo serves it
+	repoName := ""
+	canStart := false
+	if s.hasValidSession(r) {
+		if repo := s.repoForPort(port); repo != nil {
+			repoName = repo.Name
+			canStart = repo.StartCommand != ""
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write([]byte(share.OfflinePageHTML(port, repoName, canStart)))
+}
+
+// portListening checks whether something accepts connections on localhost:{port}
+func portListening(port int) bool {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", port), 500*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// waitForPort polls until the port is listening, the timeout passes or ctx is done
+func waitForPort(ctx context.Context, port int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if portListening(port) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// parseProxyPort reads the {port} URL param and checks it against the configured range
+func (s *Server) parseProxyPort(r *http.Request) (int, error) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid port")
+	}
+	if port < s.cfg.PortRangeMin || port > s.cfg.PortRangeMax {
+		return 0, fmt.Errorf("port out of range")
+	}
+	return port, nil
+}
+
+// handlePortWait long-polls until the port is listening. Only requests
+// that may reach the port get an answer.
+// GET /{port}/_homeport/wait
+func (s *Server) handlePortWait(w http.ResponseWriter, r *http.Request) {
+	port, err := s.parseProxyPort(r)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	portInfo, err := s.store.GetPort(port)
+	if err != nil {
+		portInfo = nil
+	}
+	if !s.portAccessible(r, portInfo) {
+		errorResponse(w, http.StatusForbidden, "not allowed to access this port")
+		return
+	}
+
+	ready := waitForPort(r.Context(), port, portWaitTimeout)
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, http.StatusOK, map[string]bool{"ready": ready})
+}
+
+// handlePortStart starts the dev server of the repo that owns the port.
+// Only signed-in owners may do this.
+// POST /{port}/_homeport/start
+func (s *Server) handlePortStart(w http.ResponseWriter, r *http.Request) {
+	port, err := s.parseProxyPort(r)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !s.hasValidSession(r) {
+		errorResponse(w, http.StatusUnauthorized, "Sign in to Homeport to start this server")
+		return
+	}
+
+	repo := s.repoForPort(port)
+	if repo == nil {
+		errorResponse(w, http.StatusNotFound, "no repo is associated with this port")
+		return
+	}
+	if repo.StartCommand == "" {
+		errorResponse(w, http.StatusBadRequest, "no start command configured for this repo")
+		return
+	}
+
+	if proc := s.procs.Get(repo.ID); proc != nil && proc.Status == "running" {
+		jsonResponse(w, http.StatusOK, proc)
+		return
+	}
+
+	proc, err := s.procs.Start(repo.ID, repo.Name, repo.Path, repo.StartCommand)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	activity.LogStart(repo.ID, repo.Name)
+	jsonResponse(w, http.StatusOK, proc)
+}
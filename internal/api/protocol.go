@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/probe"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+// portProtocols are the values accepted as a protocol override
+var portProtocols = map[string]bool{probe.HTTP: true, probe.H2C: true, probe.GRPC: true}
+
+// fingerprintPorts probes ports whose process changed since they were last
+// probed. Probes run in the background so a slow port can't stall the scan.
+func (s *Server) fingerprintPorts(ports []store.Port) {
+	s.probedMu.Lock()
+	defer s.probedMu.Unlock()
+
+	seen := make(map[int]bool, len(ports))
+	for _, p := range ports {
+		seen[p.Port] = true
+		if pid, ok := s.probed[p.Port]; ok && pid == p.PID {
+			continue
+		}
+		s.probed[p.Port] = p.PID
+
+		go func(port int, host string) {
+			fp := probe.Fingerprint(host, port)
+			err := s.store.SetPortFingerprint(&store.Port{
+				Port:      port,
+				Protocol:  fp.Protocol,
+				Title:     fp.Title,
+				Favicon:   fp.Favicon,
+				Server:    fp.Server,
+				Framework: fp.Framework,
+			})
+			if err != nil {
+				log.Printf("Failed to save fingerprint for port %d: %v", port, err)
+			}
+		}(p.Port, p.DialHost())
+	}
+
+	// Forget ports that went away so they are probed again when they return
+	for port := range s.probed {
+		if !seen[port] {
+			delete(s.probed, port)
+		}
+	}
+}
+
+// proxyHTTP2 reports whether the proxy should speak h2c to a port
+func proxyHTTP2(p *store.Port) bool {
+	if p == nil {
+		return false
+	}
+	protocol := p.ProxyProtocol()
+	return protocol == probe.H2C || protocol == probe.GRPC
+}
+
+// dialHost is the address the proxy connects to for a port ("" for localhost)
+func dialHost(p *store.Port) string {
+	if p == nil {
+		return ""
+	}
+	return p.DialHost()
+}
+
+// portForRequest returns the port info portAuthMiddleware looked up, or
+// reads it from the store
+func (s *Server) portForRequest(r *http.Request, port int) *store.Port {
+	if v := visitorFromContext(r.Context()); v != nil && v.port != nil && v.port.Port == port {
+		return v.port
+	}
+	p, err := s.store.GetPort(port)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// handleSetPortProtocol overrides protocol detection for a port
+func (s *Server) handleSetPortProtocol(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid port")
+		return
+	}
+
+	var req struct {
+		Protocol string `json:"protocol"` // "auto", "http", "h2c" or "grpc"
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Protocol == "auto" {
+		req.Protocol = ""
+	}
+	if req.Protocol != "" && !portProtocols[req.Protocol] {
+		errorResponse(w, http.StatusBadRequest, "protocol must be 'auto', 'http', 'h2c' or 'grpc'")
+		return
+	}
+
+	if _, err := s.store.GetPort(port); err != nil {
+		errorResponse(w, http.StatusNotFound, "port not found")
+		return
+	}
+	if err := s.store.SetPortProtocolOverride(port, req.Protocol); err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to update protocol")
+		return
+	}
+
+	p, err := s.store.GetPort(port)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "failed to load port")
+		return
+	}
+	jsonResponse(w, http.StatusOK, p)
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/store"
+	"github.com/gethomeport/homeport/internal/terminal"
+)
+
+const (
+	// recordingRetentionInterval is how often expired recordings are deleted
+	recordingRetentionInterval = time.Hour
+	// maxPlaybackSpeed bounds the speed query parameter of playback
+	maxPlaybackSpeed = 100
+)
+
+// recordingRetentionLoop periodically deletes recordings past the retention period
+func (s *Server) recordingRetentionLoop() {
+	if s.cfg.RecordingRetentionDays <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(recordingRetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().AddDate(0, 0, -s.cfg.RecordingRetentionDays)
+		n, err := s.termMgr.PruneRecordings(cutoff)
+		if err != nil {
+			log.Printf("Failed to delete old terminal recordings: %v", err)
+		} else if n > 0 {
+			log.Printf("Deleted %d terminal recordings older than %d days", n, s.cfg.RecordingRetentionDays)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.stopScan:
+			return
+		}
+	}
+}
+
+// recordingInfo is a recording as listed by the API. Size and duration of a
+// recording in progress are as of now.
+type recordingInfo struct {
+	store.TerminalRecording
+	Duration  float64 `json:"duration"` // Seconds
+	Recording bool    `json:"recording"`
+}
+
+func (s *Server) recordingInfo(rec store.TerminalRecording) recordingInfo {
+	info := recordingInfo{TerminalRecording: rec}
+	if rec.EndedAt != nil {
+		info.Duration = rec.EndedAt.Sub(rec.StartedAt).Seconds()
+		return info
+	}
+	info.Recording = true
+	info.Duration = time.Since(rec.StartedAt).Seconds()
+	if stat, err := os.Stat(s.termMgr.RecordingPath(rec.ID)); err == nil {
+		info.Size = stat.Size()
+	}
+	return info
+}
+
+// handleListRecordings lists terminal recordings, optionally of one repo (?repo=)
+func (s *Server) handleListRecordings(w http.ResponseWriter, r *http.Request) {
+	recordings, err := s.store.ListTerminalRecordings(r.URL.Query().Get("repo"))
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := []recordingInfo{}
+	for _, rec := range recordings {
+		result = append(result, s.recordingInfo(rec))
+	}
+	jsonResponse(w, http.StatusOK, result)
+}
+
+// handleDownloadRecording serves a recording as an asciicast v2 file
+func (s *Server) handleDownloadRecording(w http.ResponseWriter, r *http.Request) {
+	rec, err := s.store.GetTerminalRecording(chi.URLParam(r, "id"))
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "recording not found")
+		return
+	}
+
+	file, err := os.Open(s.termMgr.RecordingPath(rec.ID))
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "recording file is missing")
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("%s-%s.cast", rec.RepoID, rec.StartedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, stat.ModTime(), file)
+}
+
+// handleDeleteRecording deletes a recording, stopping it if it's in progress
+func (s *Server) handleDeleteRecording(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := s.store.GetTerminalRecording(id); err != nil {
+		errorResponse(w, http.StatusNotFound, "recording not found")
+		return
+	}
+	if err := s.termMgr.DeleteRecording(id); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// isRecordingPlayback matches GET /api/recordings/{id}/play, which streams
+// for as long as the recording lasts and so can't be under the request timeout
+func isRecordingPlayback(r *http.Request) bool {
+	id, ok := strings.CutPrefix(r.URL.Path, "/api/recordings/")
+	return ok && r.Method == http.MethodGet && strings.HasSuffix(id, "/play") && strings.Count(id, "/") == 1
+}
+
+// handlePlayRecording streams a recording back in real time. By default the
+// body is the raw terminal output, so `curl -N` replays it in a terminal;
+// with format=cast it is asciicast v2 with event times as played back.
+// speed scales playback (2 is twice as fast) and idle caps pauses, in
+// seconds.
+func (s *Server) handlePlayRecording(w http.ResponseWriter, r *http.Request) {
+	rec, err := s.store.GetTerminalRecording(chi.URLParam(r, "id"))
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "recording not found")
+		return
+	}
+
+	query := r.URL.Query()
+	speed := 1.0
+	if v := query.Get("speed"); v != "" {
+		speed, err = strconv.ParseFloat(v, 64)
+		if err != nil || speed <= 0 || speed > maxPlaybackSpeed {
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("speed must be above 0 and at most %d", maxPlaybackSpeed))
+			return
+		}
+	}
+	var idle float64
+	if v := query.Get("idle"); v != "" {
+		idle, err = strconv.ParseFloat(v, 64)
+		if err != nil || idle < 0 {
+			errorResponse(w, http.StatusBadRequest, "idle must be a number of seconds")
+			return
+		}
+	}
+	format := query.Get("format")
+	if format != "" && format != "raw" && format != "cast" {
+		errorResponse(w, http.StatusBadRequest, "format must be raw or cast")
+		return
+	}
+
+	file, err := os.Open(s.termMgr.RecordingPath(rec.ID))
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "recording file is missing")
+		return
+	}
+	defer file.Close()
+	cast, err := terminal.NewCastReader(file)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if format == "cast" {
+		w.Header().Set("Content-Type", "application/x-asciicast")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	flusher, _ := w.(http.Flusher)
+
+	if format == "cast" {
+		header, _ := json.Marshal(cast.Header)
+		w.Write(append(header, '\n'))
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	var last, played float64
+	for {
+		ev, err := cast.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Failed to read recording %s: %v", rec.ID, err)
+			}
+			return
+		}
+
+		delay := max(ev.Time-last, 0)
+		last = ev.Time
+		if idle > 0 {
+			delay = min(delay, idle)
+		}
+		delay /= speed
+		played += delay
+
+		if delay > 0.001 {
+			if flusher != nil {
+				flusher.Flush()
+			}
+			timer.Reset(time.Duration(delay * float64(time.Second)))
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		switch {
+		case format == "cast":
+			ev.Time = played
+			line, _ := json.Marshal(ev)
+			_, err = w.Write(append(line, '\n'))
+		case ev.Code == "o":
+			_, err = io.WriteString(w, ev.Data)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handleStartRecording starts recording a terminal session
+func (s *Server) handleStartRecording(w http.ResponseWriter, r *http.Request) {
+	session := s.termMgr.GetSession(chi.URLParam(r, "sessionId"))
+	if session == nil || session.IsClosed() {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	rec, err := s.termMgr.StartRecording(session)
+	if errors.Is(err, terminal.ErrRecording) {
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.recordingInfo(*rec))
+}
+
+// handleStopRecording stops recording a terminal session
+func (s *Server) handleStopRecording(w http.ResponseWriter, r *http.Request) {
+	session := s.termMgr.GetSession(chi.URLParam(r, "sessionId"))
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+	id := session.RecordingID()
+	if id == "" {
+		errorResponse(w, http.StatusNotFound, "session is not being recorded")
+		return
+	}
+
+	s.termMgr.StopRecording(session)
+	rec, err := s.store.GetTerminalRecording(id)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.recordingInfo(*rec))
+}
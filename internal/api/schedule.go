@@ -0,0 +1,119 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/gethomeport/homeport/internal/activity"
+	"github.com/gethomeport/homeport/internal/share"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+// maxScheduleSleep bounds how long the scheduler sleeps, so it recovers
+// from clock changes and ports that appear without a reschedule signal
+const maxScheduleSleep = 5 * time.Minute
+
+// scheduleLoop opens, closes and expires shares at their scheduled times
+func (s *Server) scheduleLoop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-s.reschedule:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-s.stopScan:
+			return
+		}
+
+		next := s.applySchedules(time.Now())
+		timer.Reset(next)
+	}
+}
+
+// triggerReschedule wakes the scheduler after a share's timing changed
+func (s *Server) triggerReschedule() {
+	select {
+	case s.reschedule <- struct{}{}:
+	default:
+	}
+}
+
+// applySchedules moves every port to the mode its schedule calls for and
+// returns how long to sleep until the next transition
+func (s *Server) applySchedules(now time.Time) time.Duration {
+	ports, err := s.store.ListPorts()
+	if err != nil {
+		log.Printf("Scheduler: failed to list ports: %v", err)
+		return maxScheduleSleep
+	}
+
+	sleep := maxScheduleSleep
+	for i := range ports {
+		p := &ports[i]
+		s.applySchedule(p, now)
+
+		if next, ok := share.NextShareChange(p, now); ok {
+			if d := next.Sub(now); d < sleep {
+				sleep = d
+			}
+		}
+	}
+	if sleep < 0 {
+		sleep = 0
+	}
+	return sleep
+}
+
+// applySchedule updates a single port's share mode for the current time
+func (s *Server) applySchedule(p *store.Port, now time.Time) {
+	if p.ExpiresAt != nil && !now.Before(*p.ExpiresAt) {
+		if err := s.expireShare(p.Port); err != nil {
+			log.Printf("Scheduler: failed to expire share on port %d: %v", p.Port, err)
+			return
+		}
+		if p.ShareMode != "private" || p.ScheduledMode != "" {
+			activity.LogShareExpired(p.Port)
+		}
+		p.ShareMode, p.ScheduledMode, p.ExpiresAt, p.StartsAt, p.Schedule = "private", "", nil, nil, nil
+		return
+	}
+
+	if p.ScheduledMode == "" {
+		return
+	}
+
+	want := "private"
+	if share.ShareOpen(p, now) {
+		want = p.ScheduledMode
+	}
+	if want == p.ShareMode {
+		return
+	}
+	// A share paused over its quota stays private until it is shared again,
+	// which resets the usage
+	if want != "private" && s.quotaExhausted(p) {
+		return
+	}
+
+	if err := s.store.SetPortShareMode(p.Port, want); err != nil {
+		log.Printf("Scheduler: failed to set port %d to %s: %v", p.Port, want, err)
+		return
+	}
+	activity.LogScheduleChange(p.Port, p.ShareMode, want)
+	p.ShareMode = want
+}
+
+// expireShare resets a port to private and clears its expiry and schedule
+func (s *Server) expireShare(port int) error {
+	if err := s.store.UpdatePortShare(port, "private", "", nil); err != nil {
+		return err
+	}
+	return s.store.UpdatePortSchedule(port, "", nil, nil)
+}
@@ -6,24 +6,35 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/gethomeport/homeport/internal/auth"
+	"github.com/gethomeport/homeport/internal/clientip"
 	"github.com/gethomeport/homeport/internal/config"
+	"github.com/gethomeport/homeport/internal/docker"
 	"github.com/gethomeport/homeport/internal/github"
+	"github.com/gethomeport/homeport/internal/jobs"
+	"github.com/gethomeport/homeport/internal/mailer"
+	"github.com/gethomeport/homeport/internal/mock"
 	"github.com/gethomeport/homeport/internal/process"
 	"github.com/gethomeport/homeport/internal/proxy"
+	"github.com/gethomeport/homeport/internal/ratelimit"
 	"github.com/gethomeport/homeport/internal/scanner"
 	"github.com/gethomeport/homeport/internal/share"
+	"github.com/gethomeport/homeport/internal/static"
 	"github.com/gethomeport/homeport/internal/store"
 	"github.com/gethomeport/homeport/internal/terminal"
 	"github.com/gethomeport/homeport/internal/version"
@@ -37,27 +48,83 @@ func generateID() string {
 }
 
 type Server struct {
-	cfg      *config.Config
-	store    *store.Store
-	scanner  *scanner.Scanner
-	github   *github.Client
-	procs    *process.Manager
-	auth     *auth.Auth
-	termMgr  *terminal.Manager
-	router   chi.Router
-	stopScan chan struct{}
+	cfg        *config.Config
+	store      *store.Store
+	scanner    *scanner.Scanner
+	github     *github.Client
+	procs      *process.Manager
+	auth       *auth.Auth
+	termMgr    *terminal.Manager
+	jobs       *jobs.Manager
+	ipResolver *clientip.Resolver
+	mailer     mailer.Mailer
+	router     chi.Router
+	stopScan   chan struct{}
+	traffic    *trafficTracker
+	wakeMu     sync.Mutex
+	limiter    *ratelimit.Limiter
+	usage      *ratelimit.Usage
+	throttled  *trafficTracker // last time rate limiting was logged per port
+	reschedule chan struct{}
+
+	feedbackLimiter *ratelimit.Limiter
+	mocks           *mock.Manager
+	static          *static.Manager
+
+	probedMu sync.Mutex
+	probed   map[int]int // port -> PID whose protocol was detected
 }
 
 func NewServer(cfg *config.Config, st *store.Store) *Server {
 	s := &Server{
-		cfg:      cfg,
-		store:    st,
-		scanner:  scanner.New(cfg.PortRangeMin, cfg.PortRangeMax, cfg.ReposDir),
-		github:   github.NewClient(cfg.ReposDir),
-		procs:    process.NewManager(),
-		auth:     auth.New(cfg.PasswordHash, cfg.CookieSecret),
-		termMgr:  terminal.NewManager(st),
-		stopScan: make(chan struct{}),
+		cfg:        cfg,
+		store:      st,
+		scanner:    scanner.New(cfg.PortRangeMin, cfg.PortRangeMax, cfg.ReposDir),
+		github:     github.NewClient(cfg.ReposDir),
+		procs:      process.NewManager(),
+		auth:       auth.New(cfg.PasswordHash, cfg.CookieSecret),
+		termMgr:    terminal.NewManager(st, filepath.Join(cfg.DataDir, "terminals"), filepath.Join(cfg.DataDir, "recordings"), cfg.ShellIntegration),
+		jobs:       jobs.NewManager(st, filepath.Join(cfg.DataDir, "jobs")),
+		stopScan:   make(chan struct{}),
+		traffic:    newTrafficTracker(),
+		limiter:    ratelimit.NewLimiter(),
+		usage:      ratelimit.NewUsage(),
+		throttled:  newTrafficTracker(),
+		reschedule: make(chan struct{}, 1),
+
+		feedbackLimiter: ratelimit.NewLimiter(),
+		mocks:           mock.NewManager(),
+		static:          static.NewManager(),
+		probed:          make(map[int]int),
+	}
+
+	resolver, err := clientip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		log.Printf("Warning: %v - only trusting loopback proxies", err)
+		resolver, _ = clientip.NewResolver(config.Default().TrustedProxies)
+	}
+	s.ipResolver = resolver
+
+	m, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Printf("Warning: mail: %v - login links will be written to the log", err)
+		m, _ = mailer.New(config.MailConfig{From: cfg.Mail.From})
+	}
+	s.mailer = m
+
+	ignore, err := scanner.ParseIgnoreRules(cfg.IgnorePorts)
+	if err != nil {
+		log.Printf("Warning: ignore_ports: %v - showing every port", err)
+	}
+	s.scanner.SetIgnoreRules(ignore)
+
+	if cfg.DockerHost != "off" {
+		dc, err := docker.NewClient(cfg.DockerHost)
+		if err != nil {
+			log.Printf("Warning: docker_host: %v - container ports won't be resolved", err)
+		} else {
+			s.scanner.SetDocker(dc)
+		}
 	}
 
 	s.setupRouter()
@@ -70,12 +137,13 @@ func (s *Server) setupRouter() {
 	// Global middleware
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	// Timeout middleware - but skip for WebSocket connections (they're long-lived)
+	// Timeout middleware - but skip for WebSocket connections and event streams (they're long-lived)
 	r.Use(func(next http.Handler) http.Handler {
 		timeout := middleware.Timeout(30 * time.Second)
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip timeout for WebSocket upgrade requests
-			if r.Header.Get("Upgrade") == "websocket" {
+			// Skip timeout for WebSocket upgrades, gRPC streams, server-sent
+			// events and recordings played back in real time
+			if r.Header.Get("Upgrade") == "websocket" || proxy.IsGRPC(r) || r.Header.Get("Accept") == "text/event-stream" || isRecordingPlayback(r) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -89,12 +157,23 @@ func (s *Server) setupRouter() {
 	r.Post("/login", s.handleLogin)
 	r.Get("/logout", s.handleLogout)
 
+	// Shared terminal sessions - the signed token in the link is the authorization
+	r.Get("/terminal/shared/{token}", s.handleSharedTerminalPage)
+	r.Get("/terminal/shared/{token}/ws", s.handleSharedTerminalWebSocket)
+
 	// Dynamic port proxy - handles its own auth via portAuthMiddleware
 	// Must be outside protected group so public/password ports work without Homeport login
 	r.Route("/{port:[0-9]+}", func(r chi.Router) {
-		r.Use(s.portAuthMiddleware)
-		r.HandleFunc("/*", s.handleProxyDirect)
-		r.HandleFunc("/", s.handleProxyDirect)
+		// Offline page endpoints - reachable while the dev server is down
+		r.Get("/_homeport/wait", s.handlePortWait)
+		r.Post("/_homeport/start", s.handlePortStart)
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.portAuthMiddleware)
+			r.Post("/_homeport/feedback", s.handlePortFeedback)
+			r.HandleFunc("/*", s.handleProxyDirect)
+			r.HandleFunc("/", s.handleProxyDirect)
+		})
 	})
 
 	// Protected routes (auth required)
@@ -107,6 +186,26 @@ func (s *Server) setupRouter() {
 			r.Get("/ports", s.handleListPorts)
 			r.Get("/access-logs", s.handleAccessLogs)
 			r.Get("/access-logs/{port}", s.handlePortAccessLogs)
+			r.Get("/ports/{port}/analytics", s.handlePortAnalytics)
+			r.Patch("/ports/{port}", s.handleUpdatePort)
+			r.Put("/ports/{port}/protocol", s.handleSetPortProtocol)
+			r.Get("/ports/{port}/feedback", s.handleListFeedback)
+			r.Get("/ports/{port}/feedback/export", s.handleExportFeedback)
+			r.Post("/ports/{port}/feedback/issue", s.handleFeedbackIssue)
+			r.Patch("/feedback/{id}", s.handleUpdateFeedback)
+			r.Delete("/feedback/{id}", s.handleDeleteFeedback)
+			r.Get("/feedback/{id}/screenshot", s.handleFeedbackScreenshot)
+
+			r.Get("/mocks", s.handleListMocks)
+			r.Post("/mocks", s.handleStartMock)
+			r.Delete("/mocks/{port}", s.handleStopMock)
+
+			r.Get("/static", s.handleListStatic)
+			r.Post("/static", s.handleStartStatic)
+			r.Delete("/static/{port}", s.handleStopStatic)
+
+			// Raw TCP/UDP tunnels for non-HTTP services (WebSocket)
+			r.Get("/forward/{port}", s.handleForward)
 
 			r.Route("/repos", func(r chi.Router) {
 				r.Get("/", s.handleListRepos)
@@ -124,6 +223,15 @@ func (s *Server) setupRouter() {
 				r.Post("/{id}/push", s.handleGitPush)
 			})
 
+			// Non-interactive commands with streamed output (remote_exec)
+			r.Route("/jobs", func(r chi.Router) {
+				r.Get("/", s.handleListJobs)
+				r.Post("/", s.handleStartJob)
+				r.Get("/{id}", s.handleGetJob)
+				r.Delete("/{id}", s.handleCancelJob)
+				r.Get("/{id}/stream", s.handleJobStream)
+			})
+
 			r.Route("/github", func(r chi.Router) {
 				r.Get("/repos", s.handleGitHubRepos)
 				r.Get("/search", s.handleGitHubSearch)
@@ -159,7 +267,21 @@ func (s *Server) setupRouter() {
 			r.Get("/terminal/{repoId}/sessions", s.handleTerminalSessions)
 			r.Post("/terminal/{repoId}/sessions", s.handleCreateTerminalSession)
 			r.Delete("/terminal/sessions/{sessionId}", s.handleDeleteTerminalSession)
+			r.Post("/terminal/sessions/{sessionId}/recording", s.handleStartRecording)
+			r.Delete("/terminal/sessions/{sessionId}/recording", s.handleStopRecording)
+			r.Get("/terminal/sessions/{sessionId}/shares", s.handleListTerminalShares)
+			r.Post("/terminal/sessions/{sessionId}/shares", s.handleCreateTerminalShare)
+			r.Delete("/terminal/sessions/{sessionId}/shares/{shareId}", s.handleRevokeTerminalShare)
+			r.Put("/terminal/sessions/{sessionId}/control", s.handleTerminalControl)
+			r.Get("/terminal/history", s.handleCommandHistory)
+			r.Get("/terminal/history/{id}", s.handleGetCommand)
 			r.Get("/terminal/{repoId}", s.handleTerminalWebSocket)
+
+			// Terminal recordings (asciicast v2)
+			r.Get("/recordings", s.handleListRecordings)
+			r.Get("/recordings/{id}", s.handleDownloadRecording)
+			r.Get("/recordings/{id}/play", s.handlePlayRecording)
+			r.Delete("/recordings/{id}", s.handleDeleteRecording)
 		})
 
 		// Terminal page wrapper
@@ -183,6 +305,9 @@ func (s *Server) setupRouter() {
 	s.router = r
 }
 
+// codeServerPort is where code-server listens, on CodeServerHost
+const codeServerPort = 8443
+
 // refererPortRegex matches /{port}/ or /{port} in URLs
 var refererPortRegex = regexp.MustCompile(`/(\d+)(?:/|$)`)
 
@@ -209,9 +334,15 @@ func (s *Server) handleServeUI(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleRefererFallback(w http.ResponseWriter, r *http.Request) {
 	var port int
 
-	// First, try to extract port from Referer
+	// Native gRPC clients can't add a /{port} prefix to method paths, so
+	// they name the port in a header instead
+	if p, err := strconv.Atoi(r.Header.Get("X-Homeport-Port")); err == nil {
+		port = p
+	}
+
+	// Otherwise, try to extract port from Referer
 	referer := r.Header.Get("Referer")
-	if referer != "" {
+	if port == 0 && referer != "" {
 		matches := refererPortRegex.FindStringSubmatch(referer)
 		if len(matches) >= 2 {
 			if p, err := strconv.Atoi(matches[1]); err == nil {
@@ -230,8 +361,9 @@ func (s *Server) handleRefererFallback(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Skip system ports to avoid infinite loops (8080 = homeportd, 8443 = code-server)
-	if port == 8080 || port == 8443 {
+	// Only ports in the configured range are proxied, and never homeportd or
+	// code-server, which would loop back here
+	if port < s.cfg.PortRangeMin || port > s.cfg.PortRangeMax || s.isSystemPort(port) {
 		port = 0
 	}
 
@@ -249,12 +381,29 @@ func (s *Server) handleRefererFallback(w http.ResponseWriter, r *http.Request) {
 	// Check if this port exists and get its share mode
 	portInfo, err := s.store.GetPort(port)
 	if err != nil {
-		// Port not tracked - still proxy it (it might be a valid dev server)
+		// Untracked and ignored ports have no share settings, so only the
+		// owner reaches them (a dev server that hasn't been scanned yet)
+		if !s.isOwner(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 		log.Printf("Referer-based proxy to untracked port %d for %s", port, r.URL.Path)
+		s.traffic.Touch(port)
 		proxy.HandlerDirect(port).ServeHTTP(w, r)
 		return
 	}
 
+	clientIP := s.clientIP(r)
+	if !s.ipAllowed(r, portInfo, clientIP) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	isOwner := s.isOwner(r)
+	if !isOwner && portInfo.ShareMode != "private" && !s.checkShareLimits(w, portInfo, clientIP) {
+		return
+	}
+
 	// Check authentication based on share mode
 	// Note: For Referer-based requests, we're more lenient because the user
 	// already authenticated when they accessed the main page
@@ -268,6 +417,13 @@ func (s *Server) handleRefererFallback(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+	case "email":
+		// Check for a verified identity that's still on the allowlist
+		email, ok := share.ValidateIdentityCookie(r, port)
+		if !ok || !share.EmailAllowed(email, portInfo.EmailAllowlist) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 	case "private":
 		// Check for valid homeport session cookie
 		cookie, err := r.Cookie(auth.SessionCookieName)
@@ -278,7 +434,18 @@ func (s *Server) handleRefererFallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("Referer-based proxy: %s -> port %d", r.URL.Path, port)
-	proxy.HandlerDirect(port).ServeHTTP(w, r)
+	s.traffic.Touch(port)
+	handler := proxy.HandlerDirectWithOptions(port, proxy.Options{HTTP2: proxyHTTP2(portInfo), Host: dialHost(portInfo)})
+	s.serveCounted(w, r, port, handler, !isOwner)
+}
+
+// isSystemPort reports whether port is homeportd's own listener or code-server's
+func (s *Server) isSystemPort(port int) bool {
+	if port == codeServerPort {
+		return true
+	}
+	_, listen, err := net.SplitHostPort(s.cfg.ListenAddr)
+	return err == nil && listen == strconv.Itoa(port)
 }
 
 // handleCodeServerProxy serves a wrapper page with navigation header,
@@ -295,7 +462,7 @@ func (s *Server) handleCodeServerProxy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Otherwise proxy to code-server (removes _wrapped param if present)
-	proxy.HandlerWithHostAndBase(s.cfg.CodeServerHost, 8443, "/code").ServeHTTP(w, r)
+	proxy.HandlerWithHostAndBase(s.cfg.CodeServerHost, codeServerPort, "/code").ServeHTTP(w, r)
 }
 
 // serveCodeServerWrapper serves an HTML page that wraps code-server with a nav header
@@ -1383,8 +1550,30 @@ func (s *Server) handleProxyDirect(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	// Proxy the request
-	proxy.Handler(port).ServeHTTP(w, r)
+	s.proxyPort(w, r, port, true)
+}
+
+// proxyPort proxies the request to localhost:{port}, showing the offline page
+// if the dev server is down. If allowWake is set, idempotent requests to a
+// wake-on-request repo start its dev server and are retried once it's up.
+func (s *Server) proxyPort(w http.ResponseWriter, r *http.Request, port int, allowWake bool) {
+	s.traffic.Touch(port)
+	info := s.portForRequest(r, port)
+
+	proxy.HandlerWithOptions(port, proxy.Options{
+		// The handler is passed the outgoing request; use the original r
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			canRetry := r.Method == http.MethodGet || r.Method == http.MethodHead
+			if allowWake && canRetry && s.wakePort(r.Context(), port) {
+				s.proxyPort(w, r, port, false)
+				return
+			}
+			s.servePortOffline(w, r, port, http.StatusBadGateway, fmt.Sprintf("Proxy error: %v", err))
+		},
+		InjectHTML: s.bannerFor(r),
+		HTTP2:      proxyHTTP2(info),
+		Host:       dialHost(info),
+	}).ServeHTTP(w, r)
 }
 
 func (s *Server) Router() chi.Router {
@@ -1395,23 +1584,55 @@ func (s *Server) Start() error {
 	// Start background port scanner
 	go s.scanLoop()
 
+	// Stop dev servers that have gone idle
+	go s.idleLoop()
+
+	// Open, close and expire scheduled shares on time
+	go s.scheduleLoop()
+
+	// Roll up old access logs
+	go s.retentionLoop()
+
+	// Delete old terminal recordings
+	go s.recordingRetentionLoop()
+
+	// Restart mock and static servers from the last run
+	s.restoreMocks()
+	s.restoreStaticServers()
+
 	// Sync existing repos from filesystem
 	if err := s.syncReposFromFilesystem(); err != nil {
 		log.Printf("Warning: failed to sync repos: %v", err)
 	}
 
+	// Accept HTTP/2 without TLS as well, so gRPC streams and trailers
+	// survive the trip from Caddy to the port proxy
 	log.Printf("Starting server on %s", s.cfg.ListenAddr)
-	return http.ListenAndServe(s.cfg.ListenAddr, s.router)
+	return http.ListenAndServe(s.cfg.ListenAddr, h2c.NewHandler(s.router, &http2.Server{}))
 }
 
 func (s *Server) Stop() {
 	close(s.stopScan)
+	s.mocks.StopAll()
+	s.static.StopAll()
 }
 
 func (s *Server) scanLoop() {
 	ticker := time.NewTicker(time.Duration(s.cfg.ScanInterval) * time.Second)
 	defer ticker.Stop()
 
+	// Rescan as soon as a port opens or closes, where the platform can tell
+	// us cheaply; the ticker still refreshes last_seen and process details
+	changed := make(chan struct{}, 1)
+	if s.scanner.Watch(s.stopScan, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}) {
+		log.Printf("Watching for new ports every %v", scanner.WatchInterval)
+	}
+
 	// Initial scan
 	s.doScan()
 
@@ -1419,6 +1640,8 @@ func (s *Server) scanLoop() {
 		select {
 		case <-ticker.C:
 			s.doScan()
+		case <-changed:
+			s.doScan()
 		case <-s.stopScan:
 			return
 		}
@@ -1433,6 +1656,7 @@ func (s *Server) doScan() {
 	}
 
 	// Update database
+	tracked := make([]store.Port, 0, len(ports))
 	for _, p := range ports {
 		// Check if port already exists to preserve share settings
 		existing, err := s.store.GetPort(p.Port)
@@ -1440,19 +1664,50 @@ func (s *Server) doScan() {
 			p.ShareMode = existing.ShareMode
 			p.FirstSeen = existing.FirstSeen
 		}
+		s.labelBuiltinPort(&p)
+		// Ignore rules hide language servers, debuggers and the like; a
+		// pinned port is always kept
+		if (existing == nil || !existing.Pinned) && s.scanner.Ignored(&p) {
+			continue
+		}
+		tracked = append(tracked, p)
 		if err := s.store.UpsertPort(&p); err != nil {
 			log.Printf("Failed to upsert port %d: %v", p.Port, err)
 		}
+		// Remember the owning repo so the offline page can offer to restart it
+		if p.RepoID != "" && (existing == nil || existing.RepoID != p.RepoID) {
+			if err := s.store.RecordPortRepo(p.Port, p.RepoID); err != nil {
+				log.Printf("Failed to record repo for port %d: %v", p.Port, err)
+			}
+		}
 	}
 
+	// Work out what each new port serves
+	s.fingerprintPorts(tracked)
+
+	// Persist share usage before stale cleanup can drop the rows
+	s.flushUsage()
+
 	// Clean up stale ports (not seen in last 30 seconds)
 	// Using 30s instead of 10s to avoid race conditions with UI polling
-	staleThreshold := time.Now().Add(-30 * time.Second)
+	staleThreshold := time.Now().Add(-store.StalePortAge)
 	if err := s.store.CleanupStalePorts(staleThreshold); err != nil {
 		log.Printf("Failed to cleanup stale ports: %v", err)
 	}
 }
 
+// labelBuiltinPort describes ports served from inside homeport (mocks and
+// static directories) instead of showing homeport's own process
+func (s *Server) labelBuiltinPort(p *store.Port) {
+	if s.mocks.Get(p.Port) != nil {
+		p.ProcessName = mockProcessName
+	}
+	if ss := s.static.Get(p.Port); ss != nil {
+		p.ProcessName = staticProcessName
+		p.RepoID = ss.RepoID
+	}
+}
+
 func (s *Server) syncReposFromFilesystem() error {
 	// Walk reposDir and find git repositories
 	entries, err := os.ReadDir(s.cfg.ReposDir)
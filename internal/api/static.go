@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gethomeport/homeport/internal/activity"
+	"github.com/gethomeport/homeport/internal/static"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+// staticProcessName is shown as the process of ports serving a directory
+const staticProcessName = "homeport-serve"
+
+// StaticRequest serves a directory of a repo
+type StaticRequest struct {
+	RepoID  string `json:"repo_id"`
+	Dir     string `json:"dir"`            // relative to the repo, e.g. "dist"
+	Port    int    `json:"port,omitempty"` // 0 picks a free port in the range
+	SPA     bool   `json:"spa"`
+	Listing *bool  `json:"listing,omitempty"` // default true
+}
+
+// restoreStaticServers restarts the directories that were being served when homeport stopped
+func (s *Server) restoreStaticServers() {
+	servers, err := s.store.ListStaticServers()
+	if err != nil {
+		log.Printf("Warning: failed to list static servers: %v", err)
+		return
+	}
+	for _, ss := range servers {
+		opts := static.Options{SPA: ss.SPA, Listing: ss.Listing}
+		if _, err := s.static.Start(ss.Port, ss.RepoID, ss.Root, opts); err != nil {
+			log.Printf("Warning: failed to restore static server on port %d: %v", ss.Port, err)
+		}
+	}
+}
+
+// freePort finds an unused port in the configured range. It searches down
+// from the top so it stays clear of the usual dev server ports.
+func (s *Server) freePort() (int, error) {
+	used := map[int]bool{}
+	if ports, err := s.store.ListPorts(); err == nil {
+		for _, p := range ports {
+			used[p.Port] = true
+		}
+	}
+
+	for port := s.cfg.PortRangeMax; port >= s.cfg.PortRangeMin; port-- {
+		if used[port] || s.mocks.Get(port) != nil || s.static.Get(port) != nil {
+			continue
+		}
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			continue
+		}
+		ln.Close()
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free port between %d and %d", s.cfg.PortRangeMin, s.cfg.PortRangeMax)
+}
+
+// handleListStatic returns the directories being served
+func (s *Server) handleListStatic(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, http.StatusOK, s.static.List())
+}
+
+// handleStartStatic serves a repo directory on a port
+func (s *Server) handleStartStatic(w http.ResponseWriter, r *http.Request) {
+	var req StaticRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	repo, err := s.store.GetRepo(req.RepoID)
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "repo not found")
+		return
+	}
+
+	repoRoot, err := filepath.EvalSymlinks(repo.Path)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, "repo directory is missing")
+		return
+	}
+	root, err := filepath.EvalSymlinks(filepath.Join(repoRoot, filepath.Clean("/"+req.Dir)))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "directory not found: "+req.Dir)
+		return
+	}
+	if root != repoRoot && !strings.HasPrefix(root, repoRoot+string(filepath.Separator)) {
+		errorResponse(w, http.StatusBadRequest, "directory must be inside the repo")
+		return
+	}
+
+	port := req.Port
+	if port == 0 {
+		if port, err = s.freePort(); err != nil {
+			errorResponse(w, http.StatusConflict, err.Error())
+			return
+		}
+	} else if port < s.cfg.PortRangeMin || port > s.cfg.PortRangeMax {
+		errorResponse(w, http.StatusBadRequest, "port must be between "+strconv.Itoa(s.cfg.PortRangeMin)+" and "+strconv.Itoa(s.cfg.PortRangeMax))
+		return
+	}
+
+	opts := static.Options{SPA: req.SPA, Listing: req.Listing == nil || *req.Listing}
+	srv, err := s.static.Start(port, repo.ID, root, opts)
+	if err != nil {
+		errorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	ss := &store.StaticServer{Port: port, RepoID: repo.ID, Root: root, SPA: opts.SPA, Listing: opts.Listing}
+	if err := s.store.SaveStaticServer(ss); err != nil {
+		log.Printf("Warning: failed to save static server on port %d: %v", port, err)
+	}
+	activity.LogServeStart(repo.ID, repo.Name, port, root)
+
+	// Show the port right away so it can be shared without waiting for the next scan
+	s.doScan()
+
+	jsonResponse(w, http.StatusCreated, srv)
+}
+
+// handleStopStatic stops serving the directory on a port
+func (s *Server) handleStopStatic(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(chi.URLParam(r, "port"))
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid port")
+		return
+	}
+
+	if err := s.static.Stop(port); err != nil {
+		errorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := s.store.DeleteStaticServer(port); err != nil {
+		log.Printf("Warning: failed to delete static server on port %d: %v", port, err)
+	}
+	activity.LogServeStop(port)
+
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "stopped"})
+}
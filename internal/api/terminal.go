@@ -27,7 +27,7 @@ var upgrader = websocket.Upgrader{
 
 // TerminalMessage represents a message between client and server
 type TerminalMessage struct {
-	Type      string `json:"type"` // "input", "resize", "ping"
+	Type      string `json:"type"` // "input", "resize", "ping", "control", "close"
 	Data      string `json:"data,omitempty"`
 	Cols      int    `json:"cols,omitempty"`
 	Rows      int    `json:"rows,omitempty"`
@@ -43,6 +43,7 @@ func (s *Server) handleTerminalSessions(w http.ResponseWriter, r *http.Request)
 		ID        string `json:"id"`
 		RepoID    string `json:"repo_id"`
 		CreatedAt int64  `json:"created_at"`
+		Recording string `json:"recording,omitempty"` // ID of the recording in progress
 	}
 
 	var result []sessionInfo
@@ -51,6 +52,7 @@ func (s *Server) handleTerminalSessions(w http.ResponseWriter, r *http.Request)
 			ID:        sess.ID,
 			RepoID:    sess.RepoID,
 			CreatedAt: sess.CreatedAt.Unix(),
+			Recording: sess.RecordingID(),
 		})
 	}
 
@@ -149,35 +151,36 @@ func (s *Server) handleTerminalWebSocket(w http.ResponseWriter, r *http.Request)
 	}
 	defer conn.Close()
 
-	// Track client connection
-	session.AddClient()
-	defer session.RemoveClient()
-
 	// Send session ID to client
 	conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"session","id":"%s"}`, session.ID)))
 
-	// Replay scrollback history with terminal reset first
-	// This prevents corruption when reconnecting to sessions that were using alternate screen
-	scrollback := session.GetScrollback()
-	if len(scrollback) > 0 {
-		// Send RIS (Reset to Initial State) followed by the scrollback
-		// This clears any corrupted state from alternate screen mode
-		reset := []byte("\033c") // RIS escape sequence
-		if err := conn.WriteMessage(websocket.BinaryMessage, reset); err != nil {
-			log.Printf("Failed to send reset: %v", err)
-		}
-		if err := conn.WriteMessage(websocket.BinaryMessage, scrollback); err != nil {
-			log.Printf("Failed to send scrollback: %v", err)
-		}
-	}
+	s.serveTerminal(conn, session, "Owner", terminal.RoleOwner, "")
+}
 
-	// Subscribe to live output
-	outputCh := session.Subscribe()
+// serveTerminal relays a session to a WebSocket client until either side
+// goes away. What the client may do depends on its role: guests can't
+// resize or close the session, and only drivers who have control can type.
+func (s *Server) serveTerminal(conn *websocket.Conn, session *terminal.Session, name, role, shareID string) {
+	// Track client connection
+	session.AddClient()
+	defer session.RemoveClient()
+
+	// Draw the current screen, then follow live output. The snapshot starts
+	// with a reset, so whatever the client showed before (a TUI on the
+	// alternate screen) is cleared.
+	snapshot, outputCh := session.SubscribeWithSnapshot()
 	defer session.Unsubscribe(outputCh)
+	if err := conn.WriteMessage(websocket.BinaryMessage, snapshot); err != nil {
+		log.Printf("Failed to send screen snapshot: %v", err)
+	}
 
-	// Subscribe to terminal events (title changes, command completion)
+	// Subscribe to terminal events (title changes, command completion,
+	// participants), then join so the client hears about itself
 	eventCh := session.SubscribeEvents()
 	defer session.UnsubscribeEvents(eventCh)
+	participant := session.Join(name, role, shareID)
+	defer session.Leave(participant)
+	conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"participant","id":"%s"}`, participant.ID)))
 
 	var wg sync.WaitGroup
 	done := make(chan struct{})
@@ -190,6 +193,9 @@ func (s *Server) handleTerminalWebSocket(w http.ResponseWriter, r *http.Request)
 			select {
 			case <-done:
 				return
+			case <-participant.Kicked():
+				conn.Close()
+				return
 			case data, ok := <-outputCh:
 				if !ok {
 					return
@@ -218,6 +224,7 @@ func (s *Server) handleTerminalWebSocket(w http.ResponseWriter, r *http.Request)
 	go func() {
 		defer wg.Done()
 		defer close(done)
+		owner := role == terminal.RoleOwner
 		for {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
@@ -228,32 +235,42 @@ func (s *Server) handleTerminalWebSocket(w http.ResponseWriter, r *http.Request)
 			if err := json.Unmarshal(message, &msg); err == nil {
 				switch msg.Type {
 				case "input":
-					session.Write([]byte(msg.Data))
+					if session.CanType(participant) {
+						session.Write([]byte(msg.Data))
+					}
 				case "resize":
-					if msg.Cols > 0 && msg.Rows > 0 {
+					if owner && msg.Cols > 0 && msg.Rows > 0 {
 						session.Resize(uint16(msg.Cols), uint16(msg.Rows))
 					}
 				case "ping":
 					conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"pong"}`))
+				case "control":
+					// The owner takes control from drivers ("take") or hands it back
+					if owner {
+						session.SetOwnerControl(msg.Data == "take")
+					}
 				case "close":
 					// Client explicitly closed this session
-					s.termMgr.DeleteSession(session.ID)
-					return
+					if owner {
+						s.termMgr.DeleteSession(session.ID)
+						return
+					}
 				}
-			} else {
+			} else if session.CanType(participant) {
 				session.Write(message)
 			}
 		}
 	}()
 
 	wg.Wait()
-	log.Printf("Terminal WebSocket closed for session %s", session.ID)
+	log.Printf("Terminal WebSocket closed for session %s (%s)", session.ID, role)
 }
 
 // handleTerminalPage serves the terminal wrapper HTML page
 func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
 	repoID := chi.URLParam(r, "repoId")
 	initCmd := r.URL.Query().Get("cmd") // Optional command to auto-run
+	initCmdJSON, _ := json.Marshal(initCmd)
 
 	var repoName string
 	var vsCodeLink string
@@ -438,6 +455,51 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
             to { transform: translateX(0); opacity: 1; }
         }
 
+        /* Share menu */
+        .share-wrap { position: relative; }
+        .share-count { font-size: 12px; padding: 0 6px; border-radius: 9999px; background: #065f46; color: #d1fae5; }
+        .share-count:empty { display: none; }
+        .share-menu {
+            display: none; position: absolute; right: 0; top: 40px; z-index: 1000;
+            width: 260px; padding: 8px; border-radius: 8px; border: 1px solid;
+            box-shadow: 0 4px 12px rgba(0,0,0,0.15); font-size: 13px;
+        }
+        .share-menu.open { display: block; }
+        body.dark .share-menu { background: #252526; border-color: #3c3c3c; color: #d4d4d4; }
+        body.light .share-menu { background: #ffffff; border-color: #e5e7eb; color: #111827; }
+        .share-menu button {
+            display: block; width: 100%%; text-align: left; padding: 8px; border: none;
+            border-radius: 6px; background: transparent; color: inherit; font-size: 13px; cursor: pointer;
+        }
+        body.dark .share-menu button:hover { background: #3c3c3c; }
+        body.light .share-menu button:hover { background: #f3f4f6; }
+        .share-menu .section { padding: 8px 8px 4px; font-size: 11px; text-transform: uppercase; opacity: 0.6; }
+        .share-menu .person { padding: 4px 8px; }
+        .share-menu .role { opacity: 0.6; }
+
+        /* Command history */
+        .history-menu { width: 480px; max-height: 70vh; overflow-y: auto; }
+        .history-menu input[type=search] {
+            width: 100%%; padding: 6px 8px; border-radius: 6px; border: 1px solid;
+            background: transparent; color: inherit; font-size: 13px;
+        }
+        body.dark .history-menu input[type=search] { border-color: #3c3c3c; }
+        body.light .history-menu input[type=search] { border-color: #e5e7eb; }
+        .history-filter { display: flex; align-items: center; gap: 6px; padding: 8px 2px; font-size: 12px; }
+        .history-item { display: flex; align-items: center; gap: 8px; padding: 6px 8px; border-radius: 6px; }
+        body.dark .history-item:hover { background: #2d2d2d; }
+        body.light .history-item:hover { background: #f9fafb; }
+        .history-text { flex: 1; min-width: 0; }
+        .history-cmd {
+            font-family: Menlo, Monaco, "Courier New", monospace; font-size: 12px;
+            white-space: nowrap; overflow: hidden; text-overflow: ellipsis;
+        }
+        .history-meta { font-size: 11px; opacity: 0.6; }
+        .history-meta .failed { color: #f14c4c; }
+        .share-menu .history-item button { width: auto; flex-shrink: 0; padding: 4px 10px; border: 1px solid; }
+        body.dark .share-menu .history-item button { border-color: #3c3c3c; }
+        body.light .share-menu .history-item button { border-color: #e5e7eb; }
+
         /* Mobile toolbar */
         .mobile-toolbar {
             display: none;
@@ -514,6 +576,35 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
             </div>
         </div>
         <div class="header-right">
+            <div class="share-wrap">
+                <button class="header-btn text" onclick="toggleHistory(event)" title="Commands run in this repo">
+                    <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2">
+                        <circle cx="12" cy="12" r="10"/><polyline points="12 6 12 12 16 14"/>
+                    </svg>
+                    History
+                </button>
+                <div class="share-menu history-menu" id="historyMenu" onclick="event.stopPropagation()">
+                    <input type="search" id="historyQuery" placeholder="Search commands" oninput="searchHistory()">
+                    <label class="history-filter"><input type="checkbox" id="historyFailed" onchange="loadHistory()"> Failed only</label>
+                    <div id="historyList"></div>
+                </div>
+            </div>
+            <div class="share-wrap">
+                <button class="header-btn text" onclick="toggleShareMenu(event)" title="Share this terminal">
+                    <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2">
+                        <circle cx="18" cy="5" r="3"/><circle cx="6" cy="12" r="3"/><circle cx="18" cy="19" r="3"/>
+                        <line x1="8.59" y1="13.51" x2="15.42" y2="17.49"/><line x1="15.41" y1="6.51" x2="8.59" y2="10.49"/>
+                    </svg>
+                    Share <span class="share-count" id="shareCount"></span>
+                </button>
+                <div class="share-menu" id="shareMenu" onclick="event.stopPropagation()">
+                    <button onclick="shareTerminal('view')">Copy view-only link</button>
+                    <button onclick="shareTerminal('drive')">Copy co-drive link</button>
+                    <button id="controlBtn" onclick="toggleControl()" style="display: none;"></button>
+                    <div class="section">Connected</div>
+                    <div id="participantList"></div>
+                </div>
+            </div>
             %s
         </div>
     </header>
@@ -547,7 +638,7 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
     <script src="https://cdn.jsdelivr.net/npm/@xterm/addon-web-links@0.11.0/lib/addon-web-links.min.js"></script>
     <script>
         const REPO_ID = '%s';
-        const INIT_CMD = '%s';
+        const INIT_CMD = %s;
 
         let tabs = [];
         let activeTabId = null;
@@ -666,12 +757,21 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
             return div.innerHTML;
         }
 
-        function showCommandNotification(tab, duration) {
-            // Only show notification if this tab is not active
+        function formatDuration(seconds) {
+            if (seconds < 60) return seconds.toFixed(1) + 's';
+            return Math.floor(seconds / 60) + 'm' + Math.round(seconds %% 60) + 's';
+        }
+
+        function showCommandNotification(tab, cmd) {
+            // Only for commands that took a while, and only if this tab is not active
+            if (cmd.duration < 3) return;
             if (tab.id === activeTabId && document.hasFocus()) return;
 
-            const title = tab.title || 'Command';
-            const msg = title + ' completed (' + duration + ')';
+            let title = cmd.command || tab.title || 'Command';
+            if (title.length > 60) title = title.slice(0, 57) + '...';
+            const failed = cmd.exit_code !== undefined && cmd.exit_code !== 0;
+            const msg = title + (failed ? ' failed (exit ' + cmd.exit_code + ', ' : ' completed (') +
+                formatDuration(cmd.duration) + ')';
 
             // Create toast notification
             const toast = document.createElement('div');
@@ -689,7 +789,120 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
             }
         }
 
-        function createTab(sessionId = null) {
+        function showToast(msg) {
+            const toast = document.createElement('div');
+            toast.className = 'command-toast';
+            toast.textContent = msg;
+            toast.onclick = () => toast.remove();
+            document.body.appendChild(toast);
+            setTimeout(() => toast.remove(), 5000);
+        }
+
+        // Sharing: links for the active tab's session, who is connected and
+        // whether co-drivers may type
+        function toggleShareMenu(event) {
+            event.stopPropagation();
+            document.getElementById('shareMenu').classList.toggle('open');
+            renderShareMenu();
+        }
+        document.addEventListener('click', () => {
+            document.getElementById('shareMenu').classList.remove('open');
+            document.getElementById('historyMenu').classList.remove('open');
+        });
+
+        async function shareTerminal(mode) {
+            const tab = tabs.find(t => t.id === activeTabId);
+            if (!tab || !tab.sessionId) return;
+            const resp = await fetch('/api/terminal/sessions/' + tab.sessionId + '/shares', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ mode })
+            });
+            const data = await resp.json();
+            if (!resp.ok) {
+                showToast(data.error || 'Failed to create link');
+                return;
+            }
+            try {
+                await navigator.clipboard.writeText(data.url);
+                showToast((mode === 'drive' ? 'Co-drive' : 'View-only') + ' link copied, valid for an hour');
+            } catch {
+                prompt('Share link (valid for an hour)', data.url);
+            }
+        }
+
+        function toggleControl() {
+            const tab = tabs.find(t => t.id === activeTabId);
+            if (tab && tab.ws && tab.ws.readyState === WebSocket.OPEN) {
+                tab.ws.send(JSON.stringify({ type: 'control', data: tab.ownerControl ? 'release' : 'take' }));
+            }
+        }
+
+        function renderShareMenu() {
+            const tab = tabs.find(t => t.id === activeTabId);
+            const people = (tab && tab.participants) || [];
+            const guests = people.filter(p => p.role !== 'owner');
+            document.getElementById('shareCount').textContent = guests.length ? guests.length : '';
+            document.getElementById('participantList').innerHTML = people.map(p =>
+                '<div class="person">' + escapeHtml(p.id === tab.participantId ? 'You' : p.name) +
+                ' <span class="role">' + p.role + '</span></div>'
+            ).join('');
+            const controlBtn = document.getElementById('controlBtn');
+            controlBtn.style.display = guests.some(p => p.role === 'driver') ? 'block' : 'none';
+            controlBtn.textContent = tab && tab.ownerControl ? 'Let co-drivers type again' : 'Take control';
+        }
+
+        // Command history: commands run in this repo's terminals, each of
+        // which can be run again in a new tab
+        let historyEntries = [];
+        let historyTimer = null;
+
+        function toggleHistory(event) {
+            event.stopPropagation();
+            const menu = document.getElementById('historyMenu');
+            menu.classList.toggle('open');
+            if (menu.classList.contains('open')) {
+                loadHistory();
+                document.getElementById('historyQuery').focus();
+            }
+        }
+
+        function searchHistory() {
+            clearTimeout(historyTimer);
+            historyTimer = setTimeout(loadHistory, 250);
+        }
+
+        async function loadHistory() {
+            let url = '/api/terminal/history?repo=' + encodeURIComponent(REPO_ID) +
+                '&q=' + encodeURIComponent(document.getElementById('historyQuery').value);
+            if (document.getElementById('historyFailed').checked) url += '&failed=true';
+            const resp = await fetch(url);
+            if (!resp.ok) return;
+            historyEntries = await resp.json();
+
+            const list = document.getElementById('historyList');
+            if (historyEntries.length === 0) {
+                list.innerHTML = '<div class="person">No commands yet</div>';
+                return;
+            }
+            list.innerHTML = historyEntries.map((c, i) => {
+                const failed = c.exit_code !== undefined && c.exit_code !== 0;
+                const status = c.exit_code === undefined ? '' :
+                    ' · <span class="' + (failed ? 'failed' : '') + '">exit ' + c.exit_code + '</span>';
+                return '<div class="history-item"><div class="history-text">' +
+                    '<div class="history-cmd" title="' + escapeHtml(c.command) + '">' + escapeHtml(c.command) + '</div>' +
+                    '<div class="history-meta">' + new Date(c.started_at).toLocaleString() + status +
+                    ' · ' + formatDuration(c.duration) + ' · ' + escapeHtml(c.cwd || '') + '</div></div>' +
+                    '<button onclick="rerunCommand(' + i + ')">Run</button></div>';
+            }).join('');
+        }
+
+        function rerunCommand(i) {
+            document.getElementById('historyMenu').classList.remove('open');
+            createTab(null, historyEntries[i].rerun);
+        }
+
+        function createTab(sessionId = null, initCmd = null) {
             const id = 'tab_' + Date.now();
             const pane = document.createElement('div');
             pane.id = 'pane_' + id;
@@ -707,7 +920,7 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
             term.loadAddon(new WebLinksAddon.WebLinksAddon());
             term.open(pane);
 
-            const tab = { id, term, fitAddon, pane, ws: null, sessionId, reconnectAttempts: 0, closing: false };
+            const tab = { id, term, fitAddon, pane, ws: null, sessionId, initCmd, reconnectAttempts: 0, closing: false };
             tabs.push(tab);
 
             term.onData(data => {
@@ -733,7 +946,8 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
             let wsUrl = (location.protocol === 'https:' ? 'wss:' : 'ws:') + '//' + location.host + '/api/terminal/' + REPO_ID;
             const params = [];
             if (sessionId) params.push('session=' + sessionId);
-            if (!sessionId && INIT_CMD) params.push('cmd=' + encodeURIComponent(INIT_CMD));
+            const initCmd = tab.initCmd || INIT_CMD;
+            if (!sessionId && initCmd) params.push('cmd=' + encodeURIComponent(initCmd));
             if (params.length > 0) wsUrl += '?' + params.join('&');
             updateStatus('connecting', 'Connecting...');
 
@@ -760,11 +974,19 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
                         const msg = JSON.parse(e.data);
                         if (msg.type === 'session' && msg.id) {
                             tab.sessionId = msg.id;
+                        } else if (msg.type === 'participant') {
+                            tab.participantId = msg.id;
+                        } else if (msg.type === 'participants') {
+                            tab.participants = JSON.parse(msg.data);
+                            renderShareMenu();
+                        } else if (msg.type === 'control') {
+                            tab.ownerControl = msg.data === 'owner';
+                            renderShareMenu();
                         } else if (msg.type === 'title' && msg.data) {
                             tab.title = msg.data;
                             renderTabs();
                         } else if (msg.type === 'command_complete' && msg.data) {
-                            showCommandNotification(tab, msg.data);
+                            showCommandNotification(tab, JSON.parse(msg.data));
                         }
                     } catch { tab.term.write(e.data); }
                 }
@@ -794,6 +1016,7 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
 
         function switchTab(id) {
             activeTabId = id;
+            renderShareMenu();
             tabs.forEach(tab => {
                 tab.pane.classList.toggle('active', tab.id === id);
                 if (tab.id === id) {
@@ -938,7 +1161,7 @@ func (s *Server) handleTerminalPage(w http.ResponseWriter, r *http.Request) {
         })();
     </script>
 </body>
-</html>`, repoName, version.GetVersion(), repoName, vsCodeLink, repoID, initCmd)
+</html>`, repoName, version.GetVersion(), repoName, vsCodeLink, repoID, initCmdJSON)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Write([]byte(page))
@@ -0,0 +1,384 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+
+	"github.com/gethomeport/homeport/internal/activity"
+	"github.com/gethomeport/homeport/internal/share"
+	"github.com/gethomeport/homeport/internal/store"
+	"github.com/gethomeport/homeport/internal/terminal"
+)
+
+const (
+	// defaultTerminalShareExpiry applies when a share link is created without expires_in
+	defaultTerminalShareExpiry = time.Hour
+	// maxGuestName bounds the name a guest shows up as
+	maxGuestName = 40
+)
+
+// terminalShareInfo is a share link as returned by the API
+type terminalShareInfo struct {
+	store.TerminalShare
+	URL string `json:"url"`
+}
+
+func (s *Server) terminalShareInfo(ts store.TerminalShare) terminalShareInfo {
+	token := share.SignTerminalToken(share.TerminalGrant{
+		SessionID: ts.SessionID,
+		ShareID:   ts.ID,
+		Mode:      ts.Mode,
+		ExpiresAt: ts.ExpiresAt,
+	})
+	return terminalShareInfo{TerminalShare: ts, URL: s.cfg.ExternalURL + "/terminal/shared/" + token}
+}
+
+// handleCreateTerminalShare creates a link to a terminal session, view-only
+// or co-drive
+func (s *Server) handleCreateTerminalShare(w http.ResponseWriter, r *http.Request) {
+	session := s.termMgr.GetSession(chi.URLParam(r, "sessionId"))
+	if session == nil || session.IsClosed() {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	var req struct {
+		Mode      string `json:"mode"`       // "view" (default) or "drive"
+		ExpiresIn string `json:"expires_in"` // "1h" (default), "24h", "7d", "30d" or a Go duration
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	if req.Mode == "" {
+		req.Mode = share.TerminalView
+	}
+	if req.Mode != share.TerminalView && req.Mode != share.TerminalDrive {
+		errorResponse(w, http.StatusBadRequest, "mode must be view or drive")
+		return
+	}
+	expiry := defaultTerminalShareExpiry
+	if req.ExpiresIn != "" {
+		var err error
+		if expiry, err = parseExpiresIn(req.ExpiresIn); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	ts := &store.TerminalShare{
+		ID:        generateID(),
+		SessionID: session.ID,
+		Mode:      req.Mode,
+		ExpiresAt: time.Now().Add(expiry).Truncate(time.Second),
+		CreatedAt: time.Now(),
+	}
+	if err := s.store.SaveTerminalShare(ts); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	activity.LogTerminalShare(session.RepoID, req.Mode)
+
+	jsonResponse(w, http.StatusOK, s.terminalShareInfo(*ts))
+}
+
+// handleListTerminalShares returns a session's live share links, who is
+// connected and whether the owner has taken control
+func (s *Server) handleListTerminalShares(w http.ResponseWriter, r *http.Request) {
+	session := s.termMgr.GetSession(chi.URLParam(r, "sessionId"))
+	if session == nil {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	shares, err := s.store.ListTerminalShares(session.ID)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	links := []terminalShareInfo{}
+	for _, ts := range shares {
+		if time.Now().After(ts.ExpiresAt) {
+			s.store.DeleteTerminalShare(ts.ID)
+			continue
+		}
+		links = append(links, s.terminalShareInfo(ts))
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"shares":        links,
+		"participants":  session.Participants(),
+		"owner_control": session.OwnerControl(),
+	})
+}
+
+// handleRevokeTerminalShare deletes a share link and disconnects the guests
+// who came in through it
+func (s *Server) handleRevokeTerminalShare(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "sessionId")
+	ts, err := s.store.GetTerminalShare(chi.URLParam(r, "shareId"))
+	if err != nil || ts.SessionID != sessionID {
+		errorResponse(w, http.StatusNotFound, "share not found")
+		return
+	}
+	if err := s.store.DeleteTerminalShare(ts.ID); err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if session := s.termMgr.GetSession(sessionID); session != nil {
+		session.Kick(ts.ID)
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// handleTerminalControl takes control of a session from drivers
+// ({"owner": true}) or hands it back ({"owner": false})
+func (s *Server) handleTerminalControl(w http.ResponseWriter, r *http.Request) {
+	session := s.termMgr.GetSession(chi.URLParam(r, "sessionId"))
+	if session == nil || session.IsClosed() {
+		errorResponse(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	var req struct {
+		Owner bool `json:"owner"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	session.SetOwnerControl(req.Owner)
+	jsonResponse(w, http.StatusOK, map[string]bool{"owner_control": req.Owner})
+}
+
+// sharedTerminal resolves a share token to its grant and session. The
+// share must not have been revoked.
+func (s *Server) sharedTerminal(token string) (*share.TerminalGrant, *terminal.Session, bool) {
+	grant, ok := share.VerifyTerminalToken(token)
+	if !ok {
+		return nil, nil, false
+	}
+	ts, err := s.store.GetTerminalShare(grant.ShareID)
+	if err != nil || ts.SessionID != grant.SessionID || ts.Mode != grant.Mode {
+		return nil, nil, false
+	}
+	session := s.termMgr.GetSession(grant.SessionID)
+	if session == nil || session.IsClosed() {
+		return nil, nil, false
+	}
+	return grant, session, true
+}
+
+// handleSharedTerminalWebSocket connects a guest to a shared session. It
+// is public: the token in the path is the authorization.
+func (s *Server) handleSharedTerminalWebSocket(w http.ResponseWriter, r *http.Request) {
+	grant, session, ok := s.sharedTerminal(chi.URLParam(r, "token"))
+	if !ok {
+		http.Error(w, "This link has expired or was revoked", http.StatusNotFound)
+		return
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" || !utf8.ValidString(name) {
+		name = "Guest"
+	}
+	if utf8.RuneCountInString(name) > maxGuestName {
+		name = string([]rune(name)[:maxGuestName])
+	}
+	role := terminal.RoleViewer
+	if grant.Mode == share.TerminalDrive {
+		role = terminal.RoleDriver
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// The link stops working at its expiry, even for guests already in
+	expired := time.AfterFunc(time.Until(grant.ExpiresAt), func() { conn.Close() })
+	defer expired.Stop()
+
+	activity.LogTerminalJoin(session.RepoID, name, grant.Mode)
+
+	// Guests draw at the owner's size and follow "resize" events
+	cols, rows := session.Size()
+	hello, _ := json.Marshal(map[string]interface{}{
+		"type":          "shared",
+		"role":          role,
+		"cols":          cols,
+		"rows":          rows,
+		"owner_control": session.OwnerControl(),
+		"expires_at":    grant.ExpiresAt.Format(time.RFC3339),
+	})
+	conn.WriteMessage(websocket.TextMessage, hello)
+
+	s.serveTerminal(conn, session, name, role, grant.ShareID)
+}
+
+// handleSharedTerminalPage serves the page guests open a share link in
+func (s *Server) handleSharedTerminalPage(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.sharedTerminal(chi.URLParam(r, "token")); !ok {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, sharedTerminalGoneHTML)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	fmt.Fprint(w, sharedTerminalHTML)
+}
+
+const sharedTerminalGoneHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Terminal link expired</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; background: #1e1e1e; color: #d4d4d4;
+               display: flex; align-items: center; justify-content: center; height: 100vh; margin: 0; }
+        .box { text-align: center; }
+        h1 { font-size: 18px; font-weight: 600; color: #ffffff; }
+        p { font-size: 14px; color: #9ca3af; }
+    </style>
+</head>
+<body>
+    <div class="box">
+        <h1>This terminal link has expired</h1>
+        <p>It may have been revoked, or the session has ended. Ask for a new link.</p>
+    </div>
+</body>
+</html>`
+
+const sharedTerminalHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Shared terminal</title>
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/@xterm/xterm@5.5.0/css/xterm.min.css">
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        html, body { height: 100%; overflow: hidden; background: #1e1e1e; color: #d4d4d4;
+                     font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; }
+        header { height: 48px; display: flex; align-items: center; justify-content: space-between;
+                 padding: 0 16px; background: #252526; border-bottom: 1px solid #3c3c3c; font-size: 14px; }
+        .title { color: #ffffff; font-weight: 600; }
+        .badge { margin-left: 8px; padding: 2px 8px; border-radius: 9999px; font-size: 12px; background: #3c3c3c; color: #9ca3af; }
+        .badge.live { background: #064e3b; color: #6ee7b7; }
+        .people { display: flex; gap: 6px; align-items: center; color: #9ca3af; font-size: 13px; }
+        .person { padding: 2px 8px; border-radius: 6px; background: #2d2d2d; }
+        .person.owner { color: #ffffff; }
+        .person.me { outline: 1px solid #4c4c4c; }
+        #terminal { position: absolute; top: 56px; left: 8px; right: 8px; bottom: 8px; overflow: auto; }
+        .status { position: fixed; bottom: 16px; right: 16px; padding: 8px 16px; border-radius: 8px;
+                  font-size: 13px; background: #3c3c3c; color: #ffffff; }
+        .status.hidden { display: none; }
+    </style>
+</head>
+<body>
+    <header>
+        <div><span class="title">Shared terminal</span><span class="badge" id="mode">connecting</span></div>
+        <div class="people" id="people"></div>
+    </header>
+    <div id="terminal"></div>
+    <div class="status" id="status">Connecting...</div>
+
+    <script src="https://cdn.jsdelivr.net/npm/@xterm/xterm@5.5.0/lib/xterm.min.js"></script>
+    <script>
+        const term = new Terminal({
+            cursorBlink: true, fontSize: 14, disableStdin: true,
+            fontFamily: 'Menlo, Monaco, "Courier New", monospace',
+            theme: { background: '#1e1e1e', foreground: '#d4d4d4', cursor: '#d4d4d4' }
+        });
+        term.open(document.getElementById('terminal'));
+
+        const name = new URLSearchParams(location.search).get('name') || '';
+        let role = 'viewer', ownerControl = false, me = null, ws = null;
+
+        function escapeHtml(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+
+        function setStatus(message) {
+            const el = document.getElementById('status');
+            el.textContent = message;
+            el.classList.toggle('hidden', !message);
+        }
+
+        function renderMode() {
+            const el = document.getElementById('mode');
+            const typing = role === 'driver' && !ownerControl;
+            term.options.disableStdin = !typing;
+            el.className = 'badge' + (typing ? ' live' : '');
+            if (role === 'viewer') el.textContent = 'view only';
+            else el.textContent = typing ? 'you can type' : 'owner has control';
+        }
+
+        function renderPeople(list) {
+            document.getElementById('people').innerHTML = list.map(p =>
+                '<span class="person ' + p.role + (p.id === me ? ' me' : '') + '">' + escapeHtml(p.name) + '</span>'
+            ).join('');
+        }
+
+        term.onData(data => {
+            if (ws && ws.readyState === WebSocket.OPEN) ws.send(JSON.stringify({ type: 'input', data }));
+        });
+
+        function connect() {
+            let url = (location.protocol === 'https:' ? 'wss:' : 'ws:') + '//' + location.host + location.pathname + '/ws';
+            if (name) url += '?name=' + encodeURIComponent(name);
+            ws = new WebSocket(url);
+            ws.binaryType = 'arraybuffer';
+            ws.onopen = () => setStatus('');
+            ws.onmessage = (e) => {
+                if (e.data instanceof ArrayBuffer) {
+                    term.write(new Uint8Array(e.data));
+                    return;
+                }
+                const msg = JSON.parse(e.data);
+                if (msg.type === 'shared') {
+                    role = msg.role;
+                    ownerControl = msg.owner_control;
+                    term.resize(msg.cols, msg.rows);
+                    renderMode();
+                } else if (msg.type === 'participant') {
+                    me = msg.id;
+                } else if (msg.type === 'resize') {
+                    const [cols, rows] = msg.data.split('x').map(Number);
+                    term.resize(cols, rows);
+                } else if (msg.type === 'control') {
+                    ownerControl = msg.data === 'owner';
+                    renderMode();
+                } else if (msg.type === 'participants') {
+                    renderPeople(JSON.parse(msg.data));
+                } else if (msg.type === 'title') {
+                    document.title = msg.data + ' - Shared terminal';
+                }
+            };
+            ws.onclose = () => {
+                setStatus('Disconnected. The link may have expired or been revoked.');
+                term.options.disableStdin = true;
+            };
+        }
+        connect();
+    </script>
+</body>
+</html>`
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gethomeport/homeport/internal/activity"
+)
+
+// trafficTracker remembers when each port last received proxied traffic
+type trafficTracker struct {
+	mu   sync.Mutex
+	last map[int]time.Time
+}
+
+func newTrafficTracker() *trafficTracker {
+	return &trafficTracker{last: make(map[int]time.Time)}
+}
+
+// Touch records traffic on a port
+func (t *trafficTracker) Touch(port int) {
+	t.mu.Lock()
+	t.last[port] = time.Now()
+	t.mu.Unlock()
+}
+
+// LastSeen returns when the port last received traffic (zero if never)
+func (t *trafficTracker) LastSeen(port int) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last[port]
+}
+
+// wakePort starts the dev server of a wake-on-request repo that owns the port
+// and waits until the port is listening. Returns false if the port's repo
+// isn't set up for wake-on-request or the server didn't come up in time.
+func (s *Server) wakePort(ctx context.Context, port int) bool {
+	repo := s.repoForPort(port)
+	if repo == nil || !repo.WakeOnRequest || repo.StartCommand == "" {
+		return false
+	}
+
+	// Serialize starts so concurrent requests don't race to launch the same server
+	s.wakeMu.Lock()
+	if proc := s.procs.Get(repo.ID); proc == nil || proc.Status != "running" {
+		if _, err := s.procs.Start(repo.ID, repo.Name, repo.Path, repo.StartCommand); err != nil {
+			s.wakeMu.Unlock()
+			log.Printf("Failed to wake %s for port %d: %v", repo.Name, port, err)
+			return false
+		}
+		activity.LogWake(repo.ID, repo.Name, port)
+		log.Printf("Woke %s on request to port %d", repo.Name, port)
+	}
+	s.wakeMu.Unlock()
+
+	if !waitForPort(ctx, port, time.Duration(s.cfg.WakeTimeout)*time.Second) {
+		return false
+	}
+
+	// Register the port right away instead of waiting for the next scan tick
+	if p, err := s.store.GetPort(port); err != nil || p.Offline {
+		s.doScan()
+	}
+	s.traffic.Touch(port)
+	return true
+}
+
+// idleLoop stops Homeport-started dev servers that haven't seen proxied
+// traffic for longer than their repo's idle timeout
+func (s *Server) idleLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.stopIdleServers()
+		case <-s.stopScan:
+			return
+		}
+	}
+}
+
+func (s *Server) stopIdleServers() {
+	ports, err := s.store.ListPorts()
+	if err != nil {
+		log.Printf("Idle check: failed to list ports: %v", err)
+		return
+	}
+
+	for _, proc := range s.procs.List() {
+		if proc.Status != "running" {
+			continue
+		}
+		repo, err := s.store.GetRepo(proc.RepoID)
+		if err != nil || repo.IdleTimeout <= 0 {
+			continue
+		}
+
+		// Most recent traffic on any of the repo's ports, or the start time
+		last := proc.StartedAt
+		for _, p := range ports {
+			if p.RepoID != repo.ID {
+				continue
+			}
+			if seen := s.traffic.LastSeen(p.Port); seen.After(last) {
+				last = seen
+			}
+		}
+
+		idle := time.Since(last)
+		if idle < time.Duration(repo.IdleTimeout)*time.Minute {
+			continue
+		}
+
+		log.Printf("Stopping %s after %s without traffic", repo.Name, idle.Round(time.Second))
+		if err := s.procs.Stop(repo.ID); err != nil {
+			log.Printf("Failed to stop idle server %s: %v", repo.Name, err)
+			continue
+		}
+		activity.LogSleep(repo.ID, repo.Name, idle)
+	}
+}
@@ -181,17 +181,6 @@ func (a *Auth) ClearSessionCookie(w http.ResponseWriter) {
 	})
 }
 
-// GetClientIP extracts the client IP from the request
-func GetClientIP(r *http.Request) string {
-	// Check X-Forwarded-For first (for proxied requests)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		return strings.TrimSpace(parts[0])
-	}
-	// Fall back to RemoteAddr
-	return strings.Split(r.RemoteAddr, ":")[0]
-}
-
 // Middleware returns an HTTP middleware that requires authentication
 func (a *Auth) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,109 @@
+// Package clientip resolves the real client IP of a request, honoring
+// forwarding headers only when they were set by a trusted proxy.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseCIDRs parses a list of CIDRs. Bare IPs are treated as single-host ranges.
+func ParseCIDRs(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Contains reports whether ip falls in any of the ranges
+func Contains(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver extracts client IPs using a set of trusted proxy ranges
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// NewResolver creates a resolver that trusts forwarding headers from the given ranges
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	nets, err := ParseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %w", err)
+	}
+	return &Resolver{trusted: nets}, nil
+}
+
+// ClientIP returns the IP of the client that made the request.
+// CF-Connecting-IP and X-Forwarded-For are only honored when the direct peer
+// is a trusted proxy; otherwise anyone could spoof their address.
+func (res *Resolver) ClientIP(r *http.Request) string {
+	peer := remoteIP(r.RemoteAddr)
+	if !Contains(res.trusted, net.ParseIP(peer)) {
+		return peer
+	}
+
+	// Cloudflare sets this to the original client (cloudflared passes it through)
+	if cfIP := strings.TrimSpace(r.Header.Get("CF-Connecting-IP")); net.ParseIP(cfIP) != nil {
+		return cfIP
+	}
+
+	// Walk X-Forwarded-For from the right, skipping our own proxies.
+	// The first untrusted hop is the client; entries left of it are client-supplied.
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			ip := net.ParseIP(hop)
+			if ip == nil {
+				break
+			}
+			if !Contains(res.trusted, ip) || i == 0 {
+				return hop
+			}
+		}
+	}
+
+	return peer
+}
+
+// remoteIP strips the port from a RemoteAddr
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/gethomeport/homeport/internal/clientip"
 )
 
 type Config struct {
@@ -16,6 +19,10 @@ type Config struct {
 	PortRangeMax int `yaml:"port_range_max"`
 	ScanInterval int `yaml:"scan_interval_seconds"`
 
+	// Listeners left out of the port list (language servers, debuggers, ...).
+	// Repos can add their own in RepoConfigFile.
+	IgnorePorts []IgnoreRule `yaml:"ignore_ports"`
+
 	// Paths
 	ReposDir string `yaml:"repos_dir"`
 	DataDir  string `yaml:"data_dir"`
@@ -33,20 +40,80 @@ type Config struct {
 
 	// Code-server host (for Docker networking - defaults to localhost)
 	CodeServerHost string `yaml:"code_server_host"`
+
+	// Docker Engine API used to match container ports to compose projects:
+	// a unix:// or tcp:// address, "" for $DOCKER_HOST or the default
+	// socket, "off" to disable
+	DockerHost string `yaml:"docker_host"`
+
+	// Proxies (IPs or CIDRs) whose CF-Connecting-IP / X-Forwarded-For headers are trusted.
+	// Requests from anywhere else are identified by their socket address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// How long a request waits for a wake-on-request dev server to start listening
+	WakeTimeout int `yaml:"wake_timeout_seconds"`
+
+	// Days to keep raw access logs; older entries are rolled up into daily totals
+	AccessLogRetentionDays int `yaml:"access_log_retention_days"`
+
+	// Days to keep terminal recordings (0 keeps them forever)
+	RecordingRetentionDays int `yaml:"recording_retention_days"`
+
+	// Start bash and zsh terminals with hooks that report each command, its
+	// exit code and working directory
+	ShellIntegration bool `yaml:"shell_integration"`
+
+	// Allow running any command in a repo through the jobs API (homeport
+	// exec). Off by default, so API clients can't run commands unless the
+	// server opts in.
+	RemoteExec bool `yaml:"remote_exec"`
+
+	// Let homeport forward tunnel to any port, not only those in the port
+	// range. Off by default, so services outside the range stay unreachable.
+	ForwardAnyPort bool `yaml:"forward_any_port"`
+
+	// Mail delivery for email-gated shares
+	Mail MailConfig `yaml:"mail"`
+}
+
+// MailConfig selects how magic-link emails are delivered
+type MailConfig struct {
+	Driver   string `yaml:"driver"` // "smtp", "log" or "file"
+	From     string `yaml:"from"`
+	SMTPHost string `yaml:"smtp_host"`
+	SMTPPort int    `yaml:"smtp_port"`
+	Username string `yaml:"smtp_username"`
+	Password string `yaml:"-"`    // from HOMEPORT_SMTP_PASSWORD
+	File     string `yaml:"file"` // mbox-style file for the "file" driver
 }
 
 func Default() *Config {
 	return &Config{
-		ListenAddr:     ":8080",
-		PortRangeMin:   3000,
-		PortRangeMax:   9999,
-		ScanInterval:   5,
-		ReposDir:       "/srv/homeport/repos",
-		DataDir:        "/srv/homeport/data",
-		UIDir:          "/srv/homeport/ui",
-		ExternalURL:    "http://localhost:8080",
-		DevMode:        false,
-		CodeServerHost: "localhost",
+		ListenAddr:             ":8080",
+		PortRangeMin:           3000,
+		PortRangeMax:           9999,
+		ScanInterval:           5,
+		ReposDir:               "/srv/homeport/repos",
+		DataDir:                "/srv/homeport/data",
+		UIDir:                  "/srv/homeport/ui",
+		ExternalURL:            "http://localhost:8080",
+		DevMode:                false,
+		CodeServerHost:         "localhost",
+		TrustedProxies:         []string{"127.0.0.0/8", "::1"},
+		WakeTimeout:            20,
+		AccessLogRetentionDays: 30,
+		RecordingRetentionDays: 30,
+		ShellIntegration:       true,
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "homeport@localhost",
+			SMTPPort: 587,
+		},
+		IgnorePorts: []IgnoreRule{
+			{Port: 9229},          // node --inspect
+			{Process: `^dlv$`},    // Delve
+			{Process: `^debugpy`}, // Python debugger adapter
+		},
 	}
 }
 
@@ -74,6 +141,14 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if _, err := clientip.ParseCIDRs(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %w", err)
+	}
+
+	if err := ValidateIgnoreRules(cfg.IgnorePorts); err != nil {
+		return nil, fmt.Errorf("ignore_ports: %w", err)
+	}
+
 	return cfg, nil
 }
 
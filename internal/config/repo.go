@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfigFile is read from the root of each repo
+const RepoConfigFile = ".homeport.yaml"
+
+// RepoConfig is the per-repo configuration, committed alongside the code
+type RepoConfig struct {
+	// Added to the global ignore_ports for ports owned by this repo
+	IgnorePorts []IgnoreRule `yaml:"ignore_ports"`
+
+	// Record every terminal session opened in this repo
+	RecordTerminals bool `yaml:"record_terminals"`
+}
+
+// IgnoreRule hides matching listeners. Every field that is set must match;
+// Process and Command are regular expressions matched anywhere in the
+// process name and full command line (anchor them with ^ and $).
+type IgnoreRule struct {
+	Port    int    `yaml:"port,omitempty" json:"port,omitempty"`
+	Process string `yaml:"process,omitempty" json:"process,omitempty"`
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// LoadRepoConfig reads RepoConfigFile from a repo. A missing file is an
+// empty config.
+func LoadRepoConfig(repoPath string) (*RepoConfig, error) {
+	cfg := &RepoConfig{}
+
+	data, err := os.ReadFile(filepath.Join(repoPath, RepoConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", RepoConfigFile, err)
+	}
+	if err := ValidateIgnoreRules(cfg.IgnorePorts); err != nil {
+		return nil, fmt.Errorf("%s: ignore_ports: %w", RepoConfigFile, err)
+	}
+	return cfg, nil
+}
+
+// ValidateIgnoreRules checks that every rule matches something and that
+// its patterns compile
+func ValidateIgnoreRules(rules []IgnoreRule) error {
+	for i, rule := range rules {
+		if rule.Port == 0 && rule.Process == "" && rule.Command == "" {
+			return fmt.Errorf("rule %d: set port, process or command", i+1)
+		}
+		for _, pattern := range []string{rule.Process, rule.Command} {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("rule %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// Package docker reads running containers from the Docker Engine API, so
+// ports published by containers can be traced back to a repo.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHost is used when neither the config nor $DOCKER_HOST name one
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// Compose labels set on every container started by docker compose
+const (
+	LabelProject    = "com.docker.compose.project"
+	LabelService    = "com.docker.compose.service"
+	LabelWorkingDir = "com.docker.compose.project.working_dir"
+)
+
+// Client talks to the Docker Engine API over a unix socket or TCP
+type Client struct {
+	base string // http://docker or http://host:port
+	http *http.Client
+
+	mu   sync.Mutex
+	pids map[string]int // container ID -> PID of its main process
+}
+
+// Container is a running container and the ports it publishes
+type Container struct {
+	ID     string
+	Name   string // without the leading slash
+	Image  string
+	Labels map[string]string
+	PID    int      // main process on the host, 0 if unknown
+	IPs    []string // addresses on the container's networks
+	Ports  []Port
+}
+
+// Port is a container port, published on the host when PublicPort is set
+type Port struct {
+	IP          string // host address it's published on, "" or "0.0.0.0" for all
+	PrivatePort int
+	PublicPort  int
+	Type        string // "tcp" or "udp"
+}
+
+// NewClient connects to host, which is a unix:// or tcp:// address as in
+// $DOCKER_HOST. An empty host uses $DOCKER_HOST, then DefaultHost.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{MaxIdleConns: 2, IdleConnTimeout: 30 * time.Second}
+	c := &Client{
+		http: &http.Client{Transport: transport, Timeout: 5 * time.Second},
+		pids: make(map[string]int),
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		c.base = "http://docker"
+	case "tcp", "http":
+		c.base = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q (use unix:// or tcp://)", host)
+	}
+	return c, nil
+}
+
+// Containers lists running containers. The PID of each is looked up once
+// and remembered for the container's lifetime.
+func (c *Client) Containers(ctx context.Context) ([]Container, error) {
+	var list []struct {
+		ID              string            `json:"Id"`
+		Names           []string          `json:"Names"`
+		Image           string            `json:"Image"`
+		Labels          map[string]string `json:"Labels"`
+		Ports           []Port            `json:"Ports"`
+		NetworkSettings struct {
+			Networks map[string]struct {
+				IPAddress string `json:"IPAddress"`
+			} `json:"Networks"`
+		} `json:"NetworkSettings"`
+	}
+	if err := c.get(ctx, "/containers/json", &list); err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0, len(list))
+	live := make(map[string]bool, len(list))
+	for _, item := range list {
+		live[item.ID] = true
+		ctr := Container{
+			ID:     item.ID,
+			Image:  item.Image,
+			Labels: item.Labels,
+			Ports:  item.Ports,
+		}
+		if len(item.Names) > 0 {
+			ctr.Name = strings.TrimPrefix(item.Names[0], "/")
+		}
+		for _, network := range item.NetworkSettings.Networks {
+			if network.IPAddress != "" {
+				ctr.IPs = append(ctr.IPs, network.IPAddress)
+			}
+		}
+		ctr.PID = c.pid(ctx, item.ID)
+		containers = append(containers, ctr)
+	}
+
+	// Forget containers that have stopped
+	c.mu.Lock()
+	for id := range c.pids {
+		if !live[id] {
+			delete(c.pids, id)
+		}
+	}
+	c.mu.Unlock()
+
+	return containers, nil
+}
+
+// pid returns the host PID of a container's main process
+func (c *Client) pid(ctx context.Context, id string) int {
+	c.mu.Lock()
+	pid, ok := c.pids[id]
+	c.mu.Unlock()
+	if ok {
+		return pid
+	}
+
+	var inspect struct {
+		State struct {
+			Pid int `json:"Pid"`
+		} `json:"State"`
+	}
+	if err := c.get(ctx, "/containers/"+url.PathEscape(id)+"/json", &inspect); err != nil {
+		return 0
+	}
+	c.mu.Lock()
+	c.pids[id] = inspect.State.Pid
+	c.mu.Unlock()
+	return inspect.State.Pid
+}
+
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("docker %s: %s %s", path, resp.Status, body.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Service describes the container for people: "project/service" for
+// compose containers, the container name otherwise
+func (c *Container) Service() string {
+	if project, service := c.Labels[LabelProject], c.Labels[LabelService]; project != "" && service != "" {
+		return project + "/" + service
+	}
+	return c.Name
+}
+
+// WorkingDir is the directory the compose project was started from
+func (c *Container) WorkingDir() string {
+	if dir := c.Labels[LabelWorkingDir]; dir != "" {
+		return filepath.Clean(dir)
+	}
+	return ""
+}
+
+// Publishes returns the published TCP port matching hostPort, if any
+func (c *Container) Publishes(hostPort int) *Port {
+	for i, p := range c.Ports {
+		if p.PublicPort == hostPort && p.Type == "tcp" {
+			return &c.Ports[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeEngine serves the two Docker Engine API endpoints the client uses and
+// counts how often each container is inspected
+type fakeEngine struct {
+	mu         sync.Mutex
+	containers []map[string]interface{}
+	pids       map[string]int
+	inspected  map[string]int
+}
+
+func newFakeEngine(t *testing.T) (*fakeEngine, *Client) {
+	t.Helper()
+	e := &fakeEngine{pids: make(map[string]int), inspected: make(map[string]int)}
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	c, err := NewClient("tcp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, c
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if r.URL.Path == "/containers/json" {
+		json.NewEncoder(w).Encode(e.containers)
+		return
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/json")
+	pid, ok := e.pids[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "No such container: " + id})
+		return
+	}
+	e.inspected[id]++
+	json.NewEncoder(w).Encode(map[string]interface{}{"State": map[string]int{"Pid": pid}})
+}
+
+// run replaces the running containers
+func (e *fakeEngine) run(containers ...map[string]interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.containers = containers
+}
+
+func (e *fakeEngine) inspections(id string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.inspected[id]
+}
+
+func container(id, name string, pid int, e *fakeEngine) map[string]interface{} {
+	e.mu.Lock()
+	e.pids[id] = pid
+	e.mu.Unlock()
+	return map[string]interface{}{
+		"Id":     id,
+		"Names":  []string{"/" + name},
+		"Image":  "postgres:16",
+		"Labels": map[string]string{LabelProject: "shop", LabelService: name, LabelWorkingDir: "/srv/homeport/repos/shop/"},
+		"Ports": []map[string]interface{}{
+			{"IP": "0.0.0.0", "PrivatePort": 5432, "PublicPort": 5433, "Type": "tcp"},
+			{"PrivatePort": 9000, "Type": "tcp"},
+		},
+		"NetworkSettings": map[string]interface{}{
+			"Networks": map[string]interface{}{"shop_default": map[string]string{"IPAddress": "172.18.0.2"}},
+		},
+	}
+}
+
+func TestContainers(t *testing.T) {
+	e, c := newFakeEngine(t)
+	e.run(container("abc", "db", 4242, e))
+
+	list, err := c.Containers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d containers, want 1", len(list))
+	}
+	ctr := list[0]
+	if ctr.Name != "db" || ctr.PID != 4242 || ctr.Service() != "shop/db" {
+		t.Errorf("got name %q, pid %d, service %q", ctr.Name, ctr.PID, ctr.Service())
+	}
+	if ctr.WorkingDir() != "/srv/homeport/repos/shop" {
+		t.Errorf("WorkingDir() = %q", ctr.WorkingDir())
+	}
+	if len(ctr.IPs) != 1 || ctr.IPs[0] != "172.18.0.2" {
+		t.Errorf("IPs = %v", ctr.IPs)
+	}
+	if p := ctr.Publishes(5433); p == nil || p.PrivatePort != 5432 {
+		t.Errorf("Publishes(5433) = %+v", p)
+	}
+	if p := ctr.Publishes(9000); p != nil {
+		t.Errorf("Publishes(9000) = %+v for an unpublished port", p)
+	}
+}
+
+func TestContainersCachesPIDs(t *testing.T) {
+	e, c := newFakeEngine(t)
+	e.run(container("abc", "db", 4242, e))
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Containers(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := e.inspections("abc"); n != 1 {
+		t.Errorf("container inspected %d times, want 1", n)
+	}
+
+	// A stopped container is forgotten, so a new one reusing its ID is
+	// inspected again
+	e.run()
+	if _, err := c.Containers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	cached := len(c.pids)
+	c.mu.Unlock()
+	if cached != 0 {
+		t.Errorf("%d PIDs still cached after the container stopped", cached)
+	}
+
+	e.run(container("abc", "db", 5151, e))
+	list, err := c.Containers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list[0].PID != 5151 {
+		t.Errorf("PID = %d after restart, want 5151", list[0].PID)
+	}
+	if n := e.inspections("abc"); n != 2 {
+		t.Errorf("container inspected %d times, want 2", n)
+	}
+}
+
+func TestContainersError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"message": "daemon is shutting down"})
+	}))
+	defer srv.Close()
+
+	c, err := NewClient("tcp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Containers(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "daemon is shutting down") {
+		t.Errorf("err = %v, want the daemon's message", err)
+	}
+}
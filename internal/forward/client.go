@@ -0,0 +1,124 @@
+package forward
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Dialer opens tunnels to homeportd
+type Dialer struct {
+	URL    string      // ws(s)://host/api/forward/{port}?proto=tcp|udp
+	Header http.Header // session cookie, Cloudflare Access headers, ...
+}
+
+// Dial opens one tunnel
+func (d *Dialer) Dial() (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 15 * time.Second,
+	}
+	ws, resp, err := dialer.Dial(d.URL, d.Header)
+	if err != nil {
+		if resp != nil {
+			var body struct {
+				Error string `json:"error"`
+			}
+			if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body) == nil && body.Error != "" {
+				return nil, fmt.Errorf("%s (%s)", body.Error, resp.Status)
+			}
+			return nil, fmt.Errorf("%s: %s", err, resp.Status)
+		}
+		return nil, err
+	}
+	return ws, nil
+}
+
+// ServeTCP accepts local connections and tunnels each over its own WebSocket
+func ServeTCP(ln net.Listener, d *Dialer) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			ws, err := d.Dial()
+			if err != nil {
+				log.Printf("Tunnel failed: %v", err)
+				conn.Close()
+				return
+			}
+			if err := Stream(ws, conn); err != nil {
+				log.Printf("Tunnel closed: %v", err)
+			}
+		}()
+	}
+}
+
+// ServeUDP relays datagrams from a local socket. Each local peer address
+// gets its own tunnel, closed after UDPIdleTimeout without traffic.
+func ServeUDP(pc net.PacketConn, d *Dialer) error {
+	var mu sync.Mutex
+	peers := map[string]*websocket.Conn{}
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		key := addr.String()
+
+		mu.Lock()
+		ws := peers[key]
+		mu.Unlock()
+
+		// A tunnel that went idle on the server side fails on write; open a fresh one
+		if ws != nil && ws.WriteMessage(websocket.BinaryMessage, buf[:n]) == nil {
+			continue
+		}
+		if ws, err = d.Dial(); err != nil {
+			log.Printf("Tunnel failed: %v", err)
+			continue
+		}
+		mu.Lock()
+		if old := peers[key]; old != nil {
+			old.Close()
+		}
+		peers[key] = ws
+		mu.Unlock()
+
+		go func(ws *websocket.Conn, addr net.Addr) {
+			relayReplies(ws, pc, addr)
+			mu.Lock()
+			if peers[addr.String()] == ws {
+				delete(peers, addr.String())
+			}
+			mu.Unlock()
+		}(ws, addr)
+
+		ws.WriteMessage(websocket.BinaryMessage, buf[:n])
+	}
+}
+
+// relayReplies sends datagrams from a tunnel back to the local peer
+func relayReplies(ws *websocket.Conn, pc net.PacketConn, addr net.Addr) {
+	defer ws.Close()
+	for {
+		ws.SetReadDeadline(time.Now().Add(UDPIdleTimeout))
+		mt, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if mt == websocket.BinaryMessage {
+			pc.WriteTo(data, addr)
+		}
+	}
+}
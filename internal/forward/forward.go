@@ -0,0 +1,116 @@
+// Package forward tunnels raw TCP streams and UDP datagrams over WebSocket,
+// so services that don't speak HTTP can be reached through homeportd.
+package forward
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// pingInterval keeps idle tunnels open through proxies like Cloudflare,
+	// which drop WebSockets after about 100 seconds without traffic
+	pingInterval = 30 * time.Second
+
+	// UDPIdleTimeout closes a UDP tunnel after no datagrams in either direction
+	UDPIdleTimeout = 2 * time.Minute
+
+	streamBufferSize = 32 << 10
+	maxDatagramSize  = 64 << 10
+)
+
+// Stream copies between a WebSocket and a TCP connection until either side
+// closes. Each binary message carries the next chunk of the stream.
+func Stream(ws *websocket.Conn, conn net.Conn) error {
+	return bridge(ws, conn, streamBufferSize, 0)
+}
+
+// Packets relays datagrams between a WebSocket and a connected UDP socket,
+// one binary message per datagram, until idle for UDPIdleTimeout
+func Packets(ws *websocket.Conn, conn net.Conn) error {
+	return bridge(ws, conn, maxDatagramSize, UDPIdleTimeout)
+}
+
+func bridge(ws *websocket.Conn, conn net.Conn, bufSize int, idle time.Duration) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go keepalive(ws, stop)
+
+	closeBoth := func() {
+		ws.Close()
+		conn.Close()
+	}
+	var idleTimer *time.Timer
+	touch := func() {}
+	if idle > 0 {
+		idleTimer = time.AfterFunc(idle, closeBoth)
+		defer idleTimer.Stop()
+		touch = func() { idleTimer.Reset(idle) }
+	}
+
+	errc := make(chan error, 2)
+	go func() {
+		for {
+			mt, data, err := ws.ReadMessage()
+			if err != nil {
+				errc <- err
+				return
+			}
+			if mt != websocket.BinaryMessage {
+				continue
+			}
+			touch()
+			if _, err := conn.Write(data); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, bufSize)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				touch()
+				if werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					errc <- werr
+					return
+				}
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	err := <-errc
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	closeBoth()
+
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return nil
+	}
+	return err
+}
+
+// keepalive pings the peer until stop is closed. WriteControl is safe to
+// call alongside the data writer.
+func keepalive(ws *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
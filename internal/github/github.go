@@ -1,12 +1,14 @@
 package github
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Client wraps the gh CLI for GitHub operations
@@ -153,6 +155,29 @@ func (c *Client) GetRemoteURL(repoPath string) string {
 	return url
 }
 
+// issueTimeout bounds how long gh may take to open an issue
+const issueTimeout = 30 * time.Second
+
+// CreateIssue opens an issue on the repo's GitHub remote and returns its URL
+func (c *Client) CreateIssue(repoPath, title, body string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), issueTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "gh", "issue", "create", "--title", title, "--body-file", "-")
+	cmd.Dir = repoPath // gh picks the repository from the checkout's remotes
+	cmd.Stdin = strings.NewReader(body)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("gh issue create: timed out after %s", issueTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("gh issue create: %s", strings.TrimSpace(string(output)))
+	}
+
+	// gh prints the new issue's URL as the last line
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1]), nil
+}
+
 // Init creates a new local git repository
 func (c *Client) Init(name string) (string, error) {
 	localPath := filepath.Join(c.reposDir, name)
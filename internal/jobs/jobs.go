@@ -0,0 +1,398 @@
+// Package jobs runs non-interactive commands in repos for the exec API. A
+// job's stdout and stderr go to a file as they are written, so the output
+// can be followed while the command runs and read back after it ended.
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+const (
+	// maxJobs is how many finished jobs are kept, with their output
+	maxJobs = 500
+	// maxRunning bounds the jobs running at the same time
+	maxRunning = 16
+	// maxOutput is how much output is kept per job; the rest is dropped
+	maxOutput = 16 << 20
+	// killDelay is how long a canceled job has to exit before it is killed,
+	// and how long output is read after the command exits
+	killDelay = 5 * time.Second
+	// idleInterval is how often followers hear from a job that is quiet
+	idleInterval = 30 * time.Second
+)
+
+// Job statuses
+const (
+	StatusRunning     = "running"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusCanceled    = "canceled"
+	StatusInterrupted = "interrupted"
+)
+
+var (
+	ErrNotFound   = errors.New("job not found")
+	ErrFinished   = errors.New("job has already finished")
+	ErrTooMany    = fmt.Errorf("%d jobs are already running", maxRunning)
+	ErrNoDatabase = errors.New("jobs need the database")
+)
+
+// Chunk is a piece of a job's output. A chunk without a stream is sent to
+// followers when the job has been quiet for a while.
+type Chunk struct {
+	Time   float64 `json:"t"` // Seconds since the job started
+	Stream string  `json:"s"` // "stdout" or "stderr"
+	Data   string  `json:"d"`
+}
+
+// Manager runs jobs and keeps track of the running ones
+type Manager struct {
+	store *store.Store
+	dir   string // output files
+
+	mu      sync.Mutex
+	running map[string]*run
+}
+
+// run is a job that is running
+type run struct {
+	cmd     *exec.Cmd
+	started time.Time
+	stdout  *streamWriter
+	stderr  *streamWriter
+	ended   chan struct{}
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	dropped  bool
+	canceled bool
+	changed  chan struct{} // closed and replaced when output is written or the job ends
+}
+
+// NewManager creates a job manager keeping output under dir. Jobs that were
+// running when homeportd last stopped are marked interrupted.
+func NewManager(st *store.Store, dir string) *Manager {
+	if st != nil {
+		st.InterruptExecJobs()
+	}
+	return &Manager{
+		store:   st,
+		dir:     dir,
+		running: make(map[string]*run),
+	}
+}
+
+// OutputPath returns the file holding a job's output, one JSON chunk per line
+func (m *Manager) OutputPath(id string) string {
+	return filepath.Join(m.dir, id+".jsonl")
+}
+
+// Start runs command with sh in dir
+func (m *Manager) Start(repoID, dir, command string) (*store.ExecJob, error) {
+	if m.store == nil {
+		return nil, ErrNoDatabase
+	}
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.running) >= maxRunning {
+		return nil, ErrTooMany
+	}
+
+	job := &store.ExecJob{
+		ID:        uuid.New().String(),
+		RepoID:    repoID,
+		Command:   command,
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+	}
+	file, err := os.OpenFile(m.OutputPath(job.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &run{
+		started: job.StartedAt,
+		ended:   make(chan struct{}),
+		file:    file,
+		changed: make(chan struct{}),
+	}
+	r.stdout = &streamWriter{run: r, stream: "stdout"}
+	r.stderr = &streamWriter{run: r, stream: "stderr"}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Stdout = r.stdout
+	cmd.Stderr = r.stderr
+	// In its own process group, so cancel reaches everything it started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Background processes holding on to stdout don't keep the job running
+	cmd.WaitDelay = killDelay
+	r.cmd = cmd
+
+	if err := cmd.Start(); err != nil {
+		file.Close()
+		os.Remove(m.OutputPath(job.ID))
+		return nil, err
+	}
+	if err := m.store.CreateExecJob(job); err != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+		file.Close()
+		os.Remove(m.OutputPath(job.ID))
+		return nil, err
+	}
+	m.running[job.ID] = r
+	go m.wait(job.ID, r)
+
+	if ids, err := m.store.PruneExecJobs(maxJobs); err == nil {
+		for _, id := range ids {
+			os.Remove(m.OutputPath(id))
+		}
+	}
+	return job, nil
+}
+
+// wait records how a job ended once its command exits, and kills whatever
+// it left running
+func (m *Manager) wait(id string, r *run) {
+	err := r.cmd.Wait()
+	syscall.Kill(-r.cmd.Process.Pid, syscall.SIGKILL)
+	r.stdout.flush()
+	r.stderr.flush()
+
+	status := StatusSucceeded
+	var exitCode *int
+	if state := r.cmd.ProcessState; state != nil {
+		code := state.ExitCode()
+		// Like shells, report death by signal as 128 + the signal
+		if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			code = 128 + int(ws.Signal())
+		}
+		exitCode = &code
+		if code != 0 {
+			status = StatusFailed
+		}
+	} else if err != nil {
+		status = StatusFailed
+	}
+
+	r.mu.Lock()
+	if r.canceled {
+		status = StatusCanceled
+	}
+	r.file.Close()
+	r.file = nil
+	r.mu.Unlock()
+
+	m.store.FinishExecJob(id, status, exitCode, time.Now())
+
+	m.mu.Lock()
+	delete(m.running, id)
+	m.mu.Unlock()
+
+	r.mu.Lock()
+	close(r.changed)
+	r.mu.Unlock()
+	close(r.ended)
+}
+
+// Cancel stops a running job: its process group gets SIGTERM, and SIGKILL
+// if it is still running after killDelay
+func (m *Manager) Cancel(id string) error {
+	m.mu.Lock()
+	r := m.running[id]
+	m.mu.Unlock()
+	if r == nil {
+		if _, err := m.Get(id); err != nil {
+			return err
+		}
+		return ErrFinished
+	}
+
+	r.mu.Lock()
+	r.canceled = true
+	r.mu.Unlock()
+
+	pid := r.cmd.Process.Pid
+	syscall.Kill(-pid, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-r.ended:
+		case <-time.After(killDelay):
+			syscall.Kill(-pid, syscall.SIGKILL)
+		}
+	}()
+	return nil
+}
+
+// Get returns a job
+func (m *Manager) Get(id string) (*store.ExecJob, error) {
+	if m.store == nil {
+		return nil, ErrNoDatabase
+	}
+	job, err := m.store.GetExecJob(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return job, nil
+}
+
+// List returns the jobs of a repo, or of all repos if repoID is empty,
+// newest first
+func (m *Manager) List(repoID string, limit int) ([]store.ExecJob, error) {
+	if m.store == nil {
+		return nil, ErrNoDatabase
+	}
+	return m.store.ListExecJobs(repoID, limit)
+}
+
+// Follow calls fn with a job's output from the start, then with new output
+// as the job writes it, and returns the job once it has ended. fn is called
+// with an empty chunk when the job has been quiet for a while, so streams can
+// be kept alive.
+func (m *Manager) Follow(ctx context.Context, id string, fn func(Chunk) error) (*store.ExecJob, error) {
+	if _, err := m.Get(id); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(m.OutputPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	idle := time.NewTimer(idleInterval)
+	defer idle.Stop()
+
+	var partial []byte
+	for {
+		// Watch for changes before catching up, so nothing written in
+		// between is missed
+		m.mu.Lock()
+		r := m.running[id]
+		m.mu.Unlock()
+		var changed chan struct{}
+		if r != nil {
+			r.mu.Lock()
+			changed = r.changed
+			r.mu.Unlock()
+		}
+
+		for {
+			line, err := reader.ReadBytes('\n')
+			partial = append(partial, line...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			var chunk Chunk
+			if err := json.Unmarshal(partial, &chunk); err == nil {
+				if err := fn(chunk); err != nil {
+					return nil, err
+				}
+			}
+			partial = partial[:0]
+		}
+
+		if r == nil {
+			return m.Get(id)
+		}
+
+		if !idle.Stop() {
+			select {
+			case <-idle.C:
+			default:
+			}
+		}
+		idle.Reset(idleInterval)
+		select {
+		case <-changed:
+		case <-idle.C:
+			if err := fn(Chunk{Time: time.Since(r.started).Seconds()}); err != nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// write appends output to the job's file and wakes its followers
+func (r *run) write(stream string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dropped || r.file == nil {
+		return
+	}
+
+	chunk := Chunk{Time: time.Since(r.started).Seconds(), Stream: stream, Data: string(data)}
+	if r.size+int64(len(data)) > maxOutput {
+		r.dropped = true
+		chunk = Chunk{Time: chunk.Time, Stream: "stderr", Data: fmt.Sprintf("\n[homeport: output past %d MiB dropped]\n", maxOutput>>20)}
+	}
+	line, _ := json.Marshal(chunk)
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		r.dropped = true
+	}
+	r.size += int64(len(data))
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// streamWriter writes one of a job's streams. A character split between two
+// writes is held back until it is complete, since chunks are JSON strings.
+type streamWriter struct {
+	run     *run
+	stream  string
+	pending []byte
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	n := len(data)
+	// Look for an incomplete character among the last three bytes
+	for i := n - 1; i >= 0 && i >= n-3; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				n = i
+			}
+			break
+		}
+	}
+	if n > 0 {
+		w.run.write(w.stream, data[:n])
+	}
+	w.pending = append([]byte(nil), data[n:]...)
+	return len(p), nil
+}
+
+// flush writes what was held back, once the command has exited
+func (w *streamWriter) flush() {
+	if len(w.pending) > 0 {
+		w.run.write(w.stream, w.pending)
+		w.pending = nil
+	}
+}
@@ -0,0 +1,95 @@
+// Package mailer sends transactional email (magic links for email-gated shares).
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gethomeport/homeport/internal/config"
+)
+
+// Mailer delivers a plain-text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// New creates a mailer for the configured driver
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("mail.smtp_host is required for the smtp driver")
+		}
+		return &SMTPMailer{cfg: cfg}, nil
+	case "file":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("mail.file is required for the file driver")
+		}
+		return &LogMailer{from: cfg.From, path: cfg.File}, nil
+	case "", "log":
+		return &LogMailer{from: cfg.From}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// SMTPMailer sends mail through an SMTP server (STARTTLS when offered)
+type SMTPMailer struct {
+	cfg config.MailConfig
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	addr := fmt.Sprintf("%s:%d", m.cfg.SMTPHost, m.cfg.SMTPPort)
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.SMTPHost)
+	}
+
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{to}, buildMessage(m.cfg.From, to, subject, body))
+}
+
+// LogMailer is a stand-in for development and testing. It writes messages
+// to the daemon log, or appends them to a file if a path is set.
+type LogMailer struct {
+	from string
+	path string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	if m.path == "" {
+		log.Printf("Mail to %s: %s\n%s", to, subject, body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "From %s %s\n%s\n", m.from, time.Now().Format(time.ANSIC), buildMessage(m.from, to, subject, body))
+	return err
+}
+
+// buildMessage formats an RFC 5322 message
+func buildMessage(from, to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
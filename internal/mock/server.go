@@ -0,0 +1,304 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// reloadInterval is how often mock files are checked for changes
+const reloadInterval = time.Second
+
+// maxRequestBody bounds the request body made available to templates
+const maxRequestBody = 1 << 20
+
+// Server is a running mock on one port
+type Server struct {
+	Port int
+	File string
+
+	mu       sync.RWMutex
+	spec     *Spec
+	modTime  time.Time
+	loadedAt time.Time
+	loadErr  string
+
+	srv  *http.Server
+	stop chan struct{}
+}
+
+// Info describes a running mock for the API
+type Info struct {
+	Port     int       `json:"port"`
+	File     string    `json:"file"`
+	Routes   int       `json:"routes"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Error    string    `json:"error,omitempty"` // last reload error; the previous routes stay active
+}
+
+// Info returns the mock's current state
+func (s *Server) Info() Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Info{Port: s.Port, File: s.File, Routes: len(s.spec.Routes), LoadedAt: s.loadedAt, Error: s.loadErr}
+}
+
+// reload re-reads the mock file if it changed. A broken file keeps the
+// previous routes so a half-saved edit doesn't take the mock down.
+func (s *Server) reload() {
+	fi, err := os.Stat(s.File)
+	if err != nil {
+		s.setError(err.Error())
+		return
+	}
+
+	s.mu.RLock()
+	unchanged := fi.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	spec, err := LoadFile(s.File)
+	if err != nil {
+		s.mu.Lock()
+		s.modTime = fi.ModTime()
+		s.loadErr = err.Error()
+		s.mu.Unlock()
+		log.Printf("Mock on port %d: keeping previous routes: %v", s.Port, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.spec, s.modTime, s.loadedAt, s.loadErr = spec, fi.ModTime(), time.Now(), ""
+	s.mu.Unlock()
+	log.Printf("Mock on port %d reloaded %s (%d routes)", s.Port, s.File, len(spec.Routes))
+}
+
+func (s *Server) setError(msg string) {
+	s.mu.Lock()
+	s.loadErr = msg
+	s.mu.Unlock()
+}
+
+func (s *Server) watch() {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.reload()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// ServeHTTP answers a request from the first matching route
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	spec := s.spec
+	s.mu.RUnlock()
+
+	if spec.CORS {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			if h := r.Header.Get("Access-Control-Request-Headers"); h != "" {
+				w.Header().Set("Access-Control-Allow-Headers", h)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	for i := range spec.Routes {
+		route := &spec.Routes[i]
+		if params, ok := route.match(r.Method, r.URL.Path); ok {
+			serveRoute(w, r, route, params)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": fmt.Sprintf("no mock route for %s %s", r.Method, r.URL.Path),
+	})
+}
+
+func serveRoute(w http.ResponseWriter, r *http.Request, route *Route, params map[string]string) {
+	if route.delay > 0 {
+		select {
+		case <-time.After(route.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	var body []byte
+	switch {
+	case route.JSON != nil:
+		w.Header().Set("Content-Type", "application/json")
+		body, _ = json.Marshal(route.JSON)
+	case route.tmpl != nil:
+		var buf bytes.Buffer
+		if err := route.tmpl.Execute(&buf, newTemplateData(r, params)); err != nil {
+			http.Error(w, fmt.Sprintf("mock template error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		body = buf.Bytes()
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}
+
+	for k, v := range route.Headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(route.Status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+func newTemplateData(r *http.Request, params map[string]string) templateData {
+	data := templateData{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Params:  params,
+		Query:   map[string]string{},
+		Headers: map[string]string{},
+	}
+	for k, v := range r.URL.Query() {
+		data.Query[k] = v[0]
+	}
+	for k, v := range r.Header {
+		data.Headers[k] = v[0]
+	}
+	if r.Body != nil {
+		raw, _ := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+		data.Body = string(raw)
+		var parsed interface{}
+		if json.Unmarshal(raw, &parsed) == nil {
+			data.JSON = parsed
+		}
+	}
+	return data
+}
+
+// Manager runs mock servers by port
+type Manager struct {
+	mu    sync.Mutex
+	mocks map[int]*Server
+}
+
+// NewManager creates a manager with no mocks running
+func NewManager() *Manager {
+	return &Manager{mocks: make(map[int]*Server)}
+}
+
+// Start serves the mock file on localhost:port and watches it for changes
+func (m *Manager) Start(port int, file string) (*Server, error) {
+	spec, err := LoadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.mocks[port]; ok {
+		return nil, fmt.Errorf("a mock is already running on port %d", port)
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("port %d is not available: %w", port, err)
+	}
+
+	s := &Server{
+		Port:     port,
+		File:     file,
+		spec:     spec,
+		modTime:  fi.ModTime(),
+		loadedAt: time.Now(),
+		stop:     make(chan struct{}),
+	}
+	s.srv = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("Mock on port %d stopped: %v", port, err)
+		}
+	}()
+	go s.watch()
+
+	m.mocks[port] = s
+	log.Printf("Mock serving %s on port %d (%d routes)", file, port, len(spec.Routes))
+	return s, nil
+}
+
+// Stop shuts down the mock on a port
+func (m *Manager) Stop(port int) error {
+	m.mu.Lock()
+	s, ok := m.mocks[port]
+	delete(m.mocks, port)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no mock running on port %d", port)
+	}
+	close(s.stop)
+	return s.srv.Close()
+}
+
+// StopAll shuts down every mock
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	ports := make([]int, 0, len(m.mocks))
+	for port := range m.mocks {
+		ports = append(ports, port)
+	}
+	m.mu.Unlock()
+
+	for _, port := range ports {
+		m.Stop(port)
+	}
+}
+
+// Get returns the mock on a port, or nil
+func (m *Manager) Get(port int) *Server {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mocks[port]
+}
+
+// List returns all running mocks ordered by port
+func (m *Manager) List() []Info {
+	m.mu.Lock()
+	servers := make([]*Server, 0, len(m.mocks))
+	for _, s := range m.mocks {
+		servers = append(servers, s)
+	}
+	m.mu.Unlock()
+
+	infos := make([]Info, 0, len(servers))
+	for _, s := range servers {
+		infos = append(infos, s.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Port < infos[j].Port })
+	return infos
+}
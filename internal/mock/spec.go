@@ -0,0 +1,199 @@
+// Package mock serves stub HTTP backends defined by a file of routes, so a
+// frontend can be developed before its real backend exists.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the contents of a mock file (YAML or JSON)
+type Spec struct {
+	CORS   bool    `yaml:"cors" json:"cors"` // allow any origin and answer preflight requests
+	Routes []Route `yaml:"routes" json:"routes"`
+}
+
+// Route is one stubbed endpoint
+type Route struct {
+	Method  string            `yaml:"method" json:"method,omitempty"` // empty matches any method
+	Path    string            `yaml:"path" json:"path"`               // "/users/{id}", "/files/*"
+	Status  int               `yaml:"status" json:"status,omitempty"` // default 200
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty"`
+	Body    string            `yaml:"body" json:"body,omitempty"` // Go template, see templateData
+	JSON    interface{}       `yaml:"json" json:"json,omitempty"` // sent as-is with a JSON content type
+	Delay   string            `yaml:"delay" json:"delay,omitempty"`
+
+	delay    time.Duration
+	segments []string
+	tmpl     *template.Template
+}
+
+// templateData is available to route body templates
+type templateData struct {
+	Method  string
+	Path    string
+	Params  map[string]string // path parameters
+	Query   map[string]string
+	Headers map[string]string
+	Body    string      // raw request body
+	JSON    interface{} // request body parsed as JSON, if it is JSON
+}
+
+var templateFuncs = template.FuncMap{
+	"uuid": func() string { return uuid.NewString() },
+	"now":  func() string { return time.Now().UTC().Format(time.RFC3339) },
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// LoadFile reads and validates a mock file
+func LoadFile(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a mock spec. JSON is accepted since it is valid YAML.
+func Parse(data []byte) (*Spec, error) {
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid mock file: %w", err)
+	}
+	if err := spec.compile(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// compile validates routes and prepares their matchers and templates
+func (s *Spec) compile() error {
+	if len(s.Routes) == 0 {
+		return fmt.Errorf("mock file has no routes")
+	}
+	for i := range s.Routes {
+		r := &s.Routes[i]
+		name := fmt.Sprintf("route %d (%s)", i+1, strings.TrimSpace(r.Method+" "+r.Path))
+
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("%s: path must start with /", name)
+		}
+		r.Method = strings.ToUpper(r.Method)
+		if r.Status == 0 {
+			r.Status = http.StatusOK
+		}
+		if r.Status < 100 || r.Status > 599 {
+			return fmt.Errorf("%s: invalid status %d", name, r.Status)
+		}
+		if r.Body != "" && r.JSON != nil {
+			return fmt.Errorf("%s: use either body or json, not both", name)
+		}
+		if r.Delay != "" {
+			d, err := time.ParseDuration(r.Delay)
+			if err != nil || d < 0 || d > time.Minute {
+				return fmt.Errorf("%s: invalid delay %q (e.g. 250ms, max 1m)", name, r.Delay)
+			}
+			r.delay = d
+		}
+		if r.JSON != nil {
+			r.JSON = normalizeYAML(r.JSON)
+		}
+		if r.Body != "" {
+			tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(r.Body)
+			if err != nil {
+				return fmt.Errorf("%s: invalid body template: %w", name, err)
+			}
+			r.tmpl = tmpl
+		}
+		r.segments = splitPath(r.Path)
+		for j, seg := range r.segments {
+			if seg == "*" && j != len(r.segments)-1 {
+				return fmt.Errorf("%s: * is only allowed at the end of a path", name)
+			}
+		}
+	}
+	return nil
+}
+
+// match reports whether the route handles a request, returning path parameters
+func (r *Route) match(method, path string) (map[string]string, bool) {
+	if r.Method != "" && r.Method != method && !(r.Method == http.MethodGet && method == http.MethodHead) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	parts := splitPath(path)
+	for i, seg := range r.segments {
+		if seg == "*" {
+			if i > len(parts) {
+				return nil, false
+			}
+			params["*"] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			params[seg[1:len(seg)-1]] = parts[i]
+			continue
+		}
+		if seg != parts[i] {
+			return nil, false
+		}
+	}
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// normalizeYAML converts the map[interface{}]interface{} values the YAML
+// decoder produces for non-string keys into maps encoding/json can marshal
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalizeYAML(val)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeYAML(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
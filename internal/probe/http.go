@@ -0,0 +1,216 @@
+package probe
+
+import (
+	"crypto/tls"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const userAgent = "homeport-probe"
+
+// maxPageSize caps how much of a page is read looking for its title and icons
+const maxPageSize = 512 << 10
+
+var (
+	httpClient = &http.Client{
+		Timeout:       Timeout,
+		Transport:     &http.Transport{DisableKeepAlives: true},
+		CheckRedirect: sameHostRedirect,
+	}
+	httpsClient = &http.Client{
+		Timeout: Timeout,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			ForceAttemptHTTP2: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, // dev certs are usually self-signed
+		},
+		CheckRedirect: sameHostRedirect,
+	}
+	h2cClient = &http.Client{
+		Timeout:       Timeout,
+		Transport:     h2cTransport,
+		CheckRedirect: sameHostRedirect,
+	}
+)
+
+// sameHostRedirect follows a few redirects (/ -> /login) but never off the port
+func sameHostRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 3 || req.URL.Host != via[0].URL.Host {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+var (
+	titleRegex = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	linkRegex  = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	attrRegex  = regexp.MustCompile(`(?is)\b(rel|href)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// inspectHTTP fetches the root page and fills in the server, framework,
+// title and icon. It returns false when the port doesn't answer HTTP.
+func inspectHTTP(res *Result, client *http.Client, base string) bool {
+	resp, body, err := get(client, base+"/")
+	if err != nil {
+		return false
+	}
+	res.Server = serverHint(resp.Header)
+
+	// WebSocket servers turn away plain requests, with 426 if they're polite
+	if resp.StatusCode == http.StatusUpgradeRequired ||
+		(resp.StatusCode >= 400 && res.Protocol == HTTP && speaksWebSocket(resp.Request.URL.Host)) {
+		res.Protocol = WebSocket
+		return true
+	}
+
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		res.Title = pageTitle(body)
+		res.Favicon = pageIcon(body, resp.Request.URL)
+	}
+	if res.Favicon == "" {
+		if icon, _, err := get(client, base+"/favicon.ico"); err == nil &&
+			icon.StatusCode == http.StatusOK && strings.HasPrefix(icon.Header.Get("Content-Type"), "image/") {
+			res.Favicon = "/favicon.ico"
+		}
+	}
+	res.Framework = framework(resp.Header, body)
+	return true
+}
+
+// get fetches a URL and reads the start of the body
+func get(client *http.Client, rawURL string) (*http.Response, string, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,*/*")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, "", err
+	}
+	return resp, string(body), nil
+}
+
+// serverHint joins the Server and X-Powered-By headers
+func serverHint(h http.Header) string {
+	var hints []string
+	for _, name := range []string{"Server", "X-Powered-By"} {
+		if v := strings.TrimSpace(h.Get(name)); v != "" {
+			hints = append(hints, v)
+		}
+	}
+	return truncate(strings.Join(hints, ", "), 100)
+}
+
+// pageTitle returns the page's <title>, whitespace collapsed
+func pageTitle(body string) string {
+	m := titleRegex.FindStringSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	return truncate(strings.Join(strings.Fields(html.UnescapeString(m[1])), " "), 100)
+}
+
+// pageIcon returns the path of the page's icon. Icons on other hosts and
+// data: URIs are skipped; the dashboard loads icons through the port proxy.
+func pageIcon(body string, page *url.URL) string {
+	var icon, touchIcon string
+	for _, tag := range linkRegex.FindAllString(body, -1) {
+		var rel, href string
+		for _, m := range attrRegex.FindAllStringSubmatch(tag, -1) {
+			v := m[2] + m[3] + m[4]
+			if strings.EqualFold(m[1], "rel") {
+				rel = strings.ToLower(v)
+			} else {
+				href = html.UnescapeString(v)
+			}
+		}
+		if href == "" || !strings.Contains(rel, "icon") {
+			continue
+		}
+		if strings.Contains(rel, "apple-touch-icon") {
+			if touchIcon == "" {
+				touchIcon = href
+			}
+		} else if icon == "" {
+			icon = href
+		}
+	}
+	if icon == "" {
+		icon = touchIcon
+	}
+	if icon == "" {
+		return ""
+	}
+
+	u, err := page.Parse(icon)
+	if err != nil || u.Host != page.Host || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return truncate(u.RequestURI(), 200)
+}
+
+// framework recognises common dev servers from their headers and markup
+func framework(h http.Header, body string) string {
+	server := strings.ToLower(h.Get("Server"))
+	poweredBy := strings.ToLower(h.Get("X-Powered-By"))
+	has := func(s ...string) bool {
+		for _, v := range s {
+			if strings.Contains(body, v) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case strings.Contains(poweredBy, "next.js") || has("__NEXT_DATA__", "/_next/static/"):
+		return "Next.js"
+	case strings.Contains(poweredBy, "nuxt") || has("__NUXT__", "/_nuxt/"):
+		return "Nuxt"
+	case has("__sveltekit"):
+		return "SvelteKit"
+	case has("__remixContext"):
+		return "Remix"
+	case has(`content="Astro`):
+		return "Astro"
+	case has("/@vite/client"):
+		return "Vite"
+	case has("/static/js/bundle.js"):
+		return "Create React App"
+	case has("/wp-content/", "/wp-includes/"):
+		return "WordPress"
+	case strings.Contains(server, "werkzeug"):
+		return "Flask"
+	case strings.Contains(server, "wsgiserver") && (h.Get("X-Frame-Options") == "DENY" || has("csrfmiddlewaretoken", "Django")):
+		return "Django"
+	case h.Get("X-Runtime") != "" || has(`name="csrf-param" content="authenticity_token"`):
+		return "Rails"
+	case strings.Contains(poweredBy, "express"):
+		return "Express"
+	case strings.Contains(poweredBy, "php"):
+		return "PHP"
+	}
+	return ""
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,265 @@
+// Package probe connects to listening ports to find out what they speak.
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Protocols a port can be detected as
+const (
+	HTTP      = "http"      // HTTP/1.1
+	HTTPS     = "https"     // HTTP over TLS
+	H2C       = "h2c"       // HTTP/2 without TLS (prior knowledge)
+	GRPC      = "grpc"      // gRPC over h2c
+	WebSocket = "websocket" // only answers WebSocket upgrades
+	Postgres  = "postgres"
+	Redis     = "redis"
+	MySQL     = "mysql"
+	Unknown   = "unknown" // accepts connections but none of the above
+)
+
+// Timeout bounds each probe so a stuck port can't hold up the others
+const Timeout = 2 * time.Second
+
+// greetingWait is how long to listen for protocols where the server talks
+// first (MySQL, SSH, SMTP) before sending anything ourselves
+const greetingWait = 300 * time.Millisecond
+
+// Result is what probing a port found out about it
+type Result struct {
+	Protocol  string // one of the constants above
+	Title     string // <title> of the root page
+	Favicon   string // path of the page's icon, e.g. "/favicon.svg"
+	Server    string // Server and X-Powered-By headers, or the greeting line
+	Framework string // "Vite", "Next.js", "Django", ...
+}
+
+// Fingerprint works out what host:port serves; an empty host means
+// localhost. Probes go from least to most intrusive: listen for a greeting,
+// try TLS, HTTP/2, a Redis PING (which HTTP servers answer with a 400) and
+// a Postgres SSL request, and only then a plain HTTP request. Ports that
+// speak both HTTP/2 and HTTP/1.1 count as HTTP unless they serve gRPC.
+func Fingerprint(host string, port int) Result {
+	if host == "" {
+		host = "localhost"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	if greeting, ok := readGreeting(addr); ok {
+		if isMySQLHandshake(greeting) {
+			return Result{Protocol: MySQL}
+		}
+		return Result{Protocol: Unknown, Server: bannerLine(greeting)}
+	}
+
+	if speaksTLS(addr) {
+		res := Result{Protocol: HTTPS}
+		inspectHTTP(&res, httpsClient, "https://"+addr)
+		return res
+	}
+
+	if speaksH2C(addr) {
+		if speaksGRPC(addr) {
+			return Result{Protocol: GRPC}
+		}
+		// Servers that also speak HTTP/1.1 are proxied with it, since
+		// WebSocket upgrades (HMR) don't work over HTTP/2
+		if !answersHTTP1(addr) {
+			res := Result{Protocol: H2C}
+			inspectHTTP(&res, h2cClient, "http://"+addr)
+			return res
+		}
+	}
+
+	reply := exchange(addr, []byte("PING\r\n"))
+	switch {
+	case bytes.HasPrefix(reply, []byte("+PONG")) || isRedisError(reply):
+		return Result{Protocol: Redis}
+	case !bytes.HasPrefix(reply, []byte("HTTP/")) && speaksPostgres(addr):
+		return Result{Protocol: Postgres}
+	}
+
+	res := Result{Protocol: HTTP}
+	if !inspectHTTP(&res, httpClient, "http://"+addr) {
+		res.Protocol = Unknown
+	}
+	return res
+}
+
+// readGreeting reports what the server sends before the client says anything
+func readGreeting(addr string) ([]byte, bool) {
+	conn, err := net.DialTimeout("tcp", addr, Timeout)
+	if err != nil {
+		return nil, false
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(greetingWait))
+
+	buf := make([]byte, 512)
+	n, _ := conn.Read(buf)
+	return buf[:n], n > 0
+}
+
+// isMySQLHandshake matches the initial packet of MySQL and MariaDB: a 3-byte
+// length, sequence 0, then protocol version 10 or an error packet (0xff)
+// when the client host isn't allowed
+func isMySQLHandshake(b []byte) bool {
+	if len(b) < 5 || b[3] != 0 {
+		return false
+	}
+	length := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+	return length > 0 && length < 1024 && (b[4] == 0x0a || b[4] == 0xff)
+}
+
+// bannerLine returns the first line of a text greeting ("SSH-2.0-OpenSSH_9.6")
+func bannerLine(b []byte) string {
+	line, _, _ := bytes.Cut(b, []byte("\n"))
+	line = bytes.TrimSpace(line)
+	for _, c := range line {
+		if c < 0x20 || c > 0x7e {
+			return ""
+		}
+	}
+	return truncate(string(line), 100)
+}
+
+// isRedisError matches RESP error replies like "-NOAUTH ..." or "-ERR ..."
+func isRedisError(b []byte) bool {
+	if len(b) < 2 || b[0] != '-' {
+		return false
+	}
+	word, _, _ := bytes.Cut(b[1:], []byte(" "))
+	return len(word) > 0 && bytes.Equal(word, bytes.ToUpper(word))
+}
+
+// exchange sends one message on a fresh connection and returns the start of the reply
+func exchange(addr string, msg []byte) []byte {
+	conn, err := net.DialTimeout("tcp", addr, Timeout)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(Timeout))
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil
+	}
+	buf := make([]byte, 64)
+	n, _ := io.ReadAtLeast(conn, buf, 1)
+	return buf[:n]
+}
+
+// speaksTLS checks whether the port completes a TLS handshake
+func speaksTLS(addr string) bool {
+	dialer := &net.Dialer{Timeout: Timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// speaksPostgres sends an SSLRequest, which Postgres answers with a single
+// 'S' or 'N' byte
+func speaksPostgres(addr string) bool {
+	reply := exchange(addr, []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f})
+	return len(reply) == 1 && (reply[0] == 'S' || reply[0] == 'N')
+}
+
+// h2Preface is what an HTTP/2 client sends first, followed by an empty SETTINGS frame
+var h2Preface = append([]byte(http2.ClientPreface), 0, 0, 0, 4, 0, 0, 0, 0, 0)
+
+// speaksH2C sends the HTTP/2 connection preface and checks that the server
+// answers with a SETTINGS frame. HTTP/1.1 servers reply with an error page.
+func speaksH2C(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, Timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(Timeout))
+
+	if _, err := conn.Write(h2Preface); err != nil {
+		return false
+	}
+	var frame [9]byte
+	if _, err := io.ReadFull(conn, frame[:]); err != nil {
+		return false
+	}
+	return http2.FrameType(frame[3]) == http2.FrameSettings
+}
+
+// answersHTTP1 checks whether the port replies to an HTTP/1.1 request with
+// an HTTP/1.1 response
+func answersHTTP1(addr string) bool {
+	reply := exchange(addr, []byte("HEAD / HTTP/1.1\r\nHost: "+addr+"\r\nUser-Agent: "+userAgent+"\r\nConnection: close\r\n\r\n"))
+	return bytes.HasPrefix(reply, []byte("HTTP/1."))
+}
+
+// speaksGRPC sends an empty gRPC call. gRPC servers answer any method,
+// even an unknown one, with a gRPC content type and a grpc-status.
+func speaksGRPC(addr string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	url := "http://" + addr + "/grpc.health.v1.Health/Check"
+	// An empty message: no compression, zero length
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(make([]byte, 5)))
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := h2cTransport.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc") ||
+		resp.Header.Get("Grpc-Status") != "" || resp.Trailer.Get("Grpc-Status") != ""
+}
+
+// speaksWebSocket checks whether the root path accepts a WebSocket upgrade
+func speaksWebSocket(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, Timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(Timeout))
+
+	req := "GET / HTTP/1.1\r\nHost: " + addr + "\r\nUser-Agent: " + userAgent + "\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return false
+	}
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	return err == nil && strings.HasPrefix(status, "HTTP/1.1 101")
+}
+
+// h2cTransport speaks HTTP/2 over plain TCP (prior knowledge, no upgrade)
+var h2cTransport = &http2.Transport{
+	AllowHTTP:       true,
+	IdleConnTimeout: Timeout,
+	DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	},
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// h2cTransport talks HTTP/2 to backends over plain TCP, which gRPC needs
+// for trailers and bidirectional streaming
+var h2cTransport = &http2.Transport{
+	AllowHTTP: true,
+	DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	},
+}
+
+// useHTTP2 switches a proxy to h2c, translating gRPC-Web on the way.
+// Upgrade requests still use HTTP/1.1.
+func useHTTP2(proxy *httputil.ReverseProxy) {
+	proxy.Transport = grpcWebTransport{h2cTransport}
+	// Stream every message as it arrives instead of buffering
+	proxy.FlushInterval = -1
+}
+
+// IsGRPC reports whether a request is a gRPC or gRPC-Web call
+func IsGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// isGRPCWeb matches binary gRPC-Web requests. The base64 "-text" variant
+// is passed through unchanged for backends that handle it themselves.
+func isGRPCWeb(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/grpc-web") &&
+		!strings.HasPrefix(contentType, "application/grpc-web-text")
+}
+
+// grpcWebTransport turns gRPC-Web calls from browsers into native gRPC for
+// the backend, moving the response trailers into the body where gRPC-Web
+// clients expect them
+type grpcWebTransport struct {
+	next http.RoundTripper
+}
+
+func (t grpcWebTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// HTTP/2 has no Upgrade, so WebSocket connections (HMR) go over HTTP/1.1
+	if req.Header.Get("Upgrade") != "" {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if !isGRPCWeb(contentType) {
+		return t.next.RoundTrip(req)
+	}
+
+	out := req.Clone(req.Context())
+	out.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(contentType, "application/grpc-web"))
+	out.Header.Set("TE", "trailers")
+	out.Header.Del("X-Grpc-Web")
+
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	respType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(respType, "application/grpc") {
+		resp.Header.Set("Content-Type", "application/grpc-web"+strings.TrimPrefix(respType, "application/grpc"))
+	}
+	// The transport fills in resp.Trailer once the body is read. Hand the
+	// proxy a copy without trailers so they only end up in the body.
+	web := *resp
+	web.Body = &grpcWebBody{body: resp.Body, resp: resp}
+	web.Trailer = nil
+	web.Header.Del("Trailer")
+	web.Header.Del("Content-Length")
+	web.ContentLength = -1
+	return &web, nil
+}
+
+// grpcWebBody passes the response through, then appends the trailers as a
+// gRPC-Web trailer frame (flag 0x80, length, "key: value\r\n" lines)
+type grpcWebBody struct {
+	body io.ReadCloser
+	resp *http.Response
+	tail *bytes.Reader
+}
+
+func (b *grpcWebBody) Read(p []byte) (int, error) {
+	if b.tail != nil {
+		return b.tail.Read(p)
+	}
+	n, err := b.body.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+
+	var block bytes.Buffer
+	for k, vv := range b.resp.Trailer {
+		for _, v := range vv {
+			block.WriteString(strings.ToLower(k) + ": " + v + "\r\n")
+		}
+	}
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = 0x80
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	if block.Len() == 0 {
+		frame = nil // trailers-only response: the status is already in the headers
+	} else {
+		frame = append(frame, block.Bytes()...)
+	}
+	b.tail = bytes.NewReader(frame)
+
+	if n > 0 {
+		return n, nil
+	}
+	return b.tail.Read(p)
+}
+
+func (b *grpcWebBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxInjectSize is the largest page that is buffered for injection; bigger
+// pages are passed through untouched
+const maxInjectSize = 5 << 20
+
+// acceptsHTML reports whether the request is likely a page navigation
+func acceptsHTML(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// injectHTML inserts the markup returned by snippet before the closing body
+// tag of an HTML response. Compressed, oversized and CSP-protected pages are
+// left alone: the first two can't be rewritten cheaply, and a
+// Content-Security-Policy would block the inline markup anyway.
+func injectHTML(resp *http.Response, snippet func() string) error {
+	if resp.Request == nil || !acceptsHTML(resp.Request) || resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" {
+		return nil
+	}
+	if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Content-Security-Policy") != "" {
+		return nil
+	}
+	if resp.ContentLength > maxInjectSize {
+		return nil
+	}
+
+	markup := snippet()
+	if markup == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxInjectSize+1))
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+	if len(body) > maxInjectSize {
+		// Chunked page turned out too big: send what was read, then the rest
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	// Insert before the last </body>, or append if the page has none
+	if i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>")); i != -1 {
+		body = append(body[:i], append([]byte(markup), body[i:]...)...)
+	} else {
+		body = append(body, markup...)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.TransferEncoding = nil
+	resp.Header.Del("ETag")
+	return nil
+}
@@ -2,18 +2,44 @@ package proxy
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
+// Options customizes a port proxy created by HandlerWithOptions
+type Options struct {
+	// ErrorHandler is called when the backend can't be reached.
+	// Defaults to a plain-text 502 response.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+	// InjectHTML returns markup inserted before </body> of HTML responses.
+	// It's only called for pages that can be rewritten; "" leaves the page as is.
+	InjectHTML func() string
+
+	// HTTP2 talks h2c to the backend, for gRPC and other HTTP/2-only servers.
+	// gRPC-Web requests are translated to gRPC.
+	HTTP2 bool
+
+	// Host is the address to connect to, such as "127.0.0.1" or "::1" for a
+	// server bound to one loopback family. Defaults to localhost. The Host
+	// header is localhost either way, which dev servers' host checks accept.
+	Host string
+}
+
 // Handler creates a reverse proxy handler for the given port
 // It strips the /{port} prefix from the path and proxies to localhost:{port}
 // WebSocket connections are handled automatically by httputil.ReverseProxy
 func Handler(port int) http.Handler {
-	// Use localhost instead of 127.0.0.1 to support both IPv4 and IPv6
-	target, _ := url.Parse(fmt.Sprintf("http://localhost:%d", port))
+	return HandlerWithOptions(port, Options{})
+}
+
+// HandlerWithOptions creates a port proxy like Handler with custom options
+func HandlerWithOptions(port int, opts Options) http.Handler {
+	target := backendURL(port, opts.Host)
 
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
@@ -48,14 +74,23 @@ func Handler(port int) http.Handler {
 		req.Header.Set("X-Forwarded-Host", req.Host)
 		req.Header.Set("X-Forwarded-Proto", "http")
 
-		// Important for WebSocket: preserve Host header
-		req.Host = target.Host
+		// Ask for an uncompressed page so the injected markup can be added
+		if opts.InjectHTML != nil && acceptsHTML(req) {
+			req.Header.Del("Accept-Encoding")
+		}
+
+		// Important for WebSocket: keep a Host header the dev server accepts,
+		// whichever address is dialed
+		req.Host = fmt.Sprintf("localhost:%d", port)
 	}
 
 	// Custom error handler
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 		http.Error(w, fmt.Sprintf("Proxy error: %v", err), http.StatusBadGateway)
 	}
+	if opts.ErrorHandler != nil {
+		proxy.ErrorHandler = opts.ErrorHandler
+	}
 
 	// Modify response to handle redirects correctly
 	proxy.ModifyResponse = func(resp *http.Response) error {
@@ -67,9 +102,16 @@ func Handler(port int) http.Handler {
 				resp.Header.Set("Location", fmt.Sprintf("/%d%s", port, location))
 			}
 		}
+		if opts.InjectHTML != nil {
+			return injectHTML(resp, opts.InjectHTML)
+		}
 		return nil
 	}
 
+	if opts.HTTP2 {
+		useHTTP2(proxy)
+	}
+
 	return proxy
 }
 
@@ -135,10 +177,24 @@ func HandlerWithHostAndBase(host string, port int, basePath string) http.Handler
 	return proxy
 }
 
+// backendURL is where a port's requests are sent
+func backendURL(port int, host string) *url.URL {
+	if host == "" {
+		host = "localhost"
+	}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(port))}
+}
+
 // HandlerDirect creates a reverse proxy handler that does NOT strip any path prefix.
 // Used for Referer-based routing where the request path should be forwarded as-is.
 func HandlerDirect(port int) http.Handler {
-	target, _ := url.Parse(fmt.Sprintf("http://localhost:%d", port))
+	return HandlerDirectWithOptions(port, Options{})
+}
+
+// HandlerDirectWithOptions creates a direct proxy like HandlerDirect. Only
+// ErrorHandler and HTTP2 apply; nothing is injected into assets.
+func HandlerDirectWithOptions(port int, opts Options) http.Handler {
+	target := backendURL(port, opts.Host)
 
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
@@ -156,13 +212,20 @@ func HandlerDirect(port int) http.Handler {
 		req.Header.Set("X-Forwarded-Host", req.Host)
 		req.Header.Set("X-Forwarded-Proto", "http")
 
-		// Important for WebSocket: preserve Host header
-		req.Host = target.Host
+		// Important for WebSocket: keep a Host header the dev server accepts,
+		// whichever address is dialed
+		req.Host = fmt.Sprintf("localhost:%d", port)
 	}
 
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 		http.Error(w, fmt.Sprintf("Proxy error: %v", err), http.StatusBadGateway)
 	}
+	if opts.ErrorHandler != nil {
+		proxy.ErrorHandler = opts.ErrorHandler
+	}
+	if opts.HTTP2 {
+		useHTTP2(proxy)
+	}
 
 	return proxy
 }
@@ -0,0 +1,145 @@
+// Package ratelimit provides per-client token buckets and transfer
+// accounting for shared ports.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// bucketIdleTTL is how long an unused bucket is kept before being dropped
+const bucketIdleTTL = 10 * time.Minute
+
+type bucketKey struct {
+	port int
+	ip   string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter holds a token bucket per (port, client IP)
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastPrune time.Time
+}
+
+// NewLimiter creates an empty limiter
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[bucketKey]*bucket), lastPrune: time.Now()}
+}
+
+// Allow takes a token from the client's bucket for the port. Buckets refill
+// at rps tokens per second and hold up to twice that, so a page load's burst
+// of asset requests gets through. When the bucket is empty it returns false
+// and how long until the next token is available.
+func (l *Limiter) Allow(port int, ip string, rps int) (bool, time.Duration) {
+	if rps <= 0 {
+		return true, 0
+	}
+	burst := float64(2 * rps)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) > bucketIdleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	key := bucketKey{port: port, ip: ip}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*float64(rps))
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / float64(rps) * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Reset drops all buckets for a port (e.g. when its limits change)
+func (l *Limiter) Reset(port int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k := range l.buckets {
+		if k.port == port {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Counter is the traffic served through a share
+type Counter struct {
+	Requests int64
+	Bytes    int64
+}
+
+// Usage accumulates per-port traffic in memory until it is flushed to the store
+type Usage struct {
+	mu      sync.Mutex
+	pending map[int]*Counter
+}
+
+// NewUsage creates an empty usage tracker
+func NewUsage() *Usage {
+	return &Usage{pending: make(map[int]*Counter)}
+}
+
+// Add records a served request
+func (u *Usage) Add(port int, bytes int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	c, ok := u.pending[port]
+	if !ok {
+		c = &Counter{}
+		u.pending[port] = c
+	}
+	c.Requests++
+	c.Bytes += bytes
+}
+
+// Pending returns the not-yet-flushed traffic for a port
+func (u *Usage) Pending(port int) Counter {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if c, ok := u.pending[port]; ok {
+		return *c
+	}
+	return Counter{}
+}
+
+// Flush returns all pending counters and clears them
+func (u *Usage) Flush() map[int]Counter {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := make(map[int]Counter, len(u.pending))
+	for port, c := range u.pending {
+		out[port] = *c
+	}
+	u.pending = make(map[int]*Counter)
+	return out
+}
+
+// Discard drops pending counters for a port (e.g. when its share is reset)
+func (u *Usage) Discard(port int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.pending, port)
+}
@@ -0,0 +1,40 @@
+package ratelimit
+
+import "net/http"
+
+// CountingWriter wraps a ResponseWriter and counts the body bytes written,
+// remembering the status code for access logs. Unwrap lets
+// http.ResponseController reach the underlying writer, so flushing and
+// WebSocket hijacking keep working through the proxy.
+type CountingWriter struct {
+	http.ResponseWriter
+	Bytes  int64
+	Status int
+}
+
+func (w *CountingWriter) WriteHeader(status int) {
+	if w.Status == 0 {
+		w.Status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *CountingWriter) Write(b []byte) (int, error) {
+	if w.Status == 0 {
+		w.Status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.Bytes += int64(n)
+	return n, err
+}
+
+// Flush forwards to the underlying writer for streaming responses
+func (w *CountingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *CountingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
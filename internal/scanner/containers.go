@@ -0,0 +1,81 @@
+package scanner
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gethomeport/homeport/internal/docker"
+)
+
+// SetDocker lets the scanner label ports published by containers and find
+// the repo of compose projects. Pass nil to turn it off.
+func (s *Scanner) SetDocker(c *docker.Client) {
+	s.docker = c
+}
+
+// containers lists running containers, or nil when Docker isn't reachable.
+// Failures are logged once rather than on every scan.
+func (s *Scanner) containers() []docker.Container {
+	if s.docker == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	list, err := s.docker.Containers(ctx)
+	if err != nil {
+		if !s.dockerDown.Swap(true) {
+			log.Printf("Port scanner: Docker API unavailable, container ports won't be resolved: %v", err)
+		}
+		return nil
+	}
+	if s.dockerDown.Swap(false) {
+		log.Printf("Port scanner: Docker API reachable again")
+	}
+	return list
+}
+
+// addContainerPorts labels ports published by containers with the container
+// and its compose directory. The host side of a published port is usually
+// held by docker-proxy; with the userland proxy disabled nothing listens at
+// all, so published ports missing from the socket table are added.
+func (s *Scanner) addContainerPorts(ports []RawPort, containers []docker.Container) []RawPort {
+	found := make(map[int]bool, len(ports))
+	for i := range ports {
+		rp := &ports[i]
+		found[rp.Port] = true
+		for _, ctr := range containers {
+			if ctr.Publishes(rp.Port) == nil {
+				continue
+			}
+			rp.Container = ctr.Service()
+			rp.WorkingDir = ctr.WorkingDir()
+			if rp.PID == 0 || rp.ProcessName == "docker-proxy" {
+				rp.ProcessName = ctr.Name
+			}
+			break
+		}
+	}
+
+	var published []RawPort
+	for _, ctr := range containers {
+		for _, p := range ctr.Ports {
+			if p.Type != "tcp" || p.PublicPort < s.minPort || p.PublicPort > s.maxPort || found[p.PublicPort] {
+				continue
+			}
+			addr := p.IP
+			if addr == "" {
+				addr = "0.0.0.0"
+			}
+			published = append(published, RawPort{
+				Port:        p.PublicPort,
+				ProcessName: ctr.Name,
+				Addresses:   []string{addr},
+				Container:   ctr.Service(),
+				WorkingDir:  ctr.WorkingDir(),
+			})
+		}
+	}
+	return append(ports, mergeSockets(published)...)
+}
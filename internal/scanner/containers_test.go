@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gethomeport/homeport/internal/docker"
+)
+
+// fakeDocker serves a Docker Engine API with one compose container
+// publishing 3000 (held by docker-proxy) and 5433 (no listener, as with the
+// userland proxy disabled)
+func fakeDocker(t *testing.T, reposDir string) *docker.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"State": map[string]int{"Pid": 4242}})
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]interface{}{{
+			"Id":    "abc",
+			"Names": []string{"/shop-web-1"},
+			"Labels": map[string]string{
+				docker.LabelProject:    "shop",
+				docker.LabelService:    "web",
+				docker.LabelWorkingDir: reposDir + "/shop/deploy",
+			},
+			"Ports": []map[string]interface{}{
+				{"IP": "0.0.0.0", "PrivatePort": 80, "PublicPort": 3000, "Type": "tcp"},
+				{"IP": "127.0.0.1", "PrivatePort": 5432, "PublicPort": 5433, "Type": "tcp"},
+				{"IP": "0.0.0.0", "PrivatePort": 53, "PublicPort": 5353, "Type": "udp"},
+				{"IP": "0.0.0.0", "PrivatePort": 22, "PublicPort": 2222, "Type": "tcp"},
+			},
+		}})
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := docker.NewClient("tcp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestAddContainerPorts(t *testing.T) {
+	reposDir := "/srv/homeport/repos"
+	s := New(3000, 9999, reposDir)
+	s.SetDocker(fakeDocker(t, reposDir))
+
+	containers := s.containers()
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers, want 1", len(containers))
+	}
+
+	sockets := []RawPort{
+		{Port: 3000, PID: 100, ProcessName: "docker-proxy", Addresses: []string{"0.0.0.0"}},
+		{Port: 4000, PID: 200, ProcessName: "node", Addresses: []string{"127.0.0.1"}},
+	}
+	ports := s.addContainerPorts(sockets, containers)
+
+	byPort := make(map[int]RawPort)
+	for _, rp := range ports {
+		byPort[rp.Port] = rp
+	}
+	if len(ports) != 3 {
+		t.Errorf("got ports %v, want 3000, 4000 and 5433", ports)
+	}
+
+	// Held by docker-proxy: labeled with the container
+	web := byPort[3000]
+	if web.Container != "shop/web" || web.ProcessName != "shop-web-1" || web.PID != 100 {
+		t.Errorf("port 3000 = %+v", web)
+	}
+	if web.WorkingDir != reposDir+"/shop/deploy" {
+		t.Errorf("port 3000 working dir = %q", web.WorkingDir)
+	}
+
+	// Not published by a container: untouched
+	if node := byPort[4000]; node.Container != "" || node.ProcessName != "node" {
+		t.Errorf("port 4000 = %+v", node)
+	}
+
+	// Published without a listener: added from the container
+	db, ok := byPort[5433]
+	if !ok {
+		t.Fatal("port 5433 published without a listener was not added")
+	}
+	if db.PID != 0 || db.Container != "shop/web" || len(db.Addresses) != 1 || db.Addresses[0] != "127.0.0.1" {
+		t.Errorf("port 5433 = %+v", db)
+	}
+
+	// The compose directory maps to the repo it is in
+	if repo := s.findRepoForDir(db.WorkingDir); repo != "shop" {
+		t.Errorf("repo for %q = %q, want shop", db.WorkingDir, repo)
+	}
+}
+
+func TestAddContainerPortsWithoutDocker(t *testing.T) {
+	s := New(3000, 9999, "/srv/homeport/repos")
+	sockets := []RawPort{{Port: 3000, PID: 100, ProcessName: "docker-proxy"}}
+
+	ports := s.addContainerPorts(sockets, s.containers())
+	if len(ports) != 1 || ports[0].ProcessName != "docker-proxy" || ports[0].Container != "" {
+		t.Errorf("ports = %+v", ports)
+	}
+}
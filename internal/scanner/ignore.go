@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gethomeport/homeport/internal/config"
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+// IgnoreRules decides which listeners are left out of the port list
+type IgnoreRules struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	port    int
+	process *regexp.Regexp
+	command *regexp.Regexp
+}
+
+// ParseIgnoreRules compiles rules from the config
+func ParseIgnoreRules(rules []config.IgnoreRule) (*IgnoreRules, error) {
+	if err := config.ValidateIgnoreRules(rules); err != nil {
+		return nil, err
+	}
+	compiled := make([]ignoreRule, len(rules))
+	for i, rule := range rules {
+		compiled[i].port = rule.Port
+		if rule.Process != "" {
+			compiled[i].process = regexp.MustCompile(rule.Process)
+		}
+		if rule.Command != "" {
+			compiled[i].command = regexp.MustCompile(rule.Command)
+		}
+	}
+	return &IgnoreRules{rules: compiled}, nil
+}
+
+// Matches reports whether any rule matches the port
+func (r *IgnoreRules) Matches(p *store.Port) bool {
+	if r == nil {
+		return false
+	}
+	for _, rule := range r.rules {
+		if rule.port != 0 && rule.port != p.Port {
+			continue
+		}
+		if rule.process != nil && !rule.process.MatchString(p.ProcessName) {
+			continue
+		}
+		if rule.command != nil && !rule.command.MatchString(p.Command) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// SetIgnoreRules replaces the global ignore rules
+func (s *Scanner) SetIgnoreRules(rules *IgnoreRules) {
+	s.ignore = rules
+}
+
+// Ignored reports whether the port matches the global rules or those in
+// its repo's config file
+func (s *Scanner) Ignored(p *store.Port) bool {
+	if s.ignore.Matches(p) {
+		return true
+	}
+	if p.RepoID == "" {
+		return false
+	}
+	return s.repoRules.get(filepath.Join(s.reposDir, p.RepoID)).Matches(p)
+}
+
+// repoRuleCache keeps each repo's parsed ignore rules until its config
+// file changes
+type repoRuleCache struct {
+	mu      sync.Mutex
+	entries map[string]repoRules
+}
+
+type repoRules struct {
+	modTime time.Time
+	rules   *IgnoreRules
+}
+
+func (c *repoRuleCache) get(repoPath string) *IgnoreRules {
+	var modTime time.Time
+	if info, err := os.Stat(filepath.Join(repoPath, config.RepoConfigFile)); err == nil {
+		modTime = info.ModTime()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[repoPath]; ok && entry.modTime.Equal(modTime) {
+		return entry.rules
+	}
+
+	var rules *IgnoreRules
+	if !modTime.IsZero() {
+		cfg, err := config.LoadRepoConfig(repoPath)
+		if err == nil {
+			rules, err = ParseIgnoreRules(cfg.IgnorePorts)
+		}
+		if err != nil {
+			log.Printf("Ignoring %s in %s: %v", config.RepoConfigFile, repoPath, err)
+		}
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]repoRules)
+	}
+	c.entries[repoPath] = repoRules{modTime: modTime, rules: rules}
+	return rules
+}
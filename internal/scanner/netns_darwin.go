@@ -0,0 +1,11 @@
+//go:build darwin
+
+package scanner
+
+import "github.com/gethomeport/homeport/internal/docker"
+
+// namespacePorts finds nothing on macOS, which has no network namespaces.
+// Docker Desktop publishes container ports through its own host process.
+func namespacePorts(minPort, maxPort int, containers []docker.Container) []RawPort {
+	return nil
+}
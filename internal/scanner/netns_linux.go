@@ -0,0 +1,229 @@
+//go:build linux
+
+package scanner
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gethomeport/homeport/internal/docker"
+)
+
+// nsSocketOwners resolves socket owners in other network namespaces. It is
+// kept apart from socketOwners so the host cache isn't pruned of them.
+var nsSocketOwners = &inodeCache{owners: make(map[uint32]owner)}
+
+// namespacePorts finds listening ports in network namespaces other than
+// our own: containers that don't publish the port, `ip netns` sandboxes,
+// rootless podman. Each namespace is read through /proc/<pid>/net/tcp of
+// one process inside it, which needs homeportd in the host PID namespace.
+// Loopback-only listeners are skipped since they can't be reached from
+// here, as are ports the namespace's container already publishes.
+func namespacePorts(minPort, maxPort int, containers []docker.Container) []RawPort {
+	if !hostPIDNamespace() {
+		return nil
+	}
+	self, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		return nil
+	}
+
+	byNamespace := make(map[string]*docker.Container)
+	for i := range containers {
+		if containers[i].PID <= 0 {
+			continue
+		}
+		if ns, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(containers[i].PID), "ns", "net")); err == nil {
+			byNamespace[ns] = &containers[i]
+		}
+	}
+
+	type namespace struct {
+		name      string
+		pid       int
+		ctr       *docker.Container
+		listeners []listener
+	}
+	var namespaces []namespace
+	var inodes []uint32
+	for ns, pid := range processNamespaces.others(self) {
+		n := namespace{name: ns, pid: pid, ctr: byNamespace[ns]}
+		for _, table := range []string{"tcp", "tcp6"} {
+			found, err := readProcNetTCP(filepath.Join("/proc", strconv.Itoa(pid), "net", table), minPort, maxPort)
+			if err != nil {
+				continue
+			}
+			for _, l := range found {
+				ip := net.ParseIP(l.addr)
+				if ip == nil || ip.IsLoopback() || (n.ctr != nil && publishesPrivate(n.ctr, l.port)) {
+					continue
+				}
+				n.listeners = append(n.listeners, l)
+				inodes = append(inodes, l.inode)
+			}
+		}
+		if len(n.listeners) > 0 {
+			namespaces = append(namespaces, n)
+		}
+	}
+	owners := nsSocketOwners.lookup(inodes)
+
+	var ports []RawPort
+	for _, n := range namespaces {
+		sockets := make([]RawPort, len(n.listeners))
+		for i, l := range n.listeners {
+			o := owners[l.inode]
+			sockets[i] = RawPort{Port: l.port, PID: o.pid, ProcessName: o.name, Addresses: []string{l.addr}}
+		}
+
+		dialAddr := namespaceAddr(n.pid, n.ctr)
+		for _, rp := range mergeSockets(sockets) {
+			rp.Namespace = n.name
+			rp.DialAddr = dialAddr
+			// A port bound to one address is reached there
+			for _, addr := range rp.Addresses {
+				if !net.ParseIP(addr).IsUnspecified() {
+					rp.DialAddr = addr
+					break
+				}
+			}
+			if rp.DialAddr == "" {
+				continue // no address the host can reach
+			}
+			if n.ctr != nil {
+				rp.Namespace = "container:" + n.ctr.Name
+				rp.Container = n.ctr.Service()
+				rp.WorkingDir = n.ctr.WorkingDir()
+			}
+			ports = append(ports, rp)
+		}
+	}
+	return ports
+}
+
+// hostPIDNamespace reports whether homeportd runs in the host's PID
+// namespace. In a PID namespace of its own /proc only holds its own
+// processes, so there are no other network namespaces to find. NSpid lists
+// the process's PID in each nested namespace; kernels without it predate
+// the check and are assumed to be the host.
+var hostPIDNamespace = sync.OnceValue(func() bool {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if rest, ok := strings.CutPrefix(line, "NSpid:"); ok {
+			return len(strings.Fields(rest)) == 1
+		}
+	}
+	return true
+})
+
+// namespaceRefresh is how often the namespace of every process is read
+// again, for processes that moved after they started (ip netns exec)
+const namespaceRefresh = time.Minute
+
+// processNamespaces remembers the network namespace of each process
+var processNamespaces = &namespaceCache{pids: make(map[int]string)}
+
+// namespaceCache keeps the namespace of each process, so a scan only reads
+// /proc/<pid>/ns/net for processes started since the one before
+type namespaceCache struct {
+	mu      sync.Mutex
+	pids    map[int]string
+	fetched time.Time
+}
+
+// others maps each network namespace other than self to one process inside it
+func (c *namespaceCache) others(self string) map[string]int {
+	namespaces := make(map[string]int)
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return namespaces
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.fetched) > namespaceRefresh {
+		c.pids = make(map[int]string)
+		c.fetched = time.Now()
+	}
+
+	current := make(map[int]string, len(procs))
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || !proc.IsDir() {
+			continue
+		}
+		ns, ok := c.pids[pid]
+		if !ok {
+			if ns, err = os.Readlink(filepath.Join("/proc", proc.Name(), "ns", "net")); err != nil {
+				continue
+			}
+		}
+		current[pid] = ns
+		if _, ok := namespaces[ns]; !ok && ns != self {
+			namespaces[ns] = pid
+		}
+	}
+	// Drop processes that exited
+	c.pids = current
+	return namespaces
+}
+
+// reset empties the cache, for measuring cold scans
+func (c *namespaceCache) reset() {
+	c.mu.Lock()
+	c.pids = make(map[int]string)
+	c.fetched = time.Time{}
+	c.mu.Unlock()
+}
+
+// publishesPrivate reports whether the container publishes its port on the host
+func publishesPrivate(ctr *docker.Container, port int) bool {
+	for _, p := range ctr.Ports {
+		if p.PrivatePort == port && p.PublicPort != 0 && p.Type == "tcp" {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceAddr picks an address the host can reach a namespace on: the
+// container's IP from Docker, otherwise the first non-loopback local
+// address in the namespace's routing table
+func namespaceAddr(pid int, ctr *docker.Container) string {
+	if ctr != nil && len(ctr.IPs) > 0 {
+		return ctr.IPs[0]
+	}
+
+	file, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "net", "fib_trie"))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	// Local addresses show up as a "|-- 10.0.0.2" line followed by
+	// "/32 host LOCAL"
+	var last string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "|-- ") {
+			last = strings.TrimPrefix(line, "|-- ")
+			continue
+		}
+		if line == "/32 host LOCAL" {
+			if ip := net.ParseIP(last); ip != nil && !ip.IsLoopback() {
+				return last
+			}
+		}
+	}
+	return ""
+}
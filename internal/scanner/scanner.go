@@ -1,11 +1,15 @@
 package scanner
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/gethomeport/homeport/internal/docker"
 	"github.com/gethomeport/homeport/internal/store"
 )
 
@@ -13,6 +17,12 @@ type Scanner struct {
 	minPort  int
 	maxPort  int
 	reposDir string
+
+	docker     *docker.Client
+	dockerDown atomic.Bool // last Docker API call failed
+
+	ignore    *IgnoreRules
+	repoRules repoRuleCache
 }
 
 func New(minPort, maxPort int, reposDir string) *Scanner {
@@ -31,23 +41,49 @@ func (s *Scanner) Scan() ([]store.Port, error) {
 		return nil, err
 	}
 
+	containers := s.containers()
+	rawPorts = s.addContainerPorts(rawPorts, containers)
+
+	// Listeners in other network namespaces, unless the port number is
+	// already taken on the host (ports are keyed by number)
+	taken := make(map[int]bool, len(rawPorts))
+	for _, rp := range rawPorts {
+		taken[rp.Port] = true
+	}
+	for _, rp := range namespacePorts(s.minPort, s.maxPort, containers) {
+		if !taken[rp.Port] {
+			taken[rp.Port] = true
+			rawPorts = append(rawPorts, rp)
+		}
+	}
+
 	now := time.Now()
 	ports := make([]store.Port, 0, len(rawPorts))
 
 	for _, rp := range rawPorts {
 		p := store.Port{
-			Port:        rp.Port,
-			PID:         rp.PID,
-			ProcessName: rp.ProcessName,
-			Command:     rp.Command,
-			ShareMode:   "private",
-			FirstSeen:   now,
-			LastSeen:    now,
+			Port:          rp.Port,
+			PID:           rp.PID,
+			ProcessName:   rp.ProcessName,
+			Command:       rp.Command,
+			BindAddresses: rp.Addresses,
+			Family:        rp.Family,
+			Container:     rp.Container,
+			Namespace:     rp.Namespace,
+			DialAddr:      rp.DialAddr,
+			ShareMode:     "private",
+			FirstSeen:     now,
+			LastSeen:      now,
+		}
+
+		// Compose projects belong to the repo their compose file is in
+		if rp.WorkingDir != "" {
+			p.RepoID = s.findRepoForDir(rp.WorkingDir)
 		}
 
 		// Try to associate with a repo by checking process CWD
 		if rp.PID > 0 {
-			if repoID := s.findRepoForPID(rp.PID); repoID != "" {
+			if repoID := s.findRepoForPID(rp.PID); repoID != "" && p.RepoID == "" {
 				p.RepoID = repoID
 			}
 			// Get full command if not already set
@@ -70,9 +106,13 @@ func (s *Scanner) findRepoForPID(pid int) string {
 	if err != nil {
 		return ""
 	}
+	return s.findRepoForDir(cwd)
+}
 
+// findRepoForDir returns the repo a directory belongs to
+func (s *Scanner) findRepoForDir(dir string) string {
 	// Normalize path
-	cwd = filepath.Clean(cwd)
+	cwd := filepath.Clean(dir)
 
 	// Check multiple possible repo directory patterns
 	// This handles cross-container scenarios where paths differ:
@@ -110,9 +150,172 @@ type RawPort struct {
 	PID         int
 	ProcessName string
 	Command     string
+	Addresses   []string // local addresses of the listening sockets, e.g. "127.0.0.1", "::"
+	Family      string   // "ipv4", "ipv6" or "dual"
+	Container   string   // container publishing or running the port ("project/service")
+	WorkingDir  string   // compose project directory, for finding the repo
+	Namespace   string   // network namespace when not the host's
+	DialAddr    string   // address to reach a port in another namespace
+}
+
+// mergeSockets combines listening sockets into one RawPort per port number,
+// keeping the first owner found and every bind address. A server often
+// listens on both 127.0.0.1 and ::1, or 0.0.0.0 and ::.
+func mergeSockets(sockets []RawPort) []RawPort {
+	var ports []RawPort
+	index := make(map[int]int)
+	for _, sock := range sockets {
+		i, ok := index[sock.Port]
+		if !ok {
+			index[sock.Port] = len(ports)
+			sock.Addresses = append([]string(nil), sock.Addresses...)
+			ports = append(ports, sock)
+			continue
+		}
+		p := &ports[i]
+		if p.PID == 0 {
+			p.PID, p.ProcessName = sock.PID, sock.ProcessName
+		}
+		for _, addr := range sock.Addresses {
+			if !containsString(p.Addresses, addr) {
+				p.Addresses = append(p.Addresses, addr)
+			}
+		}
+	}
+	for i := range ports {
+		ports[i].Family = addressFamily(ports[i].Addresses)
+	}
+	return ports
+}
+
+// addressFamily describes a set of bind addresses as "ipv4", "ipv6" or "dual"
+func addressFamily(addrs []string) string {
+	var v4, v6 bool
+	for _, addr := range addrs {
+		if strings.Contains(addr, ":") {
+			v6 = true
+		} else if addr != "" {
+			v4 = true
+		}
+	}
+	switch {
+	case v4 && v6:
+		return "dual"
+	case v6:
+		return "ipv6"
+	case v4:
+		return "ipv4"
+	}
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchInterval is how often Watch checks for ports opening or closing
+const WatchInterval = 250 * time.Millisecond
+
+var errWatchUnsupported = errors.New("watching listeners is not supported on this platform")
+
+// Watch calls onChange soon after a port in range starts or stops
+// listening, by hashing the kernel's listener table every WatchInterval.
+// The kernel has no notification for new listeners, but over netlink the
+// check costs a fraction of a full scan. Watch returns false, without
+// starting anything, where that isn't possible; callers then rely on
+// periodic scans alone.
+func (s *Scanner) Watch(stop <-chan struct{}, onChange func()) bool {
+	last, err := listenSignature(s.minPort, s.maxPort)
+	if err != nil {
+		return false
+	}
+
+	go func() {
+		ticker := time.NewTicker(WatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sig, err := listenSignature(s.minPort, s.maxPort)
+				if err != nil || sig == last {
+					continue
+				}
+				last = sig
+				onChange()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return true
+}
+
+// backend is one way of listing listening ports
+type backend struct {
+	name        string
+	description string
+	scan        func(minPort, maxPort int) ([]RawPort, error)
+}
+
+// BenchResult is the average cost of one scan with a backend
+type BenchResult struct {
+	Backend     string
+	Description string
+	Ports       int
+	Wall        time.Duration
+	CPU         time.Duration // user + system time of this process
+	Err         error
+}
+
+// Bench runs every backend available on this platform n times and reports
+// the average time per scan
+func (s *Scanner) Bench(n int) []BenchResult {
+	var results []BenchResult
+	for _, b := range backends() {
+		r := BenchResult{Backend: b.name, Description: b.description}
+
+		// Warm up once so every backend starts from the same state
+		ports, err := b.scan(s.minPort, s.maxPort)
+		if err != nil {
+			r.Err = err
+			results = append(results, r)
+			continue
+		}
+		r.Ports = len(ports)
+
+		cpuStart := cpuTime()
+		start := time.Now()
+		for i := 0; i < n; i++ {
+			if _, err := b.scan(s.minPort, s.maxPort); err != nil {
+				r.Err = err
+				break
+			}
+		}
+		r.Wall = time.Since(start) / time.Duration(n)
+		r.CPU = (cpuTime() - cpuStart) / time.Duration(n)
+		results = append(results, r)
+	}
+	return results
+}
+
+// cpuTime is the user and system CPU time used by this process so far
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
 }
 
 // Platform-specific functions are defined in scanner_darwin.go and scanner_linux.go:
 // - scanPorts(minPort, maxPort int) ([]RawPort, error)
+// - listenSignature(minPort, maxPort int) (uint64, error)
+// - backends() []backend
 // - getProcessCWD(pid int) (string, error)
 // - getProcessCommand(pid int) (string, error)
+// - namespacePorts(minPort, maxPort int, containers []docker.Container) []RawPort
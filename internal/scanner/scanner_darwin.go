@@ -5,6 +5,7 @@ package scanner
 import (
 	"bufio"
 	"fmt"
+	"net"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -27,8 +28,7 @@ func scanPorts(minPort, maxPort int) ([]RawPort, error) {
 		return nil, err
 	}
 
-	var ports []RawPort
-	seen := make(map[int]bool)
+	var sockets []RawPort
 
 	scanner := bufio.NewScanner(strings.NewReader(string(output)))
 	for scanner.Scan() {
@@ -60,20 +60,48 @@ func scanPorts(minPort, maxPort int) ([]RawPort, error) {
 			continue
 		}
 
-		// Skip duplicates (same port can appear multiple times for IPv4/IPv6)
-		if seen[port] {
-			continue
-		}
-		seen[port] = true
-
-		ports = append(ports, RawPort{
+		// The same port shows up once per socket (IPv4/IPv6); mergeSockets
+		// combines them
+		sockets = append(sockets, RawPort{
 			Port:        port,
 			PID:         pid,
 			ProcessName: processName,
+			Addresses:   []string{addressFromLsof(nameField, fields[4])},
 		})
 	}
 
-	return ports, nil
+	return mergeSockets(sockets), nil
+}
+
+// addressFromLsof extracts the bind address from an lsof name field,
+// turning "*" into the wildcard address of the socket type (IPv4/IPv6)
+func addressFromLsof(name, socketType string) string {
+	host := name
+	if idx := strings.LastIndex(name, ":"); idx != -1 {
+		host = name[:idx]
+	}
+	host = strings.Trim(host, "[]")
+	if host == "*" {
+		if socketType == "IPv6" {
+			return "::"
+		}
+		return "0.0.0.0"
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// listenSignature isn't available on macOS, where listing sockets means
+// running lsof; ports are picked up on the regular scan instead
+func listenSignature(minPort, maxPort int) (uint64, error) {
+	return 0, errWatchUnsupported
+}
+
+// backends are the ways ports can be listed on macOS, for Bench
+func backends() []backend {
+	return []backend{{"lsof", "lsof -sTCP:LISTEN", scanPorts}}
 }
 
 // parsePortFromLsof extracts port number from lsof name field
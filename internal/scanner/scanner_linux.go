@@ -4,47 +4,110 @@ package scanner
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
+	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
-// scanPorts parses /proc/net/tcp to find listening ports on Linux
+// netlinkFailed is set once sock_diag has failed (old kernels, seccomp
+// profiles that block netlink), after which /proc is always used
+var netlinkFailed atomic.Bool
+
+// scanPorts lists listening ports over netlink sock_diag, falling back to
+// parsing /proc/net/tcp where netlink isn't available
 func scanPorts(minPort, maxPort int) ([]RawPort, error) {
-	ports, err := scanProcNetTCP("/proc/net/tcp", minPort, maxPort)
+	if !netlinkFailed.Load() {
+		ports, err := scanSockDiag(minPort, maxPort)
+		if err == nil {
+			return ports, nil
+		}
+		netlinkFailed.Store(true)
+		log.Printf("Port scanner: sock_diag unavailable, falling back to /proc/net/tcp: %v", err)
+	}
+	return scanProcPorts(minPort, maxPort)
+}
+
+// backends are the ways ports can be listed on Linux, for Bench. Like Scan,
+// each full scan also looks for ports in other network namespaces.
+func backends() []backend {
+	return []backend{
+		{"proc", "/proc/net/tcp + /proc/*/fd walk per port (fallback)", withNamespaces(scanProcPorts)},
+		{"netlink", "sock_diag + cached inode owners", withNamespaces(scanSockDiag)},
+		{"netlink-cold", "sock_diag, inode and namespace caches cleared every scan", withNamespaces(func(minPort, maxPort int) ([]RawPort, error) {
+			socketOwners.reset()
+			processNamespaces.reset()
+			return scanSockDiag(minPort, maxPort)
+		})},
+		{"watch", "sock_diag listener hash, run every WatchInterval", func(minPort, maxPort int) ([]RawPort, error) {
+			_, err := listenSignature(minPort, maxPort)
+			return nil, err
+		}},
+	}
+}
+
+// withNamespaces adds the namespace walk Scan does after listing host ports
+func withNamespaces(scan func(minPort, maxPort int) ([]RawPort, error)) func(minPort, maxPort int) ([]RawPort, error) {
+	return func(minPort, maxPort int) ([]RawPort, error) {
+		ports, err := scan(minPort, maxPort)
+		if err != nil {
+			return nil, err
+		}
+		return append(ports, namespacePorts(minPort, maxPort, nil)...), nil
+	}
+}
+
+// scanProcPorts parses /proc/net/tcp to find listening ports on Linux
+func scanProcPorts(minPort, maxPort int) ([]RawPort, error) {
+	sockets, err := scanProcNetTCP("/proc/net/tcp", minPort, maxPort)
 	if err != nil {
 		return nil, err
 	}
 
 	// Also check IPv6
-	ports6, err := scanProcNetTCP("/proc/net/tcp6", minPort, maxPort)
-	if err == nil {
-		// Merge, avoiding duplicates
-		seen := make(map[int]bool)
-		for _, p := range ports {
-			seen[p.Port] = true
-		}
-		for _, p := range ports6 {
-			if !seen[p.Port] {
-				ports = append(ports, p)
-				seen[p.Port] = true
-			}
-		}
+	if sockets6, err := scanProcNetTCP("/proc/net/tcp6", minPort, maxPort); err == nil {
+		sockets = append(sockets, sockets6...)
 	}
 
-	return ports, nil
+	return mergeSockets(sockets), nil
 }
 
 func scanProcNetTCP(path string, minPort, maxPort int) ([]RawPort, error) {
+	listeners, err := readProcNetTCP(path, minPort, maxPort)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make([]RawPort, 0, len(listeners))
+	for _, l := range listeners {
+		// The inode lets us find the process
+		pid, processName := findProcessByInode(strconv.FormatUint(uint64(l.inode), 10))
+
+		ports = append(ports, RawPort{
+			Port:        l.port,
+			PID:         pid,
+			ProcessName: processName,
+			Addresses:   []string{l.addr},
+		})
+	}
+
+	return ports, nil
+}
+
+// readProcNetTCP lists the listening sockets in a /proc/net/tcp{,6} table
+func readProcNetTCP(path string, minPort, maxPort int) ([]listener, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	var ports []RawPort
+	var listeners []listener
 	scanner := bufio.NewScanner(file)
 
 	// Skip header line
@@ -67,8 +130,8 @@ func scanProcNetTCP(path string, minPort, maxPort int) ([]RawPort, error) {
 			continue
 		}
 
-		// Parse port from local_address
-		port, err := parseHexPort(localAddr)
+		// Parse address and port from local_address
+		addr, port, err := parseHexAddr(localAddr)
 		if err != nil {
 			continue
 		}
@@ -77,33 +140,41 @@ func scanProcNetTCP(path string, minPort, maxPort int) ([]RawPort, error) {
 			continue
 		}
 
-		// Field 9 is inode, we can use it to find the process
-		inode := fields[9]
-		pid, processName := findProcessByInode(inode)
+		// Field 9 is the socket inode
+		inode, err := strconv.ParseUint(fields[9], 10, 32)
+		if err != nil {
+			continue
+		}
 
-		ports = append(ports, RawPort{
-			Port:        port,
-			PID:         pid,
-			ProcessName: processName,
-		})
+		listeners = append(listeners, listener{port: port, addr: addr, inode: uint32(inode)})
 	}
 
-	return ports, nil
+	return listeners, nil
 }
 
-// parseHexPort extracts port from hex address like "0100007F:0BB8"
-func parseHexPort(addr string) (int, error) {
-	parts := strings.Split(addr, ":")
-	if len(parts) != 2 {
-		return 0, fmt.Errorf("invalid address format")
+// parseHexAddr decodes a local_address like "0100007F:0BB8". The address is
+// printed as 32-bit words in host byte order (one for IPv4, four for IPv6).
+func parseHexAddr(hexAddr string) (string, int, error) {
+	parts := strings.Split(hexAddr, ":")
+	if len(parts) != 2 || (len(parts[0]) != 8 && len(parts[0]) != 32) {
+		return "", 0, fmt.Errorf("invalid address format")
 	}
 
 	port64, err := strconv.ParseInt(parts[1], 16, 32)
 	if err != nil {
-		return 0, err
+		return "", 0, err
+	}
+
+	ip := make(net.IP, len(parts[0])/2)
+	for i := 0; i < len(parts[0]); i += 8 {
+		word, err := strconv.ParseUint(parts[0][i:i+8], 16, 32)
+		if err != nil {
+			return "", 0, err
+		}
+		binary.NativeEndian.PutUint32(ip[i/2:], uint32(word))
 	}
 
-	return int(port64), nil
+	return ip.String(), int(port64), nil
 }
 
 // findProcessByInode searches /proc/*/fd/* for a socket with the given inode
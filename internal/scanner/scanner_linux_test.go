@@ -0,0 +1,62 @@
+//go:build linux
+
+package scanner
+
+import (
+	"net"
+	"testing"
+)
+
+// listen opens a few listeners so the benchmarks have sockets to resolve
+func listen(b *testing.B, n int) {
+	b.Helper()
+	for i := 0; i < n; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { ln.Close() })
+	}
+}
+
+// benchScan runs one of the Bench backends per iteration over every port,
+// after a warm-up scan so cached backends are measured in their steady state
+func benchScan(b *testing.B, name string) {
+	var scan func(minPort, maxPort int) ([]RawPort, error)
+	for _, be := range backends() {
+		if be.name == name {
+			scan = be.scan
+		}
+	}
+	if scan == nil {
+		b.Fatalf("no backend %q", name)
+	}
+
+	listen(b, 8)
+	if _, err := scan(1, 65535); err != nil {
+		b.Skipf("backend unavailable: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scan(1, 65535); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanProc(b *testing.B) {
+	benchScan(b, "proc")
+}
+
+func BenchmarkScanSockDiag(b *testing.B) {
+	benchScan(b, "netlink")
+}
+
+func BenchmarkScanSockDiagCold(b *testing.B) {
+	benchScan(b, "netlink-cold")
+}
+
+// BenchmarkListenSignature is the check Watch runs every WatchInterval
+func BenchmarkListenSignature(b *testing.B) {
+	benchScan(b, "watch")
+}
@@ -0,0 +1,275 @@
+//go:build linux
+
+package scanner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Netlink sock_diag constants from linux/sock_diag.h and linux/inet_diag.h
+const (
+	sockDiagByFamily = 20 // SOCK_DIAG_BY_FAMILY
+	tcpListen        = 10 // TCP_LISTEN
+
+	inetDiagReqSize = 56 // struct inet_diag_req_v2
+	inetDiagMsgSize = 72 // struct inet_diag_msg
+)
+
+// listener is a listening TCP socket as reported by the kernel
+type listener struct {
+	port  int
+	addr  string
+	inode uint32
+}
+
+// sockDiagListeners asks the kernel for every listening TCP socket over
+// NETLINK_SOCK_DIAG. Unlike /proc/net/tcp this skips established
+// connections and needs no text parsing.
+func sockDiagListeners(minPort, maxPort int) ([]listener, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_INET_DIAG)
+	if err != nil {
+		return nil, fmt.Errorf("netlink socket: %w", err)
+	}
+	defer syscall.Close(fd)
+
+	tv := syscall.NsecToTimeval(int64(time.Second))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, err
+	}
+
+	var listeners []listener
+	for seq, family := range []uint8{syscall.AF_INET, syscall.AF_INET6} {
+		if err := syscall.Sendto(fd, sockDiagRequest(family, uint32(seq+1)), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+			return nil, fmt.Errorf("netlink send: %w", err)
+		}
+		found, err := readSockDiag(fd, minPort, maxPort)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, found...)
+	}
+	return listeners, nil
+}
+
+// sockDiagRequest builds a dump request for listening TCP sockets of one family
+func sockDiagRequest(family uint8, seq uint32) []byte {
+	b := make([]byte, syscall.NLMSG_HDRLEN+inetDiagReqSize)
+	// struct nlmsghdr
+	binary.NativeEndian.PutUint32(b[0:], uint32(len(b)))
+	binary.NativeEndian.PutUint16(b[4:], sockDiagByFamily)
+	binary.NativeEndian.PutUint16(b[6:], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	binary.NativeEndian.PutUint32(b[8:], seq)
+	// struct inet_diag_req_v2; the socket id stays zero to match everything
+	req := b[syscall.NLMSG_HDRLEN:]
+	req[0] = family
+	req[1] = syscall.IPPROTO_TCP
+	binary.NativeEndian.PutUint32(req[4:], 1<<tcpListen)
+	return b
+}
+
+// readSockDiag reads dump replies until NLMSG_DONE
+func readSockDiag(fd int, minPort, maxPort int) ([]listener, error) {
+	var listeners []listener
+	buf := make([]byte, 32<<10)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("netlink receive: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("netlink parse: %w", err)
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return listeners, nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					if errno := -int32(binary.NativeEndian.Uint32(m.Data)); errno != 0 {
+						return nil, fmt.Errorf("netlink: %w", syscall.Errno(errno))
+					}
+				}
+				return listeners, nil
+			case sockDiagByFamily:
+				if len(m.Data) < inetDiagMsgSize || m.Data[1] != tcpListen {
+					continue
+				}
+				// inet_diag_msg: family, state, timer, retrans, then the socket
+				// id: big-endian source port at 4, source address at 8 (4 or
+				// 16 bytes by family); inode at 68
+				port := int(binary.BigEndian.Uint16(m.Data[4:6]))
+				if port < minPort || port > maxPort {
+					continue
+				}
+				addr := net.IP(m.Data[8:12])
+				if m.Data[0] == syscall.AF_INET6 {
+					addr = net.IP(m.Data[8:24])
+				}
+				listeners = append(listeners, listener{
+					port:  port,
+					addr:  addr.String(),
+					inode: binary.NativeEndian.Uint32(m.Data[68:72]),
+				})
+			}
+		}
+	}
+}
+
+// scanSockDiag lists listening ports over netlink and resolves their
+// owners through the inode cache
+func scanSockDiag(minPort, maxPort int) ([]RawPort, error) {
+	listeners, err := sockDiagListeners(minPort, maxPort)
+	if err != nil {
+		return nil, err
+	}
+
+	inodes := make([]uint32, len(listeners))
+	for i, l := range listeners {
+		inodes[i] = l.inode
+	}
+	owners := socketOwners.lookup(inodes)
+
+	sockets := make([]RawPort, len(listeners))
+	for i, l := range listeners {
+		o := owners[l.inode]
+		sockets[i] = RawPort{Port: l.port, PID: o.pid, ProcessName: o.name, Addresses: []string{l.addr}}
+	}
+	return mergeSockets(sockets), nil
+}
+
+// listenSignature hashes the listening sockets in range, so a watcher can
+// tell cheaply whether anything started or stopped listening
+func listenSignature(minPort, maxPort int) (uint64, error) {
+	if netlinkFailed.Load() {
+		return 0, errWatchUnsupported
+	}
+	listeners, err := sockDiagListeners(minPort, maxPort)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(listeners, func(i, j int) bool { return listeners[i].inode < listeners[j].inode })
+
+	h := fnv.New64a()
+	var b [8]byte
+	for _, l := range listeners {
+		binary.LittleEndian.PutUint32(b[0:], l.inode)
+		binary.LittleEndian.PutUint32(b[4:], uint32(l.port))
+		h.Write(b[:])
+	}
+	return h.Sum64(), nil
+}
+
+// socketOwners maps socket inodes to the processes holding them
+var socketOwners = &inodeCache{owners: make(map[uint32]owner)}
+
+type owner struct {
+	pid  int
+	name string
+}
+
+// inodeCache remembers which process owns each listening socket, so /proc
+// is only walked when a socket shows up that hasn't been seen before
+type inodeCache struct {
+	mu     sync.Mutex
+	owners map[uint32]owner
+}
+
+// lookup returns the owners of the given socket inodes. Sockets whose owner
+// can't be found (another user's process without CAP_SYS_PTRACE) are
+// remembered as unowned so they don't trigger a walk on every scan.
+func (c *inodeCache) lookup(inodes []uint32) map[uint32]owner {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	missing := make(map[uint32]bool)
+	for _, inode := range inodes {
+		o, ok := c.owners[inode]
+		if !ok || (o.pid > 0 && !processExists(o.pid)) {
+			missing[inode] = true
+		}
+	}
+	if len(missing) > 0 {
+		found := walkSocketOwners(missing)
+		for inode := range missing {
+			c.owners[inode] = found[inode]
+		}
+	}
+
+	// Keep only sockets that are still listening
+	current := make(map[uint32]owner, len(inodes))
+	for _, inode := range inodes {
+		current[inode] = c.owners[inode]
+	}
+	c.owners = current
+	return current
+}
+
+// reset empties the cache, for measuring cold scans
+func (c *inodeCache) reset() {
+	c.mu.Lock()
+	c.owners = make(map[uint32]owner)
+	c.mu.Unlock()
+}
+
+// walkSocketOwners goes through /proc/*/fd once, stopping as soon as every
+// wanted inode has been found
+func walkSocketOwners(wanted map[uint32]bool) map[uint32]owner {
+	found := make(map[uint32]owner, len(wanted))
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return found
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || !proc.IsDir() {
+			continue
+		}
+
+		fdPath := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdPath)
+		if err != nil {
+			continue
+		}
+		var name string
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdPath, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 32)
+			if err != nil || !wanted[uint32(inode)] {
+				continue
+			}
+			if _, ok := found[uint32(inode)]; ok {
+				continue
+			}
+			if name == "" {
+				comm, _ := os.ReadFile(filepath.Join("/proc", proc.Name(), "comm"))
+				name = strings.TrimSpace(string(comm))
+			}
+			found[uint32(inode)] = owner{pid: pid, name: name}
+			if len(found) == len(wanted) {
+				return found
+			}
+		}
+	}
+	return found
+}
+
+func processExists(pid int) bool {
+	_, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+	return err == nil
+}
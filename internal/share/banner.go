@@ -0,0 +1,141 @@
+package share
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// BannerInfo describes the share shown in the preview banner
+type BannerInfo struct {
+	Port      int        `json:"port"`
+	RepoName  string     `json:"repo,omitempty"`
+	Branch    string     `json:"branch,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Feedback  bool       `json:"feedback"` // show the "leave feedback" box
+}
+
+// BannerHTML returns the preview banner injected into shared HTML pages.
+// It renders into a shadow root so the page's CSS can't restyle it (and vice
+// versa), can be dismissed for the rest of the browser session, and posts
+// feedback to /{port}/_homeport/feedback.
+func BannerHTML(info BannerInfo) string {
+	// json.Marshal escapes <, > and & so the data can't close the script tag
+	data, _ := json.Marshal(info)
+
+	return fmt.Sprintf(`<script data-homeport-banner>
+(function () {
+    var info = %s;
+    var dismissKey = 'homeport_banner_dismissed_' + info.port;
+    try { if (sessionStorage.getItem(dismissKey)) return; } catch (e) {}
+
+    function expiryText(iso) {
+        var ms = new Date(iso) - new Date();
+        if (ms <= 0) return 'expired';
+        var mins = Math.round(ms / 60000);
+        if (mins < 60) return 'expires in ' + mins + ' min';
+        var hours = Math.round(mins / 60);
+        if (hours < 48) return 'expires in ' + hours + ' h';
+        return 'expires ' + new Date(iso).toLocaleDateString();
+    }
+
+    function mount() {
+        if (document.getElementById('homeport-banner')) return;
+        var host = document.createElement('div');
+        host.id = 'homeport-banner';
+        host.style.cssText = 'position:fixed;left:0;right:0;bottom:0;z-index:2147483647;';
+        var root = host.attachShadow({ mode: 'open' });
+
+        root.innerHTML = '<style>' +
+            '.bar { font: 13px/1.4 -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; background: #111827; color: #f9fafb; display: flex; align-items: center; gap: 12px; padding: 8px 16px; flex-wrap: wrap; }' +
+            '.tag { background: #f59e0b; color: #111827; font-weight: 600; border-radius: 4px; padding: 1px 6px; font-size: 11px; text-transform: uppercase; letter-spacing: .03em; }' +
+            '.meta { color: #d1d5db; } .meta b { color: #f9fafb; font-weight: 600; }' +
+            '.spacer { flex: 1; }' +
+            'button { font: inherit; cursor: pointer; border-radius: 6px; border: 1px solid #374151; background: #1f2937; color: #f9fafb; padding: 4px 10px; }' +
+            'button:hover { background: #374151; }' +
+            '.close { border: none; background: none; color: #9ca3af; font-size: 18px; line-height: 1; padding: 0 4px; }' +
+            'form { display: none; width: 100%%; gap: 8px; padding-top: 4px; }' +
+            'form.open { display: flex; flex-wrap: wrap; }' +
+            'textarea, input { font: inherit; border-radius: 6px; border: 1px solid #374151; background: #1f2937; color: #f9fafb; padding: 6px 8px; }' +
+            'textarea { flex: 1 1 300px; min-height: 56px; resize: vertical; } input { flex: 0 1 180px; }' +
+            '.file { color: #9ca3af; align-self: center; font-size: 12px; } .file input { display: none; } .file span { text-decoration: underline; cursor: pointer; }' +
+            '.status { color: #9ca3af; align-self: center; }' +
+            '</style>' +
+            '<div class="bar">' +
+            '<span class="tag">Preview</span>' +
+            '<span class="meta"></span>' +
+            '<span class="spacer"></span>' +
+            (info.feedback ? '<button type="button" class="toggle">Leave feedback</button>' : '') +
+            '<button type="button" class="close" title="Hide for this session" aria-label="Dismiss">&times;</button>' +
+            (info.feedback ? '<form><textarea name="message" maxlength="2000" placeholder="What should change?" required></textarea>' +
+                '<input name="author" maxlength="100" placeholder="Your name (optional)">' +
+                '<label class="file"><input type="file" name="screenshot" accept="image/png,image/jpeg,image/webp,image/gif"><span>Attach screenshot</span></label>' +
+                '<button type="submit">Send</button><span class="status"></span></form>' : '') +
+            '</div>';
+
+        // Filled in with textContent so repo and branch names are never parsed as HTML
+        var meta = root.querySelector('.meta');
+        var parts = [];
+        if (info.repo) parts.push(['', info.repo]);
+        if (info.branch) parts.push(['on ', info.branch]);
+        parts.forEach(function (p, i) {
+            if (i > 0 || p[0]) meta.appendChild(document.createTextNode((i > 0 ? ' ' : '') + p[0]));
+            var b = document.createElement('b');
+            b.textContent = p[1];
+            meta.appendChild(b);
+        });
+        var notes = ['Work in progress'];
+        if (info.expires_at) notes.push(expiryText(info.expires_at));
+        meta.appendChild(document.createTextNode((parts.length ? ' · ' : '') + notes.join(' · ')));
+
+        root.querySelector('.close').onclick = function () {
+            try { sessionStorage.setItem(dismissKey, '1'); } catch (e) {}
+            host.remove();
+        };
+
+        if (info.feedback) {
+            var form = root.querySelector('form');
+            var status = root.querySelector('.status');
+            var fileLabel = root.querySelector('.file span');
+            form.screenshot.onchange = function () {
+                var file = form.screenshot.files[0];
+                fileLabel.textContent = file ? file.name : 'Attach screenshot';
+            };
+            root.querySelector('.toggle').onclick = function () {
+                form.classList.toggle('open');
+                if (form.classList.contains('open')) form.message.focus();
+            };
+            form.onsubmit = function (e) {
+                e.preventDefault();
+                status.textContent = 'Sending...';
+                var body = new FormData();
+                body.append('message', form.message.value);
+                body.append('name', form.author.value);
+                body.append('page', location.pathname + location.search + location.hash);
+                body.append('viewport', window.innerWidth + 'x' + window.innerHeight);
+                if (form.screenshot.files[0]) body.append('screenshot', form.screenshot.files[0]);
+                fetch('/' + info.port + '/_homeport/feedback', {
+                    method: 'POST',
+                    credentials: 'same-origin',
+                    body: body
+                }).then(function (res) {
+                    if (res.status === 429) throw new Error('Too many messages, try again later');
+                    if (!res.ok) return res.json().then(function (data) { throw new Error(data.error || 'Could not send feedback'); });
+                    form.message.value = '';
+                    form.screenshot.value = '';
+                    fileLabel.textContent = 'Attach screenshot';
+                    status.textContent = 'Thanks! Your feedback was sent.';
+                }).catch(function (err) {
+                    status.textContent = err.message;
+                });
+            };
+        }
+
+        document.body.appendChild(host);
+    }
+
+    if (document.body) mount();
+    else document.addEventListener('DOMContentLoaded', mount);
+})();
+</script>`, data)
+}
@@ -0,0 +1,328 @@
+package share
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MagicLinkTTL is how long an emailed login link stays valid
+const MagicLinkTTL = 15 * time.Minute
+
+// magicLink is a pending one-time login for an email-gated share
+type magicLink struct {
+	port    int
+	email   string
+	expires time.Time
+}
+
+// magicLinks holds unused login tokens. They're kept in memory only, so
+// outstanding links stop working when homeportd restarts.
+var magicLinks = struct {
+	tokens map[string]magicLink
+	mu     sync.Mutex
+}{tokens: make(map[string]magicLink)}
+
+// NormalizeEmail validates a bare email address and lowercases it
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", fmt.Errorf("invalid email address")
+	}
+	if strings.ContainsAny(email, "\r\n:") {
+		return "", fmt.Errorf("invalid email address")
+	}
+	return strings.ToLower(email), nil
+}
+
+// ValidateEmailAllowlist checks allowlist entries: exact addresses
+// ("alice@example.com") or domains ("example.com" / "@example.com")
+func ValidateEmailAllowlist(allowlist []string) error {
+	for _, entry := range allowlist {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if domain := strings.TrimPrefix(entry, "@"); !strings.Contains(domain, "@") {
+			if !strings.Contains(domain, ".") || strings.ContainsAny(domain, " ,:/") {
+				return fmt.Errorf("invalid email domain %q", entry)
+			}
+			continue
+		}
+		if _, err := NormalizeEmail(entry); err != nil {
+			return fmt.Errorf("invalid email address %q", entry)
+		}
+	}
+	return nil
+}
+
+// EmailAllowed reports whether a normalized email matches the allowlist
+func EmailAllowed(email string, allowlist []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(strings.TrimPrefix(entry, "@"), "@") {
+			if entry == email {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(entry, "@") == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateMagicLink issues a one-time token that signs the email in to the port
+func CreateMagicLink(port int, email string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	magicLinks.mu.Lock()
+	defer magicLinks.mu.Unlock()
+
+	// Drop expired links while we're here
+	now := time.Now()
+	for t, link := range magicLinks.tokens {
+		if now.After(link.expires) {
+			delete(magicLinks.tokens, t)
+		}
+	}
+
+	magicLinks.tokens[token] = magicLink{port: port, email: email, expires: now.Add(MagicLinkTTL)}
+	return token, nil
+}
+
+// ConsumeMagicLink redeems a token for the port. Tokens work once.
+func ConsumeMagicLink(token string, port int) (string, bool) {
+	magicLinks.mu.Lock()
+	defer magicLinks.mu.Unlock()
+
+	link, ok := magicLinks.tokens[token]
+	if !ok || link.port != port {
+		return "", false
+	}
+	delete(magicLinks.tokens, token)
+
+	if time.Now().After(link.expires) {
+		return "", false
+	}
+	return link.email, true
+}
+
+// SetIdentityCookie sets a signed cookie for the port that records the
+// visitor's verified email. It uses the same cookie name and scope as
+// SetAuthCookie, but the value carries the identity.
+func SetIdentityCookie(w http.ResponseWriter, r *http.Request, port int, email string, duration time.Duration) {
+	expires := time.Now().Add(duration)
+	data := fmt.Sprintf("%d:%d:%s", port, expires.Unix(), base64.RawURLEncoding.EncodeToString([]byte(email)))
+	value := base64.URLEncoding.EncodeToString([]byte(data + ":" + computeHMAC(data)))
+
+	secure := r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     fmt.Sprintf("homeport_auth_%d", port),
+		Value:    value,
+		Path:     "/", // Must be root for referer-based asset requests
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ValidateIdentityCookie returns the verified email from the port's identity cookie
+func ValidateIdentityCookie(r *http.Request, port int) (string, bool) {
+	cookie, err := r.Cookie(fmt.Sprintf("homeport_auth_%d", port))
+	if err != nil {
+		return "", false
+	}
+
+	decoded, err := base64.URLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return "", false
+	}
+
+	// "port:expiry:email:signature" - password cookies have no email part
+	parts := strings.Split(string(decoded), ":")
+	if len(parts) != 4 {
+		return "", false
+	}
+
+	if p, err := strconv.Atoi(parts[0]); err != nil || p != port {
+		return "", false
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return "", false
+	}
+
+	data := strings.Join(parts[:3], ":")
+	if parts[3] != computeHMAC(data) {
+		return "", false
+	}
+
+	email, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", false
+	}
+	return string(email), true
+}
+
+// EmailFormHTML returns the HTML for the email sign-in form.
+// notice is shown after a link has been requested.
+func EmailFormHTML(port int, errorMsg, notice string) string {
+	messageHTML := ""
+	if errorMsg != "" {
+		messageHTML = fmt.Sprintf(`<div class="error">%s</div>`, html.EscapeString(errorMsg))
+	} else if notice != "" {
+		messageHTML = fmt.Sprintf(`<div class="notice">%s</div>`, html.EscapeString(notice))
+	}
+
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Sign In - Port %d</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+        * { box-sizing: border-box; margin: 0; padding: 0; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+            background: #ffffff;
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            padding: 20px;
+        }
+        .container {
+            background: #ffffff;
+            padding: 40px;
+            border: 1px solid #e5e7eb;
+            border-radius: 12px;
+            width: 100%%;
+            max-width: 400px;
+        }
+        .header {
+            text-align: center;
+            margin-bottom: 32px;
+        }
+        .port-badge {
+            display: inline-flex;
+            align-items: center;
+            justify-content: center;
+            width: 48px;
+            height: 48px;
+            background: #111827;
+            color: white;
+            border-radius: 12px;
+            font-family: monospace;
+            font-size: 14px;
+            font-weight: 600;
+            margin-bottom: 16px;
+        }
+        h1 {
+            font-size: 24px;
+            font-weight: 600;
+            color: #111827;
+            margin-bottom: 4px;
+        }
+        .subtitle {
+            color: #6b7280;
+            font-size: 14px;
+        }
+        .error, .notice {
+            padding: 12px 16px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+            font-size: 14px;
+        }
+        .error {
+            background: #fef2f2;
+            border: 1px solid #fecaca;
+            color: #dc2626;
+        }
+        .notice {
+            background: #f0fdf4;
+            border: 1px solid #bbf7d0;
+            color: #166534;
+        }
+        label {
+            display: block;
+            font-size: 14px;
+            font-weight: 500;
+            color: #374151;
+            margin-bottom: 6px;
+        }
+        input[type="email"] {
+            width: 100%%;
+            padding: 12px 16px;
+            border: 1px solid #e5e7eb;
+            border-radius: 8px;
+            font-size: 16px;
+            margin-bottom: 16px;
+            color: #111827;
+        }
+        input[type="email"]:focus {
+            outline: none;
+            border-color: #111827;
+        }
+        input[type="email"]::placeholder {
+            color: #9ca3af;
+        }
+        button {
+            width: 100%%;
+            padding: 12px 16px;
+            background: #111827;
+            color: white;
+            border: none;
+            border-radius: 8px;
+            font-size: 16px;
+            font-weight: 500;
+            cursor: pointer;
+            transition: background 0.2s;
+        }
+        button:hover {
+            background: #374151;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <div class="port-badge">:%d</div>
+            <h1>Sign In</h1>
+            <p class="subtitle">We'll email you a one-time login link</p>
+        </div>
+        %s
+        <form method="POST" action="/%d/_auth">
+            <label for="email">Email</label>
+            <input type="email" id="email" name="email" placeholder="you@example.com" required autofocus>
+            <button type="submit">Send login link</button>
+        </form>
+    </div>
+</body>
+</html>`, port, port, messageHTML, port)
+}
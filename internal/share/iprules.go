@@ -0,0 +1,42 @@
+package share
+
+import (
+	"net"
+
+	"github.com/gethomeport/homeport/internal/clientip"
+)
+
+// IPRules restricts which client networks may reach a shared port
+type IPRules struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// ParseIPRules builds rules from allow/deny lists of IPs or CIDRs
+func ParseIPRules(allow, deny []string) (*IPRules, error) {
+	allowNets, err := clientip.ParseCIDRs(allow)
+	if err != nil {
+		return nil, err
+	}
+	denyNets, err := clientip.ParseCIDRs(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &IPRules{allow: allowNets, deny: denyNets}, nil
+}
+
+// Allows reports whether a client IP may access the port.
+// Deny rules win; an empty allow list allows everyone not denied.
+func (r *IPRules) Allows(ip string) bool {
+	if r == nil {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if clientip.Contains(r.deny, parsed) {
+		return false
+	}
+	if len(r.allow) == 0 {
+		return true
+	}
+	return clientip.Contains(r.allow, parsed)
+}
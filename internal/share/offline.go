@@ -0,0 +1,163 @@
+package share
+
+import (
+	"fmt"
+	"html"
+)
+
+// OfflinePageHTML returns the interstitial shown when a port's dev server isn't running.
+// The page long-polls until the port is listening again and then reloads.
+// If canStart is true, a button to start the repo's dev server is shown.
+func OfflinePageHTML(port int, repoName string, canStart bool) string {
+	subtitle := "The dev server on this port isn't running right now."
+	if repoName != "" {
+		subtitle = fmt.Sprintf("The dev server for <strong>%s</strong> isn't running right now.", html.EscapeString(repoName))
+	}
+
+	startHTML := ""
+	if canStart {
+		startHTML = `<button type="button" id="startBtn" onclick="startServer()">Start dev server</button>`
+	}
+
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Waiting for Port %d</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <style>
+        * { box-sizing: border-box; margin: 0; padding: 0; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
+            background: #ffffff;
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            padding: 20px;
+        }
+        .container {
+            background: #ffffff;
+            padding: 40px;
+            border: 1px solid #e5e7eb;
+            border-radius: 12px;
+            width: 100%%;
+            max-width: 400px;
+            text-align: center;
+        }
+        .port-badge {
+            display: inline-flex;
+            align-items: center;
+            justify-content: center;
+            width: 48px;
+            height: 48px;
+            background: #111827;
+            color: white;
+            border-radius: 12px;
+            font-family: monospace;
+            font-size: 14px;
+            font-weight: 600;
+            margin-bottom: 16px;
+        }
+        h1 {
+            font-size: 24px;
+            font-weight: 600;
+            color: #111827;
+            margin-bottom: 4px;
+        }
+        .subtitle {
+            color: #6b7280;
+            font-size: 14px;
+            margin-bottom: 24px;
+        }
+        .subtitle strong { color: #111827; font-weight: 500; }
+        .status {
+            display: inline-flex;
+            align-items: center;
+            gap: 8px;
+            color: #6b7280;
+            font-size: 13px;
+        }
+        .spinner {
+            width: 14px;
+            height: 14px;
+            border: 2px solid #e5e7eb;
+            border-top-color: #111827;
+            border-radius: 50%%;
+            animation: spin 0.8s linear infinite;
+        }
+        @keyframes spin { to { transform: rotate(360deg); } }
+        button {
+            width: 100%%;
+            padding: 12px 16px;
+            background: #111827;
+            color: white;
+            border: none;
+            border-radius: 8px;
+            font-size: 16px;
+            font-weight: 500;
+            cursor: pointer;
+            transition: background 0.2s;
+            margin-bottom: 20px;
+        }
+        button:hover { background: #374151; }
+        button:disabled { background: #9ca3af; cursor: not-allowed; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="port-badge">:%d</div>
+        <h1>Server Starting</h1>
+        <p class="subtitle">%s This page will reload automatically once it's up.</p>
+        %s
+        <div class="status"><span class="spinner"></span><span id="statusText">Waiting for port %d...</span></div>
+    </div>
+    <script>
+        const PORT = %d;
+
+        async function waitForPort() {
+            while (true) {
+                try {
+                    const resp = await fetch('/' + PORT + '/_homeport/wait', { credentials: 'include', cache: 'no-store' });
+                    if (resp.ok) {
+                        const result = await resp.json();
+                        if (result.ready) {
+                            location.reload();
+                            return;
+                        }
+                        continue;
+                    }
+                    if (resp.status === 401 || resp.status === 403) {
+                        // Not allowed to watch the port - check back by reloading
+                        setTimeout(() => location.reload(), 10000);
+                        return;
+                    }
+                } catch (e) {
+                    // Network hiccup - back off before polling again
+                }
+                await new Promise(r => setTimeout(r, 2000));
+            }
+        }
+
+        async function startServer() {
+            const btn = document.getElementById('startBtn');
+            btn.disabled = true;
+            btn.textContent = 'Starting...';
+            try {
+                const resp = await fetch('/' + PORT + '/_homeport/start', { method: 'POST', credentials: 'include' });
+                if (!resp.ok) {
+                    const result = await resp.json().catch(() => ({}));
+                    document.getElementById('statusText').textContent = result.error || 'Failed to start dev server';
+                    btn.disabled = false;
+                    btn.textContent = 'Start dev server';
+                }
+            } catch (e) {
+                btn.disabled = false;
+                btn.textContent = 'Start dev server';
+            }
+        }
+
+        waitForPort();
+    </script>
+</body>
+</html>`, port, port, subtitle, startHTML, port, port)
+}
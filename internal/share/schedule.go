@@ -0,0 +1,158 @@
+package share
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gethomeport/homeport/internal/store"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ValidateSchedule checks days, times and timezone of a share schedule
+func ValidateSchedule(sched *store.ShareSchedule) error {
+	for _, day := range sched.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day %q (use mon, tue, wed, thu, fri, sat, sun)", day)
+		}
+	}
+	if _, err := parseClock(sched.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(sched.End); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(sched.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", sched.Timezone)
+	}
+	return nil
+}
+
+// ScheduleOpen reports whether t falls inside the weekly window. Overnight
+// windows (end before start) belong to the day they start on; equal start
+// and end times mean the whole day.
+func ScheduleOpen(sched *store.ShareSchedule, t time.Time) bool {
+	start, err1 := parseClock(sched.Start)
+	end, err2 := parseClock(sched.End)
+	loc, err3 := time.LoadLocation(sched.Timezone)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return false
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	if start == end {
+		return scheduledOn(sched, local.Weekday())
+	}
+	if start < end {
+		return scheduledOn(sched, local.Weekday()) && minute >= start && minute < end
+	}
+	// Overnight: open from start until midnight, and from midnight until end the next day
+	if minute >= start {
+		return scheduledOn(sched, local.Weekday())
+	}
+	if minute < end {
+		return scheduledOn(sched, (local.Weekday()+6)%7)
+	}
+	return false
+}
+
+// ShareOpen reports whether a scheduled share should be open at t.
+// Expiry is handled separately since it ends the share for good.
+func ShareOpen(p *store.Port, t time.Time) bool {
+	if p.StartsAt != nil && t.Before(*p.StartsAt) {
+		return false
+	}
+	if p.Schedule != nil {
+		return ScheduleOpen(p.Schedule, t)
+	}
+	return true
+}
+
+// NextShareChange returns the next time after `after` at which the port's
+// share changes: it opens, closes or expires. ok is false if nothing is scheduled.
+func NextShareChange(p *store.Port, after time.Time) (next time.Time, ok bool) {
+	consider := func(t time.Time) {
+		if t.After(after) && (!ok || t.Before(next)) {
+			next, ok = t, true
+		}
+	}
+
+	if p.ExpiresAt != nil {
+		consider(*p.ExpiresAt)
+	}
+	if p.ScheduledMode == "" {
+		return next, ok
+	}
+	if p.StartsAt != nil {
+		consider(*p.StartsAt)
+	}
+	if p.Schedule != nil {
+		// Window edges are only transitions if the open state actually flips
+		from := after
+		if p.StartsAt != nil && p.StartsAt.After(from) {
+			from = *p.StartsAt
+		}
+		if t, found := nextScheduleEdge(p.Schedule, from); found {
+			consider(t)
+		}
+	}
+	return next, ok
+}
+
+// nextScheduleEdge finds the first time after `after` where ScheduleOpen changes
+func nextScheduleEdge(sched *store.ShareSchedule, after time.Time) (time.Time, bool) {
+	start, err1 := parseClock(sched.Start)
+	end, err2 := parseClock(sched.End)
+	loc, err3 := time.LoadLocation(sched.Timezone)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return time.Time{}, false
+	}
+
+	current := ScheduleOpen(sched, after)
+	local := after.In(loc)
+
+	// A weekly window changes state within 8 days, checking each day's start and end
+	for d := 0; d <= 8; d++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+d, 0, 0, 0, 0, loc)
+		edges := []int{start, end}
+		if start == end {
+			edges = []int{0} // whole-day windows flip at midnight
+		} else if end < start {
+			edges = []int{end, start}
+		}
+		for _, minute := range edges {
+			edge := time.Date(day.Year(), day.Month(), day.Day(), minute/60, minute%60, 0, 0, loc)
+			if edge.After(after) && ScheduleOpen(sched, edge) != current {
+				return edge, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func scheduledOn(sched *store.ShareSchedule, day time.Weekday) bool {
+	if len(sched.Days) == 0 {
+		return true
+	}
+	for _, d := range sched.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (use HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,65 @@
+package share
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Terminal share modes
+const (
+	TerminalView  = "view"  // watch only
+	TerminalDrive = "drive" // type along with the owner
+)
+
+// TerminalGrant is what a terminal share token lets its holder do
+type TerminalGrant struct {
+	SessionID string
+	ShareID   string
+	Mode      string
+	ExpiresAt time.Time
+}
+
+// SignTerminalToken creates the token of a terminal share link:
+// "term:session:share:mode:expiry:signature", base64 encoded
+func SignTerminalToken(g TerminalGrant) string {
+	data := fmt.Sprintf("term:%s:%s:%s:%d", g.SessionID, g.ShareID, g.Mode, g.ExpiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(data + ":" + computeHMAC(data)))
+}
+
+// VerifyTerminalToken checks a terminal share token's signature and expiry.
+// Whether the share still exists is up to the caller.
+func VerifyTerminalToken(token string) (*TerminalGrant, bool) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, false
+	}
+
+	parts := strings.Split(string(decoded), ":")
+	if len(parts) != 6 || parts[0] != "term" {
+		return nil, false
+	}
+
+	data := strings.Join(parts[:5], ":")
+	if !hmac.Equal([]byte(parts[5]), []byte(computeHMAC(data))) {
+		return nil, false
+	}
+
+	expiry, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return nil, false
+	}
+	if parts[3] != TerminalView && parts[3] != TerminalDrive {
+		return nil, false
+	}
+
+	return &TerminalGrant{
+		SessionID: parts[1],
+		ShareID:   parts[2],
+		Mode:      parts[3],
+		ExpiresAt: time.Unix(expiry, 0),
+	}, true
+}
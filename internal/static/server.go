@@ -0,0 +1,395 @@
+// Package static serves a directory over HTTP from inside homeportd, so a
+// build output or report can be shared like any dev server port.
+package static
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options controls how a directory is served
+type Options struct {
+	SPA     bool `json:"spa"`     // serve index.html for unknown paths (client-side routing)
+	Listing bool `json:"listing"` // list directories that have no index.html
+}
+
+// Server serves one directory on one port
+type Server struct {
+	Port      int       `json:"port"`
+	RepoID    string    `json:"repo_id,omitempty"`
+	Root      string    `json:"root"`
+	Options             // embedded so spa/listing appear at the top level in JSON
+	StartedAt time.Time `json:"started_at"`
+
+	srv *http.Server
+}
+
+// hashedName finds the fingerprint in asset names like app.3f9a1c2b.js or
+// index-BfT2x9Qa.css, which never change and can be cached forever
+var hashedName = regexp.MustCompile(`[.-]([0-9A-Za-z_]{8,})\.[a-z0-9]+$`)
+
+// fingerprinted reports whether a file name carries a content hash. Hashes
+// mix digits and letters, which tells them apart from words like "component".
+func fingerprinted(name string) bool {
+	if strings.HasSuffix(name, ".html") {
+		return false
+	}
+	m := hashedName.FindStringSubmatch(name)
+	return m != nil && strings.ContainsAny(m[1], "0123456789") && strings.ContainsAny(m[1], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+// encodings are the precompressed variants served when the client accepts them, in order of preference
+var encodings = []struct{ name, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// ServeHTTP serves a file, a directory listing or the SPA fallback
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := path.Clean("/" + r.URL.Path)
+	// Never serve .git, .env and friends from a repo directory
+	for _, seg := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(seg, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	name, fi, err := s.resolve(urlPath)
+	if err == nil && fi.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, path.Base(urlPath)+"/", http.StatusMovedPermanently)
+			return
+		}
+		if index, ifi, err := s.contained(filepath.Join(name, "index.html")); err == nil && !ifi.IsDir() {
+			s.serveFile(w, r, index, ifi)
+			return
+		}
+		if s.Listing {
+			s.serveListing(w, r, name, urlPath)
+			return
+		}
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		// Unknown routes of a single-page app render the app shell, but
+		// missing assets (paths with an extension) are still 404s
+		if s.SPA && path.Ext(urlPath) == "" {
+			if index, ifi, err := s.contained(filepath.Join(s.Root, "index.html")); err == nil && !ifi.IsDir() {
+				s.serveFile(w, r, index, ifi)
+				return
+			}
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	s.serveFile(w, r, name, fi)
+}
+
+// resolve maps a cleaned URL path to a file inside the root, refusing
+// symlinks that point outside it
+func (s *Server) resolve(urlPath string) (string, os.FileInfo, error) {
+	return s.contained(filepath.Join(s.Root, filepath.FromSlash(urlPath)))
+}
+
+// contained follows symlinks in a path under the root and returns the file
+// it ends at, unless that is outside the root
+func (s *Server) contained(name string) (string, os.FileInfo, error) {
+	real, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if real != s.Root && !strings.HasPrefix(real, s.Root+string(filepath.Separator)) {
+		return "", nil, os.ErrNotExist
+	}
+	fi, err := os.Stat(real)
+	if err != nil {
+		return "", nil, err
+	}
+	return real, fi, nil
+}
+
+// serveFile sends a file, preferring a precompressed sibling (file.br,
+// file.gz) when the client accepts it. Siblings get the same symlink check
+// as the file; one that fails it is ignored.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string, fi os.FileInfo) {
+	h := w.Header()
+	ctype := mime.TypeByExtension(filepath.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	h.Set("Content-Type", ctype)
+
+	if fingerprinted(fi.Name()) {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		h.Set("Cache-Control", "no-cache")
+	}
+
+	sendName, sendInfo := name, fi
+	accept := r.Header.Get("Accept-Encoding")
+	for _, enc := range encodings {
+		cname, cfi, err := s.contained(name + enc.ext)
+		if err != nil || cfi.IsDir() {
+			continue
+		}
+		h.Add("Vary", "Accept-Encoding")
+		if acceptsEncoding(accept, enc.name) {
+			h.Set("Content-Encoding", enc.name)
+			sendName, sendInfo = cname, cfi
+			break
+		}
+	}
+
+	f, err := os.Open(sendName)
+	if err != nil {
+		http.Error(w, "failed to open file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	h.Set("ETag", fmt.Sprintf(`W/"%x-%x"`, sendInfo.Size(), sendInfo.ModTime().UnixNano()))
+	http.ServeContent(w, r, fi.Name(), sendInfo.ModTime(), f)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows an encoding
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+type listingEntry struct {
+	Name    string
+	Href    string
+	Size    string
+	ModTime string
+	IsDir   bool
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2rem; color: #111827; }
+h1 { font-size: 1.1rem; font-weight: 600; }
+table { border-collapse: collapse; width: 100%; max-width: 48rem; font-size: 0.9rem; }
+td { padding: 0.3rem 1rem 0.3rem 0; border-bottom: 1px solid #f3f4f6; }
+td.meta { color: #6b7280; white-space: nowrap; }
+a { color: #2563eb; text-decoration: none; }
+a:hover { text-decoration: underline; }
+@media (prefers-color-scheme: dark) {
+  body { background: #111827; color: #e5e7eb; }
+  td { border-color: #1f2937; }
+  a { color: #60a5fa; }
+}
+</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td class="meta">{{.Size}}</td><td class="meta">{{.ModTime}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// serveListing renders a directory index, directories first
+func (s *Server) serveListing(w http.ResponseWriter, r *http.Request, dir, urlPath string) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		http.Error(w, "failed to read directory", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]listingEntry, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		if strings.HasPrefix(de.Name(), ".") {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+		e := listingEntry{
+			Name:    de.Name(),
+			Href:    url.PathEscape(de.Name()),
+			ModTime: fi.ModTime().Format("2006-01-02 15:04"),
+			IsDir:   fi.IsDir(),
+		}
+		if e.IsDir {
+			e.Href += "/"
+		} else {
+			e.Size = formatSize(fi.Size())
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == http.MethodHead {
+		return
+	}
+	listingTemplate.Execute(w, struct {
+		Path    string
+		Entries []listingEntry
+	}{urlPath, entries})
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Manager runs static servers by port
+type Manager struct {
+	mu      sync.Mutex
+	servers map[int]*Server
+}
+
+// NewManager creates a manager with nothing being served
+func NewManager() *Manager {
+	return &Manager{servers: make(map[int]*Server)}
+}
+
+// Start serves root on localhost:port
+func (m *Manager) Start(port int, repoID, root string, opts Options) (*Server, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.servers[port]; ok {
+		return nil, fmt.Errorf("already serving a directory on port %d", port)
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("port %d is not available: %w", port, err)
+	}
+
+	s := &Server{
+		Port:      port,
+		RepoID:    repoID,
+		Root:      root,
+		Options:   opts,
+		StartedAt: time.Now(),
+	}
+	s.srv = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("Static server on port %d stopped: %v", port, err)
+		}
+	}()
+
+	m.servers[port] = s
+	log.Printf("Serving %s on port %d", root, port)
+	return s, nil
+}
+
+// Stop shuts down the server on a port
+func (m *Manager) Stop(port int) error {
+	m.mu.Lock()
+	s, ok := m.servers[port]
+	delete(m.servers, port)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("nothing is being served on port %d", port)
+	}
+	return s.srv.Close()
+}
+
+// StopAll shuts down every server
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	ports := make([]int, 0, len(m.servers))
+	for port := range m.servers {
+		ports = append(ports, port)
+	}
+	m.mu.Unlock()
+
+	for _, port := range ports {
+		m.Stop(port)
+	}
+}
+
+// Get returns the server on a port, or nil
+func (m *Manager) Get(port int) *Server {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.servers[port]
+}
+
+// List returns all servers ordered by port
+func (m *Manager) List() []*Server {
+	m.mu.Lock()
+	servers := make([]*Server, 0, len(m.servers))
+	for _, s := range m.servers {
+		servers = append(servers, s)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Port < servers[j].Port })
+	return servers
+}
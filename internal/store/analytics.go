@@ -0,0 +1,193 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// sqliteTime matches the CURRENT_TIMESTAMP format used by access_logs.timestamp (UTC)
+const sqliteTime = "2006-01-02 15:04:05"
+
+// CountItem is one row of a breakdown (a path, status code, referrer, ...)
+type CountItem struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// TimelinePoint is the traffic in one hour or day
+type TimelinePoint struct {
+	Bucket   string `json:"bucket"` // "2006-01-02" or "2006-01-02 15"
+	Requests int64  `json:"requests"`
+	Visitors int64  `json:"visitors"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// AccessStats aggregates access logs for a port. Totals and the daily
+// timeline include rolled-up history; everything else comes from raw logs.
+type AccessStats struct {
+	Requests       int64           `json:"requests"`
+	UniqueVisitors int64           `json:"unique_visitors"` // from raw logs only
+	Bytes          int64           `json:"bytes"`
+	Timeline       []TimelinePoint `json:"timeline"`
+	TopPaths       []CountItem     `json:"top_paths"`
+	StatusCodes    []CountItem     `json:"status_codes"`
+	UserAgents     []CountItem     `json:"user_agents"` // raw strings; callers group them into families
+	Referrers      []CountItem     `json:"referrers"`
+	ShareModes     []CountItem     `json:"share_modes"`
+}
+
+// visitorKey identifies a visitor: verified email if known, otherwise IP
+const visitorKey = `COALESCE(NULLIF(identity, ''), ip)`
+
+// AccessAnalytics aggregates a port's traffic since the given time.
+// shareID limits it to one share link; hourly buckets the timeline by hour.
+func (s *Store) AccessAnalytics(port int, since time.Time, shareID string, hourly bool, top int) (*AccessStats, error) {
+	where := `port = ? AND timestamp >= ?`
+	args := []interface{}{port, since.UTC().Format(sqliteTime)}
+	if shareID != "" {
+		where += ` AND share_id = ?`
+		args = append(args, shareID)
+	}
+
+	stats := &AccessStats{}
+	err := s.db.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT `+visitorKey+`), COALESCE(SUM(bytes), 0) FROM access_logs WHERE `+where, args...).
+		Scan(&stats.Requests, &stats.UniqueVisitors, &stats.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Timeline from raw logs
+	bucketLen := 10
+	if hourly {
+		bucketLen = 13
+	}
+	timeline := map[string]*TimelinePoint{}
+	rows, err := s.db.Query(`
+		SELECT substr(timestamp, 1, ?), COUNT(*), COUNT(DISTINCT `+visitorKey+`), COALESCE(SUM(bytes), 0)
+		FROM access_logs WHERE `+where+` GROUP BY 1`, append([]interface{}{bucketLen}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p TimelinePoint
+		if err := rows.Scan(&p.Bucket, &p.Requests, &p.Visitors, &p.Bytes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		timeline[p.Bucket] = &p
+	}
+	rows.Close()
+
+	// Days that have already been rolled up (daily view only - rollups have no hours)
+	if !hourly {
+		dailyWhere := `port = ? AND day >= ?`
+		dailyArgs := []interface{}{port, since.UTC().Format("2006-01-02")}
+		if shareID != "" {
+			dailyWhere += ` AND share_id = ?`
+			dailyArgs = append(dailyArgs, shareID)
+		}
+		rows, err := s.db.Query(`SELECT day, SUM(requests), SUM(visitors), SUM(bytes) FROM access_daily WHERE `+dailyWhere+` GROUP BY day`, dailyArgs...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var p TimelinePoint
+			if err := rows.Scan(&p.Bucket, &p.Requests, &p.Visitors, &p.Bytes); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if existing, ok := timeline[p.Bucket]; ok {
+				existing.Requests += p.Requests
+				existing.Visitors += p.Visitors
+				existing.Bytes += p.Bytes
+			} else {
+				timeline[p.Bucket] = &p
+			}
+			stats.Requests += p.Requests
+			stats.Bytes += p.Bytes
+		}
+		rows.Close()
+	}
+
+	stats.Timeline = make([]TimelinePoint, 0, len(timeline))
+	for _, p := range timeline {
+		stats.Timeline = append(stats.Timeline, *p)
+	}
+	sort.Slice(stats.Timeline, func(i, j int) bool { return stats.Timeline[i].Bucket < stats.Timeline[j].Bucket })
+
+	breakdowns := []struct {
+		expr  string
+		limit int
+		dest  *[]CountItem
+	}{
+		{`COALESCE(path, '')`, top, &stats.TopPaths},
+		{`COALESCE(CAST(status AS TEXT), '')`, top, &stats.StatusCodes},
+		{`COALESCE(user_agent, '')`, 1000, &stats.UserAgents},
+		{`COALESCE(referrer, '')`, top, &stats.Referrers},
+		{`COALESCE(share_mode, '')`, top, &stats.ShareModes},
+	}
+	for _, b := range breakdowns {
+		items, err := s.countBy(b.expr, where, args, b.limit)
+		if err != nil {
+			return nil, err
+		}
+		*b.dest = items
+	}
+
+	return stats, nil
+}
+
+// countBy groups matching access logs by an expression, most frequent first
+func (s *Store) countBy(expr, where string, args []interface{}, limit int) ([]CountItem, error) {
+	queryArgs := append(append([]interface{}{}, args...), limit)
+	rows, err := s.db.Query(`SELECT `+expr+`, COUNT(*) FROM access_logs WHERE `+where+` GROUP BY 1 ORDER BY 2 DESC LIMIT ?`, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []CountItem{}
+	for rows.Next() {
+		var item CountItem
+		if err := rows.Scan(&item.Value, &item.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// RollupAccessLogs folds raw access logs from before the given day into
+// daily totals and deletes them. Returns the number of raw rows removed.
+func (s *Store) RollupAccessLogs(before time.Time) (int64, error) {
+	cutoff := before.UTC().Truncate(24 * time.Hour).Format(sqliteTime)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO access_daily (port, day, share_id, requests, visitors, bytes)
+		SELECT port, substr(timestamp, 1, 10), COALESCE(share_id, ''), COUNT(*), COUNT(DISTINCT `+visitorKey+`), COALESCE(SUM(bytes), 0)
+		FROM access_logs WHERE timestamp < ?
+		GROUP BY 1, 2, 3
+		ON CONFLICT(port, day, share_id) DO UPDATE SET
+			requests = requests + excluded.requests,
+			visitors = visitors + excluded.visitors,
+			bytes = bytes + excluded.bytes
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`DELETE FROM access_logs WHERE timestamp < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// maxTerminalCommands caps the command history; the oldest commands go first
+const maxTerminalCommands = 20000
+
+const commandColumns = `id, session_id, repo_id, command, cwd, exit_code, started_at, duration, output`
+
+// CommandQuery selects commands from the history. Empty fields match
+// every command.
+type CommandQuery struct {
+	RepoID string
+	Text   string // part of the command line
+	Failed bool   // exited with a non-zero code
+	Since  time.Time
+	Limit  int
+}
+
+// AddTerminalCommand adds a command to the history, dropping the oldest
+// commands past the cap
+func (s *Store) AddTerminalCommand(c *TerminalCommand) error {
+	res, err := s.db.Exec(`
+		INSERT INTO terminal_commands (session_id, repo_id, command, cwd, exit_code, started_at, duration, output)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.SessionID, c.RepoID, c.Command, c.Cwd, c.ExitCode, c.StartedAt, c.Duration, c.Output)
+	if err != nil {
+		return err
+	}
+	c.ID, _ = res.LastInsertId()
+
+	_, err = s.db.Exec(`DELETE FROM terminal_commands WHERE id <= ?`, c.ID-maxTerminalCommands)
+	return err
+}
+
+// GetTerminalCommand returns a single command from the history
+func (s *Store) GetTerminalCommand(id int64) (*TerminalCommand, error) {
+	return scanCommand(s.db.QueryRow(`SELECT `+commandColumns+` FROM terminal_commands WHERE id = ?`, id))
+}
+
+// ListTerminalCommands searches the history, newest first
+func (s *Store) ListTerminalCommands(q CommandQuery) ([]TerminalCommand, error) {
+	var where []string
+	var args []any
+	if q.RepoID != "" {
+		where = append(where, `repo_id = ?`)
+		args = append(args, q.RepoID)
+	}
+	if q.Text != "" {
+		where = append(where, `command LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(q.Text)+"%")
+	}
+	if q.Failed {
+		where = append(where, `exit_code != 0`)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, `started_at >= ?`)
+		args = append(args, q.Since)
+	}
+
+	query := `SELECT ` + commandColumns + ` FROM terminal_commands`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY id DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []TerminalCommand
+	for rows.Next() {
+		c, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, *c)
+	}
+	return commands, rows.Err()
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func scanCommand(row rowScanner) (*TerminalCommand, error) {
+	var c TerminalCommand
+	var cwd, output sql.NullString
+	var exitCode sql.NullInt64
+	if err := row.Scan(&c.ID, &c.SessionID, &c.RepoID, &c.Command, &cwd, &exitCode, &c.StartedAt, &c.Duration, &output); err != nil {
+		return nil, err
+	}
+	c.Cwd, c.Output = cwd.String, output.String
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		c.ExitCode = &code
+	}
+	return &c, nil
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// maxFeedbackPerPort caps stored feedback so a share can't be used to fill the disk
+const maxFeedbackPerPort = 500
+
+const feedbackColumns = `id, port, share_id, repo_id, page, viewport, name, message, screenshot, identity, ip, user_agent, created_at, resolved_at`
+
+// AddFeedback stores visitor feedback
+func (s *Store) AddFeedback(f *Feedback) error {
+	res, err := s.db.Exec(`
+		INSERT INTO feedback (port, share_id, repo_id, page, viewport, name, message, screenshot, identity, ip, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, f.Port, f.ShareID, f.RepoID, f.Page, f.Viewport, f.Name, f.Message, f.Screenshot, f.Identity, f.IP, f.UserAgent)
+	if err != nil {
+		return err
+	}
+	f.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// PruneFeedback drops a port's oldest entries past the cap and returns
+// the screenshot files of the removed entries so they can be deleted
+func (s *Store) PruneFeedback(port int) ([]string, error) {
+	const older = `port = ? AND id NOT IN (SELECT id FROM feedback WHERE port = ? ORDER BY id DESC LIMIT ?)`
+
+	rows, err := s.db.Query(`SELECT screenshot FROM feedback WHERE screenshot != '' AND `+older, port, port, maxFeedbackPerPort)
+	if err != nil {
+		return nil, err
+	}
+	var screenshots []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		screenshots = append(screenshots, name)
+	}
+	rows.Close()
+
+	_, err = s.db.Exec(`DELETE FROM feedback WHERE `+older, port, port, maxFeedbackPerPort)
+	return screenshots, err
+}
+
+// ListFeedback returns a port's feedback, newest first. status is "open",
+// "resolved" or "" for all entries.
+func (s *Store) ListFeedback(port int, status string, limit int) ([]Feedback, error) {
+	where := `port = ?`
+	switch status {
+	case "open":
+		where += ` AND resolved_at IS NULL`
+	case "resolved":
+		where += ` AND resolved_at IS NOT NULL`
+	}
+
+	rows, err := s.db.Query(`SELECT `+feedbackColumns+` FROM feedback WHERE `+where+` ORDER BY id DESC LIMIT ?`, port, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Feedback
+	for rows.Next() {
+		f, err := scanFeedback(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *f)
+	}
+	return entries, nil
+}
+
+// GetFeedback returns a single feedback entry
+func (s *Store) GetFeedback(id int64) (*Feedback, error) {
+	return scanFeedback(s.db.QueryRow(`SELECT `+feedbackColumns+` FROM feedback WHERE id = ?`, id))
+}
+
+func scanFeedback(row rowScanner) (*Feedback, error) {
+	var f Feedback
+	var shareID, repoID, page, viewport, name, screenshot, identity, ip, userAgent sql.NullString
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&f.ID, &f.Port, &shareID, &repoID, &page, &viewport, &name, &f.Message, &screenshot,
+		&identity, &ip, &userAgent, &f.CreatedAt, &resolvedAt); err != nil {
+		return nil, err
+	}
+	f.ShareID = shareID.String
+	f.RepoID = repoID.String
+	f.Page = page.String
+	f.Viewport = viewport.String
+	f.Name = name.String
+	f.Screenshot = screenshot.String
+	f.Identity = identity.String
+	f.IP = ip.String
+	f.UserAgent = userAgent.String
+	if resolvedAt.Valid {
+		f.ResolvedAt = &resolvedAt.Time
+	}
+	return &f, nil
+}
+
+// SetFeedbackResolved marks feedback entries as resolved or reopens them
+func (s *Store) SetFeedbackResolved(resolved bool, ids ...int64) error {
+	var resolvedAt *time.Time
+	if resolved {
+		now := time.Now().UTC()
+		resolvedAt = &now
+	}
+	for _, id := range ids {
+		if _, err := s.db.Exec(`UPDATE feedback SET resolved_at = ? WHERE id = ?`, resolvedAt, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteFeedback removes a single feedback entry
+func (s *Store) DeleteFeedback(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM feedback WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const execJobColumns = `id, repo_id, command, status, exit_code, started_at, finished_at`
+
+// CreateExecJob records a job that has started
+func (s *Store) CreateExecJob(j *ExecJob) error {
+	_, err := s.db.Exec(`
+		INSERT INTO exec_jobs (`+execJobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, j.ID, j.RepoID, j.Command, j.Status, j.ExitCode, j.StartedAt, j.FinishedAt)
+	return err
+}
+
+// FinishExecJob records how a job ended
+func (s *Store) FinishExecJob(id, status string, exitCode *int, finishedAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE exec_jobs SET status = ?, exit_code = ?, finished_at = ? WHERE id = ?`,
+		status, exitCode, finishedAt, id)
+	return err
+}
+
+// InterruptExecJobs marks jobs still recorded as running as interrupted,
+// for when homeportd starts after a stop that didn't let them finish
+func (s *Store) InterruptExecJobs() error {
+	_, err := s.db.Exec(`UPDATE exec_jobs SET status = 'interrupted', finished_at = ? WHERE status = 'running'`, time.Now())
+	return err
+}
+
+// GetExecJob returns a single job
+func (s *Store) GetExecJob(id string) (*ExecJob, error) {
+	return scanExecJob(s.db.QueryRow(`SELECT `+execJobColumns+` FROM exec_jobs WHERE id = ?`, id))
+}
+
+// ListExecJobs returns the jobs of a repo, or of all repos if repoID is
+// empty, newest first
+func (s *Store) ListExecJobs(repoID string, limit int) ([]ExecJob, error) {
+	query := `SELECT ` + execJobColumns + ` FROM exec_jobs`
+	var args []any
+	if repoID != "" {
+		query += ` WHERE repo_id = ?`
+		args = append(args, repoID)
+	}
+	query += ` ORDER BY started_at DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []ExecJob
+	for rows.Next() {
+		j, err := scanExecJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
+
+// PruneExecJobs forgets finished jobs past the newest keep and returns
+// their IDs
+func (s *Store) PruneExecJobs(keep int) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT id FROM exec_jobs WHERE status != 'running'
+		ORDER BY started_at DESC LIMIT -1 OFFSET ?
+	`, keep)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, err := s.db.Exec(`DELETE FROM exec_jobs WHERE id = ?`, id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func scanExecJob(row rowScanner) (*ExecJob, error) {
+	var j ExecJob
+	var exitCode sql.NullInt64
+	var finishedAt sql.NullTime
+	if err := row.Scan(&j.ID, &j.RepoID, &j.Command, &j.Status, &exitCode, &j.StartedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		j.ExitCode = &code
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return &j, nil
+}
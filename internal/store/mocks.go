@@ -0,0 +1,35 @@
+package store
+
+// SaveMock records a mock so it is restarted with homeport
+func (s *Store) SaveMock(m *Mock) error {
+	_, err := s.db.Exec(`
+		INSERT INTO mocks (port, file) VALUES (?, ?)
+		ON CONFLICT(port) DO UPDATE SET file = excluded.file
+	`, m.Port, m.File)
+	return err
+}
+
+// ListMocks returns all saved mocks ordered by port
+func (s *Store) ListMocks() ([]Mock, error) {
+	rows, err := s.db.Query(`SELECT port, file, created_at FROM mocks ORDER BY port`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mocks []Mock
+	for rows.Next() {
+		var m Mock
+		if err := rows.Scan(&m.Port, &m.File, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		mocks = append(mocks, m)
+	}
+	return mocks, rows.Err()
+}
+
+// DeleteMock forgets a mock
+func (s *Store) DeleteMock(port int) error {
+	_, err := s.db.Exec(`DELETE FROM mocks WHERE port = ?`, port)
+	return err
+}
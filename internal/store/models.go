@@ -1,29 +1,124 @@
 package store
 
-import "time"
+import (
+	"net"
+	"time"
+)
 
 type Repo struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	Path         string    `json:"path"`
-	GitHubURL    string    `json:"github_url,omitempty"`
-	StartCommand string    `json:"start_command,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	GitHubURL     string    `json:"github_url,omitempty"`
+	StartCommand  string    `json:"start_command,omitempty"`
+	WakeOnRequest bool      `json:"wake_on_request"`                // Start the dev server when its port is requested
+	IdleTimeout   int       `json:"idle_timeout_minutes,omitempty"` // Stop after N minutes without proxied traffic (0 = never)
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type Port struct {
-	Port         int        `json:"port"`
-	RepoID       string     `json:"repo_id,omitempty"`
-	RepoName     string     `json:"repo_name,omitempty"`
-	PID          int        `json:"pid,omitempty"`
-	ProcessName  string     `json:"process_name,omitempty"`
-	Command      string     `json:"command,omitempty"` // Full command line
-	ShareMode    string     `json:"share_mode"`        // "private", "password", "public"
-	PasswordHash string     `json:"-"`
-	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
-	FirstSeen    time.Time  `json:"first_seen"`
-	LastSeen     time.Time  `json:"last_seen"`
+	Port             int            `json:"port"`
+	RepoID           string         `json:"repo_id,omitempty"`
+	RepoName         string         `json:"repo_name,omitempty"`
+	PID              int            `json:"pid,omitempty"`
+	ProcessName      string         `json:"process_name,omitempty"`
+	Command          string         `json:"command,omitempty"` // Full command line
+	ShareMode        string         `json:"share_mode"`        // "private", "password", "email", "public"
+	PasswordHash     string         `json:"-"`
+	ExpiresAt        *time.Time     `json:"expires_at,omitempty"`
+	StartsAt         *time.Time     `json:"starts_at,omitempty"`         // Share opens at this time
+	Schedule         *ShareSchedule `json:"schedule,omitempty"`          // Recurring weekly window
+	ScheduledMode    string         `json:"scheduled_mode,omitempty"`    // Mode while the share is open (private otherwise)
+	ShareID          string         `json:"share_id,omitempty"`          // Changes every time the port is (re)shared
+	IPAllow          []string       `json:"ip_allow,omitempty"`          // IPs/CIDRs allowed to access the share (empty = anyone)
+	IPDeny           []string       `json:"ip_deny,omitempty"`           // IPs/CIDRs always refused
+	EmailAllowlist   []string       `json:"email_allowlist,omitempty"`   // Addresses/domains that may sign in to "email" shares
+	RateLimit        int            `json:"rate_limit_rps,omitempty"`    // Requests per second per visitor IP (0 = unlimited)
+	QuotaBytes       int64          `json:"quota_bytes,omitempty"`       // Total transfer before the share is paused (0 = unlimited)
+	UsageRequests    int64          `json:"usage_requests"`              // Visitor requests served since the share was set
+	UsageBytes       int64          `json:"usage_bytes"`                 // Visitor bytes served since the share was set
+	Banner           bool           `json:"banner"`                      // Inject the preview banner into HTML pages for visitors
+	BannerFeedback   bool           `json:"banner_feedback"`             // Show a "leave feedback" box in the banner
+	FeedbackCount    int            `json:"feedback_count"`              // Unresolved feedback entries for this port
+	Protocol         string         `json:"protocol,omitempty"`          // Detected: "http", "https", "h2c", "grpc", "websocket", "postgres", "redis", "mysql" or "unknown"
+	ProtocolOverride string         `json:"protocol_override,omitempty"` // Set by the user; wins over detection
+	Title            string         `json:"title,omitempty"`             // <title> of the root page
+	Favicon          string         `json:"favicon,omitempty"`           // Path of the page's icon on the port
+	Server           string         `json:"server,omitempty"`            // Server/X-Powered-By headers or greeting banner
+	Framework        string         `json:"framework,omitempty"`         // Recognised dev server, e.g. "Vite", "Next.js"
+	BindAddresses    []string       `json:"bind_addresses,omitempty"`    // Addresses the port listens on, e.g. "127.0.0.1", "::"
+	Family           string         `json:"family,omitempty"`            // "ipv4", "ipv6" or "dual"
+	Container        string         `json:"container,omitempty"`         // Container publishing or running the port, "project/service" for compose
+	Namespace        string         `json:"namespace,omitempty"`         // Network namespace when not the host's, e.g. "container:web-1"
+	DialAddr         string         `json:"dial_addr,omitempty"`         // Address the port is reached on in that namespace
+	Exposed          bool           `json:"exposed"`                     // Listens beyond loopback, so it's reachable without homeport
+	Label            string         `json:"label,omitempty"`             // Name given by the user
+	Pinned           bool           `json:"pinned"`                      // Kept with its share settings while offline
+	Offline          bool           `json:"offline"`                     // Pinned, but nothing has listened for StalePortAge
+	FirstSeen        time.Time      `json:"first_seen"`
+	LastSeen         time.Time      `json:"last_seen"`
+}
+
+// ProxyProtocol is how the proxy should talk to the port
+func (p *Port) ProxyProtocol() string {
+	if p.ProtocolOverride != "" {
+		return p.ProtocolOverride
+	}
+	return p.Protocol
+}
+
+// ListensPublicly reports whether the port is bound to all interfaces or a
+// non-loopback address. Such ports can be reached directly, bypassing
+// homeport's auth, wherever the host firewall lets traffic through. Ports
+// in other network namespaces are only reachable from the host.
+func (p *Port) ListensPublicly() bool {
+	if p.Namespace != "" {
+		return false
+	}
+	for _, addr := range p.BindAddresses {
+		if ip := net.ParseIP(addr); ip != nil && !ip.IsLoopback() {
+			return true
+		}
+	}
+	return false
+}
+
+// DialHost is the address homeport connects to for the port: loopback in a
+// family it listens on, or its own address when bound to a single interface.
+// Ports in other network namespaces are dialled on their namespace's
+// address. Unknown bindings fall back to "localhost".
+func (p *Port) DialHost() string {
+	if p.DialAddr != "" {
+		return p.DialAddr
+	}
+	var v4, v6, other string
+	for _, addr := range p.BindAddresses {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+		case ip.To4() != nil && (ip.IsLoopback() || ip.IsUnspecified()):
+			v4 = "127.0.0.1"
+		case ip.To4() == nil && (ip.IsLoopback() || ip.IsUnspecified()):
+			v6 = "::1"
+		case other == "":
+			other = addr
+		}
+	}
+	for _, host := range []string{v4, v6, other} {
+		if host != "" {
+			return host
+		}
+	}
+	return "localhost"
+}
+
+// ShareSchedule is a recurring weekly window during which a share is open
+type ShareSchedule struct {
+	Days     []string `json:"days,omitempty"` // "mon".."sun"; empty means every day
+	Start    string   `json:"start"`          // "09:00"
+	End      string   `json:"end"`            // "18:00"; earlier than start for overnight windows
+	Timezone string   `json:"timezone,omitempty"`
 }
 
 // RepoStatus contains git status info for a repo
@@ -43,6 +138,13 @@ type AccessLog struct {
 	UserAgent     string    `json:"user_agent"`
 	Timestamp     time.Time `json:"timestamp"`
 	Authenticated bool      `json:"authenticated"`
+	Identity      string    `json:"identity,omitempty"` // Verified email for email-gated shares
+	Path          string    `json:"path,omitempty"`
+	Status        int       `json:"status,omitempty"`
+	Referrer      string    `json:"referrer,omitempty"`
+	Bytes         int64     `json:"bytes"`
+	ShareMode     string    `json:"share_mode,omitempty"`
+	ShareID       string    `json:"share_id,omitempty"` // Which share link the request came through
 }
 
 // TerminalSession represents a persisted terminal session
@@ -57,3 +159,86 @@ type TerminalSession struct {
 	LastUsed  time.Time `json:"last_used"`
 }
 
+// TerminalRecording is an asciicast recording of a terminal session. It is
+// in progress until EndedAt is set.
+type TerminalRecording struct {
+	ID        string     `json:"id"`
+	SessionID string     `json:"session_id"`
+	RepoID    string     `json:"repo_id"`
+	Cols      int        `json:"cols"`
+	Rows      int        `json:"rows"`
+	Size      int64      `json:"size"` // Bytes, as of EndedAt
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// TerminalShare is a link to a terminal session. Mode is "view" or "drive".
+type TerminalShare struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Mode      string    `json:"mode"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TerminalCommand is a command run in a terminal session, as reported by
+// shell integration. ExitCode is nil if the shell didn't report one.
+type TerminalCommand struct {
+	ID        int64     `json:"id"`
+	SessionID string    `json:"session_id"`
+	RepoID    string    `json:"repo_id"`
+	Command   string    `json:"command"`
+	Cwd       string    `json:"cwd,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Duration  float64   `json:"duration"`         // Seconds
+	Output    string    `json:"output,omitempty"` // First and last lines
+}
+
+// ExecJob is a non-interactive command run in a repo through the exec API.
+// Status is "running", "succeeded", "failed", "canceled" or "interrupted"
+// (homeportd stopped while it ran). ExitCode is nil until the command exits.
+type ExecJob struct {
+	ID         string     `json:"id"`
+	RepoID     string     `json:"repo_id"`
+	Command    string     `json:"command"`
+	Status     string     `json:"status"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Feedback is a message left by a visitor through the preview banner
+type Feedback struct {
+	ID         int64      `json:"id"`
+	Port       int        `json:"port"`
+	ShareID    string     `json:"share_id,omitempty"`
+	RepoID     string     `json:"repo_id,omitempty"`
+	Page       string     `json:"page,omitempty"`     // Path the visitor was on
+	Viewport   string     `json:"viewport,omitempty"` // Browser window size, e.g. "1440x900"
+	Name       string     `json:"name,omitempty"`
+	Message    string     `json:"message"`
+	Screenshot string     `json:"screenshot,omitempty"` // File name in the feedback data directory
+	Identity   string     `json:"identity,omitempty"`   // Verified email for email-gated shares
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Mock is a mock server homeport runs on a port from a routes file
+type Mock struct {
+	Port      int       `json:"port"`
+	File      string    `json:"file"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StaticServer is a directory homeport serves on a port
+type StaticServer struct {
+	Port      int       `json:"port"`
+	RepoID    string    `json:"repo_id,omitempty"`
+	Root      string    `json:"root"`
+	SPA       bool      `json:"spa"`
+	Listing   bool      `json:"listing"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const recordingColumns = `id, session_id, repo_id, cols, rows, size, started_at, ended_at`
+
+// SaveTerminalRecording records a recording that has started
+func (s *Store) SaveTerminalRecording(rec *TerminalRecording) error {
+	_, err := s.db.Exec(`
+		INSERT INTO terminal_recordings (`+recordingColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, rec.ID, rec.SessionID, rec.RepoID, rec.Cols, rec.Rows, rec.Size, rec.StartedAt, rec.EndedAt)
+	return err
+}
+
+// GetTerminalRecording returns a single recording
+func (s *Store) GetTerminalRecording(id string) (*TerminalRecording, error) {
+	row := s.db.QueryRow(`SELECT `+recordingColumns+` FROM terminal_recordings WHERE id = ?`, id)
+	return scanRecording(row)
+}
+
+// ListTerminalRecordings returns the recordings of a repo, or of all repos
+// if repoID is empty, newest first
+func (s *Store) ListTerminalRecordings(repoID string) ([]TerminalRecording, error) {
+	query := `SELECT ` + recordingColumns + ` FROM terminal_recordings`
+	var args []any
+	if repoID != "" {
+		query += ` WHERE repo_id = ?`
+		args = append(args, repoID)
+	}
+	rows, err := s.db.Query(query+` ORDER BY started_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recordings []TerminalRecording
+	for rows.Next() {
+		rec, err := scanRecording(rows)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, *rec)
+	}
+	return recordings, rows.Err()
+}
+
+func scanRecording(row rowScanner) (*TerminalRecording, error) {
+	var rec TerminalRecording
+	var endedAt sql.NullTime
+	if err := row.Scan(&rec.ID, &rec.SessionID, &rec.RepoID, &rec.Cols, &rec.Rows, &rec.Size, &rec.StartedAt, &endedAt); err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		rec.EndedAt = &endedAt.Time
+	}
+	return &rec, nil
+}
+
+// EndTerminalRecording marks a recording as finished
+func (s *Store) EndTerminalRecording(id string, endedAt time.Time, size int64) error {
+	_, err := s.db.Exec(`UPDATE terminal_recordings SET ended_at = ?, size = ? WHERE id = ?`, endedAt, size, id)
+	return err
+}
+
+// DeleteTerminalRecording forgets a recording
+func (s *Store) DeleteTerminalRecording(id string) error {
+	_, err := s.db.Exec(`DELETE FROM terminal_recordings WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,43 @@
+package store
+
+import "database/sql"
+
+// SaveStaticServer records a served directory so it is restarted with homeport
+func (s *Store) SaveStaticServer(ss *StaticServer) error {
+	_, err := s.db.Exec(`
+		INSERT INTO static_servers (port, repo_id, root, spa, listing) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(port) DO UPDATE SET
+			repo_id = excluded.repo_id,
+			root = excluded.root,
+			spa = excluded.spa,
+			listing = excluded.listing
+	`, ss.Port, ss.RepoID, ss.Root, ss.SPA, ss.Listing)
+	return err
+}
+
+// ListStaticServers returns all saved static servers ordered by port
+func (s *Store) ListStaticServers() ([]StaticServer, error) {
+	rows, err := s.db.Query(`SELECT port, repo_id, root, spa, listing, created_at FROM static_servers ORDER BY port`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var servers []StaticServer
+	for rows.Next() {
+		var ss StaticServer
+		var repoID sql.NullString
+		if err := rows.Scan(&ss.Port, &repoID, &ss.Root, &ss.SPA, &ss.Listing, &ss.CreatedAt); err != nil {
+			return nil, err
+		}
+		ss.RepoID = repoID.String
+		servers = append(servers, ss)
+	}
+	return servers, rows.Err()
+}
+
+// DeleteStaticServer forgets a static server
+func (s *Store) DeleteStaticServer(port int) error {
+	_, err := s.db.Exec(`DELETE FROM static_servers WHERE port = ?`, port)
+	return err
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"strings"
 	"time"
 
@@ -54,6 +55,34 @@ func (s *Store) migrate() error {
 		)`,
 		// Migration: add expires_at column if it doesn't exist
 		`ALTER TABLE ports ADD COLUMN expires_at TIMESTAMP`,
+		`ALTER TABLE ports ADD COLUMN ip_allow TEXT`,
+		`ALTER TABLE ports ADD COLUMN ip_deny TEXT`,
+		`ALTER TABLE ports ADD COLUMN email_allowlist TEXT`,
+		`ALTER TABLE ports ADD COLUMN rate_limit_rps INTEGER DEFAULT 0`,
+		`ALTER TABLE ports ADD COLUMN quota_bytes INTEGER DEFAULT 0`,
+		`ALTER TABLE ports ADD COLUMN usage_requests INTEGER DEFAULT 0`,
+		`ALTER TABLE ports ADD COLUMN usage_bytes INTEGER DEFAULT 0`,
+		`ALTER TABLE ports ADD COLUMN starts_at TIMESTAMP`,
+		`ALTER TABLE ports ADD COLUMN schedule TEXT`,
+		`ALTER TABLE ports ADD COLUMN scheduled_mode TEXT`,
+		`ALTER TABLE ports ADD COLUMN share_id TEXT`,
+		`ALTER TABLE ports ADD COLUMN banner INTEGER DEFAULT 0`,
+		`ALTER TABLE ports ADD COLUMN banner_feedback INTEGER DEFAULT 0`,
+		`ALTER TABLE ports ADD COLUMN protocol TEXT`,
+		`ALTER TABLE ports ADD COLUMN protocol_override TEXT`,
+		`ALTER TABLE ports ADD COLUMN title TEXT`,
+		`ALTER TABLE ports ADD COLUMN favicon TEXT`,
+		`ALTER TABLE ports ADD COLUMN server TEXT`,
+		`ALTER TABLE ports ADD COLUMN framework TEXT`,
+		`ALTER TABLE ports ADD COLUMN bind_addresses TEXT`,
+		`ALTER TABLE ports ADD COLUMN family TEXT`,
+		`ALTER TABLE ports ADD COLUMN container TEXT`,
+		`ALTER TABLE ports ADD COLUMN namespace TEXT`,
+		`ALTER TABLE ports ADD COLUMN dial_addr TEXT`,
+		`ALTER TABLE ports ADD COLUMN label TEXT`,
+		`ALTER TABLE ports ADD COLUMN pinned BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE repos ADD COLUMN wake_on_request BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE repos ADD COLUMN idle_timeout_minutes INTEGER DEFAULT 0`,
 		`CREATE TABLE IF NOT EXISTS access_logs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			port INTEGER,
@@ -62,6 +91,65 @@ func (s *Store) migrate() error {
 			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			authenticated BOOLEAN
 		)`,
+		`ALTER TABLE access_logs ADD COLUMN identity TEXT`,
+		`ALTER TABLE access_logs ADD COLUMN path TEXT`,
+		`ALTER TABLE access_logs ADD COLUMN status INTEGER`,
+		`ALTER TABLE access_logs ADD COLUMN referrer TEXT`,
+		`ALTER TABLE access_logs ADD COLUMN bytes INTEGER`,
+		`ALTER TABLE access_logs ADD COLUMN share_mode TEXT`,
+		`ALTER TABLE access_logs ADD COLUMN share_id TEXT`,
+		`CREATE INDEX IF NOT EXISTS idx_access_logs_port_timestamp ON access_logs(port, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_access_logs_timestamp ON access_logs(timestamp)`,
+		// Daily totals kept after raw access logs age out
+		`CREATE TABLE IF NOT EXISTS access_daily (
+			port INTEGER NOT NULL,
+			day TEXT NOT NULL,
+			share_id TEXT NOT NULL DEFAULT '',
+			requests INTEGER NOT NULL DEFAULT 0,
+			visitors INTEGER NOT NULL DEFAULT 0,
+			bytes INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (port, day, share_id)
+		)`,
+		// Remembers which repo last served each port, so offline ports can
+		// still be traced back to a repo after stale cleanup removes them
+		`CREATE TABLE IF NOT EXISTS port_history (
+			port INTEGER PRIMARY KEY,
+			repo_id TEXT NOT NULL,
+			last_seen TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Feedback left by visitors through the preview banner
+		`CREATE TABLE IF NOT EXISTS feedback (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			port INTEGER NOT NULL,
+			share_id TEXT,
+			repo_id TEXT,
+			page TEXT,
+			name TEXT,
+			message TEXT NOT NULL,
+			identity TEXT,
+			ip TEXT,
+			user_agent TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_feedback_port ON feedback (port, created_at)`,
+		`ALTER TABLE feedback ADD COLUMN viewport TEXT`,
+		`ALTER TABLE feedback ADD COLUMN screenshot TEXT`,
+		`ALTER TABLE feedback ADD COLUMN resolved_at TIMESTAMP`,
+		// Mock servers to restart with homeport
+		`CREATE TABLE IF NOT EXISTS mocks (
+			port INTEGER PRIMARY KEY,
+			file TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Directories served by homeport, restarted with it
+		`CREATE TABLE IF NOT EXISTS static_servers (
+			port INTEGER PRIMARY KEY,
+			repo_id TEXT,
+			root TEXT NOT NULL,
+			spa INTEGER DEFAULT 0,
+			listing INTEGER DEFAULT 1,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
 		`CREATE TABLE IF NOT EXISTS terminal_sessions (
 			id TEXT PRIMARY KEY,
 			repo_id TEXT NOT NULL,
@@ -72,6 +160,51 @@ func (s *Store) migrate() error {
 			created_at TIMESTAMP NOT NULL,
 			last_used TIMESTAMP NOT NULL
 		)`,
+		// asciicast recordings of terminal sessions
+		`CREATE TABLE IF NOT EXISTS terminal_recordings (
+			id TEXT PRIMARY KEY,
+			session_id TEXT NOT NULL,
+			repo_id TEXT NOT NULL,
+			cols INTEGER NOT NULL,
+			rows INTEGER NOT NULL,
+			size INTEGER DEFAULT 0,
+			started_at TIMESTAMP NOT NULL,
+			ended_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_terminal_recordings_repo ON terminal_recordings (repo_id, started_at)`,
+		// Links that let others watch or type in a terminal session
+		`CREATE TABLE IF NOT EXISTS terminal_shares (
+			id TEXT PRIMARY KEY,
+			session_id TEXT NOT NULL,
+			mode TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Commands run in terminal sessions, for the searchable history
+		`CREATE TABLE IF NOT EXISTS terminal_commands (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id TEXT NOT NULL,
+			repo_id TEXT NOT NULL,
+			command TEXT NOT NULL,
+			cwd TEXT,
+			exit_code INTEGER,
+			started_at TIMESTAMP NOT NULL,
+			duration REAL DEFAULT 0,
+			output TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_terminal_commands_repo ON terminal_commands (repo_id, started_at)`,
+		// Non-interactive commands run through the exec API; their output is
+		// kept in files next to the database
+		`CREATE TABLE IF NOT EXISTS exec_jobs (
+			id TEXT PRIMARY KEY,
+			repo_id TEXT NOT NULL,
+			command TEXT NOT NULL,
+			status TEXT NOT NULL,
+			exit_code INTEGER,
+			started_at TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_exec_jobs_repo ON exec_jobs (repo_id, started_at)`,
 	}
 
 	for _, m := range migrations {
@@ -96,7 +229,7 @@ func isDuplicateColumnError(err error) bool {
 // Repo operations
 
 func (s *Store) ListRepos() ([]Repo, error) {
-	rows, err := s.db.Query(`SELECT id, name, path, github_url, start_command, created_at, updated_at FROM repos ORDER BY name`)
+	rows, err := s.db.Query(`SELECT id, name, path, github_url, start_command, wake_on_request, idle_timeout_minutes, created_at, updated_at FROM repos ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
@@ -106,11 +239,15 @@ func (s *Store) ListRepos() ([]Repo, error) {
 	for rows.Next() {
 		var r Repo
 		var githubURL, startCmd sql.NullString
-		if err := rows.Scan(&r.ID, &r.Name, &r.Path, &githubURL, &startCmd, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		var wake sql.NullBool
+		var idle sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.Name, &r.Path, &githubURL, &startCmd, &wake, &idle, &r.CreatedAt, &r.UpdatedAt); err != nil {
 			return nil, err
 		}
 		r.GitHubURL = githubURL.String
 		r.StartCommand = startCmd.String
+		r.WakeOnRequest = wake.Bool
+		r.IdleTimeout = int(idle.Int64)
 		repos = append(repos, r)
 	}
 	return repos, nil
@@ -119,22 +256,26 @@ func (s *Store) ListRepos() ([]Repo, error) {
 func (s *Store) GetRepo(id string) (*Repo, error) {
 	var r Repo
 	var githubURL, startCmd sql.NullString
+	var wake sql.NullBool
+	var idle sql.NullInt64
 	err := s.db.QueryRow(
-		`SELECT id, name, path, github_url, start_command, created_at, updated_at FROM repos WHERE id = ?`,
+		`SELECT id, name, path, github_url, start_command, wake_on_request, idle_timeout_minutes, created_at, updated_at FROM repos WHERE id = ?`,
 		id,
-	).Scan(&r.ID, &r.Name, &r.Path, &githubURL, &startCmd, &r.CreatedAt, &r.UpdatedAt)
+	).Scan(&r.ID, &r.Name, &r.Path, &githubURL, &startCmd, &wake, &idle, &r.CreatedAt, &r.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	r.GitHubURL = githubURL.String
 	r.StartCommand = startCmd.String
+	r.WakeOnRequest = wake.Bool
+	r.IdleTimeout = int(idle.Int64)
 	return &r, nil
 }
 
 func (s *Store) CreateRepo(r *Repo) error {
 	_, err := s.db.Exec(
-		`INSERT INTO repos (id, name, path, github_url, start_command, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		r.ID, r.Name, r.Path, r.GitHubURL, r.StartCommand, r.CreatedAt, r.UpdatedAt,
+		`INSERT INTO repos (id, name, path, github_url, start_command, wake_on_request, idle_timeout_minutes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Name, r.Path, r.GitHubURL, r.StartCommand, r.WakeOnRequest, r.IdleTimeout, r.CreatedAt, r.UpdatedAt,
 	)
 	return err
 }
@@ -146,8 +287,8 @@ func (s *Store) DeleteRepo(id string) error {
 
 func (s *Store) UpdateRepo(r *Repo) error {
 	_, err := s.db.Exec(
-		`UPDATE repos SET name = ?, path = ?, github_url = ?, start_command = ?, updated_at = ? WHERE id = ?`,
-		r.Name, r.Path, r.GitHubURL, r.StartCommand, r.UpdatedAt, r.ID,
+		`UPDATE repos SET name = ?, path = ?, github_url = ?, start_command = ?, wake_on_request = ?, idle_timeout_minutes = ?, updated_at = ? WHERE id = ?`,
+		r.Name, r.Path, r.GitHubURL, r.StartCommand, r.WakeOnRequest, r.IdleTimeout, r.UpdatedAt, r.ID,
 	)
 	return err
 }
@@ -155,15 +296,19 @@ func (s *Store) UpdateRepo(r *Repo) error {
 func (s *Store) GetRepoByPath(path string) (*Repo, error) {
 	var r Repo
 	var githubURL, startCmd sql.NullString
+	var wake sql.NullBool
+	var idle sql.NullInt64
 	err := s.db.QueryRow(
-		`SELECT id, name, path, github_url, start_command, created_at, updated_at FROM repos WHERE path = ?`,
+		`SELECT id, name, path, github_url, start_command, wake_on_request, idle_timeout_minutes, created_at, updated_at FROM repos WHERE path = ?`,
 		path,
-	).Scan(&r.ID, &r.Name, &r.Path, &githubURL, &startCmd, &r.CreatedAt, &r.UpdatedAt)
+	).Scan(&r.ID, &r.Name, &r.Path, &githubURL, &startCmd, &wake, &idle, &r.CreatedAt, &r.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	r.GitHubURL = githubURL.String
 	r.StartCommand = startCmd.String
+	r.WakeOnRequest = wake.Bool
+	r.IdleTimeout = int(idle.Int64)
 	return &r, nil
 }
 
@@ -171,48 +316,110 @@ func (s *Store) GetRepoByPath(path string) (*Repo, error) {
 
 func (s *Store) UpsertPort(p *Port) error {
 	_, err := s.db.Exec(`
-		INSERT INTO ports (port, repo_id, pid, process_name, share_mode, first_seen, last_seen)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO ports (port, repo_id, pid, process_name, bind_addresses, family, container, namespace, dial_addr, share_mode, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(port) DO UPDATE SET
 			repo_id = excluded.repo_id,
 			pid = excluded.pid,
 			process_name = excluded.process_name,
+			bind_addresses = excluded.bind_addresses,
+			family = excluded.family,
+			container = excluded.container,
+			namespace = excluded.namespace,
+			dial_addr = excluded.dial_addr,
 			last_seen = excluded.last_seen
-	`, p.Port, p.RepoID, p.PID, p.ProcessName, p.ShareMode, p.FirstSeen, p.LastSeen)
+	`, p.Port, p.RepoID, p.PID, p.ProcessName, strings.Join(p.BindAddresses, ","), p.Family, p.Container, p.Namespace, p.DialAddr, p.ShareMode, p.FirstSeen, p.LastSeen)
 	return err
 }
 
-func (s *Store) GetPort(port int) (*Port, error) {
+// portColumns is the column list read by scanPort (ports p LEFT JOIN repos r)
+const portColumns = `p.port, p.repo_id, r.name, p.pid, p.process_name, p.share_mode, p.password_hash, p.expires_at,
+	p.starts_at, p.schedule, p.scheduled_mode, p.share_id, p.ip_allow, p.ip_deny, p.email_allowlist,
+	p.rate_limit_rps, p.quota_bytes, p.usage_requests, p.usage_bytes, p.banner, p.banner_feedback,
+	p.protocol, p.protocol_override, p.title, p.favicon, p.server, p.framework, p.bind_addresses, p.family,
+	p.container, p.namespace, p.dial_addr, p.label, p.pinned,
+	(SELECT COUNT(*) FROM feedback f WHERE f.port = p.port AND f.resolved_at IS NULL), p.first_seen, p.last_seen`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPort reads a row selected with portColumns
+func scanPort(row rowScanner) (*Port, error) {
 	var p Port
-	var repoID sql.NullString
+	var repoID, repoName, processName, passwordHash sql.NullString
 	var pid sql.NullInt64
-	var processName sql.NullString
-	var passwordHash sql.NullString
-	var expiresAt sql.NullTime
-	err := s.db.QueryRow(`
-		SELECT port, repo_id, pid, process_name, share_mode, password_hash, expires_at, first_seen, last_seen
-		FROM ports WHERE port = ?
-	`, port).Scan(&p.Port, &repoID, &pid, &processName, &p.ShareMode, &passwordHash, &expiresAt, &p.FirstSeen, &p.LastSeen)
-	if err != nil {
+	var expiresAt, startsAt sql.NullTime
+	var schedule, scheduledMode, shareID sql.NullString
+	var ipAllow, ipDeny, emailAllowlist sql.NullString
+	var rateLimit, quota, usageRequests, usageBytes sql.NullInt64
+	var banner, bannerFeedback sql.NullBool
+	var protocol, protocolOverride sql.NullString
+	var title, favicon, server, framework sql.NullString
+	var bindAddresses, family sql.NullString
+	var container, namespace, dialAddr, label sql.NullString
+	var pinned sql.NullBool
+	if err := row.Scan(&p.Port, &repoID, &repoName, &pid, &processName, &p.ShareMode, &passwordHash, &expiresAt,
+		&startsAt, &schedule, &scheduledMode, &shareID, &ipAllow, &ipDeny, &emailAllowlist,
+		&rateLimit, &quota, &usageRequests, &usageBytes, &banner, &bannerFeedback,
+		&protocol, &protocolOverride, &title, &favicon, &server, &framework, &bindAddresses, &family,
+		&container, &namespace, &dialAddr, &label, &pinned, &p.FeedbackCount, &p.FirstSeen, &p.LastSeen); err != nil {
 		return nil, err
 	}
 	p.RepoID = repoID.String
+	p.RepoName = repoName.String
 	p.PID = int(pid.Int64)
 	p.ProcessName = processName.String
 	p.PasswordHash = passwordHash.String
 	if expiresAt.Valid {
 		p.ExpiresAt = &expiresAt.Time
 	}
+	if startsAt.Valid {
+		p.StartsAt = &startsAt.Time
+	}
+	if schedule.String != "" {
+		var sched ShareSchedule
+		if err := json.Unmarshal([]byte(schedule.String), &sched); err == nil {
+			p.Schedule = &sched
+		}
+	}
+	p.ScheduledMode = scheduledMode.String
+	p.ShareID = shareID.String
+	p.IPAllow = splitList(ipAllow.String)
+	p.IPDeny = splitList(ipDeny.String)
+	p.EmailAllowlist = splitList(emailAllowlist.String)
+	p.RateLimit = int(rateLimit.Int64)
+	p.QuotaBytes = quota.Int64
+	p.UsageRequests = usageRequests.Int64
+	p.UsageBytes = usageBytes.Int64
+	p.Banner = banner.Bool
+	p.BannerFeedback = bannerFeedback.Bool
+	p.Protocol = protocol.String
+	p.ProtocolOverride = protocolOverride.String
+	p.Title = title.String
+	p.Favicon = favicon.String
+	p.Server = server.String
+	p.Framework = framework.String
+	p.BindAddresses = splitList(bindAddresses.String)
+	p.Family = family.String
+	p.Container = container.String
+	p.Namespace = namespace.String
+	p.DialAddr = dialAddr.String
+	p.Label = label.String
+	p.Pinned = pinned.Bool
+	p.Offline = p.LastSeen.Before(time.Now().Add(-StalePortAge))
+	p.Exposed = p.ListensPublicly()
 	return &p, nil
 }
 
+func (s *Store) GetPort(port int) (*Port, error) {
+	row := s.db.QueryRow(`SELECT `+portColumns+` FROM ports p LEFT JOIN repos r ON p.repo_id = r.id WHERE p.port = ?`, port)
+	return scanPort(row)
+}
+
 func (s *Store) ListPorts() ([]Port, error) {
-	rows, err := s.db.Query(`
-		SELECT p.port, p.repo_id, r.name, p.pid, p.process_name, p.share_mode, p.expires_at, p.first_seen, p.last_seen
-		FROM ports p
-		LEFT JOIN repos r ON p.repo_id = r.id
-		ORDER BY p.port
-	`)
+	rows, err := s.db.Query(`SELECT ` + portColumns + ` FROM ports p LEFT JOIN repos r ON p.repo_id = r.id ORDER BY p.port`)
 	if err != nil {
 		return nil, err
 	}
@@ -220,21 +427,11 @@ func (s *Store) ListPorts() ([]Port, error) {
 
 	var ports []Port
 	for rows.Next() {
-		var p Port
-		var repoID, repoName, processName sql.NullString
-		var pid sql.NullInt64
-		var expiresAt sql.NullTime
-		if err := rows.Scan(&p.Port, &repoID, &repoName, &pid, &processName, &p.ShareMode, &expiresAt, &p.FirstSeen, &p.LastSeen); err != nil {
+		p, err := scanPort(rows)
+		if err != nil {
 			return nil, err
 		}
-		p.RepoID = repoID.String
-		p.RepoName = repoName.String
-		p.PID = int(pid.Int64)
-		p.ProcessName = processName.String
-		if expiresAt.Valid {
-			p.ExpiresAt = &expiresAt.Time
-		}
-		ports = append(ports, p)
+		ports = append(ports, *p)
 	}
 	return ports, nil
 }
@@ -244,61 +441,194 @@ func (s *Store) UpdatePortShare(port int, mode string, passwordHash string, expi
 	return err
 }
 
+// SetPortShareID assigns a new share link ID, used to tell shares of the same port apart in analytics
+func (s *Store) SetPortShareID(port int, shareID string) error {
+	_, err := s.db.Exec(`UPDATE ports SET share_id = ? WHERE port = ?`, shareID, port)
+	return err
+}
+
+// SetPortShareMode changes only the share mode, keeping password, expiry and schedule
+func (s *Store) SetPortShareMode(port int, mode string) error {
+	_, err := s.db.Exec(`UPDATE ports SET share_mode = ? WHERE port = ?`, mode, port)
+	return err
+}
+
+// UpdatePortSchedule sets when a share is open. While it is, the port uses
+// scheduledMode; otherwise it is private. An empty scheduledMode clears the schedule.
+func (s *Store) UpdatePortSchedule(port int, scheduledMode string, startsAt *time.Time, schedule *ShareSchedule) error {
+	var scheduleJSON sql.NullString
+	if schedule != nil {
+		data, err := json.Marshal(schedule)
+		if err != nil {
+			return err
+		}
+		scheduleJSON = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := s.db.Exec(`UPDATE ports SET scheduled_mode = ?, starts_at = ?, schedule = ? WHERE port = ?`,
+		scheduledMode, startsAt, scheduleJSON, port)
+	return err
+}
+
+// UpdatePortIPRules sets the IP/CIDR allow and deny lists for a port
+func (s *Store) UpdatePortIPRules(port int, allow, deny []string) error {
+	_, err := s.db.Exec(`UPDATE ports SET ip_allow = ?, ip_deny = ? WHERE port = ?`, strings.Join(allow, ","), strings.Join(deny, ","), port)
+	return err
+}
+
+// UpdatePortEmailAllowlist sets the addresses/domains allowed to request magic links for a port
+func (s *Store) UpdatePortEmailAllowlist(port int, allowlist []string) error {
+	_, err := s.db.Exec(`UPDATE ports SET email_allowlist = ? WHERE port = ?`, strings.Join(allowlist, ","), port)
+	return err
+}
+
+// UpdatePortLimits sets the per-client request rate and total transfer quota for a port (0 = unlimited)
+func (s *Store) UpdatePortLimits(port int, rateLimit int, quotaBytes int64) error {
+	_, err := s.db.Exec(`UPDATE ports SET rate_limit_rps = ?, quota_bytes = ? WHERE port = ?`, rateLimit, quotaBytes, port)
+	return err
+}
+
+// UpdatePortBanner turns the preview banner and its feedback box on or off for a port
+func (s *Store) UpdatePortBanner(port int, banner, feedback bool) error {
+	_, err := s.db.Exec(`UPDATE ports SET banner = ?, banner_feedback = ? WHERE port = ?`, banner, feedback, port)
+	return err
+}
+
+// SetPortFingerprint records what probing the port found: protocol, page
+// title, favicon, server hints and framework
+func (s *Store) SetPortFingerprint(p *Port) error {
+	_, err := s.db.Exec(`UPDATE ports SET protocol = ?, title = ?, favicon = ?, server = ?, framework = ? WHERE port = ?`,
+		p.Protocol, p.Title, p.Favicon, p.Server, p.Framework, p.Port)
+	return err
+}
+
+// SetPortProtocolOverride forces how the proxy talks to a port ("" to use detection)
+func (s *Store) SetPortProtocolOverride(port int, protocol string) error {
+	_, err := s.db.Exec(`UPDATE ports SET protocol_override = ? WHERE port = ?`, protocol, port)
+	return err
+}
+
+// SetPortLabel names a port ("" to clear)
+func (s *Store) SetPortLabel(port int, label string) error {
+	_, err := s.db.Exec(`UPDATE ports SET label = ? WHERE port = ?`, label, port)
+	return err
+}
+
+// SetPortPinned keeps a port, with its share settings, while nothing listens on it
+func (s *Store) SetPortPinned(port int, pinned bool) error {
+	_, err := s.db.Exec(`UPDATE ports SET pinned = ? WHERE port = ?`, pinned, port)
+	return err
+}
+
+// AddPortUsage adds served traffic to a port's usage counters
+func (s *Store) AddPortUsage(port int, requests, bytes int64) error {
+	_, err := s.db.Exec(`UPDATE ports SET usage_requests = COALESCE(usage_requests, 0) + ?, usage_bytes = COALESCE(usage_bytes, 0) + ? WHERE port = ?`,
+		requests, bytes, port)
+	return err
+}
+
+// ResetPortUsage zeroes a port's usage counters
+func (s *Store) ResetPortUsage(port int) error {
+	_, err := s.db.Exec(`UPDATE ports SET usage_requests = 0, usage_bytes = 0 WHERE port = ?`, port)
+	return err
+}
+
+// splitList splits a comma-separated column into its entries
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
 func (s *Store) DeletePort(port int) error {
 	_, err := s.db.Exec(`DELETE FROM ports WHERE port = ?`, port)
 	return err
 }
 
+// StalePortAge is how long a port can go unseen by the scanner before it
+// is dropped, or shown as offline if pinned
+const StalePortAge = 30 * time.Second
+
+// CleanupStalePorts forgets ports not seen since before, except pinned ones
 func (s *Store) CleanupStalePorts(before time.Time) error {
-	_, err := s.db.Exec(`DELETE FROM ports WHERE last_seen < ?`, before)
+	_, err := s.db.Exec(`DELETE FROM ports WHERE last_seen < ? AND NOT COALESCE(pinned, FALSE)`, before)
 	return err
 }
 
+// RecordPortRepo remembers that a port was last served by the given repo
+func (s *Store) RecordPortRepo(port int, repoID string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO port_history (port, repo_id, last_seen) VALUES (?, ?, ?)
+		ON CONFLICT(port) DO UPDATE SET repo_id = excluded.repo_id, last_seen = excluded.last_seen
+	`, port, repoID, time.Now())
+	return err
+}
+
+// GetLastRepoForPort returns the repo that most recently served the port
+func (s *Store) GetLastRepoForPort(port int) (string, error) {
+	var repoID string
+	err := s.db.QueryRow(`SELECT repo_id FROM port_history WHERE port = ?`, port).Scan(&repoID)
+	return repoID, err
+}
+
 // Access log operations
 
-func (s *Store) LogAccess(port int, ip string, userAgent string, authenticated bool) error {
-	_, err := s.db.Exec(`INSERT INTO access_logs (port, ip, user_agent, authenticated) VALUES (?, ?, ?, ?)`,
-		port, ip, userAgent, authenticated)
+// LogAccess records a request to a port
+func (s *Store) LogAccess(entry *AccessLog) error {
+	_, err := s.db.Exec(`
+		INSERT INTO access_logs (port, ip, user_agent, authenticated, identity, path, status, referrer, bytes, share_mode, share_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Port, entry.IP, entry.UserAgent, entry.Authenticated, entry.Identity, entry.Path, entry.Status,
+		entry.Referrer, entry.Bytes, entry.ShareMode, entry.ShareID)
 	return err
 }
 
+const accessLogColumns = `id, port, ip, user_agent, timestamp, authenticated, identity, path, status, referrer, bytes, share_mode, share_id`
+
 func (s *Store) GetAccessLogs(port int, limit int) ([]AccessLog, error) {
 	if limit <= 0 {
 		limit = 100
 	}
-	rows, err := s.db.Query(`SELECT id, port, ip, user_agent, timestamp, authenticated FROM access_logs WHERE port = ? ORDER BY timestamp DESC LIMIT ?`, port, limit)
+	rows, err := s.db.Query(`SELECT `+accessLogColumns+` FROM access_logs WHERE port = ? ORDER BY timestamp DESC LIMIT ?`, port, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-
-	var logs []AccessLog
-	for rows.Next() {
-		var log AccessLog
-		if err := rows.Scan(&log.ID, &log.Port, &log.IP, &log.UserAgent, &log.Timestamp, &log.Authenticated); err != nil {
-			return nil, err
-		}
-		logs = append(logs, log)
-	}
-	return logs, nil
+	return scanAccessLogs(rows)
 }
 
 func (s *Store) GetAllAccessLogs(limit int) ([]AccessLog, error) {
 	if limit <= 0 {
 		limit = 100
 	}
-	rows, err := s.db.Query(`SELECT id, port, ip, user_agent, timestamp, authenticated FROM access_logs ORDER BY timestamp DESC LIMIT ?`, limit)
+	rows, err := s.db.Query(`SELECT `+accessLogColumns+` FROM access_logs ORDER BY timestamp DESC LIMIT ?`, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanAccessLogs(rows)
+}
 
+func scanAccessLogs(rows *sql.Rows) ([]AccessLog, error) {
 	var logs []AccessLog
 	for rows.Next() {
 		var log AccessLog
-		if err := rows.Scan(&log.ID, &log.Port, &log.IP, &log.UserAgent, &log.Timestamp, &log.Authenticated); err != nil {
+		var identity, path, referrer, shareMode, shareID sql.NullString
+		var status, bytes sql.NullInt64
+		if err := rows.Scan(&log.ID, &log.Port, &log.IP, &log.UserAgent, &log.Timestamp, &log.Authenticated,
+			&identity, &path, &status, &referrer, &bytes, &shareMode, &shareID); err != nil {
 			return nil, err
 		}
+		log.Identity = identity.String
+		log.Path = path.String
+		log.Status = int(status.Int64)
+		log.Referrer = referrer.String
+		log.Bytes = bytes.Int64
+		log.ShareMode = shareMode.String
+		log.ShareID = shareID.String
 		logs = append(logs, log)
 	}
 	return logs, nil
@@ -395,6 +725,11 @@ func (s *Store) UpdateTerminalSessionTitle(id string, title string) error {
 	return err
 }
 
+func (s *Store) UpdateTerminalSessionPID(id string, pid int) error {
+	_, err := s.db.Exec(`UPDATE terminal_sessions SET pid = ? WHERE id = ?`, pid, id)
+	return err
+}
+
 func (s *Store) UpdateTerminalSessionLastUsed(id string) error {
 	_, err := s.db.Exec(`UPDATE terminal_sessions SET last_used = ? WHERE id = ?`, time.Now(), id)
 	return err
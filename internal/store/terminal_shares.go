@@ -0,0 +1,55 @@
+package store
+
+// SaveTerminalShare records a new terminal share link
+func (s *Store) SaveTerminalShare(ts *TerminalShare) error {
+	_, err := s.db.Exec(`
+		INSERT INTO terminal_shares (id, session_id, mode, expires_at) VALUES (?, ?, ?, ?)
+	`, ts.ID, ts.SessionID, ts.Mode, ts.ExpiresAt)
+	return err
+}
+
+// GetTerminalShare returns a single terminal share link
+func (s *Store) GetTerminalShare(id string) (*TerminalShare, error) {
+	var ts TerminalShare
+	err := s.db.QueryRow(`
+		SELECT id, session_id, mode, expires_at, created_at FROM terminal_shares WHERE id = ?
+	`, id).Scan(&ts.ID, &ts.SessionID, &ts.Mode, &ts.ExpiresAt, &ts.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+// ListTerminalShares returns a session's share links, oldest first
+func (s *Store) ListTerminalShares(sessionID string) ([]TerminalShare, error) {
+	rows, err := s.db.Query(`
+		SELECT id, session_id, mode, expires_at, created_at FROM terminal_shares
+		WHERE session_id = ? ORDER BY created_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []TerminalShare
+	for rows.Next() {
+		var ts TerminalShare
+		if err := rows.Scan(&ts.ID, &ts.SessionID, &ts.Mode, &ts.ExpiresAt, &ts.CreatedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, ts)
+	}
+	return shares, rows.Err()
+}
+
+// DeleteTerminalShare revokes a terminal share link
+func (s *Store) DeleteTerminalShare(id string) error {
+	_, err := s.db.Exec(`DELETE FROM terminal_shares WHERE id = ?`, id)
+	return err
+}
+
+// DeleteTerminalShares revokes all share links of a session
+func (s *Store) DeleteTerminalShares(sessionID string) error {
+	_, err := s.db.Exec(`DELETE FROM terminal_shares WHERE session_id = ?`, sessionID)
+	return err
+}
@@ -0,0 +1,329 @@
+package terminal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// HolderCommand is the homeportd subcommand that runs a session holder
+const HolderCommand = "term-holder"
+
+// A session holder is a small detached process that owns one shell's PTY,
+// so the shell outlives homeportd. homeportd talks to it over a Unix socket
+// with length-prefixed frames: a type byte, a big-endian uint32 length and
+// the payload. The holder runs the output through its own Screen, sends a
+// snapshot of it on attach and checkpoints the snapshot to disk so a session
+// can be restored even if the holder itself is gone (container restart,
+// reboot).
+const (
+	// holder -> homeportd
+	frameHello    = 'H' // JSON holderHello, sent first on attach
+	frameSnapshot = 'S' // Screen snapshot, sent after the hello
+	frameOutput   = 'O' // live PTY output
+	frameExit     = 'X' // the shell exited; payload is the exit code
+
+	// homeportd -> holder
+	frameInput  = 'I' // bytes for the PTY
+	frameResize = 'R' // cols and rows as big-endian uint16s
+	frameKill   = 'K' // end the session
+
+	holderProtocol = 1
+	maxFrameSize   = 8 << 20
+
+	// checkpointInterval is how often a changed screen is saved to disk
+	checkpointInterval = 2 * time.Second
+)
+
+type holderHello struct {
+	Protocol int `json:"protocol"`
+	PID      int `json:"pid"`
+	Cols     int `json:"cols"`
+	Rows     int `json:"rows"`
+}
+
+// restoredNotice is shown under the saved screen of a restored session
+const restoredNotice = "\r\n\x1b[2m[homeport: session restored, the previous shell has ended]\x1b[0m\r\n"
+
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	buf := make([]byte, 5+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(payload)))
+	copy(buf[5:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// holder serves one PTY to at most one homeportd at a time
+type holder struct {
+	ptmx       *os.File
+	cmd        *exec.Cmd
+	socket     string
+	checkpoint string
+
+	mu      sync.Mutex
+	client  net.Conn
+	screen  *Screen
+	dirty   bool
+	stopped bool // stopped from outside, so the session should be restored
+	exited  bool
+}
+
+// RunHolder is the entry point of the holder process:
+//
+//	homeportd term-holder -socket <path> -checkpoint <path> [-restore] -- <shell>
+//
+// The shell starts in the current directory with the current environment.
+// RunHolder returns when the shell exits.
+func RunHolder(args []string) error {
+	fs := flag.NewFlagSet(HolderCommand, flag.ContinueOnError)
+	socket := fs.String("socket", "", "Unix socket to serve the session on")
+	checkpoint := fs.String("checkpoint", "", "File to save the screen to")
+	restore := fs.Bool("restore", false, "Start with the screen saved in the checkpoint")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *socket == "" || *checkpoint == "" || fs.NArg() == 0 {
+		return errors.New("usage: homeportd term-holder -socket <path> -checkpoint <path> [-restore] -- <shell> [args...]")
+	}
+
+	h := &holder{socket: *socket, checkpoint: *checkpoint, screen: NewScreen(120, 40)}
+	if *restore {
+		if saved, err := os.ReadFile(h.checkpoint); err == nil && len(saved) > 0 {
+			h.screen.Write(saved)
+			h.screen.Release()
+			h.screen.Write([]byte(restoredNotice))
+		}
+	}
+
+	// A socket left behind by a holder that was killed would block Listen
+	os.Remove(h.socket)
+	ln, err := net.Listen("unix", h.socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(h.socket)
+	os.Chmod(h.socket, 0600)
+
+	h.cmd = exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	h.ptmx, err = pty.StartWithSize(h.cmd, &pty.Winsize{Rows: 40, Cols: 120})
+	if err != nil {
+		ln.Close()
+		return fmt.Errorf("failed to start PTY: %w", err)
+	}
+
+	// Being stopped from outside (service stop, shutdown) ends the shell
+	// but keeps the checkpoint, so homeportd restores the session
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		h.mu.Lock()
+		h.stopped = true
+		h.mu.Unlock()
+		h.kill()
+	}()
+
+	go h.acceptLoop(ln)
+	go h.checkpointLoop()
+
+	output := make(chan struct{})
+	go func() {
+		h.readLoop()
+		close(output)
+	}()
+
+	err = h.cmd.Wait()
+	// Background jobs can keep the PTY open; don't wait on them for long
+	select {
+	case <-output:
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.exited = true
+	ln.Close()
+	h.ptmx.Close()
+
+	if h.stopped {
+		h.saveCheckpoint(h.screen.Snapshot())
+		return nil
+	}
+	if h.client != nil {
+		writeFrame(h.client, frameExit, []byte(fmt.Sprint(code)))
+		h.client.Close()
+	}
+	// The session is over, nothing left to restore
+	os.Remove(h.checkpoint)
+	return nil
+}
+
+// readLoop feeds PTY output to the screen and the client
+func (h *holder) readLoop() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := h.ptmx.Read(buf)
+		if n > 0 {
+			h.mu.Lock()
+			h.screen.Write(buf[:n])
+			h.dirty = true
+			if h.client != nil {
+				// A stuck homeportd mustn't stall the shell forever
+				h.client.SetWriteDeadline(time.Now().Add(5 * time.Second))
+				if err := writeFrame(h.client, frameOutput, buf[:n]); err != nil {
+					h.client.Close()
+					h.client = nil
+				}
+			}
+			h.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// acceptLoop takes homeportd connections. A new connection replaces the
+// previous one, which belongs to a homeportd that has gone away.
+func (h *holder) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		h.mu.Lock()
+		if h.client != nil {
+			h.client.Close()
+		}
+		cols, rows := h.screen.Size()
+		hello, _ := json.Marshal(holderHello{
+			Protocol: holderProtocol,
+			PID:      h.cmd.Process.Pid,
+			Cols:     cols,
+			Rows:     rows,
+		})
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if writeFrame(conn, frameHello, hello) != nil || writeFrame(conn, frameSnapshot, h.screen.Snapshot()) != nil {
+			conn.Close()
+			h.mu.Unlock()
+			continue
+		}
+		h.client = conn
+		h.mu.Unlock()
+
+		go h.serve(conn)
+	}
+}
+
+// serve handles input from one client until it disconnects
+func (h *holder) serve(conn net.Conn) {
+	defer func() {
+		h.mu.Lock()
+		if h.client == conn {
+			h.client = nil
+		}
+		h.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		typ, payload, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case frameInput:
+			h.ptmx.Write(payload)
+		case frameResize:
+			if len(payload) == 4 {
+				cols, rows := binary.BigEndian.Uint16(payload[0:]), binary.BigEndian.Uint16(payload[2:])
+				h.mu.Lock()
+				h.screen.Resize(int(cols), int(rows))
+				h.mu.Unlock()
+				pty.Setsize(h.ptmx, &pty.Winsize{Cols: cols, Rows: rows})
+			}
+		case frameKill:
+			h.kill()
+			return
+		}
+	}
+}
+
+// kill hangs up the shell's process group, then kills the shell if it
+// ignores that
+func (h *holder) kill() {
+	pid := h.cmd.Process.Pid
+	syscall.Kill(-pid, syscall.SIGHUP)
+	time.AfterFunc(time.Second, func() {
+		h.cmd.Process.Kill()
+	})
+}
+
+// checkpointLoop saves the screen whenever it has changed
+func (h *holder) checkpointLoop() {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.mu.Lock()
+		if !h.dirty || h.exited {
+			h.mu.Unlock()
+			continue
+		}
+		data := h.screen.Snapshot()
+		h.dirty = false
+		h.mu.Unlock()
+
+		h.saveCheckpoint(data)
+	}
+}
+
+// saveCheckpoint replaces the checkpoint file atomically
+func (h *holder) saveCheckpoint(data []byte) {
+	tmp := h.checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err == nil {
+		os.Rename(tmp, h.checkpoint)
+	}
+}
+
+// holderPaths returns the socket and checkpoint file of a session
+func holderPaths(dir, id string) (socket, checkpoint string) {
+	return filepath.Join(dir, id+".sock"), filepath.Join(dir, id+".scrollback")
+}
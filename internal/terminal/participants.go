@@ -0,0 +1,128 @@
+package terminal
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Participant roles
+const (
+	RoleOwner  = "owner"  // signed in to homeport
+	RoleDriver = "driver" // guest on a co-drive link
+	RoleViewer = "viewer" // guest on a view-only link
+)
+
+// Participant is a client connected to a session
+type Participant struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Role     string    `json:"role"`
+	ShareID  string    `json:"share_id,omitempty"` // link a guest came in through
+	JoinedAt time.Time `json:"joined_at"`
+
+	kicked chan struct{}
+}
+
+// Kicked is closed when the participant's link is revoked
+func (p *Participant) Kicked() <-chan struct{} {
+	return p.kicked
+}
+
+// Join adds a participant to the session and tells everyone who's there
+func (s *Session) Join(name, role, shareID string) *Participant {
+	p := &Participant{
+		ID:       uuid.New().String(),
+		Name:     name,
+		Role:     role,
+		ShareID:  shareID,
+		JoinedAt: time.Now(),
+		kicked:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.participants = append(s.participants, p)
+	s.mu.Unlock()
+
+	s.emitParticipants()
+	return p
+}
+
+// Leave removes a participant from the session
+func (s *Session) Leave(p *Participant) {
+	s.mu.Lock()
+	for i, other := range s.participants {
+		if other == p {
+			s.participants = append(s.participants[:i], s.participants[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	s.emitParticipants()
+}
+
+// Participants returns who is connected, in the order they joined
+func (s *Session) Participants() []Participant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Participant, 0, len(s.participants))
+	for _, p := range s.participants {
+		list = append(list, *p)
+	}
+	return list
+}
+
+// Kick disconnects the guests that came in through a share link
+func (s *Session) Kick(shareID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.participants {
+		if p.ShareID == shareID {
+			select {
+			case <-p.kicked:
+			default:
+				close(p.kicked)
+			}
+		}
+	}
+}
+
+// CanType reports whether a participant's input goes to the shell. Drivers
+// can type unless the owner has taken control.
+func (s *Session) CanType(p *Participant) bool {
+	switch p.Role {
+	case RoleOwner:
+		return true
+	case RoleDriver:
+		return !s.OwnerControl()
+	}
+	return false
+}
+
+// OwnerControl reports whether the owner has taken control from drivers
+func (s *Session) OwnerControl() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ownerControl
+}
+
+// SetOwnerControl takes control from drivers or hands it back, and tells
+// everyone with a "control" event ("owner" or "shared")
+func (s *Session) SetOwnerControl(on bool) {
+	s.mu.Lock()
+	s.ownerControl = on
+	s.mu.Unlock()
+
+	control := "shared"
+	if on {
+		control = "owner"
+	}
+	s.emitEvent(TerminalEvent{Type: "control", Data: control})
+}
+
+// emitParticipants sends the participant list as a "participants" event
+func (s *Session) emitParticipants() {
+	data, _ := json.Marshal(s.Participants())
+	s.emitEvent(TerminalEvent{Type: "participants", Data: string(data)})
+}
@@ -2,13 +2,30 @@ package terminal
 
 import (
 	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-// MinCommandDuration is the minimum duration for a command to trigger a completion event.
-// Quick commands like 'ls', 'cd' won't trigger notifications.
+// MinCommandDuration is the minimum duration for a command to trigger a completion event
+// when it is detected from the prompt. Quick commands like 'ls', 'cd' won't trigger
+// notifications.
 const MinCommandDuration = 3 * time.Second
 
+const (
+	// maxMarks bounds the shell integration marks a Screen holds between TakeMarks calls
+	maxMarks = 64
+
+	// Output kept with a command: its first and last lines, each cut to
+	// maxExcerptLine characters
+	excerptHead    = 10
+	excerptTail    = 40
+	maxExcerptLine = 500
+)
+
 // Common shell prompt patterns (at end of line or data)
 var promptPatterns = [][]byte{
 	[]byte("$ "),  // bash default
@@ -19,17 +36,37 @@ var promptPatterns = [][]byte{
 	[]byte("➜ "), // oh-my-zsh
 }
 
-// CommandCompletion represents a completed command
-type CommandCompletion struct {
-	Duration time.Duration
+// ShellMark is a shell integration mark in terminal output: OSC 133 A (prompt
+// starts), B (command line starts), C (command runs) and D (command done), or
+// OSC 7 (working directory)
+type ShellMark struct {
+	Code   string // "A", "B", "C", "D" or "7"
+	Params string // exit code for D, options for C, file URL for 7
+	Text   string // command line as shown on the screen for C, output excerpt for D
+}
+
+// CommandEvent is the data of command_start and command_complete events.
+// Without shell integration only the duration of a completed command is known.
+type CommandEvent struct {
+	Command   string    `json:"command,omitempty"`
+	Cwd       string    `json:"cwd,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Duration  float64   `json:"duration"` // seconds, 0 on command_start
+	Output    string    `json:"-"`        // excerpt, on command_complete
 }
 
 // CommandTracker tracks command execution state for a terminal session.
-// It detects when commands complete by watching for shell prompts.
+// With shell integration it follows the marks the shell prints; otherwise it
+// guesses when commands complete by watching for shell prompts.
 type CommandTracker struct {
 	lastPromptTime time.Time
 	commandRunning bool
 	commandStart   time.Time
+
+	integrated bool // the shell marks commands, the prompt heuristic is off
+	command    string
+	cwd        string
 }
 
 // NewCommandTracker creates a new CommandTracker
@@ -39,9 +76,93 @@ func NewCommandTracker() *CommandTracker {
 	}
 }
 
-// ProcessOutput analyzes terminal output and returns a CommandCompletion
-// if a command appears to have finished.
-func (t *CommandTracker) ProcessOutput(data []byte) *CommandCompletion {
+// ProcessMark follows a shell integration mark. It returns the event type
+// and data when a command starts or completes.
+func (t *CommandTracker) ProcessMark(mark ShellMark) (string, *CommandEvent) {
+	switch mark.Code {
+	case "7":
+		if cwd := fileURLPath(mark.Params); cwd != "" {
+			t.cwd = cwd
+		}
+	case "C":
+		// Shells that can't mark commands starting (bash before 4.4) still
+		// mark prompts; the prompt heuristic stays on for them
+		t.integrated = true
+		t.command = mark.Text
+		if cmdline := markOption(mark.Params, "cmdline_url"); cmdline != "" {
+			if unescaped, err := url.PathUnescape(cmdline); err == nil {
+				t.command = unescaped
+			}
+		}
+		t.commandRunning = true
+		t.commandStart = time.Now()
+		return "command_start", &CommandEvent{Command: t.command, Cwd: t.cwd, StartedAt: t.commandStart}
+	case "D":
+		// D also comes before the first prompt and after an empty command line
+		if !t.commandRunning {
+			return "", nil
+		}
+		t.commandRunning = false
+		ev := &CommandEvent{
+			Command:   t.command,
+			Cwd:       t.cwd,
+			StartedAt: t.commandStart,
+			Duration:  time.Since(t.commandStart).Seconds(),
+			Output:    mark.Text,
+		}
+		code, _, _ := strings.Cut(mark.Params, ";")
+		if exit, err := strconv.Atoi(code); err == nil {
+			ev.ExitCode = &exit
+		}
+		return "command_complete", ev
+	}
+	return "", nil
+}
+
+// excerpt bounds a command's output to its first and last lines
+func excerpt(lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > excerptHead+excerptTail {
+		omitted := fmt.Sprintf("[... %d lines ...]", len(lines)-excerptHead-excerptTail)
+		lines = append(append(lines[:excerptHead:excerptHead], omitted), lines[len(lines)-excerptTail:]...)
+	}
+	for i, l := range lines {
+		if utf8.RuneCountInString(l) > maxExcerptLine {
+			lines[i] = string([]rune(l)[:maxExcerptLine]) + "..."
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markOption returns the value of a key=value option of a mark
+func markOption(params, key string) string {
+	for _, option := range strings.Split(params, ";") {
+		if k, v, ok := strings.Cut(option, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// fileURLPath returns the path of an OSC 7 file://host/path URL
+func fileURLPath(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return u.Path
+}
+
+// ProcessOutput analyzes terminal output and returns a CommandEvent if a
+// command appears to have finished. It does nothing once the shell is known
+// to mark commands.
+func (t *CommandTracker) ProcessOutput(data []byte) *CommandEvent {
+	if t.integrated {
+		return nil
+	}
+
 	// Check if output contains a prompt pattern
 	hasPrompt := false
 	for _, pattern := range promptPatterns {
@@ -52,13 +173,13 @@ func (t *CommandTracker) ProcessOutput(data []byte) *CommandCompletion {
 	}
 
 	if hasPrompt {
-		var completion *CommandCompletion
+		var completion *CommandEvent
 
 		// If a command was running, it just finished
 		if t.commandRunning {
 			duration := time.Since(t.commandStart)
 			if duration >= MinCommandDuration {
-				completion = &CommandCompletion{Duration: duration}
+				completion = &CommandEvent{StartedAt: t.commandStart, Duration: duration.Seconds()}
 			}
 			t.commandRunning = false
 		}
@@ -0,0 +1,388 @@
+package terminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gethomeport/homeport/internal/config"
+	"github.com/gethomeport/homeport/internal/store"
+	"github.com/google/uuid"
+)
+
+// MaxRecordingSize caps a recording file. Output past it is not recorded.
+const MaxRecordingSize = 100 << 20
+
+// ErrRecording is returned when a session is already being recorded
+var ErrRecording = errors.New("session is already being recorded")
+
+// CastHeader is the first line of an asciicast v2 file
+// (https://docs.asciinema.org/manual/asciicast/v2/)
+type CastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// CastEvent is one line after the header: seconds since the start, the
+// event code ("o" output, "r" resize) and its data
+type CastEvent struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// MarshalJSON encodes the event as asciicast's [time, code, data]
+func (e CastEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{float64(int64(e.Time*1e6)) / 1e6, e.Code, e.Data})
+}
+
+// UnmarshalJSON decodes a [time, code, data] array
+func (e *CastEvent) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("event has %d fields, want 3", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[1], &e.Code); err != nil {
+		return err
+	}
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// CastReader reads an asciicast v2 file
+type CastReader struct {
+	Header CastHeader
+	r      *bufio.Reader
+}
+
+// NewCastReader reads the header of an asciicast v2 file
+func NewCastReader(r io.Reader) (*CastReader, error) {
+	cr := &CastReader{r: bufio.NewReader(r)}
+	line, err := cr.r.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, err
+	}
+	if err := json.Unmarshal(line, &cr.Header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %w", err)
+	}
+	if cr.Header.Version != 2 {
+		return nil, fmt.Errorf("asciicast version %d is not supported", cr.Header.Version)
+	}
+	return cr, nil
+}
+
+// Next returns the next event, or io.EOF after the last one. A torn last
+// line, left by a recording that was cut off, also ends the file.
+func (cr *CastReader) Next() (CastEvent, error) {
+	for {
+		line, err := cr.r.ReadBytes('\n')
+		if len(line) > 1 {
+			var ev CastEvent
+			if jsonErr := json.Unmarshal(line, &ev); jsonErr != nil {
+				return CastEvent{}, io.EOF
+			}
+			return ev, nil
+		}
+		if err != nil {
+			return CastEvent{}, err
+		}
+	}
+}
+
+// Recorder appends a session's output and resizes to an asciicast v2 file
+type Recorder struct {
+	ID      string
+	file    *os.File
+	start   time.Time
+	size    int64
+	pending []byte // incomplete UTF-8 sequence at the end of the last output
+	full    bool
+}
+
+// createRecorder starts a new recording file
+func createRecorder(path, id string, start time.Time, cols, rows int) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{ID: id, file: file, start: start}
+	header, _ := json.Marshal(CastHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: start.Unix(),
+		Env:       map[string]string{"TERM": "xterm-256color", "SHELL": os.Getenv("SHELL")},
+	})
+	if err := r.write(header); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return r, nil
+}
+
+// openRecorder continues a recording started by a previous homeportd
+func openRecorder(path, id string, start time.Time) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Recorder{ID: id, file: file, start: start, size: info.Size()}, nil
+}
+
+// Output records terminal output. asciicast wants whole UTF-8 strings, so a
+// sequence split across reads is held back until the rest arrives.
+func (r *Recorder) Output(data []byte) {
+	if len(r.pending) > 0 {
+		data = append(r.pending, data...)
+		r.pending = nil
+	}
+	if tail := incompleteRune(data); tail > 0 {
+		r.pending = append([]byte(nil), data[len(data)-tail:]...)
+		data = data[:len(data)-tail]
+	}
+	if len(data) > 0 {
+		r.event("o", string(data))
+	}
+}
+
+// Resize records a change of terminal size
+func (r *Recorder) Resize(cols, rows int) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Resync records the whole screen, after output may have been missed
+func (r *Recorder) Resync(cols, rows int, snapshot []byte) {
+	r.pending = nil
+	r.Resize(cols, rows)
+	r.Output(snapshot)
+}
+
+func (r *Recorder) event(code, data string) {
+	if r.full {
+		return
+	}
+	line, _ := json.Marshal(CastEvent{Time: time.Since(r.start).Seconds(), Code: code, Data: data})
+	if r.size+int64(len(line)) > MaxRecordingSize {
+		r.full = true
+		log.Printf("Terminal: recording %s reached %d MB, no longer recording", r.ID, MaxRecordingSize>>20)
+		return
+	}
+	if err := r.write(line); err != nil {
+		r.full = true
+		log.Printf("Terminal: recording %s failed: %v", r.ID, err)
+	}
+}
+
+func (r *Recorder) write(line []byte) error {
+	n, err := r.file.Write(append(line, '\n'))
+	r.size += int64(n)
+	return err
+}
+
+// Close ends the recording and returns the file's size
+func (r *Recorder) Close() int64 {
+	r.file.Close()
+	return r.size
+}
+
+// incompleteRune returns the length of a UTF-8 sequence cut off at the end
+// of data
+func incompleteRune(data []byte) int {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(data); i++ {
+		b := data[len(data)-i]
+		if b < 0x80 {
+			return 0
+		}
+		if utf8.RuneStart(b) {
+			if utf8.FullRune(data[len(data)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
+
+// RecordingPath returns the asciicast file of a recording
+func (m *Manager) RecordingPath(id string) string {
+	return filepath.Join(m.recordingsDir, id+".cast")
+}
+
+// StartRecording records a session from now on. The recording starts with
+// the current screen, so it plays back like the session looked.
+func (m *Manager) StartRecording(session *Session) (*store.TerminalRecording, error) {
+	if m.store == nil {
+		return nil, errors.New("recordings need the database")
+	}
+	if err := os.MkdirAll(m.recordingsDir, 0700); err != nil {
+		return nil, err
+	}
+
+	session.screenMu.Lock()
+	defer session.screenMu.Unlock()
+	if session.recorder != nil {
+		return nil, ErrRecording
+	}
+
+	cols, rows := session.screen.Size()
+	rec := &store.TerminalRecording{
+		ID:        uuid.New().String(),
+		SessionID: session.ID,
+		RepoID:    session.RepoID,
+		Cols:      cols,
+		Rows:      rows,
+		StartedAt: time.Now(),
+	}
+	recorder, err := createRecorder(m.RecordingPath(rec.ID), rec.ID, rec.StartedAt, cols, rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.SaveTerminalRecording(rec); err != nil {
+		recorder.Close()
+		os.Remove(m.RecordingPath(rec.ID))
+		return nil, err
+	}
+	recorder.Output(session.screen.Snapshot())
+	session.recorder = recorder
+	return rec, nil
+}
+
+// StopRecording ends the session's recording, if there is one
+func (m *Manager) StopRecording(session *Session) {
+	session.screenMu.Lock()
+	recorder := session.recorder
+	session.recorder = nil
+	session.screenMu.Unlock()
+
+	if recorder != nil {
+		size := recorder.Close()
+		if m.store != nil {
+			m.store.EndTerminalRecording(recorder.ID, time.Now(), size)
+		}
+	}
+}
+
+// DeleteRecording removes a recording, stopping it first if its session is
+// still being recorded
+func (m *Manager) DeleteRecording(id string) error {
+	if m.store == nil {
+		return errors.New("recordings need the database")
+	}
+	rec, err := m.store.GetTerminalRecording(id)
+	if err != nil {
+		return err
+	}
+	if session := m.GetSession(rec.SessionID); session != nil && session.RecordingID() == id {
+		m.StopRecording(session)
+	}
+	if err := m.store.DeleteTerminalRecording(id); err != nil {
+		return err
+	}
+	if err := os.Remove(m.RecordingPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// PruneRecordings deletes recordings that ended before cutoff and returns
+// how many were deleted
+func (m *Manager) PruneRecordings(cutoff time.Time) (int, error) {
+	if m.store == nil {
+		return 0, nil
+	}
+	recordings, err := m.store.ListTerminalRecordings("")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, rec := range recordings {
+		if rec.EndedAt == nil || !rec.EndedAt.Before(cutoff) {
+			continue
+		}
+		if err := m.DeleteRecording(rec.ID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// autoRecord starts recording a new session if its repo asks for it
+func (m *Manager) autoRecord(session *Session) {
+	cfg, err := config.LoadRepoConfig(session.RepoPath)
+	if err != nil || !cfg.RecordTerminals {
+		return
+	}
+	if _, err := m.StartRecording(session); err != nil {
+		log.Printf("Terminal: can't record session %s: %v", session.ID, err)
+	}
+}
+
+// resumeRecording picks up the recording a restored session had when
+// homeportd stopped. attach then records the screen to cover the gap.
+func (m *Manager) resumeRecording(session *Session, open map[string]store.TerminalRecording) {
+	rec, ok := open[session.ID]
+	if !ok {
+		return
+	}
+	recorder, err := openRecorder(m.RecordingPath(rec.ID), rec.ID, rec.StartedAt)
+	if err != nil {
+		log.Printf("Terminal: can't resume recording %s: %v", rec.ID, err)
+		return
+	}
+	delete(open, session.ID)
+	session.recorder = recorder
+}
+
+// openRecordings returns the recordings that were in progress when
+// homeportd stopped, by session
+func (m *Manager) openRecordings() map[string]store.TerminalRecording {
+	open := make(map[string]store.TerminalRecording)
+	if m.store == nil {
+		return open
+	}
+	recordings, err := m.store.ListTerminalRecordings("")
+	if err != nil {
+		log.Printf("Terminal: failed to list recordings: %v", err)
+		return open
+	}
+	for _, rec := range recordings {
+		if rec.EndedAt == nil {
+			open[rec.SessionID] = rec
+		}
+	}
+	return open
+}
+
+// endRecordings finishes recordings whose session is gone, as of the last
+// write to their file
+func (m *Manager) endRecordings(open map[string]store.TerminalRecording) {
+	for _, rec := range open {
+		endedAt, size := rec.StartedAt, int64(0)
+		if info, err := os.Stat(m.RecordingPath(rec.ID)); err == nil {
+			endedAt, size = info.ModTime(), info.Size()
+		}
+		m.store.EndTerminalRecording(rec.ID, endedAt, size)
+	}
+}
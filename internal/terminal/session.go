@@ -1,45 +1,31 @@
 package terminal
 
 import (
-	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/creack/pty"
 	"github.com/gethomeport/homeport/internal/store"
 	"github.com/google/uuid"
 )
 
-const (
-	// MaxScrollback is the maximum size of the scrollback buffer (100KB)
-	MaxScrollback = 100 * 1024
-)
-
-// Alternate screen escape sequences (smcup/rmcup)
-var (
-	altScreenEnter = [][]byte{
-		[]byte("\x1b[?1049h"), // Most common (xterm)
-		[]byte("\x1b[?47h"),   // Legacy
-		[]byte("\x1b[?1047h"), // Another variant
-	}
-	altScreenExit = [][]byte{
-		[]byte("\x1b[?1049l"),
-		[]byte("\x1b[?47l"),
-		[]byte("\x1b[?1047l"),
-	}
-)
-
 // TerminalEvent represents an event emitted by the terminal
 type TerminalEvent struct {
-	Type string `json:"type"` // "title", "command_complete"
+	Type string `json:"type"` // "title", "command_start", "command_complete", "participants", "control", "resize"
 	Data string `json:"data"`
 }
 
-// Session represents a terminal session with a PTY
+// Session is a terminal session. The PTY lives in a session holder process
+// (see holder.go) so the shell survives homeportd restarts.
 type Session struct {
 	ID        string    `json:"id"`
 	RepoID    string    `json:"repo_id"`
@@ -48,19 +34,22 @@ type Session struct {
 	CreatedAt time.Time `json:"created_at"`
 	LastUsed  time.Time `json:"last_used"`
 
-	ptmx    *os.File
-	cmd     *exec.Cmd
+	conn    net.Conn // to the session holder
+	writeMu sync.Mutex
+	pid     int
 	mu      sync.Mutex
 	closed  bool
 	clients int // number of connected WebSocket clients
 
-	// Scrollback buffer for replay on reconnect
-	scrollback   []byte
-	scrollbackMu sync.RWMutex
+	// Clients by who they are, for shared sessions
+	participants []*Participant
+	ownerControl bool // drivers can't type
 
-	// Track alternate screen mode (TUI apps use this)
-	// When in alternate screen, we don't save to scrollback
-	inAltScreen bool
+	// Emulated screen, sent to clients when they connect, and the recording
+	// in progress. Both are fed under screenMu.
+	screen   *Screen
+	recorder *Recorder
+	screenMu sync.Mutex
 
 	// Subscribers for live output broadcast
 	subscribers   []chan []byte
@@ -70,8 +59,10 @@ type Session struct {
 	eventSubs   []chan TerminalEvent
 	eventSubsMu sync.Mutex
 
-	// Command tracking for completion detection
-	cmdTracker *CommandTracker
+	// Command tracking for completion detection, and where completed
+	// commands go for the history
+	cmdTracker  *CommandTracker
+	commandDone func(*CommandEvent)
 }
 
 // Manager manages terminal sessions
@@ -79,19 +70,34 @@ type Manager struct {
 	sessions map[string]*Session
 	mu       sync.RWMutex
 	store    *store.Store
+	dir      string // holder sockets and scrollback checkpoints
+
+	recordingsDir string // asciicast files
+
+	shellIntegration bool // start bash and zsh with command marks (shell.go)
 }
 
-// NewManager creates a new terminal session manager
-func NewManager(s *store.Store) *Manager {
+// NewManager creates a new terminal session manager. Sessions left running
+// by a previous homeportd are picked up again from dir; recordings are
+// written to recordingsDir. With shellIntegration, new bash and zsh shells
+// report their commands (see shell.go).
+func NewManager(s *store.Store, dir, recordingsDir string, shellIntegration bool) *Manager {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
 	m := &Manager{
-		sessions: make(map[string]*Session),
-		store:    s,
+		sessions:      make(map[string]*Session),
+		store:         s,
+		dir:           dir,
+		recordingsDir: recordingsDir,
+
+		shellIntegration: shellIntegration,
 	}
 
-	// Mark any previously running sessions as exited (daemon restarted)
-	if s != nil {
-		s.MarkAllTerminalSessionsExited()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("Terminal: %v - sessions won't survive restarts", err)
 	}
+	m.restoreSessions()
 
 	// Start cleanup goroutine to remove idle sessions
 	go m.cleanupLoop()
@@ -99,11 +105,97 @@ func NewManager(s *store.Store) *Manager {
 	return m
 }
 
+// restoreSessions reattaches to the holders of sessions that were running
+// when homeportd stopped. Sessions whose holder is gone get a new shell
+// under their saved screen; without a checkpoint they are marked exited.
+func (m *Manager) restoreSessions() {
+	if m.store == nil {
+		return
+	}
+	saved, err := m.store.ListTerminalSessions()
+	if err != nil {
+		log.Printf("Terminal: failed to list sessions: %v", err)
+		return
+	}
+	open := m.openRecordings()
+
+	for _, row := range saved {
+		if row.Status != "running" {
+			continue
+		}
+		session := &Session{
+			ID:        row.ID,
+			RepoID:    row.RepoID,
+			RepoPath:  row.RepoPath,
+			Title:     row.Title,
+			CreatedAt: row.CreatedAt,
+			LastUsed:  row.LastUsed,
+		}
+		m.resumeRecording(session, open)
+
+		err := m.attach(session)
+		if err != nil {
+			_, checkpoint := holderPaths(m.dir, row.ID)
+			if _, statErr := os.Stat(checkpoint); statErr == nil {
+				err = m.spawn(session, true)
+			}
+		}
+		if err != nil {
+			log.Printf("Terminal: session %s can't be restored: %v", row.ID, err)
+			m.StopRecording(session)
+			m.forget(row.ID)
+			continue
+		}
+
+		m.store.UpdateTerminalSessionPID(session.ID, session.pid)
+		m.sessions[session.ID] = session
+		if session.recorder == nil {
+			m.autoRecord(session)
+		}
+		log.Printf("Terminal: restored session %s (pid %d)", session.ID, session.pid)
+	}
+	m.endRecordings(open)
+}
+
 // CreateSession creates a new terminal session for a repo
 func (m *Manager) CreateSession(repoID, repoPath string) (*Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	session := &Session{
+		ID:        uuid.New().String(),
+		RepoID:    repoID,
+		RepoPath:  repoPath,
+		CreatedAt: time.Now(),
+		LastUsed:  time.Now(),
+	}
+	if err := m.spawn(session, false); err != nil {
+		return nil, err
+	}
+
+	// Persist to database
+	if m.store != nil {
+		dbSess := &store.TerminalSession{
+			ID:        session.ID,
+			RepoID:    session.RepoID,
+			RepoPath:  session.RepoPath,
+			PID:       session.pid,
+			Status:    "running",
+			CreatedAt: session.CreatedAt,
+			LastUsed:  session.LastUsed,
+		}
+		m.store.SaveTerminalSession(dbSess)
+	}
+
+	m.sessions[session.ID] = session
+	m.autoRecord(session)
+
+	return session, nil
+}
+
+// spawn starts a session holder running the user's shell and attaches to it.
+// With restore, the holder starts from the session's saved screen.
+func (m *Manager) spawn(session *Session, restore bool) error {
 	// Determine shell
 	shell := os.Getenv("SHELL")
 	if shell == "" {
@@ -113,56 +205,169 @@ func (m *Manager) CreateSession(repoID, repoPath string) (*Session, error) {
 		}
 	}
 
-	// Start PTY
-	cmd := exec.Command(shell)
-	cmd.Dir = repoPath
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find homeportd: %w", err)
+	}
+	socket, checkpoint := holderPaths(m.dir, session.ID)
+	args := []string{HolderCommand, "-socket", socket, "-checkpoint", checkpoint}
+	if restore {
+		args = append(args, "-restore")
+	}
+	args = append(args, "--", shell)
+
+	var shellEnv []string
+	if m.shellIntegration {
+		shellArgs, env, err := shellIntegration(m.dir, shell)
+		if err != nil {
+			log.Printf("Terminal: no shell integration: %v", err)
+		}
+		args = append(args, shellArgs...)
+		shellEnv = env
+	}
+
+	cmd := exec.Command(self, args...)
+	cmd.Dir = session.RepoPath
 	cmd.Env = append(os.Environ(),
 		"TERM=xterm-256color",
 		"COLORTERM=truecolor",
 	)
+	cmd.Env = append(cmd.Env, shellEnv...)
+	// Its own session, so the holder outlives homeportd and isn't hit by
+	// signals sent to homeportd's process group
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start session holder: %w", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait() // reap the holder if it exits while we're running
+		close(exited)
+	}()
+
+	// Wait for the holder to listen
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		err = m.attach(session)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-exited:
+			return fmt.Errorf("session holder exited: %w", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			return fmt.Errorf("session holder didn't start: %w", err)
+		}
+	}
+}
 
-	ptmx, err := pty.Start(cmd)
+// attach connects to the session's holder, loads its screen and starts
+// relaying output
+func (m *Manager) attach(session *Session) error {
+	socket, _ := holderPaths(m.dir, session.ID)
+	conn, err := net.DialTimeout("unix", socket, time.Second)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start PTY: %w", err)
+		return err
 	}
 
-	// Set default size (larger default to accommodate TUI apps before resize)
-	pty.Setsize(ptmx, &pty.Winsize{Rows: 40, Cols: 120})
-
-	session := &Session{
-		ID:          uuid.New().String(),
-		RepoID:      repoID,
-		RepoPath:    repoPath,
-		CreatedAt:   time.Now(),
-		LastUsed:    time.Now(),
-		ptmx:        ptmx,
-		cmd:         cmd,
-		scrollback:  make([]byte, 0, MaxScrollback),
-		subscribers: make([]chan []byte, 0),
-		eventSubs:   make([]chan TerminalEvent, 0),
-		cmdTracker:  NewCommandTracker(),
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	typ, payload, err := readFrame(conn)
+	var hello holderHello
+	if err == nil && (typ != frameHello || json.Unmarshal(payload, &hello) != nil) {
+		err = fmt.Errorf("unexpected reply from session holder")
 	}
-
-	// Persist to database
-	if m.store != nil {
-		dbSess := &store.TerminalSession{
-			ID:        session.ID,
-			RepoID:    session.RepoID,
-			RepoPath:  session.RepoPath,
-			PID:       cmd.Process.Pid,
-			Status:    "running",
-			CreatedAt: session.CreatedAt,
-			LastUsed:  session.LastUsed,
+	if err == nil && hello.Protocol != holderProtocol {
+		err = fmt.Errorf("session holder speaks protocol %d, want %d", hello.Protocol, holderProtocol)
+	}
+	var snapshot []byte
+	if err == nil {
+		typ, snapshot, err = readFrame(conn)
+		if err == nil && typ != frameSnapshot {
+			err = fmt.Errorf("unexpected reply from session holder")
 		}
-		m.store.SaveTerminalSession(dbSess)
 	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	session.writeMu.Lock()
+	session.conn = conn
+	session.writeMu.Unlock()
+	session.mu.Lock()
+	session.pid = hello.PID
+	session.mu.Unlock()
+	screen := NewScreen(120, 40)
+	if hello.Cols > 0 && hello.Rows > 0 {
+		screen = NewScreen(hello.Cols, hello.Rows)
+	}
+	screen.Write(snapshot)
+	screen.TrackMarks()
+	session.screenMu.Lock()
+	session.screen = screen
+	if session.recorder != nil {
+		// Output since the holder was last attached wasn't recorded
+		session.recorder.Resync(screen.cols, screen.rows, snapshot)
+	}
+	session.screenMu.Unlock()
+	session.cmdTracker = NewCommandTracker()
+	session.commandDone = func(ev *CommandEvent) { m.saveCommand(session, ev) }
 
 	// Start background reader to capture output
-	go session.readLoop()
+	go func() {
+		if !session.readLoop(conn) && m.recover(session) {
+			return
+		}
+		session.mu.Lock()
+		session.closed = true
+		session.mu.Unlock()
+		m.StopRecording(session)
+	}()
+	return nil
+}
 
-	m.sessions[session.ID] = session
+// recover brings back a session whose holder went away without its shell
+// exiting, reattaching or restoring from the checkpoint
+func (m *Manager) recover(session *Session) bool {
+	// Give a homeportd that is shutting down time to go first
+	time.Sleep(time.Second)
+	if session.IsClosed() {
+		return false
+	}
 
-	return session, nil
+	err := m.attach(session)
+	if err != nil {
+		_, checkpoint := holderPaths(m.dir, session.ID)
+		if _, statErr := os.Stat(checkpoint); statErr == nil {
+			err = m.spawn(session, true)
+		}
+	}
+	if err != nil {
+		log.Printf("Terminal: lost session %s: %v", session.ID, err)
+		return false
+	}
+	if m.store != nil {
+		m.store.UpdateTerminalSessionPID(session.ID, session.GetPID())
+	}
+	log.Printf("Terminal: restored session %s (pid %d)", session.ID, session.GetPID())
+	return true
+}
+
+// forget cleans up after a session that has ended: its holder files, share
+// links and database status
+func (m *Manager) forget(id string) {
+	socket, checkpoint := holderPaths(m.dir, id)
+	os.Remove(socket)
+	os.Remove(checkpoint)
+
+	if m.store != nil {
+		m.store.UpdateTerminalSessionStatus(id, "exited")
+		m.store.DeleteTerminalShares(id)
+	}
 }
 
 // GetSession retrieves a session by ID
@@ -194,11 +399,7 @@ func (m *Manager) DeleteSession(id string) {
 	if session, ok := m.sessions[id]; ok {
 		session.Close()
 		delete(m.sessions, id)
-
-		// Update database
-		if m.store != nil {
-			m.store.UpdateTerminalSessionStatus(id, "exited")
-		}
+		m.forget(id)
 	}
 }
 
@@ -214,91 +415,73 @@ func (m *Manager) cleanupLoop() {
 			if session.clients == 0 && time.Since(session.LastUsed) > 30*time.Minute {
 				session.Close()
 				delete(m.sessions, id)
-				if m.store != nil {
-					m.store.UpdateTerminalSessionStatus(id, "exited")
-				}
+				m.forget(id)
 			}
 			// Remove closed sessions
-			if session.closed {
+			if session.IsClosed() {
 				delete(m.sessions, id)
-				if m.store != nil {
-					m.store.UpdateTerminalSessionStatus(id, "exited")
-				}
+				m.forget(id)
 			}
 		}
 		m.mu.Unlock()
 	}
 }
 
-// readLoop continuously reads from PTY and broadcasts to subscribers
-func (s *Session) readLoop() {
-	buf := make([]byte, 4096)
+// readLoop relays output from the session holder to subscribers. It
+// returns true when the shell exited and false when the holder went away.
+func (s *Session) readLoop(conn net.Conn) bool {
+	defer conn.Close()
+
 	for {
-		n, err := s.ptmx.Read(buf)
+		typ, data, err := readFrame(conn)
 		if err != nil {
-			return
+			return false
+		}
+		if typ == frameExit {
+			return true
+		}
+		if typ != frameOutput || len(data) == 0 {
+			continue
 		}
-		if n > 0 {
-			data := make([]byte, n)
-			copy(data, buf[:n])
-
-			// Check for alternate screen mode transitions
-			s.scrollbackMu.Lock()
-			for _, seq := range altScreenEnter {
-				if bytes.Contains(data, seq) {
-					s.inAltScreen = true
-					break
-				}
-			}
-			for _, seq := range altScreenExit {
-				if bytes.Contains(data, seq) {
-					s.inAltScreen = false
-					break
-				}
-			}
 
-			// Only add to scrollback when NOT in alternate screen mode
-			// TUI apps (like Claude Code) use alternate screen and shouldn't
-			// corrupt the scrollback buffer
-			if !s.inAltScreen {
-				s.scrollback = append(s.scrollback, data...)
-				// Trim if exceeds max size
-				if len(s.scrollback) > MaxScrollback {
-					s.scrollback = s.scrollback[len(s.scrollback)-MaxScrollback:]
-				}
-			}
-			s.scrollbackMu.Unlock()
+		// Output reaches subscribers under screenMu, so a snapshot taken by
+		// SubscribeWithSnapshot is followed by exactly what comes after it
+		s.screenMu.Lock()
+		s.screen.Write(data)
+		marks := s.screen.TakeMarks()
+		inAltScreen := s.screen.AltScreen()
+		if s.recorder != nil {
+			s.recorder.Output(data)
+		}
+		s.broadcast(data)
+		s.screenMu.Unlock()
 
-			// Extract OSC title sequences
-			if title, found := ExtractAllOSCTitles(data); found {
-				s.SetTitle(title)
-			}
+		// Extract OSC title sequences
+		if title, found := ExtractAllOSCTitles(data); found {
+			s.SetTitle(title)
+		}
 
-			// Check for command completion (only when not in alternate screen)
-			if !s.inAltScreen && s.cmdTracker != nil {
-				if completion := s.cmdTracker.ProcessOutput(data); completion != nil {
-					s.emitEvent(TerminalEvent{
-						Type: "command_complete",
-						Data: completion.Duration.String(),
-					})
+		// Follow commands through shell integration marks, or guess from
+		// prompts (only when not in alternate screen)
+		if s.cmdTracker != nil {
+			for _, mark := range marks {
+				if typ, ev := s.cmdTracker.ProcessMark(mark); ev != nil {
+					s.emitCommandEvent(typ, ev)
+					if typ == "command_complete" && s.commandDone != nil {
+						s.commandDone(ev)
+					}
 				}
 			}
-
-			// Broadcast to all subscribers
-			s.subscribersMu.Lock()
-			for _, ch := range s.subscribers {
-				select {
-				case ch <- data:
-				default:
-					// Skip slow subscribers
+			if !inAltScreen {
+				if completion := s.cmdTracker.ProcessOutput(data); completion != nil {
+					s.emitCommandEvent("command_complete", completion)
 				}
 			}
-			s.subscribersMu.Unlock()
-
-			s.mu.Lock()
-			s.LastUsed = time.Now()
-			s.mu.Unlock()
 		}
+
+		s.mu.Lock()
+		s.LastUsed = time.Now()
+		s.mu.Unlock()
 	}
 }
 
@@ -311,6 +494,28 @@ func (s *Session) Subscribe() chan []byte {
 	return ch
 }
 
+// SubscribeWithSnapshot returns output that redraws the session's current
+// screen, with its line history, on a freshly connected terminal, and a
+// channel that receives the output following it
+func (s *Session) SubscribeWithSnapshot() ([]byte, chan []byte) {
+	s.screenMu.Lock()
+	defer s.screenMu.Unlock()
+	return s.screen.Snapshot(), s.Subscribe()
+}
+
+// broadcast sends output to all subscribers
+func (s *Session) broadcast(data []byte) {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- data:
+		default:
+			// Skip slow subscribers
+		}
+	}
+}
+
 // Unsubscribe removes a subscriber channel
 func (s *Session) Unsubscribe(ch chan []byte) {
 	s.subscribersMu.Lock()
@@ -324,17 +529,8 @@ func (s *Session) Unsubscribe(ch chan []byte) {
 	}
 }
 
-// GetScrollback returns the current scrollback buffer
-func (s *Session) GetScrollback() []byte {
-	s.scrollbackMu.RLock()
-	defer s.scrollbackMu.RUnlock()
-	result := make([]byte, len(s.scrollback))
-	copy(result, s.scrollback)
-	return result
-}
-
-// Read reads from the PTY (deprecated - use Subscribe instead)
-func (s *Session) Read(p []byte) (int, error) {
+// Write writes to the PTY
+func (s *Session) Write(p []byte) (int, error) {
 	s.mu.Lock()
 	if s.closed {
 		s.mu.Unlock()
@@ -343,33 +539,54 @@ func (s *Session) Read(p []byte) (int, error) {
 	s.LastUsed = time.Now()
 	s.mu.Unlock()
 
-	return s.ptmx.Read(p)
+	// Large pastes go in several frames
+	written := 0
+	for written < len(p) {
+		n := min(len(p)-written, 32*1024)
+		if err := s.send(frameInput, p[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
 }
 
-// Write writes to the PTY
-func (s *Session) Write(p []byte) (int, error) {
+// Resize resizes the PTY
+func (s *Session) Resize(cols, rows uint16) error {
 	s.mu.Lock()
 	if s.closed {
 		s.mu.Unlock()
-		return 0, io.EOF
+		return fmt.Errorf("session closed")
 	}
 	s.LastUsed = time.Now()
 	s.mu.Unlock()
 
-	return s.ptmx.Write(p)
-}
-
-// Resize resizes the PTY
-func (s *Session) Resize(cols, rows uint16) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.screenMu.Lock()
+	c, r := s.screen.Size()
+	changed := c != int(cols) || r != int(rows)
+	if changed && s.recorder != nil {
+		s.recorder.Resize(int(cols), int(rows))
+	}
+	s.screen.Resize(int(cols), int(rows))
+	s.screenMu.Unlock()
 
-	if s.closed {
-		return fmt.Errorf("session closed")
+	// Guests follow the owner's terminal size
+	if changed {
+		s.emitEvent(TerminalEvent{Type: "resize", Data: fmt.Sprintf("%dx%d", cols, rows)})
 	}
 
-	s.LastUsed = time.Now()
-	return pty.Setsize(s.ptmx, &pty.Winsize{Rows: rows, Cols: cols})
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint16(size[0:], cols)
+	binary.BigEndian.PutUint16(size[2:], rows)
+	return s.send(frameResize, size)
+}
+
+// send writes a frame to the session holder
+func (s *Session) send(typ byte, payload []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return writeFrame(s.conn, typ, payload)
 }
 
 // AddClient increments the client count
@@ -400,11 +617,11 @@ func (s *Session) Close() {
 	}
 
 	s.closed = true
-	s.ptmx.Close()
-	if s.cmd.Process != nil {
-		s.cmd.Process.Kill()
-		s.cmd.Wait()
-	}
+	// The holder hangs up the shell and exits
+	s.send(frameKill, nil)
+	s.writeMu.Lock()
+	s.conn.Close()
+	s.writeMu.Unlock()
 }
 
 // IsClosed returns whether the session is closed
@@ -453,6 +670,33 @@ func (s *Session) UnsubscribeEvents(ch chan TerminalEvent) {
 	}
 }
 
+// saveCommand adds a command reported by shell integration to the history
+func (m *Manager) saveCommand(session *Session, ev *CommandEvent) {
+	if m.store == nil || ev.Command == "" {
+		return
+	}
+	err := m.store.AddTerminalCommand(&store.TerminalCommand{
+		SessionID: session.ID,
+		RepoID:    session.RepoID,
+		Command:   ev.Command,
+		Cwd:       ev.Cwd,
+		ExitCode:  ev.ExitCode,
+		StartedAt: ev.StartedAt,
+		Duration:  ev.Duration,
+		Output:    ev.Output,
+	})
+	if err != nil {
+		log.Printf("Terminal: failed to save command: %v", err)
+	}
+}
+
+// emitCommandEvent sends a command_start or command_complete event with the
+// command as JSON
+func (s *Session) emitCommandEvent(typ string, ev *CommandEvent) {
+	data, _ := json.Marshal(ev)
+	s.emitEvent(TerminalEvent{Type: typ, Data: string(data)})
+}
+
 // emitEvent broadcasts an event to all event subscribers
 func (s *Session) emitEvent(event TerminalEvent) {
 	s.eventSubsMu.Lock()
@@ -466,12 +710,26 @@ func (s *Session) emitEvent(event TerminalEvent) {
 	}
 }
 
+// Size returns the terminal's columns and rows
+func (s *Session) Size() (cols, rows int) {
+	s.screenMu.Lock()
+	defer s.screenMu.Unlock()
+	return s.screen.Size()
+}
+
+// RecordingID returns the ID of the recording in progress, or ""
+func (s *Session) RecordingID() string {
+	s.screenMu.Lock()
+	defer s.screenMu.Unlock()
+	if s.recorder == nil {
+		return ""
+	}
+	return s.recorder.ID
+}
+
 // GetPID returns the process ID of the shell
 func (s *Session) GetPID() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.cmd != nil && s.cmd.Process != nil {
-		return s.cmd.Process.Pid
-	}
-	return 0
+	return s.pid
 }
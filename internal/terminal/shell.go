@@ -0,0 +1,153 @@
+package terminal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+// Shell integration: bash and zsh are started with hooks that mark prompts
+// and commands with OSC 133 (A prompt, B command line, C command runs,
+// D;<exit> command done) and report the working directory with OSC 7, so
+// commands are tracked exactly rather than guessed from prompts. The user's
+// own startup files are read first, as the shell would read them. Other
+// shells start as they are.
+
+// bashIntegration is passed to bash with --rcfile, which replaces both the
+// system and the user's bashrc
+const bashIntegration = `# Homeport shell integration
+[ -f /etc/bash.bashrc ] && . /etc/bash.bashrc
+[ -f ~/.bashrc ] && . ~/.bashrc
+
+if [[ $- == *i* && -z $__homeport_integration ]]; then
+    __homeport_integration=1
+
+    # Sets REPLY to $1 escaped for a file URL
+    __homeport_urlencode() {
+        local LC_ALL=C s=$1 c i
+        REPLY=
+        for (( i = 0; i < ${#s}; i++ )); do
+            c=${s:i:1}
+            case $c in
+                [a-zA-Z0-9._~/-]) REPLY+=$c ;;
+                *) printf -v c '%%%02X' "'$c"; REPLY+=$c ;;
+            esac
+        done
+    }
+
+    __homeport_prompt_start() {
+        local ret=$?
+        __homeport_urlencode "$PWD"
+        printf '\e]133;D;%s\a\e]7;file://%s%s\a\e]133;A\a' "$ret" "$HOSTNAME" "$REPLY"
+        return $ret
+    }
+
+    # Prompt frameworks rebuild PS1 in PROMPT_COMMAND, so its end is marked
+    # after they run
+    __homeport_prompt_end() {
+        local ret=$?
+        [[ $PS1 == *'\e]133;B\a\]' ]] || PS1+='\[\e]133;B\a\]'
+        return $ret
+    }
+
+    if [[ $(declare -p PROMPT_COMMAND 2>/dev/null) == "declare -a"* ]]; then
+        PROMPT_COMMAND=(__homeport_prompt_start "${PROMPT_COMMAND[@]}" __homeport_prompt_end)
+    else
+        PROMPT_COMMAND=__homeport_prompt_start$'\n'${PROMPT_COMMAND}$'\n'__homeport_prompt_end
+    fi
+    PS0+='\e]133;C\a'
+fi
+`
+
+// zshEnv and zshRC are started from ZDOTDIR. .zshenv reads the user's, and
+// .zshrc hands ZDOTDIR back before reading the user's .zshrc.
+const zshEnv = `# Homeport shell integration
+__homeport_zdotdir=$ZDOTDIR
+ZDOTDIR=${HOMEPORT_ZDOTDIR:-$HOME}
+[[ -f $ZDOTDIR/.zshenv ]] && source $ZDOTDIR/.zshenv
+HOMEPORT_ZDOTDIR=$ZDOTDIR
+ZDOTDIR=$__homeport_zdotdir
+`
+
+const zshRC = `# Homeport shell integration
+ZDOTDIR=$HOMEPORT_ZDOTDIR
+unset HOMEPORT_ZDOTDIR __homeport_zdotdir
+[[ -f $ZDOTDIR/.zshrc ]] && source $ZDOTDIR/.zshrc
+
+if [[ -o interactive && -z $__homeport_integration ]]; then
+    __homeport_integration=1
+
+    # Sets REPLY to $1 escaped for a URL
+    __homeport_urlencode() {
+        emulate -L zsh -o extendedglob +o multibyte
+        REPLY=${1//(#b)([^A-Za-z0-9._~\/-])/%${(l:2::0:)$(( [##16] #match ))}}
+    }
+
+    __homeport_precmd() {
+        local ret=$?
+        __homeport_urlencode $PWD
+        print -rn -- $'\e]133;D;'$ret$'\a\e]7;file://'$HOST$REPLY$'\a\e]133;A\a'
+        return ret
+    }
+
+    # Prompt themes rebuild PS1 in precmd, so its end is marked after they run
+    __homeport_prompt_end() {
+        local ret=$?
+        [[ $PS1 == *$'\e]133;B\a'* ]] || PS1+=$'%{\e]133;B\a%}'
+        return ret
+    }
+
+    __homeport_preexec() {
+        __homeport_urlencode $1
+        print -rn -- $'\e]133;C;cmdline_url='$REPLY$'\a'
+    }
+
+    precmd_functions=(__homeport_precmd $precmd_functions __homeport_prompt_end)
+    preexec_functions+=(__homeport_preexec)
+fi
+`
+
+// shellIntegration returns the arguments and environment that start shell
+// with shell integration, writing its startup files under dir. It returns
+// nothing for shells it doesn't know.
+func shellIntegration(dir, shell string) (args, env []string, err error) {
+	dir = filepath.Join(dir, "shell")
+	switch filepath.Base(shell) {
+	case "bash":
+		rcfile := filepath.Join(dir, "bash", "homeport.bash")
+		if err := writeIfChanged(rcfile, bashIntegration); err != nil {
+			return nil, nil, err
+		}
+		return []string{"--rcfile", rcfile}, nil, nil
+	case "zsh":
+		zdotdir := filepath.Join(dir, "zsh")
+		if err := writeIfChanged(filepath.Join(zdotdir, ".zshenv"), zshEnv); err != nil {
+			return nil, nil, err
+		}
+		if err := writeIfChanged(filepath.Join(zdotdir, ".zshrc"), zshRC); err != nil {
+			return nil, nil, err
+		}
+		userDir := os.Getenv("ZDOTDIR")
+		if userDir == "" {
+			userDir = os.Getenv("HOME")
+		}
+		return nil, []string{"ZDOTDIR=" + zdotdir, "HOMEPORT_ZDOTDIR=" + userDir}, nil
+	}
+	return nil, nil, nil
+}
+
+// writeIfChanged writes a file unless it already has the content, so shells
+// starting up never read it half written
+func writeIfChanged(path, content string) error {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, []byte(content)) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
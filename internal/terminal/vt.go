@@ -0,0 +1,1407 @@
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// MaxHistoryLines is how many lines scrolled off the top of the screen are
+// kept for reattaching clients
+const MaxHistoryLines = 2000
+
+// Screen is a headless VT100/xterm emulator. It keeps what a terminal would
+// show - the screen grid, cursor, modes and the alternate screen - plus a
+// bounded history of lines scrolled off the top, so a reattaching client
+// can be sent the current state rather than a replay of raw output, which
+// garbles TUIs. Screen is not safe for concurrent use.
+type Screen struct {
+	cols, rows int
+	main, alt  []line
+	altActive  bool
+	history    []line
+
+	cur   cursor
+	saved [2]savedCursor // DECSC per buffer: main, alt
+
+	top, bottom int // scroll region, inclusive
+	tabs        []bool
+
+	appCursor   bool // DECCKM
+	appKeypad   bool // DECKPAM
+	autowrap    bool // DECAWM
+	origin      bool // DECOM
+	insert      bool // IRM
+	hideCursor  bool // DECTCEM off
+	cursorStyle int  // DECSCUSR
+	modes       map[int]bool
+	charsets    [2]bool // G0, G1 designated as DEC line drawing
+	shifted     bool    // SO: G1 in use
+	title       string
+	lastRune    rune
+
+	// Shell integration marks, collected for TakeMarks once TrackMarks is
+	// called. scrolled counts lines that went to history, so positions of
+	// the command line and its output survive scrolling.
+	trackMarks bool
+	marks      []ShellMark
+	input      [2]int // line (counted with scrolled) and column of OSC 133;B
+	output     [2]int // same for OSC 133;C
+	running    bool   // output is set
+	scrolled   int
+
+	// Parser
+	state   int
+	params  []byte
+	inter   []byte
+	osc     []byte
+	pending []byte // incomplete UTF-8 sequence
+}
+
+type line struct {
+	cells   []cell
+	wrapped bool // continues on the next line
+}
+
+// cell holds one character. The right half of a wide character has r == 0.
+type cell struct {
+	r    rune
+	attr attr
+}
+
+type attr struct {
+	fg, bg color
+	flags  uint16
+}
+
+// color is 0 for the default, 1<<24|n for palette color n or 2<<24|rgb
+type color uint32
+
+const (
+	colorIndexed color = 1 << 24
+	colorRGB     color = 2 << 24
+)
+
+const (
+	attrBold uint16 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrInverse
+	attrHidden
+	attrStrike
+)
+
+type cursor struct {
+	row, col int
+	pen      attr
+	wrapNext bool // the last column was written; the next character wraps
+}
+
+type savedCursor struct {
+	cursor
+	set      bool
+	origin   bool
+	charsets [2]bool
+	shifted  bool
+}
+
+// Modes that only affect how the terminal reports input. They are tracked
+// so a snapshot turns them back on.
+var passthroughModes = []int{
+	1000, 1002, 1003, 1005, 1006, 1015, // mouse reporting
+	1004, // focus events
+	2004, // bracketed paste
+}
+
+// DEC special graphics, used by TUIs to draw boxes
+var lineDrawing = map[rune]rune{
+	'`': '◆', 'a': '▒', 'b': '␉', 'c': '␌', 'd': '␍', 'e': '␊', 'f': '°', 'g': '±',
+	'h': '␤', 'i': '␋', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└', 'n': '┼', 'o': '⎺',
+	'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤', 'v': '┴', 'w': '┬',
+	'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£', '~': '·',
+}
+
+const (
+	stateGround = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateOSC
+	stateOSCEscape
+	stateString // DCS, SOS, PM, APC: ignored
+	stateStringEscape
+)
+
+// NewScreen creates an empty screen
+func NewScreen(cols, rows int) *Screen {
+	s := &Screen{}
+	s.cols, s.rows = max(cols, 1), max(rows, 1)
+	s.reset()
+	return s
+}
+
+// Size returns the screen's columns and rows
+func (s *Screen) Size() (cols, rows int) {
+	return s.cols, s.rows
+}
+
+// AltScreen reports whether the alternate screen is in use
+func (s *Screen) AltScreen() bool {
+	return s.altActive
+}
+
+// reset is a full reset (RIS). History is kept.
+func (s *Screen) reset() {
+	s.main = blankLines(s.rows, s.cols, attr{})
+	s.alt = blankLines(s.rows, s.cols, attr{})
+	s.altActive = false
+	s.cur = cursor{}
+	s.saved = [2]savedCursor{}
+	s.top, s.bottom = 0, s.rows-1
+	s.resetTabs()
+	s.appCursor, s.appKeypad, s.origin, s.insert, s.hideCursor = false, false, false, false, false
+	s.autowrap = true
+	s.cursorStyle = 0
+	s.modes = make(map[int]bool)
+	s.charsets = [2]bool{}
+	s.shifted = false
+	s.title = ""
+	s.state = stateGround
+}
+
+// softReset is DECSTR
+func (s *Screen) softReset() {
+	s.cur.pen = attr{}
+	s.cur.wrapNext = false
+	s.top, s.bottom = 0, s.rows-1
+	s.appCursor, s.appKeypad, s.origin, s.insert, s.hideCursor = false, false, false, false, false
+	s.autowrap = true
+	s.charsets = [2]bool{}
+	s.shifted = false
+	s.saved[s.buffer()] = savedCursor{}
+}
+
+// Release puts the screen in the state a new program expects after the
+// last one went away without cleaning up: main screen, default modes. The
+// contents are kept.
+func (s *Screen) Release() {
+	s.setPrivateMode(1049, false)
+	s.softReset()
+	s.modes = make(map[int]bool)
+	s.cursorStyle = 0
+	s.state = stateGround
+}
+
+func (s *Screen) resetTabs() {
+	s.tabs = make([]bool, s.cols)
+	for i := 8; i < s.cols; i += 8 {
+		s.tabs[i] = true
+	}
+}
+
+func blankLines(n, cols int, a attr) []line {
+	lines := make([]line, n)
+	for i := range lines {
+		lines[i] = blankLine(cols, a)
+	}
+	return lines
+}
+
+// rotate moves lines left by n, wrapping around
+func rotate(lines []line, n int) {
+	if n <= 0 || n >= len(lines) {
+		return
+	}
+	head := append([]line(nil), lines[:n]...)
+	copy(lines, lines[n:])
+	copy(lines[len(lines)-n:], head)
+}
+
+// clearLine blanks a line in place
+func clearLine(l *line, a attr) {
+	for i := range l.cells {
+		l.cells[i] = cell{r: ' ', attr: a}
+	}
+	l.wrapped = false
+}
+
+func blankLine(cols int, a attr) line {
+	cells := make([]cell, cols)
+	for i := range cells {
+		cells[i] = cell{r: ' ', attr: a}
+	}
+	return line{cells: cells}
+}
+
+// lines returns the buffer in use
+func (s *Screen) lines() []line {
+	if s.altActive {
+		return s.alt
+	}
+	return s.main
+}
+
+func (s *Screen) buffer() int {
+	if s.altActive {
+		return 1
+	}
+	return 0
+}
+
+// erased is what erased cells look like: blank, with the current background
+func (s *Screen) erased() attr {
+	return attr{bg: s.cur.pen.bg}
+}
+
+// Write feeds terminal output through the emulator
+func (s *Screen) Write(p []byte) {
+	for _, b := range p {
+		s.step(b)
+	}
+}
+
+func (s *Screen) step(b byte) {
+	// CAN and SUB abort any sequence; ESC starts a new one except inside
+	// strings, where it may begin the ST terminator
+	switch {
+	case b == 0x18 || b == 0x1a:
+		s.state = stateGround
+		return
+	case b == 0x1b && s.state != stateOSC && s.state != stateString:
+		s.flushPending()
+		s.state = stateEscape
+		s.inter = s.inter[:0]
+		return
+	}
+
+	switch s.state {
+	case stateGround:
+		switch {
+		case b >= 0x80:
+			s.pending = append(s.pending, b)
+			for len(s.pending) > 0 && utf8.FullRune(s.pending) {
+				r, size := utf8.DecodeRune(s.pending)
+				s.pending = s.pending[size:]
+				s.print(r)
+			}
+		case b < 0x20 || b == 0x7f:
+			s.flushPending()
+			s.execute(b)
+		default:
+			s.flushPending()
+			s.print(rune(b))
+		}
+
+	case stateEscape:
+		switch {
+		case b < 0x20:
+			s.execute(b)
+		case b >= 0x20 && b <= 0x2f:
+			s.inter = append(s.inter, b)
+			s.state = stateEscapeIntermediate
+		default:
+			s.state = stateGround
+			s.escape(b)
+		}
+
+	case stateEscapeIntermediate:
+		switch {
+		case b < 0x20:
+			s.execute(b)
+		case b <= 0x2f:
+			s.inter = append(s.inter, b)
+		default:
+			s.state = stateGround
+			s.escapeIntermediate(b)
+		}
+
+	case stateCSI:
+		switch {
+		case b < 0x20:
+			s.execute(b)
+		case b <= 0x2f:
+			s.inter = append(s.inter, b)
+		case b <= 0x3f:
+			if len(s.params) < 64 {
+				s.params = append(s.params, b)
+			}
+		case b <= 0x7e:
+			s.state = stateGround
+			s.csi(b)
+		}
+
+	case stateOSC:
+		switch b {
+		case 0x07:
+			s.state = stateGround
+			s.oscDispatch()
+		case 0x1b:
+			s.state = stateOSCEscape
+		default:
+			if len(s.osc) < 4096 {
+				s.osc = append(s.osc, b)
+			}
+		}
+
+	case stateOSCEscape:
+		if b == '\\' {
+			s.state = stateGround
+			s.oscDispatch()
+			return
+		}
+		// An unterminated OSC cut short by another sequence
+		s.state = stateEscape
+		s.inter = s.inter[:0]
+		s.step(b)
+
+	case stateString:
+		if b == 0x1b {
+			s.state = stateStringEscape
+		} else if b == 0x07 {
+			s.state = stateGround
+		}
+
+	case stateStringEscape:
+		if b == '\\' {
+			s.state = stateGround
+		} else {
+			s.state = stateString
+		}
+	}
+}
+
+// flushPending drops an incomplete UTF-8 sequence interrupted by other output
+func (s *Screen) flushPending() {
+	if len(s.pending) > 0 {
+		s.pending = s.pending[:0]
+		s.print(utf8.RuneError)
+	}
+}
+
+// execute handles C0 control characters
+func (s *Screen) execute(b byte) {
+	switch b {
+	case '\b':
+		if s.cur.col > 0 {
+			s.cur.col--
+		}
+		s.cur.wrapNext = false
+	case '\t':
+		s.tab(1)
+	case '\n', '\v', '\f':
+		s.index()
+	case '\r':
+		s.cur.col = 0
+		s.cur.wrapNext = false
+	case 0x0e: // SO
+		s.shifted = true
+	case 0x0f: // SI
+		s.shifted = false
+	}
+}
+
+func (s *Screen) escape(b byte) {
+	switch b {
+	case '[':
+		s.state = stateCSI
+		s.params = s.params[:0]
+		s.inter = s.inter[:0]
+	case ']':
+		s.state = stateOSC
+		s.osc = s.osc[:0]
+	case 'P', 'X', '^', '_':
+		s.state = stateString
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.index()
+		s.cur.col = 0
+	case 'M':
+		s.reverseIndex()
+	case 'H':
+		s.tabs[s.cur.col] = true
+	case 'c':
+		s.reset()
+	case '=':
+		s.appKeypad = true
+	case '>':
+		s.appKeypad = false
+	}
+}
+
+func (s *Screen) escapeIntermediate(b byte) {
+	switch s.inter[0] {
+	case '(':
+		s.charsets[0] = b == '0'
+	case ')':
+		s.charsets[1] = b == '0'
+	case '#':
+		if b == '8' { // DECALN
+			for i := range s.lines() {
+				for j := range s.lines()[i].cells {
+					s.lines()[i].cells[j] = cell{r: 'E'}
+				}
+			}
+		}
+	}
+}
+
+func (s *Screen) oscDispatch() {
+	code, text, _ := strings.Cut(string(s.osc), ";")
+	switch code {
+	case "0", "2":
+		s.title = text
+	case "7", "133":
+		if s.trackMarks {
+			s.shellMark(code, text)
+		}
+	}
+}
+
+// TrackMarks makes the screen collect shell integration marks
+func (s *Screen) TrackMarks() {
+	s.trackMarks = true
+}
+
+// TakeMarks returns the shell integration marks written since the last call
+func (s *Screen) TakeMarks() []ShellMark {
+	marks := s.marks
+	s.marks = nil
+	return marks
+}
+
+// shellMark records an OSC 133 or OSC 7 mark. The command line is read off
+// the screen between the B and C marks, as the user saw it, and an excerpt
+// of its output between the C and D marks.
+func (s *Screen) shellMark(code, text string) {
+	mark := ShellMark{Code: "7", Params: text}
+	if code == "133" {
+		mark.Code, mark.Params, _ = strings.Cut(text, ";")
+	}
+	here := [2]int{s.scrolled + s.cur.row, s.cur.col}
+	switch mark.Code {
+	case "B":
+		s.input = here
+	case "C":
+		mark.Text = strings.TrimSpace(strings.Join(s.linesFrom(s.input), "\n"))
+		s.output, s.running = here, true
+	case "D":
+		if s.running {
+			mark.Text = excerpt(s.linesFrom(s.output))
+			s.running = false
+		}
+	}
+	if len(s.marks) < maxMarks {
+		s.marks = append(s.marks, mark)
+	}
+}
+
+// linesFrom returns the lines of the main screen and its history from a
+// position counted with scrolled up to the cursor. Soft-wrapped lines are
+// joined.
+func (s *Screen) linesFrom(pos [2]int) []string {
+	if s.altActive {
+		return nil
+	}
+	first := s.scrolled - len(s.history) // oldest line still kept
+	start, col := pos[0], pos[1]
+	if start < first {
+		start, col = first, 0
+	}
+	end := s.scrolled + s.cur.row
+
+	var lines []string
+	var b strings.Builder
+	for n := start; n <= end; n++ {
+		var l line
+		if n < s.scrolled {
+			l = s.history[n-first]
+		} else {
+			l = s.main[n-s.scrolled]
+		}
+		cells := l.cells
+		if n == start {
+			cells = cells[min(col, len(cells)):]
+		}
+		if !l.wrapped {
+			cells = trimBlank(cells)
+		}
+		for _, c := range cells {
+			if c.r != 0 {
+				b.WriteRune(c.r)
+			}
+		}
+		if !l.wrapped || n == end {
+			lines = append(lines, b.String())
+			b.Reset()
+		}
+	}
+	return lines
+}
+
+// print puts a character at the cursor
+func (s *Screen) print(r rune) {
+	if s.charsets[btoi(s.shifted)] {
+		if g, ok := lineDrawing[r]; ok {
+			r = g
+		}
+	}
+	w := runeWidth(r)
+	if w == 0 {
+		return // combining marks aren't kept
+	}
+	s.lastRune = r
+
+	if s.cur.wrapNext && s.autowrap {
+		s.lines()[s.cur.row].wrapped = true
+		s.index()
+		s.cur.col = 0
+	}
+	s.cur.wrapNext = false
+	if w == 2 && s.cur.col == s.cols-1 {
+		if !s.autowrap || s.cols < 2 {
+			return
+		}
+		breakPair(s.lines()[s.cur.row].cells, s.cur.col)
+		s.lines()[s.cur.row].cells[s.cur.col] = cell{r: ' ', attr: s.erased()}
+		s.lines()[s.cur.row].wrapped = true
+		s.index()
+		s.cur.col = 0
+	}
+	if s.insert {
+		s.insertBlanks(w)
+	}
+
+	cells := s.lines()[s.cur.row].cells
+	breakPair(cells, s.cur.col)
+	cells[s.cur.col] = cell{r: r, attr: s.cur.pen}
+	if w == 2 {
+		breakPair(cells, s.cur.col+1)
+		cells[s.cur.col+1] = cell{r: 0, attr: s.cur.pen}
+	}
+	s.cur.col += w
+	if s.cur.col >= s.cols {
+		s.cur.col = s.cols - 1
+		s.cur.wrapNext = s.autowrap
+	}
+}
+
+// breakPair blanks the other half of a wide character at col, before col
+// is overwritten
+func breakPair(cells []cell, col int) {
+	if cells[col].r == 0 && col > 0 {
+		cells[col-1].r = ' '
+	}
+	if col+1 < len(cells) && cells[col+1].r == 0 {
+		cells[col+1].r = ' '
+	}
+}
+
+// fixWide blanks halves of wide characters that editing or resizing split
+// from their other half
+func fixWide(cells []cell) {
+	for i := range cells {
+		switch {
+		case cells[i].r == 0:
+			if i == 0 || cells[i-1].r == ' ' || runeWidth(cells[i-1].r) != 2 {
+				cells[i].r = ' '
+			}
+		case i+1 == len(cells) || cells[i+1].r != 0:
+			if runeWidth(cells[i].r) == 2 {
+				cells[i].r = ' '
+			}
+		}
+	}
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x300, r == utf8.RuneError:
+		// Nothing below the combining marks is wide or zero width
+		return 1
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// index moves the cursor down, scrolling at the bottom of the scroll region
+func (s *Screen) index() {
+	s.cur.wrapNext = false
+	if s.cur.row == s.bottom {
+		s.scrollUp(1)
+	} else if s.cur.row < s.rows-1 {
+		s.cur.row++
+	}
+}
+
+// reverseIndex moves the cursor up, scrolling at the top of the scroll region
+func (s *Screen) reverseIndex() {
+	s.cur.wrapNext = false
+	if s.cur.row == s.top {
+		s.scrollDown(1)
+	} else if s.cur.row > 0 {
+		s.cur.row--
+	}
+}
+
+// scrollUp scrolls the scroll region up. Lines leaving the top of the main
+// screen go to history.
+func (s *Screen) scrollUp(n int) {
+	s.scrollUpFrom(s.top, n, s.top == 0 && !s.altActive)
+}
+
+// scrollDown scrolls the scroll region down
+func (s *Screen) scrollDown(n int) {
+	s.scrollDownFrom(s.top, n)
+}
+
+// scrollUpFrom scrolls lines top through the bottom margin up
+func (s *Screen) scrollUpFrom(top, n int, toHistory bool) {
+	n = min(n, s.bottom-top+1)
+	lines := s.lines()
+	if toHistory {
+		for _, l := range lines[top : top+n] {
+			s.pushHistory(l)
+		}
+	}
+	// Lines scrolled out are reused for the blank lines coming in
+	rotate(lines[top:s.bottom+1], n)
+	for i := s.bottom - n + 1; i <= s.bottom; i++ {
+		clearLine(&lines[i], s.erased())
+	}
+}
+
+// scrollDownFrom scrolls lines top through the bottom margin down
+func (s *Screen) scrollDownFrom(top, n int) {
+	n = min(n, s.bottom-top+1)
+	lines := s.lines()
+	rotate(lines[top:s.bottom+1], len(lines[top:s.bottom+1])-n)
+	for i := top; i < top+n; i++ {
+		clearLine(&lines[i], s.erased())
+	}
+}
+
+func (s *Screen) pushHistory(l line) {
+	s.scrolled++
+	if !l.wrapped {
+		l.cells = trimBlank(l.cells)
+	}
+	if len(s.history) == MaxHistoryLines {
+		// append moves the lines to a new array now and then, which frees
+		// the ones dropped here
+		s.history[0] = line{}
+		s.history = s.history[1:]
+	}
+	s.history = append(s.history, line{cells: append([]cell(nil), l.cells...), wrapped: l.wrapped})
+}
+
+// trimBlank drops trailing cells that look like nothing was written there
+func trimBlank(cells []cell) []cell {
+	end := len(cells)
+	for end > 0 && cells[end-1].r == ' ' && cells[end-1].attr == (attr{}) {
+		end--
+	}
+	return cells[:end]
+}
+
+func (s *Screen) tab(n int) {
+	for ; n > 0 && s.cur.col < s.cols-1; n-- {
+		s.cur.col++
+		for s.cur.col < s.cols-1 && !s.tabs[s.cur.col] {
+			s.cur.col++
+		}
+	}
+	s.cur.wrapNext = false
+}
+
+func (s *Screen) backTab(n int) {
+	for ; n > 0 && s.cur.col > 0; n-- {
+		s.cur.col--
+		for s.cur.col > 0 && !s.tabs[s.cur.col] {
+			s.cur.col--
+		}
+	}
+	s.cur.wrapNext = false
+}
+
+// moveTo positions the cursor, relative to the scroll region in origin mode
+func (s *Screen) moveTo(row, col int) {
+	minRow, maxRow := 0, s.rows-1
+	if s.origin {
+		row += s.top
+		minRow, maxRow = s.top, s.bottom
+	}
+	s.cur.row = clamp(row, minRow, maxRow)
+	s.cur.col = clamp(col, 0, s.cols-1)
+	s.cur.wrapNext = false
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+func (s *Screen) saveCursor() {
+	s.saved[s.buffer()] = savedCursor{
+		cursor:   s.cur,
+		set:      true,
+		origin:   s.origin,
+		charsets: s.charsets,
+		shifted:  s.shifted,
+	}
+}
+
+func (s *Screen) restoreCursor() {
+	saved := s.saved[s.buffer()]
+	if !saved.set {
+		s.cur = cursor{}
+		s.origin = false
+		return
+	}
+	s.cur = saved.cursor
+	s.cur.row = min(s.cur.row, s.rows-1)
+	s.cur.col = min(s.cur.col, s.cols-1)
+	s.origin = saved.origin
+	s.charsets = saved.charsets
+	s.shifted = saved.shifted
+}
+
+func (s *Screen) insertBlanks(n int) {
+	cells := s.lines()[s.cur.row].cells
+	n = min(n, s.cols-s.cur.col)
+	copy(cells[s.cur.col+n:], cells[s.cur.col:])
+	for i := s.cur.col; i < s.cur.col+n; i++ {
+		cells[i] = cell{r: ' ', attr: s.erased()}
+	}
+	fixWide(cells)
+}
+
+func (s *Screen) deleteChars(n int) {
+	cells := s.lines()[s.cur.row].cells
+	n = min(n, s.cols-s.cur.col)
+	copy(cells[s.cur.col:], cells[s.cur.col+n:])
+	for i := s.cols - n; i < s.cols; i++ {
+		cells[i] = cell{r: ' ', attr: s.erased()}
+	}
+	fixWide(cells)
+}
+
+// erase blanks columns [from, to) of a row
+func (s *Screen) erase(row, from, to int) {
+	cells := s.lines()[row].cells
+	for i := max(from, 0); i < min(to, s.cols); i++ {
+		cells[i] = cell{r: ' ', attr: s.erased()}
+	}
+	fixWide(cells)
+	if to >= s.cols {
+		s.lines()[row].wrapped = false
+	}
+}
+
+// csi dispatches a control sequence
+func (s *Screen) csi(final byte) {
+	private := byte(0)
+	params := s.params
+	if len(params) > 0 && params[0] >= '<' && params[0] <= '?' {
+		private, params = params[0], params[1:]
+	}
+	args := parseParams(params)
+	arg := func(i, def int) int {
+		if i < len(args) && args[i][0] > 0 {
+			return args[i][0]
+		}
+		return def
+	}
+	n := arg(0, 1)
+	inter := string(s.inter)
+
+	if private == '?' {
+		if final == 'h' || final == 'l' {
+			for _, a := range args {
+				s.setPrivateMode(a[0], final == 'h')
+			}
+		}
+		return
+	}
+	if private != 0 {
+		return // DA2, xterm key modifiers and the like
+	}
+
+	switch {
+	case inter == " " && final == 'q':
+		s.cursorStyle = arg(0, 0)
+		return
+	case inter == "!" && final == 'p':
+		s.softReset()
+		return
+	case inter != "":
+		return
+	}
+
+	switch final {
+	case '@':
+		s.insertBlanks(n)
+	case 'A':
+		top := 0
+		if s.cur.row >= s.top {
+			top = s.top
+		}
+		s.cur.row = max(s.cur.row-n, top)
+		s.cur.wrapNext = false
+	case 'B', 'e':
+		bottom := s.rows - 1
+		if s.cur.row <= s.bottom {
+			bottom = s.bottom
+		}
+		s.cur.row = min(s.cur.row+n, bottom)
+		s.cur.wrapNext = false
+	case 'C', 'a':
+		s.cur.col = min(s.cur.col+n, s.cols-1)
+		s.cur.wrapNext = false
+	case 'D':
+		s.cur.col = max(s.cur.col-n, 0)
+		s.cur.wrapNext = false
+	case 'E':
+		s.cur.row = min(s.cur.row+n, s.bottom)
+		s.cur.col = 0
+		s.cur.wrapNext = false
+	case 'F':
+		s.cur.row = max(s.cur.row-n, s.top)
+		s.cur.col = 0
+		s.cur.wrapNext = false
+	case 'G', '`':
+		s.cur.col = clamp(n-1, 0, s.cols-1)
+		s.cur.wrapNext = false
+	case 'H', 'f':
+		s.moveTo(arg(0, 1)-1, arg(1, 1)-1)
+	case 'I':
+		s.tab(n)
+	case 'Z':
+		s.backTab(n)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			s.erase(s.cur.row, s.cur.col, s.cols)
+			for r := s.cur.row + 1; r < s.rows; r++ {
+				s.erase(r, 0, s.cols)
+			}
+		case 1:
+			for r := 0; r < s.cur.row; r++ {
+				s.erase(r, 0, s.cols)
+			}
+			s.erase(s.cur.row, 0, s.cur.col+1)
+		case 2:
+			for r := 0; r < s.rows; r++ {
+				s.erase(r, 0, s.cols)
+			}
+		case 3:
+			s.history = nil
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			s.erase(s.cur.row, s.cur.col, s.cols)
+		case 1:
+			s.erase(s.cur.row, 0, s.cur.col+1)
+		case 2:
+			s.erase(s.cur.row, 0, s.cols)
+		}
+		s.cur.wrapNext = false
+	case 'L':
+		if s.cur.row >= s.top && s.cur.row <= s.bottom {
+			s.scrollDownFrom(s.cur.row, n)
+			s.cur.col = 0
+			s.cur.wrapNext = false
+		}
+	case 'M':
+		if s.cur.row >= s.top && s.cur.row <= s.bottom {
+			s.scrollUpFrom(s.cur.row, n, false)
+			s.cur.col = 0
+			s.cur.wrapNext = false
+		}
+	case 'P':
+		s.deleteChars(n)
+	case 'X':
+		s.erase(s.cur.row, s.cur.col, s.cur.col+n)
+	case 'S':
+		s.scrollUp(n)
+	case 'T':
+		if len(args) <= 1 {
+			s.scrollDown(n)
+		}
+	case 'b':
+		if s.lastRune != 0 {
+			for i := 0; i < min(n, s.cols*s.rows); i++ {
+				s.print(s.lastRune)
+			}
+		}
+	case 'd':
+		s.moveTo(n-1, s.cur.col)
+	case 'g':
+		switch arg(0, 0) {
+		case 0:
+			s.tabs[s.cur.col] = false
+		case 3:
+			s.tabs = make([]bool, s.cols)
+		}
+	case 'h', 'l':
+		for _, a := range args {
+			if a[0] == 4 {
+				s.insert = final == 'h'
+			}
+		}
+	case 'm':
+		s.sgr(args)
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, s.rows)-1
+		bottom = min(bottom, s.rows-1)
+		if top < bottom {
+			s.top, s.bottom = top, bottom
+			s.moveTo(0, 0)
+		}
+	case 's':
+		if len(args) == 0 {
+			s.saveCursor()
+		}
+	case 'u':
+		s.restoreCursor()
+	}
+}
+
+// parseParams splits CSI parameters; each has its colon-separated
+// subparameters after it. Missing values are -1.
+func parseParams(params []byte) [][]int {
+	if len(params) == 0 {
+		return nil
+	}
+	var args [][]int
+	for _, p := range bytes.Split(params, []byte{';'}) {
+		var arg []int
+		for _, sub := range bytes.Split(p, []byte{':'}) {
+			v, err := strconv.Atoi(string(sub))
+			if err != nil {
+				v = -1
+			}
+			arg = append(arg, v)
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+func (s *Screen) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 1:
+		s.appCursor = on
+	case 6:
+		s.origin = on
+		s.moveTo(0, 0)
+	case 7:
+		s.autowrap = on
+		if !on {
+			s.cur.wrapNext = false
+		}
+	case 25:
+		s.hideCursor = !on
+	case 47:
+		s.switchBuffer(on)
+	case 1047:
+		if !on && s.altActive {
+			s.alt = blankLines(s.rows, s.cols, attr{})
+		}
+		s.switchBuffer(on)
+	case 1048:
+		if on {
+			s.saveCursor()
+		} else {
+			s.restoreCursor()
+		}
+	case 1049:
+		if on && !s.altActive {
+			s.saveCursor()
+			s.switchBuffer(true)
+			s.alt = blankLines(s.rows, s.cols, s.erased())
+		} else if !on && s.altActive {
+			s.switchBuffer(false)
+			s.restoreCursor()
+		}
+	default:
+		for _, m := range passthroughModes {
+			if m == mode {
+				s.modes[mode] = on
+			}
+		}
+	}
+}
+
+func (s *Screen) switchBuffer(alt bool) {
+	if s.altActive == alt {
+		return
+	}
+	s.altActive = alt
+	s.cur.row = min(s.cur.row, s.rows-1)
+	s.cur.wrapNext = false
+}
+
+// sgr sets graphic rendition
+func (s *Screen) sgr(args [][]int) {
+	if len(args) == 0 {
+		args = [][]int{{0}}
+	}
+	pen := &s.cur.pen
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch v := a[0]; {
+		case v <= 0:
+			*pen = attr{}
+		case v == 1:
+			pen.flags |= attrBold
+		case v == 2:
+			pen.flags |= attrDim
+		case v == 3:
+			pen.flags |= attrItalic
+		case v == 4:
+			if len(a) > 1 && a[1] == 0 {
+				pen.flags &^= attrUnderline
+			} else {
+				pen.flags |= attrUnderline
+			}
+		case v == 5 || v == 6:
+			pen.flags |= attrBlink
+		case v == 7:
+			pen.flags |= attrInverse
+		case v == 8:
+			pen.flags |= attrHidden
+		case v == 9:
+			pen.flags |= attrStrike
+		case v == 21:
+			pen.flags |= attrUnderline
+		case v == 22:
+			pen.flags &^= attrBold | attrDim
+		case v == 23:
+			pen.flags &^= attrItalic
+		case v == 24:
+			pen.flags &^= attrUnderline
+		case v == 25:
+			pen.flags &^= attrBlink
+		case v == 27:
+			pen.flags &^= attrInverse
+		case v == 28:
+			pen.flags &^= attrHidden
+		case v == 29:
+			pen.flags &^= attrStrike
+		case v >= 30 && v <= 37:
+			pen.fg = colorIndexed | color(v-30)
+		case v == 38, v == 48, v == 58:
+			var c color
+			c, i = extendedColor(args, i)
+			if v == 38 {
+				pen.fg = c
+			} else if v == 48 {
+				pen.bg = c
+			}
+		case v == 39:
+			pen.fg = 0
+		case v >= 40 && v <= 47:
+			pen.bg = colorIndexed | color(v-40)
+		case v == 49:
+			pen.bg = 0
+		case v >= 90 && v <= 97:
+			pen.fg = colorIndexed | color(v-90+8)
+		case v >= 100 && v <= 107:
+			pen.bg = colorIndexed | color(v-100+8)
+		}
+	}
+}
+
+// extendedColor reads a 38/48 color, as subparameters (38:5:n, 38:2::r:g:b)
+// or as the following parameters (38;5;n, 38;2;r;g;b). It returns the index
+// of the last parameter used.
+func extendedColor(args [][]int, i int) (color, int) {
+	vals := args[i][1:]
+	next := i
+	if len(vals) == 0 {
+		for _, a := range args[i+1:] {
+			vals = append(vals, a[0])
+		}
+	}
+	if len(vals) == 0 {
+		return 0, i
+	}
+	byteVal := func(v int) color { return color(clamp(v, 0, 255)) }
+	switch vals[0] {
+	case 5:
+		if len(vals) < 2 {
+			return 0, len(args)
+		}
+		if len(args[i]) == 1 {
+			next = i + 2
+		}
+		return colorIndexed | byteVal(vals[1]), next
+	case 2:
+		rgb := vals[1:]
+		// The colon form may carry a colorspace ID first
+		if len(args[i]) > 1 && len(rgb) == 4 {
+			rgb = rgb[1:]
+		}
+		if len(rgb) < 3 {
+			return 0, len(args)
+		}
+		if len(args[i]) == 1 {
+			next = i + 4
+		}
+		return colorRGB | byteVal(rgb[0])<<16 | byteVal(rgb[1])<<8 | byteVal(rgb[2]), next
+	}
+	return 0, i
+}
+
+// Resize changes the screen size. Lines aren't reflowed; when rows are
+// removed, blank lines below the cursor go first, then lines at the top
+// (into history on the main screen).
+func (s *Screen) Resize(cols, rows int) {
+	cols, rows = max(cols, 1), max(rows, 1)
+	if cols == s.cols && rows == s.rows {
+		return
+	}
+
+	resize := func(lines []line, cur *cursor, history bool) []line {
+		for i := range lines {
+			l := &lines[i]
+			if len(l.cells) > cols {
+				l.cells = l.cells[:cols]
+				l.wrapped = false
+			}
+			for len(l.cells) < cols {
+				l.cells = append(l.cells, cell{r: ' '})
+			}
+			fixWide(l.cells)
+		}
+		for len(lines) > rows && len(lines)-1 > cur.row && len(trimBlank(lines[len(lines)-1].cells)) == 0 {
+			lines = lines[:len(lines)-1]
+		}
+		if extra := len(lines) - rows; extra > 0 {
+			if history {
+				for _, l := range lines[:extra] {
+					s.pushHistory(l)
+				}
+			}
+			lines = lines[extra:]
+			cur.row = max(cur.row-extra, 0)
+		}
+		for len(lines) < rows {
+			lines = append(lines, blankLine(cols, attr{}))
+		}
+		cur.row = min(cur.row, rows-1)
+		cur.col = min(cur.col, cols-1)
+		cur.wrapNext = false
+		return lines
+	}
+
+	// Only the active buffer's cursor moves with its content; the other
+	// buffer's saved cursor is just clamped
+	mainCur, altCur := &s.saved[0].cursor, &s.cur
+	if !s.altActive {
+		mainCur, altCur = &s.cur, &s.saved[1].cursor
+	}
+	s.main = resize(s.main, mainCur, true)
+	s.alt = resize(s.alt, altCur, false)
+
+	s.cols, s.rows = cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.resetTabs()
+}
+
+// Snapshot serializes the screen as output that recreates it - history,
+// screen contents, cursor, modes and title - in a freshly reset terminal
+// of the same size. Soft-wrapped lines are written unbroken so a terminal
+// of another width reflows them.
+func (s *Screen) Snapshot() []byte {
+	var b bytes.Buffer
+	b.WriteString("\x1bc")
+	if s.title != "" {
+		fmt.Fprintf(&b, "\x1b]2;%s\x07", s.title)
+	}
+
+	// History and the main screen, as a stream of lines. A line only
+	// continues onto the next one if there is something there; otherwise
+	// the wrap is left out so the blank line isn't lost.
+	var pen attr
+	lines := append(append(make([]line, 0, len(s.history)+len(s.main)), s.history...), s.main...)
+	continued := false
+	for i, l := range lines {
+		wrapped := l.wrapped && i < len(lines)-1 && len(trimBlank(lines[i+1].cells)) > 0
+		cells := l.cells
+		if !wrapped {
+			cells = trimBlank(cells)
+		}
+		if continued && cells[0].attr.bg != 0 {
+			// Wrap with a plain space, so the new line isn't filled with
+			// the first character's background
+			b.WriteString("\x1b[0m \b")
+			pen = attr{}
+		}
+		pen = writeCells(&b, cells, pen)
+		if i < len(lines)-1 && !wrapped {
+			pen = writeNewline(&b, pen)
+		}
+		continued = wrapped
+	}
+
+	if s.altActive {
+		// Entering the alternate screen saves the main screen's cursor
+		main := s.saved[0]
+		fmt.Fprintf(&b, "\x1b[%d;%dH", main.row+1, main.col+1)
+		b.WriteString(sgr(main.pen))
+		b.WriteString("\x1b[?1049h")
+		pen = main.pen
+		for i, l := range s.alt {
+			fmt.Fprintf(&b, "\x1b[%d;1H", i+1)
+			pen = writeCells(&b, trimBlank(l.cells), pen)
+		}
+		if alt := s.saved[1]; alt.set {
+			fmt.Fprintf(&b, "\x1b[%d;%dH", alt.row+1, alt.col+1)
+			b.WriteString(sgr(alt.pen))
+			b.WriteString("\x1b7")
+			pen = alt.pen
+		}
+	} else if main := s.saved[0]; main.set {
+		fmt.Fprintf(&b, "\x1b[%d;%dH", main.row+1, main.col+1)
+		b.WriteString(sgr(main.pen))
+		b.WriteString("\x1b7")
+		pen = main.pen
+	}
+
+	if s.top != 0 || s.bottom != s.rows-1 {
+		fmt.Fprintf(&b, "\x1b[%d;%dr", s.top+1, s.bottom+1)
+	}
+	row := s.cur.row
+	if s.origin {
+		b.WriteString("\x1b[?6h")
+		row -= s.top
+	}
+	if s.cur.wrapNext && s.cur.col == s.cols-1 {
+		// Rewrite the last character so the next one wraps
+		c := s.lines()[s.cur.row].cells[s.cur.col]
+		if c.r != 0 {
+			fmt.Fprintf(&b, "\x1b[%d;%dH", row+1, s.cur.col+1)
+			writeCells(&b, []cell{c}, pen)
+		} else {
+			fmt.Fprintf(&b, "\x1b[%d;%dH", row+1, s.cur.col)
+			writeCells(&b, s.lines()[s.cur.row].cells[s.cur.col-1:], pen)
+		}
+	} else {
+		fmt.Fprintf(&b, "\x1b[%d;%dH", row+1, s.cur.col+1)
+	}
+	b.WriteString(sgr(s.cur.pen))
+
+	if s.appCursor {
+		b.WriteString("\x1b[?1h")
+	}
+	if s.appKeypad {
+		b.WriteString("\x1b=")
+	}
+	if !s.autowrap {
+		b.WriteString("\x1b[?7l")
+	}
+	if s.insert {
+		b.WriteString("\x1b[4h")
+	}
+	if s.hideCursor {
+		b.WriteString("\x1b[?25l")
+	}
+	if s.cursorStyle != 0 {
+		fmt.Fprintf(&b, "\x1b[%d q", s.cursorStyle)
+	}
+	for _, m := range passthroughModes {
+		if s.modes[m] {
+			fmt.Fprintf(&b, "\x1b[?%dh", m)
+		}
+	}
+	if s.charsets[0] {
+		b.WriteString("\x1b(0")
+	}
+	if s.charsets[1] {
+		b.WriteString("\x1b)0")
+	}
+	if s.shifted {
+		b.WriteByte(0x0e)
+	}
+	return b.Bytes()
+}
+
+// writeCells writes characters, changing rendition as needed, and returns
+// the rendition in effect afterwards
+func writeCells(b *bytes.Buffer, cells []cell, pen attr) attr {
+	for _, c := range cells {
+		if c.r == 0 {
+			continue
+		}
+		if c.attr != pen {
+			b.WriteString(sgr(c.attr))
+			pen = c.attr
+		}
+		b.WriteRune(c.r)
+	}
+	return pen
+}
+
+// writeNewline ends a line. The rendition is reset first so a colored
+// background doesn't bleed into the new line.
+func writeNewline(b *bytes.Buffer, pen attr) attr {
+	if pen != (attr{}) {
+		b.WriteString("\x1b[0m")
+	}
+	b.WriteString("\r\n")
+	return attr{}
+}
+
+// sgr returns the sequence that sets a rendition from scratch
+func sgr(a attr) string {
+	var b strings.Builder
+	b.WriteString("\x1b[0")
+	for i, code := range []string{"1", "2", "3", "4", "5", "7", "8", "9"} {
+		if a.flags&(1<<i) != 0 {
+			b.WriteString(";" + code)
+		}
+	}
+	writeColor(&b, a.fg, 30, 90, 38)
+	writeColor(&b, a.bg, 40, 100, 48)
+	b.WriteByte('m')
+	return b.String()
+}
+
+func writeColor(b *strings.Builder, c color, base, bright, extended int) {
+	switch {
+	case c == 0:
+	case c&colorRGB != 0:
+		fmt.Fprintf(b, ";%d;2;%d;%d;%d", extended, c>>16&0xff, c>>8&0xff, c&0xff)
+	case c&0xff < 8:
+		fmt.Fprintf(b, ";%d", base+int(c&0xff))
+	case c&0xff < 16:
+		fmt.Fprintf(b, ";%d", bright+int(c&0xff)-8)
+	default:
+		fmt.Fprintf(b, ";%d;5;%d", extended, c&0xff)
+	}
+}
@@ -2,9 +2,10 @@ import { useEffect, useState, useCallback, useRef, createContext } from 'react'
 import Markdown from 'react-markdown'
 import { Card, CardContent, CardHeader, CardTitle } from '@/components/ui/card'
 import { ShareMenu } from '@/components/ShareMenu'
+import { FeedbackPanel } from '@/components/FeedbackPanel'
 import { Button } from '@/components/ui/button'
 import { Toaster, toast } from '@/components/ui/sonner'
-import { api, type Repo, type Port, type Status, type GitHubRepo, type GitStatus, type RepoInfo, type BranchInfo, type UpdateInfo, type UpgradeStatus, type Process, type LogEntry, type ActivityEntry } from '@/lib/api'
+import { api, type Repo, type Port, type Status, type GitHubRepo, type GitStatus, type RepoInfo, type BranchInfo, type UpdateInfo, type UpgradeStatus, type Process, type LogEntry, type ActivityEntry, type ShareOptions } from '@/lib/api'
 import {
   ExternalLink,
   Copy,
@@ -16,6 +17,7 @@ import {
   Lock,
   Unlock,
   KeyRound,
+  Mail,
   Plus,
   Search,
   Check,
@@ -49,6 +51,9 @@ import {
   History,
   Star,
   Loader2,
+  MessageSquare,
+  Pin,
+  PinOff,
 } from 'lucide-react'
 
 // Convert homeportd repo path to code-server path
@@ -231,9 +236,9 @@ function App() {
     window.open(`/${port}/`, '_blank')
   }
 
-  const handleShare = async (port: number, mode: string, password?: string, expiresIn?: string) => {
+  const handleShare = async (port: number, mode: string, password?: string, expiresIn?: string, options?: ShareOptions) => {
     try {
-      const result = await api.sharePort(port, mode, password, expiresIn)
+      const result = await api.sharePort(port, mode, password, expiresIn, undefined, options)
       toast.success(`Port ${port} shared as ${mode}${result.expires_at ? ' (expires ' + formatRelativeTime(result.expires_at) + ')' : ''}`)
       fetchData()
     } catch (err) {
@@ -241,6 +246,18 @@ function App() {
     }
   }
 
+  const handleUpdatePort = async (port: number, changes: { label?: string; pinned?: boolean }) => {
+    try {
+      await api.updatePort(port, changes)
+      if (changes.pinned !== undefined) {
+        toast.success(changes.pinned ? `Port ${port} pinned` : `Port ${port} unpinned`)
+      }
+      fetchData()
+    } catch (err) {
+      toast.error('Failed to update port')
+    }
+  }
+
   const handleDeleteRepo = async (repo: Repo) => {
     if (!confirm(`Delete "${repo.name}"? This will remove the repository from disk.`)) {
       return
@@ -697,6 +714,7 @@ function App() {
                     onCopyCurl={copyCurl}
                     onOpenPort={openPort}
                     onShare={handleShare}
+                    onUpdatePort={handleUpdatePort}
                     onConfigureStart={() => setShowStartCommandModal(repo)}
                     onExecCommand={(cmd) => handleExecCommand(repo, cmd)}
                     onCheckoutBranch={(branch) => handleCheckoutBranch(repo, branch)}
@@ -904,6 +922,7 @@ function getActivityIcon(type: string) {
     case 'pull': return <Download className="h-3 w-3" />
     case 'start': return <Play className="h-3 w-3" />
     case 'stop': return <Square className="h-3 w-3" />
+    case 'feedback': return <MessageSquare className="h-3 w-3" />
     default: return <History className="h-3 w-3" />
   }
 }
@@ -919,6 +938,7 @@ function getActivityColor(type: string, theme: Theme) {
     pull: theme === 'dark' ? 'bg-cyan-900/30 text-cyan-400' : 'bg-cyan-50 text-cyan-600',
     start: theme === 'dark' ? 'bg-emerald-900/30 text-emerald-400' : 'bg-emerald-50 text-emerald-600',
     stop: theme === 'dark' ? 'bg-gray-800 text-gray-400' : 'bg-gray-100 text-gray-600',
+    feedback: theme === 'dark' ? 'bg-amber-900/30 text-amber-400' : 'bg-amber-50 text-amber-600',
   }
   return colors[type] || (theme === 'dark' ? 'bg-gray-800 text-gray-400' : 'bg-gray-100 text-gray-600')
 }
@@ -1028,6 +1048,7 @@ function RepoCard({
   onCopyCurl,
   onOpenPort,
   onShare,
+  onUpdatePort,
   onConfigureStart,
   onExecCommand,
   onCheckoutBranch,
@@ -1052,7 +1073,8 @@ function RepoCard({
   onCopyUrl: (port: number) => void
   onCopyCurl: (port: number) => void
   onOpenPort: (port: number) => void
-  onShare: (port: number, mode: string, password?: string, expiresIn?: string) => void
+  onShare: (port: number, mode: string, password?: string, expiresIn?: string, options?: ShareOptions) => void
+  onUpdatePort: (port: number, changes: { label?: string; pinned?: boolean }) => void
   onConfigureStart: () => void
   onExecCommand: (cmd: 'install' | 'fetch' | 'reset') => void
   onCheckoutBranch: (branch: string) => void
@@ -1340,6 +1362,7 @@ function RepoCard({
                 onCopyCurl={() => onCopyCurl(port.port)}
                 onOpen={() => onOpenPort(port.port)}
                 onShare={onShare}
+                onUpdate={(changes) => onUpdatePort(port.port, changes)}
                 onStop={onStopProcess}
               />
             ))}
@@ -1386,6 +1409,7 @@ function PortRow({
   onCopyCurl,
   onOpen,
   onShare,
+  onUpdate,
   onStop,
 }: {
   port: Port
@@ -1395,13 +1419,16 @@ function PortRow({
   onCopy: () => void
   onCopyCurl: () => void
   onOpen: () => void
-  onShare: (port: number, mode: string, password?: string, expiresIn?: string) => void
+  onShare: (port: number, mode: string, password?: string, expiresIn?: string, options?: ShareOptions) => void
+  onUpdate: (changes: { label?: string; pinned?: boolean }) => void
   onStop: () => void
 }) {
   const [showShareMenu, setShowShareMenu] = useState(false)
   const [showCopyMenu, setShowCopyMenu] = useState(false)
+  const [showFeedback, setShowFeedback] = useState(false)
   const shareMenuRef = useRef<HTMLDivElement>(null)
   const copyMenuRef = useRef<HTMLDivElement>(null)
+  const feedbackRef = useRef<HTMLDivElement>(null)
 
   useEffect(() => {
     const handleClickOutside = (e: MouseEvent) => {
@@ -1411,38 +1438,64 @@ function PortRow({
       if (copyMenuRef.current && !copyMenuRef.current.contains(e.target as Node)) {
         setShowCopyMenu(false)
       }
+      if (feedbackRef.current && !feedbackRef.current.contains(e.target as Node)) {
+        setShowFeedback(false)
+      }
     }
     document.addEventListener('mousedown', handleClickOutside)
     return () => document.removeEventListener('mousedown', handleClickOutside)
   }, [])
 
   const ShareIcon = port.share_mode === 'public' ? Unlock :
-                    port.share_mode === 'password' ? KeyRound : Lock
+                    port.share_mode === 'password' ? KeyRound :
+                    port.share_mode === 'email' ? Mail : Lock
 
   const modeColors = {
     private: theme === 'dark' ? 'bg-gray-800 text-gray-400' : 'bg-gray-100 text-gray-700',
     password: theme === 'dark' ? 'bg-amber-900/30 text-amber-400' : 'bg-amber-50 text-amber-700',
+    email: theme === 'dark' ? 'bg-blue-900/30 text-blue-400' : 'bg-blue-50 text-blue-700',
     public: theme === 'dark' ? 'bg-green-900/30 text-green-400' : 'bg-green-50 text-green-700'
   }
 
+  const editLabel = () => {
+    const label = prompt(`Label for port ${port.port} (empty to clear)`, port.label || '')
+    if (label !== null) onUpdate({ label })
+  }
+
   return (
-    <div className={`flex items-center justify-between p-3 rounded-lg group ${theme === 'dark' ? 'bg-gray-800/50' : 'bg-gray-50'}`}>
+    <div className={`flex items-center justify-between p-3 rounded-lg group ${theme === 'dark' ? 'bg-gray-800/50' : 'bg-gray-50'} ${port.offline ? 'opacity-60' : ''}`}>
       <div className="flex items-center gap-2 sm:gap-3 min-w-0">
         {/* Health indicator */}
-        <div className={`w-2 h-2 rounded-full flex-shrink-0 ${isHealthy === true ? 'bg-green-500' : isHealthy === false ? 'bg-red-500' : 'bg-gray-400'}`} title={isHealthy ? 'Responding' : 'Not responding'} />
+        <div className={`w-2 h-2 rounded-full flex-shrink-0 ${port.offline ? 'bg-gray-400' : isHealthy === true ? 'bg-green-500' : isHealthy === false ? 'bg-red-500' : 'bg-gray-400'}`} title={port.offline ? 'Offline (pinned)' : isHealthy ? 'Responding' : 'Not responding'} />
 
         <code className={`text-xs sm:text-sm font-mono font-medium px-1.5 sm:px-2 py-0.5 sm:py-1 rounded border flex-shrink-0 ${theme === 'dark' ? 'bg-gray-800 border-gray-700 text-gray-200' : 'bg-white border-gray-200 text-gray-900'}`}>
           :{port.port}
         </code>
+        {port.favicon && (
+          <img
+            src={`/${port.port}${port.favicon}`}
+            alt=""
+            className="h-4 w-4 flex-shrink-0"
+            onError={(e) => { e.currentTarget.style.display = 'none' }}
+          />
+        )}
         <span
           className={`text-xs sm:text-sm truncate max-w-[120px] sm:max-w-[200px] ${theme === 'dark' ? 'text-gray-400' : 'text-gray-500'}`}
-          title={port.command || port.process_name || 'Unknown'}
+          title={[
+            port.command || port.process_name || 'Unknown',
+            port.server,
+            port.container && `Container: ${port.container}`,
+            port.namespace && `Namespace: ${port.namespace} (${port.dial_addr})`,
+          ].filter(Boolean).join('\n')}
         >
-          {(() => {
+          {port.label || port.title || (() => {
+            if (port.container) return port.container
             const raw = port.command ? port.command.split('/').pop()?.split(' ')[0] : port.process_name
             return raw?.replace(/\s*\(v[\d.]+\)/g, '').replace(/\(v\d+\)$/, '') || 'Unknown'
           })()}
         </span>
+        <ProtocolBadge port={port} theme={theme} />
+        <ExposedWarning port={port} theme={theme} />
         <div className={`hidden sm:flex items-center gap-1 px-2 py-0.5 rounded-full text-xs font-medium ${modeColors[port.share_mode]}`}>
           <ShareIcon className="h-3 w-3" />
           {port.share_mode}
@@ -1455,6 +1508,42 @@ function PortRow({
         </div>
       </div>
       <div className="flex items-center gap-0.5 sm:gap-1">
+        <Button
+          variant="ghost"
+          size="sm"
+          onClick={editLabel}
+          className="h-7 w-7 sm:h-8 sm:w-8 p-0 opacity-0 group-hover:opacity-100"
+          title="Rename"
+        >
+          <Pencil className="h-3.5 w-3.5 sm:h-4 sm:w-4" />
+        </Button>
+        <Button
+          variant="ghost"
+          size="sm"
+          onClick={() => onUpdate({ pinned: !port.pinned })}
+          className={`h-7 w-7 sm:h-8 sm:w-8 p-0 ${port.pinned ? '' : 'opacity-0 group-hover:opacity-100'}`}
+          title={port.pinned ? 'Unpin' : 'Pin: keep this port and its share settings while offline'}
+        >
+          {port.pinned ? <PinOff className="h-3.5 w-3.5 sm:h-4 sm:w-4" /> : <Pin className="h-3.5 w-3.5 sm:h-4 sm:w-4" />}
+        </Button>
+        {/* Feedback left through the preview banner */}
+        {port.feedback_count > 0 && (
+          <div className="relative" ref={feedbackRef}>
+            <Button
+              variant="ghost"
+              size="sm"
+              onClick={() => setShowFeedback(!showFeedback)}
+              className="h-7 sm:h-8 px-1.5 gap-1 text-xs"
+              title="Visitor feedback"
+            >
+              <MessageSquare className="h-3.5 w-3.5 sm:h-4 sm:w-4" />
+              {port.feedback_count}
+            </Button>
+            {showFeedback && (
+              <FeedbackPanel port={port.port} theme={theme} onClose={() => setShowFeedback(false)} />
+            )}
+          </div>
+        )}
         {/* Copy menu */}
         <div className="relative" ref={copyMenuRef}>
           <Button variant="ghost" size="sm" onClick={() => setShowCopyMenu(!showCopyMenu)} className="h-7 w-7 sm:h-8 sm:w-8 p-0">
@@ -1493,8 +1582,8 @@ function PortRow({
             <ShareMenu
               port={port}
               theme={theme}
-              onShare={(mode, password, expiresIn) => {
-                onShare(port.port, mode, password, expiresIn)
+              onShare={(mode, password, expiresIn, options) => {
+                onShare(port.port, mode, password, expiresIn, options)
                 setShowShareMenu(false)
               }}
               onClose={() => setShowShareMenu(false)}
@@ -1520,6 +1609,36 @@ function PortRow({
   )
 }
 
+// ProtocolBadge shows the detected framework, or the protocol when it isn't plain HTTP
+function ProtocolBadge({ port, theme }: { port: Port; theme: Theme }) {
+  const protocol = port.protocol_override || port.protocol
+  const label = port.framework || (protocol && protocol !== 'http' && protocol !== 'unknown' ? protocol : '')
+  if (!label) return null
+  return (
+    <span
+      className={`hidden sm:inline text-[10px] px-1.5 py-0.5 rounded font-medium uppercase tracking-wide flex-shrink-0 ${theme === 'dark' ? 'bg-gray-800 text-gray-400' : 'bg-gray-200 text-gray-600'}`}
+      title={protocol ? `Protocol: ${protocol}${port.protocol_override ? ' (override)' : ''}` : undefined}
+    >
+      {label}
+    </span>
+  )
+}
+
+// ExposedWarning flags ports bound beyond loopback, which can be reached
+// directly without going through homeport's auth
+function ExposedWarning({ port, theme }: { port: Port; theme: Theme }) {
+  if (!port.exposed) return null
+  return (
+    <span
+      className={`flex items-center gap-0.5 text-[10px] px-1.5 py-0.5 rounded font-medium flex-shrink-0 ${theme === 'dark' ? 'bg-amber-900/30 text-amber-400' : 'bg-amber-50 text-amber-700'}`}
+      title={`Listening on ${port.bind_addresses?.join(', ')}. Anyone who can reach this host on port ${port.port} bypasses homeport auth unless a firewall blocks it. Bind the server to 127.0.0.1 to keep it private.`}
+    >
+      <AlertCircle className="h-3 w-3" />
+      <span className="hidden sm:inline">exposed</span>
+    </span>
+  )
+}
+
 function ExternalPortRow({ port, theme }: { port: Port; theme: Theme }) {
   return (
     <div className={`flex items-center justify-between py-2 px-3 rounded-lg ${theme === 'dark' ? 'bg-gray-800/30' : 'bg-gray-100/50'}`}>
@@ -1528,9 +1647,11 @@ function ExternalPortRow({ port, theme }: { port: Port; theme: Theme }) {
         <code className={`text-xs font-mono px-1.5 py-0.5 rounded ${theme === 'dark' ? 'bg-gray-800 text-gray-500' : 'bg-gray-200 text-gray-500'}`}>
           :{port.port}
         </code>
-        <span className={`text-xs ${theme === 'dark' ? 'text-gray-500' : 'text-gray-500'}`}>
-          {port.process_name || 'Unknown'}
+        <span className={`text-xs ${theme === 'dark' ? 'text-gray-500' : 'text-gray-500'}`} title={port.server}>
+          {port.title || port.process_name || 'Unknown'}
         </span>
+        <ProtocolBadge port={port} theme={theme} />
+        <ExposedWarning port={port} theme={theme} />
       </div>
       <span className={`text-xs ${theme === 'dark' ? 'text-gray-600' : 'text-gray-400'}`}>
         External
@@ -0,0 +1,160 @@
+import { useEffect, useState } from 'react'
+import { Check, Copy, Github, Image, Loader2, RotateCcw, Trash2 } from 'lucide-react'
+import { api, type Feedback } from '@/lib/api'
+import { toast } from '@/components/ui/sonner'
+
+export interface FeedbackPanelProps {
+  port: number
+  theme: 'light' | 'dark'
+  onClose: () => void
+}
+
+// FeedbackPanel lists feedback visitors left through the preview banner
+export function FeedbackPanel({ port, theme, onClose }: FeedbackPanelProps) {
+  const [entries, setEntries] = useState<Feedback[] | null>(null)
+  const [showResolved, setShowResolved] = useState(false)
+  const [creatingIssue, setCreatingIssue] = useState(false)
+  const [error, setError] = useState('')
+
+  useEffect(() => {
+    setEntries(null)
+    api.getPortFeedback(port, showResolved ? '' : 'open')
+      .then(setEntries)
+      .catch(() => setError('Failed to load feedback'))
+  }, [port, showResolved])
+
+  const handleResolve = async (f: Feedback) => {
+    try {
+      const updated = await api.resolveFeedback(f.id, !f.resolved_at)
+      setEntries((prev) => prev
+        ?.map((e) => (e.id === f.id ? updated : e))
+        .filter((e) => showResolved || !e.resolved_at) ?? null)
+    } catch {
+      setError('Failed to update feedback')
+    }
+  }
+
+  const handleDelete = async (id: number) => {
+    try {
+      await api.deleteFeedback(id)
+      setEntries((prev) => prev?.filter((f) => f.id !== id) ?? null)
+    } catch {
+      setError('Failed to delete feedback')
+    }
+  }
+
+  const handleCopyMarkdown = async () => {
+    try {
+      await navigator.clipboard.writeText(await api.exportFeedback(port))
+      toast.success('Copied feedback as markdown')
+    } catch {
+      toast.error('Failed to export feedback')
+    }
+  }
+
+  const handleCreateIssue = async () => {
+    setCreatingIssue(true)
+    try {
+      const result = await api.createFeedbackIssue(port, true)
+      toast.success(`Created GitHub issue with ${result.count} entries`)
+      window.open(result.url, '_blank')
+      setEntries((prev) => (showResolved ? prev : []))
+    } catch (err) {
+      toast.error(err instanceof Error ? err.message : 'Failed to create issue')
+    } finally {
+      setCreatingIssue(false)
+    }
+  }
+
+  const muted = theme === 'dark' ? 'text-gray-400' : 'text-gray-500'
+  const iconButton = theme === 'dark' ? 'hover:text-gray-200' : 'hover:text-gray-900'
+  const hasOpen = entries?.some((f) => !f.resolved_at)
+
+  return (
+    <div
+      className={`absolute right-0 top-full mt-1 w-96 max-h-[28rem] overflow-y-auto rounded-xl shadow-lg border p-4 z-50 ${theme === 'dark' ? 'bg-gray-800 border-gray-700' : 'bg-white border-gray-200'}`}
+      onClick={(e) => e.stopPropagation()}
+    >
+      <div className="flex items-center justify-between mb-2">
+        <div className={`text-sm font-semibold ${theme === 'dark' ? 'text-gray-100' : 'text-gray-900'}`}>Feedback for :{port}</div>
+        <button onClick={onClose} className={`text-xs ${muted}`}>Close</button>
+      </div>
+
+      <div className={`flex items-center justify-between mb-3 text-xs ${muted}`}>
+        <label className="flex items-center gap-1.5 cursor-pointer">
+          <input type="checkbox" checked={showResolved} onChange={(e) => setShowResolved(e.target.checked)} />
+          Show resolved
+        </label>
+        <div className="flex items-center gap-3">
+          <button onClick={handleCopyMarkdown} className={`flex items-center gap-1 ${iconButton}`} title="Copy open feedback as markdown">
+            <Copy className="h-3 w-3" /> Markdown
+          </button>
+          <button
+            onClick={handleCreateIssue}
+            disabled={creatingIssue || !hasOpen}
+            className={`flex items-center gap-1 disabled:opacity-50 ${iconButton}`}
+            title="File open feedback as a GitHub issue and resolve it"
+          >
+            {creatingIssue ? <Loader2 className="h-3 w-3 animate-spin" /> : <Github className="h-3 w-3" />} Issue
+          </button>
+        </div>
+      </div>
+
+      {error && <div className="text-xs text-red-500 mb-2">{error}</div>}
+
+      {entries === null && !error && (
+        <div className="flex justify-center py-4">
+          <Loader2 className={`h-4 w-4 animate-spin ${muted}`} />
+        </div>
+      )}
+
+      {entries?.length === 0 && <div className={`text-sm ${muted}`}>No {showResolved ? '' : 'open '}feedback.</div>}
+
+      <div className="space-y-3">
+        {entries?.map((f) => (
+          <div
+            key={f.id}
+            className={`group rounded-lg border p-3 ${f.resolved_at ? 'opacity-60' : ''} ${theme === 'dark' ? 'border-gray-700' : 'border-gray-100'}`}
+          >
+            <div className={`flex items-center justify-between text-xs ${muted}`}>
+              <span className="truncate">
+                {f.identity || f.name || f.ip}
+                {f.page && <> · <code>{f.page}</code></>}
+              </span>
+              <span className="flex items-center gap-2 flex-shrink-0">
+                {new Date(f.created_at).toLocaleString()}
+                <button
+                  onClick={() => handleResolve(f)}
+                  className={`opacity-0 group-hover:opacity-100 ${iconButton}`}
+                  title={f.resolved_at ? 'Reopen' : 'Resolve'}
+                >
+                  {f.resolved_at ? <RotateCcw className="h-3 w-3" /> : <Check className="h-3 w-3" />}
+                </button>
+                <button
+                  onClick={() => handleDelete(f.id)}
+                  className="opacity-0 group-hover:opacity-100 hover:text-red-500"
+                  title="Delete"
+                >
+                  <Trash2 className="h-3 w-3" />
+                </button>
+              </span>
+            </div>
+            <p className={`text-sm mt-1 whitespace-pre-wrap break-words ${theme === 'dark' ? 'text-gray-200' : 'text-gray-800'}`}>{f.message}</p>
+            {(f.screenshot || f.viewport) && (
+              <div className={`flex items-center gap-3 mt-2 text-xs ${muted}`}>
+                {f.screenshot && (
+                  <a href={api.feedbackScreenshotURL(f.id)} target="_blank" rel="noreferrer" className={`flex items-center gap-1 underline ${iconButton}`}>
+                    <Image className="h-3 w-3" /> Screenshot
+                  </a>
+                )}
+                {f.viewport && <span>{f.viewport}</span>}
+              </div>
+            )}
+          </div>
+        ))}
+      </div>
+    </div>
+  )
+}
+
+export default FeedbackPanel
@@ -1,10 +1,13 @@
 import { useState } from 'react'
 import { Eye, EyeOff } from 'lucide-react'
 import { Button } from '@/components/ui/button'
+import type { ShareOptions } from '@/lib/api'
 
 export interface ShareMenuPort {
   port: number
-  share_mode: 'private' | 'password' | 'public'
+  share_mode: 'private' | 'password' | 'email' | 'public'
+  banner?: boolean
+  banner_feedback?: boolean
 }
 
 export type ShareMenuTheme = 'light' | 'dark'
@@ -12,7 +15,7 @@ export type ShareMenuTheme = 'light' | 'dark'
 export interface ShareMenuProps {
   port: ShareMenuPort
   theme: ShareMenuTheme
-  onShare: (mode: string, password?: string, expiresIn?: string) => void
+  onShare: (mode: string, password?: string, expiresIn?: string, options?: ShareOptions) => void
   onClose: () => void
   onCopyUrl: () => void
 }
@@ -30,6 +33,8 @@ export function ShareMenu({
     return localStorage.getItem(`homeport_share_pw_${port.port}`) || ''
   })
   const [showPassword, setShowPassword] = useState(true) // Show password by default
+  const [banner, setBanner] = useState(!!port.banner)
+  const [feedback, setFeedback] = useState(!!port.banner_feedback)
 
   const isValid = mode !== 'password' || password.length > 0
 
@@ -41,7 +46,9 @@ export function ShareMenu({
       // Clear saved password if switching away from password mode
       localStorage.removeItem(`homeport_share_pw_${port.port}`)
     }
-    onShare(mode, mode === 'password' ? password : undefined, undefined)
+    // Banner settings are kept as they are while a port is private
+    const options = mode === 'private' ? undefined : { banner, feedback: banner && feedback }
+    onShare(mode, mode === 'password' ? password : undefined, undefined, options)
     if (shouldCopy) {
       onCopyUrl()
     }
@@ -97,6 +104,22 @@ export function ShareMenu({
           <OptionButton value="public" title="Public" desc="Anyone with the link can access" />
         </div>
 
+        {/* Preview banner shown to visitors */}
+        {mode !== 'private' && (
+          <div className={`space-y-2 text-sm ${theme === 'dark' ? 'text-gray-300' : 'text-gray-700'}`}>
+            <label className="flex items-center gap-2 cursor-pointer">
+              <input type="checkbox" checked={banner} onChange={(e) => setBanner(e.target.checked)} />
+              Show preview banner
+            </label>
+            {banner && (
+              <label className="flex items-center gap-2 cursor-pointer pl-5">
+                <input type="checkbox" checked={feedback} onChange={(e) => setFeedback(e.target.checked)} />
+                Let visitors leave feedback
+              </label>
+            )}
+          </div>
+        )}
+
         {/* Buttons */}
         <div className={`flex justify-end gap-2 pt-3 border-t ${theme === 'dark' ? 'border-gray-700' : 'border-gray-100'}`}>
           <Button variant="outline" size="sm" onClick={onClose} className="text-xs">
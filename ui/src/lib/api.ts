@@ -6,6 +6,8 @@ export interface Repo {
   path: string
   github_url?: string
   start_command?: string
+  wake_on_request: boolean
+  idle_timeout_minutes?: number
   created_at: string
   updated_at: string
   ports?: Port[]
@@ -18,12 +20,59 @@ export interface Port {
   pid?: number
   process_name?: string
   command?: string
-  share_mode: 'private' | 'password' | 'public'
+  share_mode: 'private' | 'password' | 'email' | 'public'
   expires_at?: string
+  starts_at?: string
+  schedule?: ShareSchedule
+  scheduled_mode?: string
+  ip_allow?: string[]
+  ip_deny?: string[]
+  email_allowlist?: string[]
+  rate_limit_rps?: number
+  quota_bytes?: number
+  usage_requests: number
+  usage_bytes: number
+  share_id?: string
+  banner: boolean
+  banner_feedback: boolean
+  feedback_count: number
+  protocol?: DetectedProtocol
+  protocol_override?: PortProtocol
+  title?: string
+  favicon?: string
+  server?: string
+  framework?: string
+  bind_addresses?: string[]
+  family?: 'ipv4' | 'ipv6' | 'dual'
+  exposed: boolean
+  container?: string // "project/service" for compose containers
+  namespace?: string // set when the port is in another network namespace
+  dial_addr?: string
+  label?: string
+  pinned: boolean
+  offline: boolean // pinned, but nothing is listening
   first_seen: string
   last_seen: string
 }
 
+export type PortProtocol = 'http' | 'h2c' | 'grpc'
+
+export type DetectedProtocol =
+  | PortProtocol
+  | 'https'
+  | 'websocket'
+  | 'postgres'
+  | 'redis'
+  | 'mysql'
+  | 'unknown'
+
+export interface ShareSchedule {
+  days?: string[]
+  start: string
+  end: string
+  timezone?: string
+}
+
 export interface GitStatus {
   branch: string
   is_dirty: boolean
@@ -150,6 +199,70 @@ export interface ActivityEntry {
   details?: string
 }
 
+export interface ShareOptions {
+  banner?: boolean
+  feedback?: boolean
+}
+
+export interface Feedback {
+  id: number
+  port: number
+  share_id?: string
+  repo_id?: string
+  page?: string
+  viewport?: string
+  name?: string
+  message: string
+  screenshot?: string
+  identity?: string
+  ip: string
+  user_agent: string
+  created_at: string
+  resolved_at?: string
+}
+
+export interface MockServer {
+  port: number
+  file: string
+  routes: number
+  loaded_at: string
+  error?: string // last reload error; the previous routes stay active
+}
+
+export interface StaticServer {
+  port: number
+  repo_id?: string
+  root: string
+  spa: boolean
+  listing: boolean
+  started_at: string
+}
+
+export interface CountItem {
+  value: string
+  count: number
+}
+
+export interface PortAnalytics {
+  port: number
+  range: string
+  from: string
+  granularity: 'hour' | 'day'
+  share_id?: string
+  detailed_since?: string
+  stats: {
+    requests: number
+    unique_visitors: number
+    bytes: number
+    timeline: { bucket: string; requests: number; visitors: number; bytes: number }[]
+    top_paths: CountItem[]
+    status_codes: CountItem[]
+    user_agents: CountItem[]
+    referrers: CountItem[]
+    share_modes: CountItem[]
+  }
+}
+
 // API functions
 
 const API_BASE = '/api'
@@ -173,6 +286,59 @@ export const api = {
 
   getPorts: () => fetchJSON<Port[]>('/ports'),
 
+  getPortFeedback: (port: number, status: '' | 'open' | 'resolved' = '', limit = 100) =>
+    fetchJSON<Feedback[]>(`/ports/${port}/feedback?status=${status}&limit=${limit}`),
+
+  resolveFeedback: (id: number, resolved: boolean) =>
+    fetchJSON<Feedback>(`/feedback/${id}`, {
+      method: 'PATCH',
+      body: JSON.stringify({ resolved }),
+    }),
+
+  exportFeedback: async (port: number) => {
+    const res = await fetch(`${API_BASE}/ports/${port}/feedback/export`)
+    if (!res.ok) throw new Error(`HTTP ${res.status}`)
+    return res.text()
+  },
+
+  createFeedbackIssue: (port: number, resolve = false) =>
+    fetchJSON<{ url: string; count: number }>(`/ports/${port}/feedback/issue`, {
+      method: 'POST',
+      body: JSON.stringify({ resolve }),
+    }),
+
+  feedbackScreenshotURL: (id: number) => `${API_BASE}/feedback/${id}/screenshot`,
+
+  deleteFeedback: (id: number) =>
+    fetchJSON<{ status: string }>(`/feedback/${id}`, { method: 'DELETE' }),
+
+  getPortAnalytics: (port: number, range = '7d', shareId?: string) =>
+    fetchJSON<PortAnalytics>(`/ports/${port}/analytics?range=${range}${shareId ? `&share=${shareId}` : ''}`),
+
+  getMocks: () => fetchJSON<MockServer[]>('/mocks'),
+
+  // spec is a mock routes object, or YAML/JSON text
+  startMock: (port: number, spec: object | string) =>
+    fetchJSON<MockServer>('/mocks', {
+      method: 'POST',
+      body: JSON.stringify({ port, spec }),
+    }),
+
+  stopMock: (port: number) =>
+    fetchJSON<{ status: string }>(`/mocks/${port}`, { method: 'DELETE' }),
+
+  getStaticServers: () => fetchJSON<StaticServer[]>('/static'),
+
+  // Serves a repo directory; port 0 picks a free one
+  serveDirectory: (repoId: string, dir: string, options: { port?: number; spa?: boolean; listing?: boolean } = {}) =>
+    fetchJSON<StaticServer>('/static', {
+      method: 'POST',
+      body: JSON.stringify({ repo_id: repoId, dir, ...options }),
+    }),
+
+  stopServingDirectory: (port: number) =>
+    fetchJSON<{ status: string }>(`/static/${port}`, { method: 'DELETE' }),
+
   getRepos: () => fetchJSON<Repo[]>('/repos'),
 
   cloneRepo: (repo: string) =>
@@ -190,7 +356,7 @@ export const api = {
   getRepoStatus: (id: string) =>
     fetchJSON<GitStatus>(`/repos/${id}/status`),
 
-  updateRepo: (id: string, data: { start_command?: string }) =>
+  updateRepo: (id: string, data: { start_command?: string; wake_on_request?: boolean; idle_timeout_minutes?: number }) =>
     fetchJSON<Repo>(`/repos/${id}`, {
       method: 'PATCH',
       body: JSON.stringify(data),
@@ -216,15 +382,27 @@ export const api = {
       body: JSON.stringify({ name }),
     }),
 
-  sharePort: (port: number, mode: string, password?: string, expiresIn?: string) =>
-    fetchJSON<{ status: string; mode: string; url: string; expires_at?: string }>(`/share/${port}`, {
+  sharePort: (port: number, mode: string, password?: string, expiresIn?: string, emailAllowlist?: string[], options?: ShareOptions) =>
+    fetchJSON<{ status: string; mode: string; url: string; share_id: string; expires_at?: string }>(`/share/${port}`, {
       method: 'POST',
-      body: JSON.stringify({ mode, password, expires_in: expiresIn }),
+      body: JSON.stringify({ mode, password, expires_in: expiresIn, email_allowlist: emailAllowlist, ...options }),
     }),
 
   unsharePort: (port: number) =>
     fetchJSON<{ status: string }>(`/share/${port}`, { method: 'DELETE' }),
 
+  setPortProtocol: (port: number, protocol: PortProtocol | 'auto') =>
+    fetchJSON<Port>(`/ports/${port}/protocol`, {
+      method: 'PUT',
+      body: JSON.stringify({ protocol }),
+    }),
+
+  updatePort: (port: number, changes: { label?: string; pinned?: boolean }) =>
+    fetchJSON<Port>(`/ports/${port}`, {
+      method: 'PATCH',
+      body: JSON.stringify(changes),
+    }),
+
   searchGitHubRepos: (query: string, limit = 20) =>
     fetchJSON<GitHubRepo[]>(`/github/search?q=${encodeURIComponent(query)}&limit=${limit}`),
 